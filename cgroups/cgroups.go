@@ -0,0 +1,42 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package cgroups exposes the cgroup parsing automaxprocs relies on, so that
+// other tools inspecting container limits can reuse it.
+//
+// The package is a curated subset of the detection automaxprocs uses
+// internally, and follows the semantic versioning of the module: its types
+// don't expose the internal implementation, which may change between
+// releases.
+package cgroups
+
+// MountPoint is a mount point read from `/proc/$PID/mountinfo`. See also
+// proc(5) for more information.
+type MountPoint struct {
+	MountID      int
+	Root         string
+	MountPoint   string
+	FSType       string
+	SuperOptions []string
+	// Controllers lists the cgroup v1 controllers attached to a mount point
+	// of the "cgroup" file system type, e.g. "cpu" and "cpuacct". It is empty
+	// for every other file system, including cgroup2.
+	Controllers []string
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"io"
+	"time"
+
+	cg "github.com/emadolsky/automaxprocs/internal/cgroups"
+)
+
+// CPUStat holds the CFS throttling statistics of a `cpu.stat` file, which
+// tell how often a cgroup ran into its CPU quota.
+type CPUStat struct {
+	// NrPeriods is the number of enforcement periods that have elapsed.
+	NrPeriods int64
+	// NrThrottled is the number of periods in which the cgroup was
+	// throttled.
+	NrThrottled int64
+	// ThrottledTime is the total time the tasks of the cgroup were
+	// throttled for.
+	ThrottledTime time.Duration
+}
+
+// ParseCPUStat parses the content of a `cpu.stat` file read from r, either
+// from cgroup v1, which reports the throttled time in nanoseconds as
+// throttled_time, or from cgroup2, which reports it in microseconds as
+// throttled_usec. Keys that aren't known are ignored and missing ones are
+// reported as zero.
+func ParseCPUStat(r io.Reader) (CPUStat, error) {
+	stat, err := cg.ParseCPUStat(r)
+	return CPUStat(stat), err
+}
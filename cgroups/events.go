@@ -0,0 +1,56 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"io"
+
+	cg "github.com/emadolsky/automaxprocs/internal/cgroups"
+)
+
+// Events holds the values of a cgroup2 `cgroup.events` file. The kernel
+// notifies a modification of the file whenever one of them changes, which
+// makes it a cheap trigger to re-read other cgroup files, and lets programs
+// pause their work while their cgroup is frozen.
+type Events struct {
+	// Populated is true if the cgroup or one of its descendants has live
+	// processes.
+	Populated bool
+	// Frozen is true if the cgroup is frozen, see `cgroup.freeze`.
+	Frozen bool
+}
+
+// ParseEvents parses the content of a `cgroup.events` file read from r, such
+// as "populated 1\nfrozen 0\n". Keys that aren't known are ignored and
+// missing ones are reported as false.
+func ParseEvents(r io.Reader) (Events, error) {
+	events, err := cg.ParseEvents(r)
+	return Events(events), err
+}
+
+// CurrentEvents returns the events of the cgroup2 directory the current
+// process belongs to. It returns false if the process isn't part of a cgroup2
+// hierarchy or its cgroup has no `cgroup.events` file, as is the case of
+// the root cgroup.
+func CurrentEvents() (Events, bool, error) {
+	events, ok, err := cg.Source{}.EventsV2()
+	return Events(events), ok, err
+}
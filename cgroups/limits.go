@@ -0,0 +1,67 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+// Limits reports the CPU and memory limits applied to a process through its
+// cgroups. It resolves v1, cgroup2 and hybrid layouts the way automaxprocs
+// does. Its fields are unexported so that the detection behind it can
+// change without breaking callers; new limits are added as methods.
+type Limits struct {
+	opts iruntime.Options
+	v2   bool
+}
+
+// NewForProcess returns the Limits of the current process. The layout of
+// its cgroup hierarchies is read once, while every limit is read anew on
+// each call. Outside of Linux, no cgroup is read and no limit is defined.
+func NewForProcess() (*Limits, error) {
+	return newLimits(iruntime.Options{})
+}
+
+// newLimits returns the Limits of the process whose cgroups are described
+// by opts.
+func newLimits(opts iruntime.Options) (*Limits, error) {
+	layout, err := iruntime.CGroupLayout(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Limits{opts: opts, v2: layout.CGroupV2}, nil
+}
+
+// IsV2 returns true if only the cgroup2 unified hierarchy is mounted. Hybrid
+// layouts, with v1 hierarchies next to cgroup2, aren't considered cgroup2.
+func (l *Limits) IsV2() bool {
+	return l.v2
+}
+
+// CPUQuota returns the CPU quota of the process as a fraction of CPUs, e.g.
+// 2.5, before any rounding. It returns false if no quota is set.
+func (l *Limits) CPUQuota() (float64, bool, error) {
+	return iruntime.CPUQuota(l.opts)
+}
+
+// MemoryLimit returns the memory limit of the process in bytes. It returns
+// false if no limit is set.
+func (l *Limits) MemoryLimit() (int64, bool, error) {
+	return iruntime.MemoryLimit(l.opts)
+}
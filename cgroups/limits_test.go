@@ -0,0 +1,64 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"path/filepath"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimits(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedV2      bool
+		expectedQuota   float64
+		expectedDefined bool
+		expectedMemory  int64
+	}{
+		{name: "v1", expectedQuota: 1.5, expectedDefined: true, expectedMemory: 536870912},
+		{name: "v2", expectedV2: true, expectedQuota: 3, expectedDefined: true, expectedMemory: 1073741824},
+		{name: "cpuset-only", expectedQuota: -1, expectedMemory: -1},
+	}
+
+	for _, tt := range testTable {
+		root := filepath.Join("..", "internal", "cgroups", "testdata", "root", tt.name)
+		limits, err := newLimits(iruntime.Options{RootPrefix: root})
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.expectedV2, limits.IsV2(), tt.name)
+
+		quota, defined, err := limits.CPUQuota()
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.expectedQuota, quota, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+
+		memory, _, err := limits.MemoryLimit()
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.expectedMemory, memory, tt.name)
+	}
+
+	_, err := newLimits(iruntime.Options{RootPrefix: filepath.Join(t.TempDir(), "nonexistent")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"io"
+	"strings"
+
+	cg "github.com/emadolsky/automaxprocs/internal/cgroups"
+)
+
+// _cgroupFSType is the file system type of cgroup v1 hierarchies.
+const _cgroupFSType = "cgroup"
+
+// _cgroupMountFlags are the cgroup v1 super options that configure the
+// hierarchy rather than name a controller attached to it.
+var _cgroupMountFlags = map[string]struct{}{
+	"rw":             {},
+	"ro":             {},
+	"none":           {},
+	"noprefix":       {},
+	"xattr":          {},
+	"clone_children": {},
+	"cpuset_v2_mode": {},
+	"favordynmods":   {},
+}
+
+// ParseMountInfo parses the content of a `/proc/$PID/mountinfo` file read
+// from r and returns its mount points in order.
+func ParseMountInfo(r io.Reader) ([]MountPoint, error) {
+	var mountPoints []MountPoint
+	err := cg.ParseMountInfo(r, func(mp *cg.MountPoint) error {
+		mountPoints = append(mountPoints, MountPoint{
+			MountID:      mp.MountID,
+			Root:         mp.Root,
+			MountPoint:   mp.MountPoint,
+			FSType:       mp.FSType,
+			SuperOptions: mp.SuperOptions,
+			Controllers:  controllers(mp),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mountPoints, nil
+}
+
+// controllers returns the cgroup v1 controllers named by the super options of
+// mp, or nil if mp isn't a cgroup v1 hierarchy.
+func controllers(mp *cg.MountPoint) []string {
+	if mp.FSType != _cgroupFSType {
+		return nil
+	}
+
+	var names []string
+	for _, opt := range mp.SuperOptions {
+		if _, ok := _cgroupMountFlags[opt]; ok || strings.Contains(opt, "=") {
+			continue
+		}
+		names = append(names, opt)
+	}
+	return names
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	const mountInfo = `1 0 8:1 / / rw,noatime shared:1 - ext4 /dev/sda1 rw,errors=remount-ro
+5 1 0:4 / /sys/fs/cgroup ro,nosuid,nodev,noexec shared:5 - tmpfs tmpfs ro,mode=755
+7 5 0:6 /docker /sys/fs/cgroup/cpu,cpuacct rw,nosuid,nodev,noexec,relatime shared:7 - cgroup cgroup rw,cpu,cpuacct
+8 5 0:7 / /sys/fs/cgroup/systemd rw,nosuid,nodev,noexec,relatime shared:8 - cgroup cgroup rw,xattr,name=systemd
+9 5 0:8 / /sys/fs/cgroup/my\040cgroup rw,nosuid,nodev,noexec,relatime shared:9 - cgroup2 cgroup2 rw,nsdelegate
+`
+
+	mountPoints, err := ParseMountInfo(strings.NewReader(mountInfo))
+	require.NoError(t, err)
+	assert.Equal(t, []MountPoint{
+		{
+			MountID:      1,
+			Root:         "/",
+			MountPoint:   "/",
+			FSType:       "ext4",
+			SuperOptions: []string{"rw", "errors=remount-ro"},
+		},
+		{
+			MountID:      5,
+			Root:         "/",
+			MountPoint:   "/sys/fs/cgroup",
+			FSType:       "tmpfs",
+			SuperOptions: []string{"ro", "mode=755"},
+		},
+		{
+			MountID:      7,
+			Root:         "/docker",
+			MountPoint:   "/sys/fs/cgroup/cpu,cpuacct",
+			FSType:       "cgroup",
+			SuperOptions: []string{"rw", "cpu", "cpuacct"},
+			Controllers:  []string{"cpu", "cpuacct"},
+		},
+		{
+			MountID:      8,
+			Root:         "/",
+			MountPoint:   "/sys/fs/cgroup/systemd",
+			FSType:       "cgroup",
+			SuperOptions: []string{"rw", "xattr", "name=systemd"},
+		},
+		{
+			MountID:      9,
+			Root:         "/",
+			MountPoint:   "/sys/fs/cgroup/my cgroup",
+			FSType:       "cgroup2",
+			SuperOptions: []string{"rw", "nsdelegate"},
+		},
+	}, mountPoints)
+}
+
+func TestParseMountInfoInvalid(t *testing.T) {
+	mountPoints, err := ParseMountInfo(strings.NewReader("1 0 8:1 / / rw - ext4\n"))
+	assert.Error(t, err)
+	assert.Nil(t, mountPoints)
+
+	mountPoints, err = ParseMountInfo(strings.NewReader(""))
+	assert.NoError(t, err)
+	assert.Empty(t, mountPoints)
+}
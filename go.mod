@@ -1,5 +1,5 @@
 module github.com/emadolsky/automaxprocs
 
-go 1.13
+go 1.16
 
 require github.com/stretchr/testify v1.4.0
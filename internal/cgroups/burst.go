@@ -0,0 +1,125 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// _cgroupCPUCFSBurstUsParam is the file name for the CGroup CFS burst
+	// parameter, available since Linux 5.14.
+	_cgroupCPUCFSBurstUsParam = "cpu.cfs_burst_us"
+	// _cgroupv2CPUMaxBurst is the file name for the CGroup-V2 CPU burst
+	// parameter.
+	_cgroupv2CPUMaxBurst = "cpu.max.burst"
+)
+
+// CPUBurst returns the CFS burst applied with the CPU cgroup controller, as
+// a number of CPUs. It is a result of `cpu.cfs_burst_us / cpu.cfs_period_us`.
+// If the kernel doesn't expose `cpu.cfs_burst_us` or no burst is set, the
+// method returns `(0, false, nil)`.
+func (cg CGroups) CPUBurst() (float64, bool, error) {
+	cpuCGroup, exists := cg.cfsCGroup()
+	if !exists {
+		return 0, false, nil
+	}
+
+	cfsBurstUs, err := cpuCGroup.readInt(_cgroupCPUCFSBurstUsParam)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if defined := cfsBurstUs > 0; err != nil || !defined {
+		return 0, false, err
+	}
+
+	cfsPeriodUs, err := cpuCGroup.readIntFromNearest(_cgroupCPUCFSPeriodUsParam)
+	if err != nil {
+		return 0, false, err
+	}
+	if cfsPeriodUs <= 0 {
+		return 0, false, cpuPeriodInvalidError{cfsPeriodUs}
+	}
+
+	return quotaRatio(cfsBurstUs, cfsPeriodUs), true, nil
+}
+
+// CPUBurstV2 returns the CPU burst applied with the CPU cgroup2 controller to
+// the current process. See CGroup.CPUBurstV2.
+func (s Source) CPUBurstV2() (float64, bool, error) {
+	cgroup, err := s.NewUnifiedCGroupForCurrentProcess()
+	if cgroup == nil || err != nil {
+		return 0, false, err
+	}
+	return cgroup.CPUBurstV2()
+}
+
+// CPUBurstV2 returns the CPU burst read from the cpu.max.burst file of a
+// cgroup2 directory, as a number of CPUs. It is a result of dividing the
+// burst by the period of cpu.max. Like CGroup.CPUQuotaV2, the files of the
+// innermost ancestor with a cpu.max are read if the directory has none. If
+// the file doesn't exist or no burst is set, the method returns
+// `(0, false, nil)`.
+func (cg *CGroup) CPUBurstV2() (float64, bool, error) {
+	cg = cg.cpuMaxCGroup()
+	burst, err := cg.readInt(_cgroupv2CPUMaxBurst)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if defined := burst > 0; err != nil || !defined {
+		return 0, false, err
+	}
+
+	period, err := cg.cpuMaxPeriod()
+	if err != nil {
+		return 0, false, err
+	}
+	return quotaRatio(burst, period), true, nil
+}
+
+// cpuMaxPeriod returns the period of the cpu.max file of a cgroup2
+// directory, which defaults to 100000 if the file only holds max.
+func (cg *CGroup) cpuMaxPeriod() (int64, error) {
+	line, err := cg.readFirstLine(_cgroupv2CPUMax)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, cpuMaxFormatInvalidError{line}
+	}
+	if len(fields) == 1 {
+		if fields[_cgroupv2CPUMaxQuotaIndex] != _cgroupV2CPUMaxQuotaMax {
+			return 0, cpuMaxFormatInvalidError{line}
+		}
+		return _cgroupV2CPUMaxDefaultPeriod, nil
+	}
+	period, err := strconv.ParseInt(fields[_cgroupv2CPUMaxPeriodIndex], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if period <= 0 {
+		return 0, cpuPeriodInvalidError{period}
+	}
+	return period, nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCGroupsCPUBurst(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedBurst   float64
+		expectedDefined bool
+		shouldHaveError bool
+	}{
+		{
+			name:            "burst",
+			expectedBurst:   0.5,
+			expectedDefined: true,
+		},
+		{
+			name: "burst-zero",
+		},
+		{
+			// The kernel doesn't expose cpu.cfs_burst_us.
+			name: "cpu",
+		},
+	}
+
+	cgroups := make(CGroups)
+
+	burst, defined, err := cgroups.CPUBurst()
+	assert.Equal(t, 0.0, burst, "nonexistent")
+	assert.False(t, defined, "nonexistent")
+	assert.NoError(t, err, "nonexistent")
+
+	for _, tt := range testTable {
+		cgroups[_cgroupSubsysCPU] = NewCGroup(filepath.Join(testDataCGroupsPath, tt.name))
+
+		burst, defined, err := cgroups.CPUBurst()
+		assert.Equal(t, tt.expectedBurst, burst, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
+
+func TestCGroupCPUBurstV2(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedBurst   float64
+		expectedDefined bool
+	}{
+		{
+			name:            "burst-v2",
+			expectedBurst:   1.5,
+			expectedDefined: true,
+		},
+		{
+			name: "burst-v2-unset",
+		},
+		{
+			// cpu.max.burst doesn't exist.
+			name: "memory-v2",
+		},
+	}
+
+	for _, tt := range testTable {
+		burst, defined, err := NewCGroup(filepath.Join(testDataCGroupsPath, tt.name)).CPUBurstV2()
+		assert.Equal(t, tt.expectedBurst, burst, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+		assert.NoError(t, err, tt.name)
+	}
+
+	burst, defined, err := Source{Root: filepath.Join(testDataPath, "root", "v2-burst")}.CPUBurstV2()
+	assert.Equal(t, 1.0, burst, "v2-burst root")
+	assert.True(t, defined, "v2-burst root")
+	assert.NoError(t, err, "v2-burst root")
+}
@@ -18,27 +18,55 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-//go:build linux
-// +build linux
-
 package cgroups
 
 import (
 	"bufio"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 // CGroup represents the data structure for a Linux control group.
 type CGroup struct {
 	path string
+	src  Source
+	// mountPoint is the mount point of the hierarchy path belongs to, if
+	// known. It bounds the ancestors parent returns.
+	mountPoint string
 }
 
 // NewCGroup returns a new *CGroup from a given path.
 func NewCGroup(path string) *CGroup {
-	return &CGroup{path: path}
+	return Source{}.NewCGroup(path)
+}
+
+// NewCGroup returns a new *CGroup from a given path, whose params are read
+// from s.
+func (s Source) NewCGroup(path string) *CGroup {
+	return &CGroup{path: path, src: s}
+}
+
+// newMountedCGroup returns a new *CGroup from a given path within the
+// hierarchy mounted at mountPoint.
+func (s Source) newMountedCGroup(mountPoint, path string) *CGroup {
+	return &CGroup{path: path, src: s, mountPoint: mountPoint}
+}
+
+// parent returns the parent *CGroup of cg, or nil if cg is the root of its
+// hierarchy or its mount point isn't known.
+func (cg *CGroup) parent() *CGroup {
+	if cg.mountPoint == "" || cg.path == cg.mountPoint {
+		return nil
+	}
+	parentPath := filepath.Dir(cg.path)
+	if rel, err := filepath.Rel(cg.mountPoint, parentPath); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil
+	}
+	return cg.src.newMountedCGroup(cg.mountPoint, parentPath)
 }
 
 // Path returns the path of the CGroup*.
@@ -51,13 +79,28 @@ func (cg *CGroup) ParamPath(param string) string {
 	return filepath.Join(cg.path, param)
 }
 
+// ReadFile reads the whole content of the given param file, e.g.
+// `pids.max`. The name must be a plain file name within the cgroup
+// directory; names containing a path separator or referring to the directory
+// or its parent are rejected.
+func (cg *CGroup) ReadFile(param string) ([]byte, error) {
+	if param == "" || param == "." || param == ".." || strings.ContainsRune(param, '/') {
+		return nil, paramNameInvalidError{param}
+	}
+
+	paramFile, err := cg.src.open(cg.ParamPath(param))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(paramFile)
+}
+
 // readFirstLine reads the first line from a cgroup param file.
 func (cg *CGroup) readFirstLine(param string) (string, error) {
-	paramFile, err := os.Open(cg.ParamPath(param))
+	paramFile, err := cg.src.open(cg.ParamPath(param))
 	if err != nil {
 		return "", err
 	}
-	defer paramFile.Close()
 
 	scanner := bufio.NewScanner(paramFile)
 	if scanner.Scan() {
@@ -69,11 +112,22 @@ func (cg *CGroup) readFirstLine(param string) (string, error) {
 	return "", io.ErrUnexpectedEOF
 }
 
-// readInt parses the first line from a cgroup param file as int.
-func (cg *CGroup) readInt(param string) (int, error) {
+// readInt parses the first line from a cgroup param file as int64, so that
+// quotas and periods that don't fit in 32 bits parse on every platform.
+func (cg *CGroup) readInt(param string) (int64, error) {
 	text, err := cg.readFirstLine(param)
 	if err != nil {
 		return 0, err
 	}
-	return strconv.Atoi(text)
+	return strconv.ParseInt(text, 10, 64)
+}
+
+// readIntFromNearest is like readInt, but reads param from the innermost
+// ancestor of cg that has it if cg doesn't, within the mounted hierarchy.
+func (cg *CGroup) readIntFromNearest(param string) (int64, error) {
+	value, err := cg.readInt(param)
+	for c := cg.parent(); os.IsNotExist(err) && c != nil; c = c.parent() {
+		value, err = c.readInt(param)
+	}
+	return value, err
 }
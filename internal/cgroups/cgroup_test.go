@@ -18,9 +18,6 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-//go:build linux
-// +build linux
-
 package cgroups
 
 import (
@@ -82,7 +79,7 @@ func TestCGroupReadInt(t *testing.T) {
 	testTable := []struct {
 		name            string
 		paramName       string
-		expectedValue   int
+		expectedValue   int64
 		shouldHaveError bool
 	}{
 		{
@@ -125,3 +122,54 @@ func TestCGroupReadInt(t *testing.T) {
 		}
 	}
 }
+
+func TestCGroupReadFile(t *testing.T) {
+	testTable := []struct {
+		name            string
+		paramName       string
+		expectedContent string
+		expectedError   error
+		shouldHaveError bool
+	}{
+		{
+			name:            "cpu",
+			paramName:       "cpu.cfs_period_us",
+			expectedContent: "100000\n",
+		},
+		{
+			name:            "absent",
+			paramName:       "pids.max",
+			shouldHaveError: true,
+		},
+		{
+			name:          "traversal",
+			paramName:     "../cpu/cpu.cfs_period_us",
+			expectedError: paramNameInvalidError{"../cpu/cpu.cfs_period_us"},
+		},
+		{
+			name:          "parent",
+			paramName:     "..",
+			expectedError: paramNameInvalidError{".."},
+		},
+		{
+			name:          "empty-name",
+			paramName:     "",
+			expectedError: paramNameInvalidError{""},
+		},
+	}
+
+	for _, tt := range testTable {
+		cgroup := NewCGroup(filepath.Join(testDataCGroupsPath, "cpu"))
+		content, err := cgroup.ReadFile(tt.paramName)
+		assert.Equal(t, tt.expectedContent, string(content), tt.name)
+
+		switch {
+		case tt.expectedError != nil:
+			assert.Equal(t, tt.expectedError, err, tt.name)
+		case tt.shouldHaveError:
+			assert.Error(t, err, tt.name)
+		default:
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
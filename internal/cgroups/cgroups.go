@@ -18,15 +18,14 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-//go:build linux
-// +build linux
-
 package cgroups
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"strconv"
@@ -45,6 +44,9 @@ const (
 	_cgroupSubsysCPUSet = "cpuset"
 	// _cgroupSubsysMemory is the Memory CGroup subsystem.
 	_cgroupSubsysMemory = "memory"
+	// _cgroupNamedHierarchyPrefix prefixes the names of v1 hierarchies
+	// without a controller, such as `name=systemd`.
+	_cgroupNamedHierarchyPrefix = "name="
 
 	// _cgroupCPUCFSQuotaUsParam is the file name for the CGroup CFS quota
 	// parameter.
@@ -59,12 +61,20 @@ const (
 	// _cgroupFSType is the Linux CGroup-V2 file system type used in
 	// `/proc/$PID/mountinfo`.
 	_cgroupv2FSType = "cgroup2"
+	// _cgroupv2SubsysName is the (empty) subsystem name of the cgroup2 entry
+	// in `/proc/$PID/cgroup`.
+	_cgroupv2SubsysName = ""
 )
 
 const (
-	_procPathCGroup     = "/proc/self/cgroup"
-	_procPathMountInfo  = "/proc/self/mountinfo"
-	_cgroupv2MountPoint = "/sys/fs/cgroup"
+	_procMount         = "/proc"
+	_cgroupMount       = "/sys/fs/cgroup"
+	_procPathCGroup    = "/proc/self/cgroup"
+	_procPathMountInfo = "/proc/self/mountinfo"
+
+	// _cgroupNamespaceRoot is the path `/proc/$PID/cgroup` lists for a
+	// process at the root of its cgroup namespace.
+	_cgroupNamespaceRoot = "/"
 
 	_cgroupV2CPUMaxDefaultPeriod = 100000
 	_cgroupV2CPUMaxQuotaMax      = "max"
@@ -80,52 +90,144 @@ type CGroups map[string]*CGroup
 
 // NewCGroups returns a new *CGroups from given `mountinfo` and `cgroup` files
 // under for some process under `/proc` file system (see also proc(5) for more
-// information).
+// information). Named hierarchies without a controller, such as
+// `name=systemd`, are left out.
 func NewCGroups(procPathMountInfo, procPathCGroup string) (CGroups, error) {
-	cgroupSubsystems, err := parseCGroupSubsystems(procPathCGroup)
+	return Source{}.NewCGroups(procPathMountInfo, procPathCGroup)
+}
+
+// NewCGroups is like the package-level NewCGroups, but reads every file from
+// s.
+func (s Source) NewCGroups(procPathMountInfo, procPathCGroup string) (CGroups, error) {
+	cgroupSubsystems, err := s.parseCGroupSubsystems(procPathCGroup)
 	if err != nil {
 		return nil, err
 	}
 
 	cgroups := make(CGroups)
-	newMountPoint := func(mp *MountPoint) error {
-		if mp.FSType != _cgroupFSType {
+	newMountPoint := func(e *mountInfoEntry) error {
+		if string(e.fsType) != _cgroupFSType {
 			return nil
 		}
 
-		for _, opt := range mp.SuperOptions {
-			subsys, exists := cgroupSubsystems[opt]
+		var err error
+		forEachSubslice(e.superOptions, _mountInfoOptsSep[0], func(opt []byte) {
+			// Named hierarchies have no controller files, and their path
+			// often isn't exposed to containers.
+			if err != nil || bytes.HasPrefix(opt, []byte(_cgroupNamedHierarchyPrefix)) || !s.wants(string(opt)) {
+				return
+			}
+			subsys, exists := cgroupSubsystems[string(opt)]
 			if !exists {
-				continue
+				return
 			}
 
-			cgroupPath, err := mp.Translate(subsys.Name)
-			if err != nil {
-				return err
+			var mountPoint, cgroupPath string
+			if mountPoint, cgroupPath, err = e.translate(subsys.Name); err == nil {
+				cgroups[string(opt)] = s.newMountedCGroup(s.cgroupMountPath(mountPoint), s.cgroupMountPath(cgroupPath))
 			}
-			cgroups[opt] = NewCGroup(cgroupPath)
+		})
+		return err
+	}
+
+	if err := s.scanMountInfo(procPathMountInfo, newMountPoint); err != nil {
+		return nil, err
+	}
+	return cgroups, nil
+}
+
+// NewUnifiedCGroup returns the *CGroup of the cgroup2 unified hierarchy that a
+// process belongs to, given its `mountinfo` and `cgroup` files. In hybrid
+// mode, the unified hierarchy is mounted next to the v1 controllers (usually
+// at `/sys/fs/cgroup/unified`) and controllers such as cpu may be attached to
+// it instead of a v1 hierarchy. It returns nil if no unified hierarchy is
+// mounted or the process isn't part of one.
+func NewUnifiedCGroup(procPathMountInfo, procPathCGroup string) (*CGroup, error) {
+	return Source{}.NewUnifiedCGroup(procPathMountInfo, procPathCGroup)
+}
+
+// NewUnifiedCGroup is like the package-level NewUnifiedCGroup, but reads
+// every file from s.
+func (s Source) NewUnifiedCGroup(procPathMountInfo, procPathCGroup string) (*CGroup, error) {
+	cgroupSubsystems, err := s.parseCGroupSubsystems(procPathCGroup)
+	if err != nil {
+		return nil, err
+	}
+	subsys, exists := cgroupSubsystems[_cgroupv2SubsysName]
+	if !exists {
+		return nil, nil
+	}
+
+	var cgroup *CGroup
+	newMountPoint := func(e *mountInfoEntry) error {
+		if string(e.fsType) != _cgroupv2FSType || cgroup != nil {
+			return nil
 		}
 
+		mountPoint, cgroupPath, err := e.translate(subsys.Name)
+		if err != nil {
+			return err
+		}
+		cgroup = s.newMountedCGroup(s.cgroupMountPath(mountPoint), s.cgroupMountPath(cgroupPath))
 		return nil
 	}
 
-	if err := parseMountInfo(procPathMountInfo, newMountPoint); err != nil {
+	if err := s.scanMountInfo(procPathMountInfo, newMountPoint); err != nil {
 		return nil, err
 	}
-	return cgroups, nil
+	return cgroup, nil
+}
+
+// NewUnifiedCGroupForCurrentProcess returns the *CGroup of the cgroup2
+// unified hierarchy that the current process belongs to. See
+// NewUnifiedCGroup.
+func (s Source) NewUnifiedCGroupForCurrentProcess() (*CGroup, error) {
+	return s.NewUnifiedCGroup(s.procPath(_procPathMountInfo), s.procPath(_procPathCGroup))
 }
 
 // NewCGroupsForCurrentProcess returns a new *CGroups instance for the current
 // process.
 func NewCGroupsForCurrentProcess() (CGroups, error) {
-	return NewCGroups(_procPathMountInfo, _procPathCGroup)
+	return Source{}.NewCGroupsForCurrentProcess()
+}
+
+// NewCGroupsForCurrentProcess returns a new *CGroups instance for the current
+// process, reading `/proc` and every cgroup directory from s.
+func (s Source) NewCGroupsForCurrentProcess() (CGroups, error) {
+	return s.NewCGroups(s.procPath(_procPathMountInfo), s.procPath(_procPathCGroup))
+}
+
+// CGroupMembership returns the content of `/proc/self/cgroup`, which lists
+// the cgroups the current process belongs to, e.g. to notice that it was
+// moved to another cgroup.
+func (s Source) CGroupMembership() ([]byte, error) {
+	return s.ReadFile(s.procPath(_procPathCGroup))
+}
+
+// HasCPUController returns true if the CPU cgroup controller is mounted. On
+// hosts without it, no CPU quota can be applied to the process.
+func (cg CGroups) HasCPUController() bool {
+	_, exists := cg[_cgroupSubsysCPU]
+	return exists
+}
+
+// ReadControllerFile reads a param file, e.g. `pids.max`, from the cgroup
+// the given controller is mounted for. It returns an error if the controller
+// isn't mounted or the file name isn't valid; see CGroup.ReadFile.
+func (cg CGroups) ReadControllerFile(subsys, param string) ([]byte, error) {
+	cgroup, exists := cg[subsys]
+	if !exists {
+		return nil, controllerNotMountedError{subsys}
+	}
+	return cgroup.ReadFile(param)
 }
 
 // CPUQuota returns the CPU quota applied with the CPU cgroup controller.
 // It is a result of `cpu.cfs_quota_us / cpu.cfs_period_us`. If the value of
-// `cpu.cfs_quota_us` was not set (-1), the method returns `(-1, nil)`.
+// `cpu.cfs_quota_us` was not set (-1), the method returns `(-1, nil)`. The
+// files are read from the cpuacct controller if only its mount has them.
 func (cg CGroups) CPUQuota() (float64, bool, error) {
-	cpuCGroup, exists := cg[_cgroupSubsysCPU]
+	cpuCGroup, exists := cg.cfsCGroup()
 	if !exists {
 		return -1, false, nil
 	}
@@ -135,44 +237,288 @@ func (cg CGroups) CPUQuota() (float64, bool, error) {
 		return -1, defined, err
 	}
 
-	cfsPeriodUs, err := cpuCGroup.readInt(_cgroupCPUCFSPeriodUsParam)
+	// Under delegation, the period may only be exposed by an ancestor of
+	// the cgroup that holds the quota.
+	cfsPeriodUs, err := cpuCGroup.readIntFromNearest(_cgroupCPUCFSPeriodUsParam)
 	if err != nil {
 		return -1, false, err
 	}
+	if cfsPeriodUs <= 0 {
+		return -1, false, cpuPeriodInvalidError{cfsPeriodUs}
+	}
+
+	return quotaRatio(cfsQuotaUs, cfsPeriodUs), true, nil
+}
 
-	return float64(cfsQuotaUs) / float64(cfsPeriodUs), true, nil
+// cfsCGroup returns the cgroup of the CPU controller, which holds the CFS
+// quota files, or false if the controller isn't mounted. On some broken
+// hosts that mount cpu and cpuacct separately, the files only exist under
+// cpuacct, whose cgroup is returned instead then.
+func (cg CGroups) cfsCGroup() (*CGroup, bool) {
+	cpuCGroup, exists := cg[_cgroupSubsysCPU]
+	if !exists {
+		return nil, false
+	}
+	cpuacctCGroup, exists := cg[_cgroupSubsysCPUAcct]
+	if !exists || cpuacctCGroup.Path() == cpuCGroup.Path() {
+		return cpuCGroup, true
+	}
+	if _, err := cpuCGroup.readFirstLine(_cgroupCPUCFSQuotaUsParam); !os.IsNotExist(err) {
+		return cpuCGroup, true
+	}
+	if _, err := cpuacctCGroup.readFirstLine(_cgroupCPUCFSQuotaUsParam); err == nil {
+		return cpuacctCGroup, true
+	}
+	return cpuCGroup, true
 }
 
 // IsCGroupV2 returns true if the system supports and uses cgroup2.
 // It gets the required information for deciding from mountinfo file.
 func IsCGroupV2() (bool, error) {
-	return isCGroupV2(_procPathMountInfo)
+	return Source{}.IsCGroupV2()
+}
+
+// IsCGroupV2 is like the package-level IsCGroupV2, but reads mountinfo from
+// s.
+func (s Source) IsCGroupV2() (bool, error) {
+	return s.isCGroupV2(s.procPath(_procPathMountInfo))
+}
+
+// A Mode describes which cgroup hierarchies are mounted.
+type Mode int
+
+const (
+	// ModeLegacy means that only v1 hierarchies are mounted, or none.
+	ModeLegacy Mode = iota
+	// ModeHybrid means that the cgroup2 unified hierarchy is mounted next to
+	// v1 hierarchies, usually at `/sys/fs/cgroup/unified`. Controllers may
+	// then be attached to either of them, depending on the distribution.
+	ModeHybrid
+	// ModeUnified means that the cgroup2 unified hierarchy is the only one
+	// mounted.
+	ModeUnified
+)
+
+// String returns the name of m, e.g. "hybrid".
+func (m Mode) String() string {
+	switch m {
+	case ModeLegacy:
+		return "legacy"
+	case ModeHybrid:
+		return "hybrid"
+	case ModeUnified:
+		return "unified"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+// Mode returns which cgroup hierarchies are mounted, reading mountinfo only
+// once, unlike IsCGroupV2 and IsHybrid together.
+func (s Source) Mode() (Mode, error) {
+	hasV1, hasV2, err := s.mountedHierarchies(s.procPath(_procPathMountInfo))
+	switch {
+	case err != nil:
+		return ModeLegacy, err
+	case hasV2 && hasV1:
+		return ModeHybrid, nil
+	case hasV2:
+		return ModeUnified, nil
+	default:
+		return ModeLegacy, nil
+	}
 }
 
-func isCGroupV2(procPathMountInfo string) (bool, error) {
-	var isV2 bool
-	newMountPoint := func(mp *MountPoint) error {
-		if mp.FSType == _cgroupv2FSType && mp.MountPoint == _cgroupv2MountPoint {
-			isV2 = true
+// ModeAndUnifiedCGroup returns the Mode like Mode and, unless it's
+// ModeLegacy, the *CGroup of the cgroup2 unified hierarchy the current
+// process belongs to like NewUnifiedCGroupForCurrentProcess, scanning
+// mountinfo only once. It's the fast path on cgroup2 hosts, where the quota
+// is read from the unified hierarchy without building the CGroups of the v1
+// controllers.
+func (s Source) ModeAndUnifiedCGroup() (Mode, *CGroup, error) {
+	var hasV1 bool
+	var unified *mountInfoEntry
+	newMountPoint := func(e *mountInfoEntry) error {
+		switch string(e.fsType) {
+		case _cgroupFSType:
+			hasV1 = true
+		case _cgroupv2FSType:
+			// e is reused for the next line, so the fields are copied.
+			if unified == nil {
+				unified = &mountInfoEntry{
+					root:       append([]byte(nil), e.root...),
+					mountPoint: append([]byte(nil), e.mountPoint...),
+				}
+			}
 		}
 		return nil
 	}
-	if err := parseMountInfo(procPathMountInfo, newMountPoint); err != nil {
-		return false, err
+	if err := s.scanMountInfo(s.procPath(_procPathMountInfo), newMountPoint); err != nil {
+		return ModeLegacy, nil, err
+	}
+	if unified == nil {
+		return ModeLegacy, nil, nil
+	}
+	mode := ModeUnified
+	if hasV1 {
+		mode = ModeHybrid
+	}
+
+	cgroupSubsystems, err := s.parseCGroupSubsystems(s.procPath(_procPathCGroup))
+	if err != nil {
+		return mode, nil, err
 	}
-	return isV2, nil
+	subsys, exists := cgroupSubsystems[_cgroupv2SubsysName]
+	if !exists {
+		return mode, nil, nil
+	}
+	mountPoint, cgroupPath, err := unified.translate(subsys.Name)
+	if err != nil {
+		return mode, nil, err
+	}
+	return mode, s.newMountedCGroup(s.cgroupMountPath(mountPoint), s.cgroupMountPath(cgroupPath)), nil
+}
+
+// CPUCGroupForCurrentProcess returns the *CGroup whose files the CPU quota
+// of the current process is read from: the cgroup2 directory that holds its
+// cpu.max in unified mode, and the cgroup of the v1 cpu controller
+// otherwise, see CGroups.CPUQuota, unless in hybrid mode the cgroup2 one
+// defines a quota or the cpu controller isn't attached to a v1 hierarchy. It
+// returns nil if there's none.
+func (s Source) CPUCGroupForCurrentProcess() (*CGroup, error) {
+	mode, unified, err := s.ModeAndUnifiedCGroup()
+	if err != nil || mode == ModeUnified {
+		if unified == nil {
+			return nil, err
+		}
+		return unified.cpuMaxCGroup(), err
+	}
+
+	cgroups, err := s.NewCGroupsForCurrentProcess()
+	if err != nil {
+		return nil, err
+	}
+	if unified != nil && unified.HasCPUQuotaV2() {
+		if _, defined, _ := unified.CPUQuotaV2(); defined || !cgroups.HasCPUController() {
+			return unified.cpuMaxCGroup(), nil
+		}
+	}
+	cgroup, _ := cgroups.cfsCGroup()
+	return cgroup, nil
+}
+
+// IsHybrid returns true if the cgroup2 unified hierarchy is mounted next to
+// v1 hierarchies. Controllers may then be attached to either of them.
+func (s Source) IsHybrid() (bool, error) {
+	hasV1, hasV2, err := s.mountedHierarchies(s.procPath(_procPathMountInfo))
+	return hasV1 && hasV2, err
+}
+
+// isCGroupV2 reports whether the cgroup2 unified hierarchy is the only one
+// mounted. Hybrid layouts aren't considered cgroup2.
+func (s Source) isCGroupV2(procPathMountInfo string) (bool, error) {
+	hasV1, hasV2, err := s.mountedHierarchies(procPathMountInfo)
+	return hasV2 && !hasV1, err
+}
+
+// mountedHierarchies reports whether v1 and cgroup2 hierarchies are mounted.
+// Mount points are taken from mountinfo rather than assumed to be under
+// `/sys/fs/cgroup`.
+func (s Source) mountedHierarchies(procPathMountInfo string) (hasV1, hasV2 bool, err error) {
+	newMountPoint := func(e *mountInfoEntry) error {
+		switch string(e.fsType) {
+		case _cgroupFSType:
+			hasV1 = true
+		case _cgroupv2FSType:
+			hasV2 = true
+		}
+		return nil
+	}
+	if err := s.scanMountInfo(procPathMountInfo, newMountPoint); err != nil {
+		return false, false, err
+	}
+	return hasV1, hasV2, nil
 }
 
 // CPUQuotaV2 returns the CPU quota applied with the CPU cgroup2 controller.
 // It is a result of reading cpu quota and period from cpu.max file.
 // It will return `cpu.max / cpu.period`. If cpu.max is set to max, it returns
-// (-1, false, nil)
+// (-1, false, nil). A cpu.max holding a single number other than max is
+// malformed and yields an error.
 func CPUQuotaV2() (float64, bool, error) {
-	return cpuQuotaV2(_cgroupv2MountPoint, _cgroupv2CPUMax)
+	return Source{}.CPUQuotaV2()
+}
+
+// CPUQuotaV2 is like the package-level CPUQuotaV2, but reads every file
+// from s. The cgroup2 directory of the current process is resolved from
+// `mountinfo` and `cgroup`.
+func (s Source) CPUQuotaV2() (float64, bool, error) {
+	cgroup, err := s.NewUnifiedCGroupForCurrentProcess()
+	if cgroup == nil || err != nil {
+		return -1, false, err
+	}
+	return cgroup.CPUQuotaV2()
+}
+
+// CPUQuotaV2 returns the CPU quota read from the cpu.max file of a cgroup2
+// directory. If the directory has no cpu.max, the file of its innermost
+// ancestor that has one is read instead; see cpuMaxCGroup. See CPUQuotaV2
+// for details.
+func (cg *CGroup) CPUQuotaV2() (float64, bool, error) {
+	c := cg.cpuMaxCGroup()
+	return c.src.cpuQuotaV2(c.path, _cgroupv2CPUMax)
+}
+
+// EffectiveCPUQuotaV2 returns the most restrictive CPU quota, the smallest
+// quota/period ratio, among the cpu.max files of the cgroup2 directory and
+// all of its ancestors up to the root of the hierarchy. Under systemd
+// delegation, the leaf often has a cpu.max of max while the limit is set on
+// a parent slice, which CPUQuotaV2 doesn't see. If no cpu.max defines a
+// quota, the method returns `(-1, false, nil)`. The walk stops at the first
+// ancestor whose cpu.max can't be read for lack of permission, as is common
+// above the root of a delegated subtree (nsdelegate), with the quotas found
+// below it.
+func (cg *CGroup) EffectiveCPUQuotaV2() (float64, bool, error) {
+	quota, defined := -1.0, false
+	for c := cg; c != nil; c = c.parent() {
+		q, ok, err := c.src.cpuQuotaV2(c.path, _cgroupv2CPUMax)
+		if err != nil {
+			if c != cg && os.IsPermission(err) {
+				break
+			}
+			return -1, false, err
+		}
+		if ok && (!defined || q < quota) {
+			quota, defined = q, true
+		}
+	}
+	return quota, defined, nil
 }
 
-func cpuQuotaV2(cgroupv2MountPoint, cgroupv2CPUMax string) (float64, bool, error) {
-	cpuMaxParams, err := os.Open(path.Join(cgroupv2MountPoint, cgroupv2CPUMax))
+// HasCPUQuotaV2 returns true if the cgroup2 directory or one of its
+// ancestors exposes cpu.max, which is the case when the cpu controller is
+// enabled for it.
+func (cg *CGroup) HasCPUQuotaV2() bool {
+	return cg.src.stat(cg.cpuMaxCGroup().ParamPath(_cgroupv2CPUMax)) == nil
+}
+
+// cpuMaxCGroup returns the innermost of cg and its ancestors that has a
+// cpu.max file, or cg itself if none has. A cgroup only has cpu.max if its
+// parent enables the cpu controller for its children, which a delegated
+// subtree such as the `user@.service` manager of `systemctl --user` usually
+// doesn't: the services it starts then have no cpu.max of their own and are
+// bound by the quota of the manager.
+func (cg *CGroup) cpuMaxCGroup() *CGroup {
+	for c := cg; c != nil; c = c.parent() {
+		if err := c.src.stat(c.ParamPath(_cgroupv2CPUMax)); !os.IsNotExist(err) {
+			return c
+		}
+	}
+	return cg
+}
+
+func (s Source) cpuQuotaV2(cgroupv2MountPoint, cgroupv2CPUMax string) (float64, bool, error) {
+	cpuMaxParams, err := s.open(path.Join(cgroupv2MountPoint, cgroupv2CPUMax))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return -1, false, nil
@@ -183,28 +529,103 @@ func cpuQuotaV2(cgroupv2MountPoint, cgroupv2CPUMax string) (float64, bool, error
 	if scanner.Scan() {
 		fields := strings.Fields(scanner.Text())
 		if len(fields) == 0 || len(fields) > 2 {
-			return -1, false, fmt.Errorf("invalid format")
+			return -1, false, cpuMaxFormatInvalidError{scanner.Text()}
 		}
+		// An unlimited quota is undefined whatever the period, which may
+		// differ from the default one.
 		if fields[_cgroupv2CPUMaxQuotaIndex] == _cgroupV2CPUMaxQuotaMax {
 			return -1, false, nil
 		}
-		max, err := strconv.Atoi(fields[_cgroupv2CPUMaxQuotaIndex])
+		// A single number may well be a period that lost its quota, so only
+		// max may appear without a period.
+		if len(fields) == 1 {
+			return -1, false, cpuMaxFormatInvalidError{scanner.Text()}
+		}
+		max, err := strconv.ParseInt(fields[_cgroupv2CPUMaxQuotaIndex], 10, 64)
 		if err != nil {
 			return -1, false, err
 		}
-		var period int
-		if len(fields) == 1 {
-			period = _cgroupV2CPUMaxDefaultPeriod
-		} else {
-			period, err = strconv.Atoi(fields[_cgroupv2CPUMaxPeriodIndex])
-			if err != nil {
-				return -1, false, err
-			}
+		if max <= 0 {
+			return -1, false, cpuMaxFormatInvalidError{scanner.Text()}
+		}
+		period, err := strconv.ParseInt(fields[_cgroupv2CPUMaxPeriodIndex], 10, 64)
+		if err != nil {
+			return -1, false, err
+		}
+		if period <= 0 {
+			return -1, false, cpuPeriodInvalidError{period}
 		}
-		return float64(max) / float64(period), true, nil
+		return quotaRatio(max, period), true, nil
 	}
 	if err := scanner.Err(); err != nil {
 		return -1, false, err
 	}
 	return 0, false, io.ErrUnexpectedEOF
 }
+
+// CPUQuotaFromFile returns the CPU quota read from a file in the format of
+// the cgroup2 cpu.max file, given by its exact path rather than resolved
+// through mountinfo, e.g. when only that file is bind-mounted into the
+// process' namespace. Unlike cpu.max itself, the period always has to be
+// present: the file must hold "<quota> <period>" or "max <period>". If the
+// quota is max, the method returns `(-1, false, nil)`.
+func (s Source) CPUQuotaFromFile(path string) (float64, bool, error) {
+	r, err := s.open(path)
+	if err != nil {
+		return -1, false, err
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return -1, false, err
+	}
+
+	line := strings.TrimSpace(string(content))
+	fields := strings.Fields(line)
+	if len(fields) != 2 || strings.ContainsRune(line, '\n') {
+		return -1, false, cpuMaxFormatInvalidError{line}
+	}
+	period, err := strconv.ParseInt(fields[_cgroupv2CPUMaxPeriodIndex], 10, 64)
+	if err != nil || period <= 0 {
+		return -1, false, cpuMaxFormatInvalidError{line}
+	}
+	if fields[_cgroupv2CPUMaxQuotaIndex] == _cgroupV2CPUMaxQuotaMax {
+		return -1, false, nil
+	}
+	quota, err := strconv.ParseInt(fields[_cgroupv2CPUMaxQuotaIndex], 10, 64)
+	if err != nil || quota <= 0 {
+		return -1, false, cpuMaxFormatInvalidError{line}
+	}
+	return quotaRatio(quota, period), true, nil
+}
+
+// CPUQuotaFromCGroup returns the CPU quota of the cgroup directory at path,
+// given by its exact path rather than resolved through `/proc/self/cgroup`,
+// e.g. the cgroup of a child workload. The quota is read from cpu.max if the
+// directory has one, as a cgroup2 directory does, and from cpu.cfs_quota_us
+// and cpu.cfs_period_us otherwise, as a cgroup v1 one does. The method
+// returns an error if the directory has neither.
+func (s Source) CPUQuotaFromCGroup(path string) (float64, bool, error) {
+	cgroup := s.NewCGroup(path)
+	if err := s.stat(cgroup.ParamPath(_cgroupv2CPUMax)); !os.IsNotExist(err) {
+		if err != nil {
+			return -1, false, err
+		}
+		return cgroup.CPUQuotaV2()
+	}
+	if err := s.stat(cgroup.ParamPath(_cgroupCPUCFSQuotaUsParam)); err != nil {
+		if os.IsNotExist(err) {
+			return -1, false, cpuFilesNotFoundError{path}
+		}
+		return -1, false, err
+	}
+	return CGroups{_cgroupSubsysCPU: cgroup}.CPUQuota()
+}
+
+// quotaRatio divides quota by period. The integer part of the result is
+// computed exactly and only the remainder goes through floating point, so
+// that quotas that are an exact multiple of the period yield an exact integer
+// even when they're too large to be represented exactly as a float64.
+func quotaRatio(quota, period int64) float64 {
+	whole, rem := quota/period, quota%period
+	return float64(whole) + float64(rem)/float64(period)
+}
@@ -18,16 +18,19 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-//go:build linux
-// +build linux
-
 package cgroups
 
 import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewCGroups(t *testing.T) {
@@ -55,6 +58,299 @@ func TestNewCGroups(t *testing.T) {
 	}
 }
 
+func TestNewCGroupsCustomMountPoint(t *testing.T) {
+	// Older and RHEL-family hosts mount the v1 hierarchies under `/cgroup`.
+	root := filepath.Join(testDataPath, "root", "custom-mount")
+
+	testTable := []struct {
+		subsys string
+		path   string
+	}{
+		{_cgroupSubsysCPU, "/cgroup/cpu,cpuacct"},
+		{_cgroupSubsysCPUAcct, "/cgroup/cpu,cpuacct"},
+		{_cgroupSubsysCPUSet, "/cgroup/cpuset"},
+		{_cgroupSubsysMemory, "/cgroup/memory/large"},
+	}
+
+	cgroups, err := NewCGroups(
+		filepath.Join(root, _procPathMountInfo),
+		filepath.Join(root, _procPathCGroup),
+	)
+	assert.Equal(t, len(testTable), len(cgroups))
+	assert.NoError(t, err)
+
+	for _, tt := range testTable {
+		cgroup, exists := cgroups[tt.subsys]
+		assert.Equal(t, true, exists, "%q expected to present in `cgroups`", tt.subsys)
+		assert.Equal(t, tt.path, cgroup.path, "%q expected for `cgroups[%q].path`, got %q", tt.path, tt.subsys, cgroup.path)
+	}
+
+	src := Source{Root: root}
+	isV2, err := src.IsCGroupV2()
+	assert.False(t, isV2)
+	assert.NoError(t, err)
+
+	cgroups, err = src.NewCGroupsForCurrentProcess()
+	assert.NoError(t, err)
+	quota, defined, err := cgroups.CPUQuota()
+	assert.Equal(t, 2.5, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+}
+
+func TestCGroupsReadControllerFile(t *testing.T) {
+	cgroups, err := Source{Root: filepath.Join(testDataPath, "root", "v1")}.NewCGroupsForCurrentProcess()
+	assert.NoError(t, err)
+
+	content, err := cgroups.ReadControllerFile(_cgroupSubsysCPU, _cgroupCPUCFSQuotaUsParam)
+	assert.Equal(t, "150000\n", string(content))
+	assert.NoError(t, err)
+
+	content, err = cgroups.ReadControllerFile("pids", "pids.max")
+	assert.Nil(t, content)
+	assert.Equal(t, controllerNotMountedError{"pids"}, err)
+
+	content, err = cgroups.ReadControllerFile(_cgroupSubsysCPU, "../memory/memory.limit_in_bytes")
+	assert.Nil(t, content)
+	assert.Equal(t, paramNameInvalidError{"../memory/memory.limit_in_bytes"}, err)
+}
+
+func TestNewCGroupsWithoutCPUController(t *testing.T) {
+	cgroups, err := NewCGroups(
+		filepath.Join(testDataProcPath, "cpuset-only", "mountinfo"),
+		filepath.Join(testDataProcPath, "cpuset-only", "cgroup"),
+	)
+	assert.NoError(t, err)
+
+	_, exists := cgroups[_cgroupSubsysCPU]
+	assert.False(t, exists, "cpu controller shouldn't be present")
+	assert.Equal(t, "/sys/fs/cgroup/cpuset", cgroups[_cgroupSubsysCPUSet].Path())
+	assert.False(t, cgroups.HasCPUController())
+
+	quota, defined, err := cgroups.CPUQuota()
+	assert.Equal(t, -1.0, quota)
+	assert.False(t, defined)
+	assert.NoError(t, err)
+}
+
+func TestNewUnifiedCGroup(t *testing.T) {
+	testTable := []struct {
+		name         string
+		expectedPath string
+	}{
+		{
+			name:         "hybrid",
+			expectedPath: "/sys/fs/cgroup/unified/docker",
+		},
+		{
+			// No cgroup2 entry in the cgroup file.
+			name:         "cgroups",
+			expectedPath: "",
+		},
+	}
+
+	for _, tt := range testTable {
+		cgroup, err := NewUnifiedCGroup(
+			filepath.Join(testDataProcPath, tt.name, "mountinfo"),
+			filepath.Join(testDataProcPath, tt.name, "cgroup"),
+		)
+		assert.NoError(t, err, tt.name)
+		if tt.expectedPath == "" {
+			assert.Nil(t, cgroup, tt.name)
+			continue
+		}
+		assert.Equal(t, tt.expectedPath, cgroup.Path(), tt.name)
+	}
+
+	// Hybrid layout without cpu on the v1 side: the quota lives on the unified
+	// hierarchy.
+	src := Source{Root: filepath.Join(testDataPath, "root", "hybrid")}
+	cgroups, err := src.NewCGroupsForCurrentProcess()
+	assert.NoError(t, err)
+	assert.False(t, cgroups.HasCPUController())
+
+	unified, err := src.NewUnifiedCGroupForCurrentProcess()
+	assert.NoError(t, err)
+	assert.Equal(t, "/sys/fs/cgroup/unified/docker", unified.Path())
+	assert.True(t, unified.HasCPUQuotaV2())
+
+	quota, defined, err := unified.CPUQuotaV2()
+	assert.Equal(t, 2.0, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+
+	isV2, err := src.IsCGroupV2()
+	assert.False(t, isV2, "hybrid layout shouldn't be detected as cgroup2")
+	assert.NoError(t, err)
+
+	unified, err = Source{Root: filepath.Join(testDataPath, "root", "nonexistent")}.NewUnifiedCGroupForCurrentProcess()
+	assert.Nil(t, unified)
+	assert.Error(t, err)
+}
+
+func TestNewCGroupsForCurrentProcessUnderRoot(t *testing.T) {
+	src := Source{Root: filepath.Join(testDataPath, "root", "v1")}
+
+	cgroups, err := src.NewCGroupsForCurrentProcess()
+	assert.NoError(t, err)
+	assert.Equal(t, "/sys/fs/cgroup/cpu,cpuacct", cgroups[_cgroupSubsysCPU].Path())
+	assert.Equal(t, "/sys/fs/cgroup/memory/large", cgroups[_cgroupSubsysMemory].Path())
+
+	assert.True(t, cgroups.HasCPUController())
+
+	quota, defined, err := cgroups.CPUQuota()
+	assert.Equal(t, 1.5, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+
+	cgroups, err = Source{Root: filepath.Join(testDataPath, "root", "nonexistent")}.NewCGroupsForCurrentProcess()
+	assert.Nil(t, cgroups)
+	assert.Error(t, err)
+}
+
+func TestNewCGroupsUnderRootGVisor(t *testing.T) {
+	// gVisor generates its own mountinfo: mounts have no optional fields,
+	// "none" as their source, and each controller is mounted on its own,
+	// including the gVisor-specific job controller.
+	src := Source{Root: filepath.Join(testDataPath, "root", "gvisor")}
+
+	isV2, err := src.IsCGroupV2()
+	assert.False(t, isV2)
+	assert.NoError(t, err)
+
+	cgroups, err := src.NewCGroupsForCurrentProcess()
+	require.NoError(t, err)
+	for _, subsys := range []string{"cpu", "cpuacct", "cpuset", "devices", "job", "memory", "pids"} {
+		cgroup, exists := cgroups[subsys]
+		require.True(t, exists, "%q should be mounted", subsys)
+		assert.Equal(t, "/sys/fs/cgroup/"+subsys, cgroup.Path(), subsys)
+	}
+
+	quota, defined, err := cgroups.CPUQuota()
+	assert.Equal(t, 2.0, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+
+	cpus, defined, err := cgroups.CPUSetCPUs()
+	assert.Equal(t, 4, cpus)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+}
+
+func TestNewCGroupsUnderRootAlpine(t *testing.T) {
+	// The kernel writes mountinfo and cgroup for the process, so they don't
+	// depend on the libc of the container: these layouts come from Alpine
+	// containers, on a cgroup v2 host and on an OpenRC host with cgroup v1.
+	t.Run("v2", func(t *testing.T) {
+		src := Source{Root: filepath.Join(testDataPath, "root", "alpine")}
+
+		isV2, err := src.IsCGroupV2()
+		assert.True(t, isV2)
+		assert.NoError(t, err)
+
+		quota, defined, err := src.CPUQuotaV2()
+		assert.Equal(t, 1.5, quota)
+		assert.True(t, defined)
+		assert.NoError(t, err)
+
+		limit, defined, err := src.MemoryLimitV2()
+		assert.Equal(t, int64(512<<20), limit)
+		assert.True(t, defined)
+		assert.NoError(t, err)
+	})
+
+	t.Run("openrc", func(t *testing.T) {
+		// OpenRC mounts a named openrc hierarchy next to one mount per
+		// controller.
+		src := Source{Root: filepath.Join(testDataPath, "root", "alpine-openrc")}
+
+		isV2, err := src.IsCGroupV2()
+		assert.False(t, isV2)
+		assert.NoError(t, err)
+
+		cgroups, err := src.NewCGroupsForCurrentProcess()
+		require.NoError(t, err)
+		assert.Equal(t, "/sys/fs/cgroup/cpu", cgroups[_cgroupSubsysCPU].Path())
+		assert.Equal(t, "/sys/fs/cgroup/memory", cgroups[_cgroupSubsysMemory].Path())
+
+		quota, defined, err := cgroups.CPUQuota()
+		assert.Equal(t, 2.5, quota)
+		assert.True(t, defined)
+		assert.NoError(t, err)
+
+		limit, defined, err := cgroups.MemoryLimit()
+		assert.Equal(t, int64(256<<20), limit)
+		assert.True(t, defined)
+		assert.NoError(t, err)
+
+		containerID, err := src.ContainerIDForCurrentProcess()
+		assert.Equal(t, "4e2b9c1f0a7d3e6b8c5f2a1d9e0b7c4a6f3d8e2b1c9a0f7e5d4c3b2a1f0e9d8c", containerID)
+		assert.NoError(t, err)
+	})
+}
+
+func TestNewCGroupsTrailingSlash(t *testing.T) {
+	// The cgroup paths of /proc/self/cgroup and the roots and mount points
+	// of mountinfo end with a slash, which must not leak into the resolved
+	// paths as double slashes.
+	var read []string
+	src := Source{
+		Root:   filepath.Join(testDataPath, "root", "trailing-slash"),
+		OnRead: func(name string) { read = append(read, name) },
+	}
+
+	cgroups, err := src.NewCGroupsForCurrentProcess()
+	require.NoError(t, err)
+	assert.Equal(t, "/sys/fs/cgroup/cpu,cpuacct/app", cgroups[_cgroupSubsysCPU].Path())
+	assert.Equal(t, "/sys/fs/cgroup/memory/large", cgroups[_cgroupSubsysMemory].Path())
+	assert.Equal(t, "/sys/fs/cgroup/cpuset", cgroups[_cgroupSubsysCPUSet].Path())
+
+	quota, defined, err := cgroups.CPUQuota()
+	assert.Equal(t, 1.5, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+
+	src.Root = filepath.Join(testDataPath, "root", "trailing-slash-v2")
+	quota, defined, err = src.CPUQuotaV2()
+	assert.Equal(t, 2.0, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+
+	for _, name := range read {
+		assert.NotContains(t, name, "//", "unclean path read")
+	}
+}
+
+func TestSourcePathClean(t *testing.T) {
+	assert.Equal(t, "/sys/fs/cgroup/cpu.max", Source{}.path("/sys/fs/cgroup//cpu.max"))
+	assert.Equal(t, filepath.Join("root", "sys", "fs", "cgroup", "cpu.max"), Source{Root: "root"}.path("/sys/fs/cgroup//cpu.max"))
+}
+
+func TestNewCGroupsNamedHierarchies(t *testing.T) {
+	// In a container, the name=systemd hierarchy is mounted from the
+	// container's cgroup while /proc/self/cgroup lists the systemd scope of
+	// the host, which can't be translated to a path in the container.
+	mountInfoPath := filepath.Join(testDataProcPath, "name-systemd", "mountinfo")
+	cgroupPath := filepath.Join(testDataProcPath, "name-systemd", "cgroup")
+
+	cgroups, err := NewCGroups(mountInfoPath, cgroupPath)
+	require.NoError(t, err)
+	assert.Len(t, cgroups, 5)
+	for _, subsys := range []string{"cpu", "cpuacct", "cpuset", "memory", "pids"} {
+		_, exists := cgroups[subsys]
+		assert.True(t, exists, "%q should be mounted", subsys)
+	}
+	assert.Equal(t, "/sys/fs/cgroup/cpu,cpuacct", cgroups[_cgroupSubsysCPU].Path())
+	for _, name := range []string{"name=systemd", "name=openrc"} {
+		_, exists := cgroups[name]
+		assert.False(t, exists, "%q shouldn't be registered", name)
+	}
+
+	cgroups, err = Source{}.WantControllers(DefaultControllers).NewCGroups(mountInfoPath, cgroupPath)
+	require.NoError(t, err)
+	assert.Len(t, cgroups, 4)
+}
+
 func TestNewCGroupsWithErrors(t *testing.T) {
 	testTable := []struct {
 		mountInfoPath string
@@ -83,6 +379,28 @@ func TestNewCGroupsWithErrors(t *testing.T) {
 	}
 }
 
+func TestNewCGroupsNamespaceRoot(t *testing.T) {
+	// Inside a cgroup namespace, the process is listed at "/" while the
+	// hierarchies were mounted from outside the namespace, so their roots
+	// aren't ancestors of it.
+	cgroups, err := NewCGroups(
+		filepath.Join(testDataProcPath, "cgroupns", "mountinfo"),
+		filepath.Join(testDataProcPath, "cgroupns", "cgroup"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "/sys/fs/cgroup/cpu,cpuacct", cgroups[_cgroupSubsysCPU].Path())
+	assert.Equal(t, "/sys/fs/cgroup/memory", cgroups[_cgroupSubsysMemory].Path())
+	assert.Equal(t, "/sys/fs/cgroup/cpuset", cgroups[_cgroupSubsysCPUSet].Path())
+
+	cgroup, err := NewUnifiedCGroup(
+		filepath.Join(testDataProcPath, "cgroupns-v2", "mountinfo"),
+		filepath.Join(testDataProcPath, "cgroupns-v2", "cgroup"),
+	)
+	require.NoError(t, err)
+	require.NotNil(t, cgroup)
+	assert.Equal(t, "/sys/fs/cgroup", cgroup.Path())
+}
+
 func TestCGroupsCPUQuota(t *testing.T) {
 	testTable := []struct {
 		name            string
@@ -108,6 +426,25 @@ func TestCGroupsCPUQuota(t *testing.T) {
 			expectedDefined: false,
 			shouldHaveError: true,
 		},
+		{
+			name:            "zero-period",
+			expectedQuota:   -1.0,
+			expectedDefined: false,
+			shouldHaveError: true,
+		},
+		{
+			name:            "negative-period",
+			expectedQuota:   -1.0,
+			expectedDefined: false,
+			shouldHaveError: true,
+		},
+		{
+			// 9007199255791737 isn't exactly representable as a float64.
+			name:            "large",
+			expectedQuota:   9007208263.0,
+			expectedDefined: true,
+			shouldHaveError: false,
+		},
 	}
 
 	cgroups := make(CGroups)
@@ -133,6 +470,24 @@ func TestCGroupsCPUQuota(t *testing.T) {
 	}
 }
 
+func TestQuotaRatio(t *testing.T) {
+	testTable := []struct {
+		quota    int64
+		period   int64
+		expected float64
+	}{
+		{quota: 150000, period: 100000, expected: 1.5},
+		{quota: 800000, period: 100000, expected: 8},
+		{quota: 50000, period: 100000, expected: 0.5},
+		{quota: 9007199255791737, period: 999999, expected: 9007208263},
+		{quota: 9007199255125071, period: 333333, expected: 27021624787},
+	}
+
+	for _, tt := range testTable {
+		assert.Equal(t, tt.expected, quotaRatio(tt.quota, tt.period), "%d/%d", tt.quota, tt.period)
+	}
+}
+
 func TestCGroupsIsCGroupV2(t *testing.T) {
 	testTable := []struct {
 		name            string
@@ -154,6 +509,16 @@ func TestCGroupsIsCGroupV2(t *testing.T) {
 			expectedIsV2:    true,
 			shouldHaveError: false,
 		},
+		{
+			name:            "mountinfo-v2-custom",
+			expectedIsV2:    true,
+			shouldHaveError: false,
+		},
+		{
+			name:            "mountinfo-mixed",
+			expectedIsV2:    true,
+			shouldHaveError: false,
+		},
 		{
 			name:            "mountinfo-nonexistent",
 			expectedIsV2:    false,
@@ -163,7 +528,7 @@ func TestCGroupsIsCGroupV2(t *testing.T) {
 
 	for _, tt := range testTable {
 		mountInfoPath := filepath.Join(testDataProcPath, "v2", tt.name)
-		isV2, err := isCGroupV2(mountInfoPath)
+		isV2, err := Source{}.isCGroupV2(mountInfoPath)
 
 		assert.Equal(t, tt.expectedIsV2, isV2, tt.name)
 
@@ -175,6 +540,331 @@ func TestCGroupsIsCGroupV2(t *testing.T) {
 	}
 }
 
+func TestCGroupsIsHybrid(t *testing.T) {
+	testTable := []struct {
+		name             string
+		expectedIsHybrid bool
+		shouldHaveError  bool
+	}{
+		{name: "v1", expectedIsHybrid: false},
+		{name: "v2", expectedIsHybrid: false},
+		{name: "hybrid", expectedIsHybrid: true},
+		{name: "nonexistent", expectedIsHybrid: false, shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		src := Source{Root: filepath.Join(testDataPath, "root", tt.name)}
+		isHybrid, err := src.IsHybrid()
+		assert.Equal(t, tt.expectedIsHybrid, isHybrid, tt.name)
+
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
+
+func TestSourceMode(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedMode    Mode
+		shouldHaveError bool
+	}{
+		{name: "v1", expectedMode: ModeLegacy},
+		{name: "v2", expectedMode: ModeUnified},
+		{name: "hybrid", expectedMode: ModeHybrid},
+		{name: "hybrid-v1-quota", expectedMode: ModeHybrid},
+		{name: "nonexistent", expectedMode: ModeLegacy, shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		src := Source{Root: filepath.Join(testDataPath, "root", tt.name)}
+		mode, err := src.Mode()
+		assert.Equal(t, tt.expectedMode, mode, tt.name)
+
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+
+	assert.Equal(t, []string{"legacy", "hybrid", "unified", "Mode(42)"},
+		[]string{ModeLegacy.String(), ModeHybrid.String(), ModeUnified.String(), Mode(42).String()})
+}
+
+func TestModeAndUnifiedCGroup(t *testing.T) {
+	// The fast path must resolve the same cgroup, and so the same quota, as
+	// Mode and NewUnifiedCGroupForCurrentProcess on every fixture.
+	infos, err := ioutil.ReadDir(filepath.Join(testDataPath, "root"))
+	require.NoError(t, err)
+	names := []string{"nonexistent"}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			src := Source{Root: filepath.Join(testDataPath, "root", name)}
+			mode, unified, err := src.ModeAndUnifiedCGroup()
+
+			expectedMode, expectedErr := src.Mode()
+			var expected *CGroup
+			if expectedErr == nil && expectedMode != ModeLegacy {
+				expected, expectedErr = src.NewUnifiedCGroupForCurrentProcess()
+			}
+			assert.Equal(t, expectedMode, mode)
+			if expectedErr != nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, expected, unified)
+			if unified == nil {
+				return
+			}
+
+			quota, defined, err := unified.CPUQuotaV2()
+			expectedQuota, expectedDefined, expectedErr := expected.CPUQuotaV2()
+			assert.Equal(t, expectedQuota, quota)
+			assert.Equal(t, expectedDefined, defined)
+			assert.Equal(t, expectedErr, err)
+		})
+	}
+}
+
+func TestCPUCGroupForCurrentProcess(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedPath    string
+		shouldHaveError bool
+	}{
+		{name: "v1", expectedPath: "/sys/fs/cgroup/cpu,cpuacct"},
+		{name: "v2", expectedPath: "/sys/fs/cgroup"},
+		{name: "systemd-user", expectedPath: "/sys/fs/cgroup/user.slice/user-1000.slice/user@1000.service"},
+		{name: "hybrid-unified-quota", expectedPath: "/sys/fs/cgroup/unified/docker"},
+		{name: "hybrid-v1-quota", expectedPath: "/sys/fs/cgroup/cpu,cpuacct/docker"},
+		{name: "cpuset-only"},
+		{name: "nonexistent", shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		cgroup, err := Source{Root: filepath.Join(testDataPath, "root", tt.name)}.CPUCGroupForCurrentProcess()
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+			continue
+		}
+		require.NoError(t, err, tt.name)
+		if tt.expectedPath == "" {
+			assert.Nil(t, cgroup, tt.name)
+			continue
+		}
+		require.NotNil(t, cgroup, tt.name)
+		assert.Equal(t, tt.expectedPath, cgroup.Path(), tt.name)
+	}
+}
+
+func TestCGroupsUnderRootV2(t *testing.T) {
+	src := Source{Root: filepath.Join(testDataPath, "root", "v2")}
+
+	isV2, err := src.IsCGroupV2()
+	assert.True(t, isV2)
+	assert.NoError(t, err)
+
+	quota, defined, err := src.CPUQuotaV2()
+	assert.Equal(t, 3.0, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+
+	isV2, err = Source{Root: filepath.Join(testDataPath, "root", "v1")}.IsCGroupV2()
+	assert.False(t, isV2)
+	assert.NoError(t, err)
+}
+
+func TestCGroupsUnderRootV1SplitPeriod(t *testing.T) {
+	// Under delegation, the leaf cgroup holds the quota while the period is
+	// only exposed by the root of the mounted hierarchy, two levels up.
+	src := Source{Root: filepath.Join(testDataPath, "root", "v1-split-period")}
+
+	cgroups, err := src.NewCGroupsForCurrentProcess()
+	require.NoError(t, err)
+	assert.Equal(t, "/sys/fs/cgroup/cpu,cpuacct/app/worker", cgroups[_cgroupSubsysCPU].Path())
+
+	quota, defined, err := cgroups.CPUQuota()
+	assert.Equal(t, 2.5, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+}
+
+func TestCGroupsUnderRootV1QuotaUnderCPUAcct(t *testing.T) {
+	// On some broken hosts that mount cpu and cpuacct separately, the quota
+	// files only exist under the cpuacct mount.
+	src := Source{Root: filepath.Join(testDataPath, "root", "v1-cpuacct-quota")}
+
+	cgroups, err := src.NewCGroupsForCurrentProcess()
+	require.NoError(t, err)
+	assert.Equal(t, "/sys/fs/cgroup/cpu/app", cgroups[_cgroupSubsysCPU].Path())
+	assert.Equal(t, "/sys/fs/cgroup/cpuacct/app", cgroups[_cgroupSubsysCPUAcct].Path())
+
+	quota, defined, err := cgroups.CPUQuota()
+	assert.Equal(t, 3.0, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+
+	// The cpu mount wins whenever it has the quota files.
+	root := t.TempDir()
+	writeRoot(t, root, map[string]string{
+		"proc/self/mountinfo":                     "3 2 0:20 / /sys/fs/cgroup/cpu rw - cgroup cgroup rw,cpu\n4 2 0:21 / /sys/fs/cgroup/cpuacct rw - cgroup cgroup rw,cpuacct\n",
+		"proc/self/cgroup":                        "3:cpuacct:/\n2:cpu:/\n",
+		"sys/fs/cgroup/cpu/cpu.cfs_quota_us":      "100000\n",
+		"sys/fs/cgroup/cpu/cpu.cfs_period_us":     "100000\n",
+		"sys/fs/cgroup/cpuacct/cpu.cfs_quota_us":  "300000\n",
+		"sys/fs/cgroup/cpuacct/cpu.cfs_period_us": "100000\n",
+	})
+	cgroups, err = Source{Root: root}.NewCGroupsForCurrentProcess()
+	require.NoError(t, err)
+	quota, defined, err = cgroups.CPUQuota()
+	assert.Equal(t, 1.0, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+}
+
+func TestCGroupsUnderRootV2Symlinks(t *testing.T) {
+	// Some container setups expose the cgroup2 hierarchy, and even
+	// individual controller files, through symlinks, the same way
+	// /proc/self links to the directory of the process. Every read follows
+	// them.
+	fixture, err := fs.Sub(testDataFS, "testdata/root/v2")
+	require.NoError(t, err)
+	root := t.TempDir()
+	require.NoError(t, extractTestData(fixture, root))
+
+	cgroupDir := filepath.Join(root, "sys", "fs", "cgroup")
+	realDir := filepath.Join(root, "run", "cgroup")
+	require.NoError(t, os.MkdirAll(filepath.Dir(realDir), 0o755))
+	require.NoError(t, os.Rename(cgroupDir, realDir))
+	require.NoError(t, os.Symlink(filepath.Join("..", "..", "run", "cgroup"), cgroupDir))
+	require.NoError(t, os.Rename(filepath.Join(realDir, "cpu.max"), filepath.Join(realDir, "cpu.max.real")))
+	require.NoError(t, os.Symlink("cpu.max.real", filepath.Join(realDir, "cpu.max")))
+
+	procDir := filepath.Join(root, "proc")
+	require.NoError(t, os.Rename(filepath.Join(procDir, "self"), filepath.Join(procDir, "1234")))
+	require.NoError(t, os.Symlink("1234", filepath.Join(procDir, "self")))
+
+	src := Source{Root: root}
+	isV2, err := src.IsCGroupV2()
+	assert.True(t, isV2)
+	assert.NoError(t, err)
+
+	cgroup, err := src.NewUnifiedCGroupForCurrentProcess()
+	require.NoError(t, err)
+	assert.True(t, cgroup.HasCPUQuotaV2())
+
+	quota, defined, err := src.CPUQuotaV2()
+	assert.Equal(t, 3.0, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+
+	limit, defined, err := src.MemoryLimitV2()
+	assert.Equal(t, int64(1073741824), limit)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+}
+
+// writeRoot creates the given files, keyed by their path relative to root.
+func writeRoot(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func TestCGroupsUnderRootSystemdEscaped(t *testing.T) {
+	// systemd escapes "-" in unit names as "\x2d". /proc/self/cgroup shows
+	// the path as is, while mountinfo escapes its backslash as "\134", so
+	// that only the octal escape must be undone to match both. Such names
+	// can't be embedded, so the layouts are written at run time.
+	const unit = `app\x2dworker.service`
+
+	t.Run("v1", func(t *testing.T) {
+		root := t.TempDir()
+		writeRoot(t, root, map[string]string{
+			"proc/self/mountinfo": `7 5 0:6 /system.slice/app\134x2dworker.service /sys/fs/cgroup/cpu,cpuacct rw,nosuid,nodev,noexec,relatime shared:7 - cgroup cgroup rw,cpu,cpuacct` + "\n",
+			"proc/self/cgroup":    `2:cpu,cpuacct:/system.slice/` + unit + `/sub\x2dgroup` + "\n",
+			`sys/fs/cgroup/cpu,cpuacct/sub\x2dgroup/cpu.cfs_quota_us`:  "150000\n",
+			`sys/fs/cgroup/cpu,cpuacct/sub\x2dgroup/cpu.cfs_period_us`: "100000\n",
+		})
+
+		cgroups, err := Source{Root: root}.NewCGroupsForCurrentProcess()
+		require.NoError(t, err)
+		assert.Equal(t, `/sys/fs/cgroup/cpu,cpuacct/sub\x2dgroup`, cgroups[_cgroupSubsysCPU].Path())
+
+		quota, defined, err := cgroups.CPUQuota()
+		assert.Equal(t, 1.5, quota)
+		assert.True(t, defined)
+		assert.NoError(t, err)
+	})
+
+	t.Run("v2", func(t *testing.T) {
+		root := t.TempDir()
+		writeRoot(t, root, map[string]string{
+			"proc/self/mountinfo": "34 33 0:29 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:10 - cgroup2 cgroup rw,nsdelegate\n",
+			"proc/self/cgroup":    "0::/system.slice/" + unit + "\n",
+			"sys/fs/cgroup/system.slice/" + unit + "/cpu.max": "250000 100000\n",
+		})
+
+		src := Source{Root: root}
+		cgroup, err := src.NewUnifiedCGroupForCurrentProcess()
+		require.NoError(t, err)
+		assert.Equal(t, "/sys/fs/cgroup/system.slice/"+unit, cgroup.Path())
+
+		quota, defined, err := src.CPUQuotaV2()
+		assert.Equal(t, 2.5, quota)
+		assert.True(t, defined)
+		assert.NoError(t, err)
+	})
+}
+
+func TestCGroupsUnderRootV2RootCGroup(t *testing.T) {
+	// The root cgroup of the unified hierarchy has no cpu.max file, since
+	// it can't be limited.
+	src := Source{Root: filepath.Join(testDataPath, "root", "v2-root-cgroup")}
+
+	cgroup, err := src.NewUnifiedCGroupForCurrentProcess()
+	require.NoError(t, err)
+	assert.Equal(t, "/sys/fs/cgroup", cgroup.Path())
+	assert.False(t, cgroup.HasCPUQuotaV2())
+
+	quota, defined, err := src.CPUQuotaV2()
+	assert.Equal(t, -1.0, quota)
+	assert.False(t, defined)
+	assert.NoError(t, err)
+}
+
+func TestCGroupsUnderRootSystemdUserService(t *testing.T) {
+	// A service started with `systemctl --user` runs below the user@.service
+	// manager, which doesn't enable the cpu controller for its children: the
+	// quota is the one of the manager, not of the user slice or of the login
+	// session.
+	src := Source{Root: filepath.Join(testDataPath, "root", "systemd-user")}
+
+	cgroup, err := src.NewUnifiedCGroupForCurrentProcess()
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(cgroup.Path(), "/user@1000.service/app.slice/app-editor.service"), cgroup.Path())
+	assert.True(t, cgroup.HasCPUQuotaV2())
+
+	quota, defined, err := src.CPUQuotaV2()
+	assert.Equal(t, 2.0, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+
+	manager := cgroup.parent().parent()
+	assert.True(t, strings.HasSuffix(manager.Path(), "/user@1000.service"), manager.Path())
+	assert.Equal(t, manager.Path(), cgroup.cpuMaxCGroup().Path())
+}
+
 func TestCGroupsCPUQuotaV2(t *testing.T) {
 	testTable := []struct {
 		name            string
@@ -196,7 +886,49 @@ func TestCGroupsCPUQuotaV2(t *testing.T) {
 		},
 		{
 			name:            "only-max",
-			expectedQuota:   5.0,
+			expectedQuota:   -1.0,
+			expectedDefined: false,
+			shouldHaveError: false,
+		},
+		{
+			name:            "max-with-period",
+			expectedQuota:   -1.0,
+			expectedDefined: false,
+			shouldHaveError: false,
+		},
+		{
+			name:            "trailing-space",
+			expectedQuota:   1.5,
+			expectedDefined: true,
+			shouldHaveError: false,
+		},
+		{
+			name:            "three-fields",
+			expectedQuota:   -1.0,
+			expectedDefined: false,
+			shouldHaveError: true,
+		},
+		{
+			name:            "single-number",
+			expectedQuota:   -1.0,
+			expectedDefined: false,
+			shouldHaveError: true,
+		},
+		{
+			name:            "period-25000",
+			expectedQuota:   2.0,
+			expectedDefined: true,
+			shouldHaveError: false,
+		},
+		{
+			name:            "period-10000",
+			expectedQuota:   2.5,
+			expectedDefined: true,
+			shouldHaveError: false,
+		},
+		{
+			name:            "period-50000",
+			expectedQuota:   0.5,
 			expectedDefined: true,
 			shouldHaveError: false,
 		},
@@ -212,16 +944,46 @@ func TestCGroupsCPUQuotaV2(t *testing.T) {
 			expectedDefined: false,
 			shouldHaveError: true,
 		},
+		{
+			name:            "zero-period",
+			expectedQuota:   -1.0,
+			expectedDefined: false,
+			shouldHaveError: true,
+		},
+		{
+			name:            "negative-period",
+			expectedQuota:   -1.0,
+			expectedDefined: false,
+			shouldHaveError: true,
+		},
+		{
+			name:            "negative-max",
+			expectedQuota:   -1.0,
+			expectedDefined: false,
+			shouldHaveError: true,
+		},
+		{
+			name:            "zero-max",
+			expectedQuota:   -1.0,
+			expectedDefined: false,
+			shouldHaveError: true,
+		},
+		{
+			name:            "large",
+			expectedQuota:   9007208263.0,
+			expectedDefined: true,
+			shouldHaveError: false,
+		},
 	}
 
-	quota, defined, err := cpuQuotaV2("nonexistent", "nonexistent")
+	quota, defined, err := Source{}.cpuQuotaV2("nonexistent", "nonexistent")
 	assert.Equal(t, -1.0, quota, "nonexistent")
 	assert.Equal(t, false, defined, "nonexistent")
 	assert.NoError(t, err, "nonexistent")
 
 	cgroupPath := filepath.Join(testDataCGroupsPath, "v2")
 	for _, tt := range testTable {
-		quota, defined, err := cpuQuotaV2(cgroupPath, tt.name)
+		quota, defined, err := Source{}.cpuQuotaV2(cgroupPath, tt.name)
 		assert.Equal(t, tt.expectedQuota, quota, tt.name)
 		assert.Equal(t, tt.expectedDefined, defined, tt.name)
 
@@ -231,4 +993,200 @@ func TestCGroupsCPUQuotaV2(t *testing.T) {
 			assert.NoError(t, err, tt.name)
 		}
 	}
+
+	_, _, err = Source{}.cpuQuotaV2(cgroupPath, "three-fields")
+	assert.EqualError(t, err, `invalid format for cpu.max: "150000 100000 1", expected "<quota> <period>" or "max <period>"`)
+}
+
+func TestNewCGroupsWantControllers(t *testing.T) {
+	mountInfo := filepath.Join(testDataProcPath, "many-controllers", "mountinfo")
+	cgroup := filepath.Join(testDataProcPath, "many-controllers", "cgroup")
+
+	all, err := Source{}.NewCGroups(mountInfo, cgroup)
+	require.NoError(t, err)
+	assert.Len(t, all, 14)
+
+	wanted, err := Source{}.WantControllers(DefaultControllers).NewCGroups(mountInfo, cgroup)
+	require.NoError(t, err)
+	paths := make(map[string]string)
+	for name, cgroup := range wanted {
+		paths[name] = cgroup.Path()
+	}
+	assert.Equal(t, map[string]string{
+		"cpu":     "/sys/fs/cgroup/cpu,cpuacct",
+		"cpuacct": "/sys/fs/cgroup/cpu,cpuacct",
+		"cpuset":  "/sys/fs/cgroup/cpuset",
+		"memory":  "/sys/fs/cgroup/memory",
+	}, paths)
+
+	none, err := Source{}.WantControllers([]string{}).NewCGroups(mountInfo, cgroup)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	unified, err := Source{}.WantControllers([]string{}).NewUnifiedCGroup(mountInfo, cgroup)
+	require.NoError(t, err)
+	require.NotNil(t, unified, "the unified hierarchy shouldn't be filtered out")
+	assert.Equal(t, "/sys/fs/cgroup/unified/docker", unified.Path())
+}
+
+func BenchmarkNewCGroups(b *testing.B) {
+	mountInfo := filepath.Join(testDataProcPath, "many-controllers", "mountinfo")
+	cgroup := filepath.Join(testDataProcPath, "many-controllers", "cgroup")
+
+	for _, bb := range []struct {
+		name string
+		src  Source
+	}{
+		{name: "all", src: Source{}},
+		{name: "default-controllers", src: Source{}.WantControllers(DefaultControllers)},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := bb.src.NewCGroups(mountInfo, cgroup); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCPUQuotaFromFile(t *testing.T) {
+	testTable := []struct {
+		name            string
+		content         string
+		expectedQuota   float64
+		expectedDefined bool
+		shouldHaveError bool
+	}{
+		{name: "set", content: "250000 100000\n", expectedQuota: 2.5, expectedDefined: true},
+		{name: "no-newline", content: "200000 100000", expectedQuota: 2, expectedDefined: true},
+		{name: "max", content: "max 100000\n", expectedQuota: -1},
+		{name: "no-period", content: "250000\n", expectedQuota: -1, shouldHaveError: true},
+		{name: "max-no-period", content: "max\n", expectedQuota: -1, shouldHaveError: true},
+		{name: "empty", content: "", expectedQuota: -1, shouldHaveError: true},
+		{name: "extra-field", content: "250000 100000 1\n", expectedQuota: -1, shouldHaveError: true},
+		{name: "two-lines", content: "250000\n100000\n", expectedQuota: -1, shouldHaveError: true},
+		{name: "invalid-quota", content: "abc 100000\n", expectedQuota: -1, shouldHaveError: true},
+		{name: "negative-quota", content: "-1 100000\n", expectedQuota: -1, shouldHaveError: true},
+		{name: "zero-period", content: "250000 0\n", expectedQuota: -1, shouldHaveError: true},
+		{name: "negative-period", content: "200000 -100000\n", expectedQuota: -1, shouldHaveError: true},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range testTable {
+		path := filepath.Join(dir, tt.name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(tt.content), 0o644), tt.name)
+
+		quota, defined, err := Source{}.CPUQuotaFromFile(path)
+		assert.Equal(t, tt.expectedQuota, quota, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+
+	_, _, err := Source{}.CPUQuotaFromFile(filepath.Join(dir, "nonexistent"))
+	assert.Error(t, err, "missing file")
+
+	_, _, err = Source{}.CPUQuotaFromFile(filepath.Join(dir, "no-period"))
+	assert.EqualError(t, err, `invalid format for cpu.max: "250000", expected "<quota> <period>" or "max <period>"`)
+}
+
+func TestCPUQuotaFromCGroup(t *testing.T) {
+	v2 := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(v2, "cpu.max"), []byte("150000 100000\n"), 0o644))
+	v2Max := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(v2Max, "cpu.max"), []byte("max 100000\n"), 0o644))
+
+	testTable := []struct {
+		name            string
+		path            string
+		expectedQuota   float64
+		expectedDefined bool
+		expectedError   string
+	}{
+		{name: "v2", path: v2, expectedQuota: 1.5, expectedDefined: true},
+		{name: "v2-max", path: v2Max, expectedQuota: -1},
+		{name: "v1", path: filepath.Join(testDataCGroupsPath, "cpu"), expectedQuota: 6, expectedDefined: true},
+		{name: "v1-undefined", path: filepath.Join(testDataCGroupsPath, "undefined"), expectedQuota: -1},
+		{
+			name:          "neither",
+			path:          filepath.Join(testDataCGroupsPath, "v2"),
+			expectedQuota: -1,
+			expectedError: fmt.Sprintf("cgroup directory %q has neither cpu.max nor cpu.cfs_quota_us", filepath.Join(testDataCGroupsPath, "v2")),
+		},
+	}
+
+	for _, tt := range testTable {
+		quota, defined, err := Source{}.CPUQuotaFromCGroup(tt.path)
+		assert.Equal(t, tt.expectedQuota, quota, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+		if tt.expectedError != "" {
+			assert.EqualError(t, err, tt.expectedError, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
+
+func TestCGroupEffectiveCPUQuotaV2(t *testing.T) {
+	// v2-delegated has a leaf cpu.max of max under a pod slice limited to 2
+	// CPUs, itself under a slice limited to 4 CPUs.
+	src := Source{Root: filepath.Join(testDataPath, "root", "v2-delegated")}
+	cgroup, err := src.NewUnifiedCGroupForCurrentProcess()
+	require.NoError(t, err)
+
+	quota, defined, err := cgroup.CPUQuotaV2()
+	require.NoError(t, err)
+	assert.False(t, defined, "the leaf alone has no quota")
+	assert.Equal(t, -1.0, quota)
+
+	quota, defined, err = cgroup.EffectiveCPUQuotaV2()
+	require.NoError(t, err)
+	assert.True(t, defined)
+	assert.Equal(t, 2.0, quota, "should pick the most restrictive ancestor")
+
+	cgroup, err = Source{Root: filepath.Join(testDataPath, "root", "v2")}.NewUnifiedCGroupForCurrentProcess()
+	require.NoError(t, err)
+	quota, defined, err = cgroup.EffectiveCPUQuotaV2()
+	require.NoError(t, err)
+	assert.True(t, defined)
+	assert.Equal(t, 3.0, quota, "a single level should match CPUQuotaV2")
+}
+
+func TestCGroupEffectiveCPUQuotaV2Unreadable(t *testing.T) {
+	defer func(f func(string) ([]byte, error)) { _readFile = f }(_readFile)
+
+	// cpu-nsdelegate-v2 has a leaf cpu.max of max under a slice limited to
+	// 2 CPUs, and no cpu.max at the root of the hierarchy.
+	src := Source{Root: filepath.Join(testDataPath, "root", "cpu-nsdelegate-v2")}
+	cgroup, err := src.NewUnifiedCGroupForCurrentProcess()
+	require.NoError(t, err)
+
+	quota, defined, err := cgroup.EffectiveCPUQuotaV2()
+	require.NoError(t, err, "a missing cpu.max shouldn't fail the walk")
+	assert.True(t, defined)
+	assert.Equal(t, 2.0, quota)
+
+	deny := func(name string) {
+		_readFile = func(path string) ([]byte, error) {
+			if strings.HasSuffix(path, name) {
+				return nil, &os.PathError{Op: "open", Path: path, Err: fs.ErrPermission}
+			}
+			return ioutil.ReadFile(path)
+		}
+	}
+
+	deny(filepath.Join("user.slice", _cgroupv2CPUMax))
+	quota, defined, err = cgroup.EffectiveCPUQuotaV2()
+	require.NoError(t, err, "an unreadable ancestor should end the walk")
+	assert.False(t, defined)
+	assert.Equal(t, -1.0, quota)
+
+	deny(filepath.Join("container", _cgroupv2CPUMax))
+	_, _, err = cgroup.EffectiveCPUQuotaV2()
+	assert.Error(t, err, "an unreadable leaf should fail")
 }
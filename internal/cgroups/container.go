@@ -0,0 +1,68 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import "regexp"
+
+// _containerIDPattern matches the 64 hex digit container IDs used by Docker,
+// containerd, CRI-O and Podman, with or without a runtime prefix such as
+// `docker-<id>.scope` or `cri-containerd:<id>`.
+var _containerIDPattern = regexp.MustCompile(`(?:^|[^0-9a-f])([0-9a-f]{64})(?:[^0-9a-f]|$)`)
+
+// ContainerID parses the ID of the container from a cgroup path. If the path
+// contains several IDs, the innermost one is returned. The second return
+// value is false if the path has no recognizable container ID.
+func ContainerID(cgroupPath string) (string, bool) {
+	matches := _containerIDPattern.FindAllStringSubmatch(cgroupPath, -1)
+	if len(matches) == 0 {
+		return "", false
+	}
+	return matches[len(matches)-1][1], true
+}
+
+// ContainerIDForCurrentProcess returns the ID of the container the current
+// process runs in, parsed from `/proc/self/cgroup` read from s. The cpu controller's path is preferred, then the cgroup2 path, and
+// then any other controller's. It returns an empty string if none of them
+// contain a recognizable container ID.
+func (s Source) ContainerIDForCurrentProcess() (string, error) {
+	return s.containerIDFromCGroupFile(s.procPath(_procPathCGroup))
+}
+
+func (s Source) containerIDFromCGroupFile(procPathCGroup string) (string, error) {
+	subsystems, err := s.parseCGroupSubsystems(procPathCGroup)
+	if err != nil {
+		return "", err
+	}
+
+	for _, name := range []string{_cgroupSubsysCPU, ""} {
+		if subsys, exists := subsystems[name]; exists {
+			if id, ok := ContainerID(subsys.Name); ok {
+				return id, nil
+			}
+		}
+	}
+	for _, subsys := range subsystems {
+		if id, ok := ContainerID(subsys.Name); ok {
+			return id, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerID(t *testing.T) {
+	const id = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	testTable := []struct {
+		name       string
+		path       string
+		expectedID string
+		expectedOK bool
+	}{
+		{
+			name:       "docker",
+			path:       "/docker/" + id,
+			expectedID: id,
+			expectedOK: true,
+		},
+		{
+			name:       "docker-scope",
+			path:       "/system.slice/docker-" + id + ".scope",
+			expectedID: id,
+			expectedOK: true,
+		},
+		{
+			name:       "cri-containerd",
+			path:       "/system.slice/containerd.service/kubepods-besteffort-podb41662f7_b03a_4c65_8ef9_6e4e55c3cf27.slice:cri-containerd:" + id,
+			expectedID: id,
+			expectedOK: true,
+		},
+		{
+			name:       "nested",
+			path:       "/docker/fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210/docker/" + id,
+			expectedID: id,
+			expectedOK: true,
+		},
+		{
+			name:       "too-short",
+			path:       "/docker/0123456789abcdef",
+			expectedOK: false,
+		},
+		{
+			name:       "too-long",
+			path:       "/docker/" + id + "0",
+			expectedOK: false,
+		},
+		{
+			name:       "root",
+			path:       "/",
+			expectedOK: false,
+		},
+		{
+			name:       "systemd-user",
+			path:       "/user.slice/user-1000.slice/session-2.scope",
+			expectedOK: false,
+		},
+	}
+
+	for _, tt := range testTable {
+		containerID, ok := ContainerID(tt.path)
+		assert.Equal(t, tt.expectedID, containerID, tt.name)
+		assert.Equal(t, tt.expectedOK, ok, tt.name)
+	}
+}
+
+func TestContainerIDFromCGroupFile(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedID      string
+		shouldHaveError bool
+	}{
+		{
+			name:       "container",
+			expectedID: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		},
+		{
+			name:       "container-v2",
+			expectedID: "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210",
+		},
+		{
+			name:       "cgroups",
+			expectedID: "",
+		},
+		{
+			name:            "nonexistent",
+			shouldHaveError: true,
+		},
+	}
+
+	for _, tt := range testTable {
+		cgroupPath := filepath.Join(testDataProcPath, tt.name, "cgroup")
+		containerID, err := Source{}.containerIDFromCGroupFile(cgroupPath)
+		assert.Equal(t, tt.expectedID, containerID, tt.name)
+
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+
+	containerID, err := Source{Root: filepath.Join(testDataPath, "root", "v1")}.ContainerIDForCurrentProcess()
+	assert.Equal(t, "", containerID, "v1 root")
+	assert.NoError(t, err, "v1 root")
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// _cgroupCPUSetCPUsParam is the file name for the CGroup cpuset CPUs
+	// parameter.
+	_cgroupCPUSetCPUsParam = "cpuset.cpus"
+	// _cgroupv2CPUSetCPUsEffective is the file name for the CGroup-V2 CPUs
+	// the cgroup is actually allowed to run on.
+	_cgroupv2CPUSetCPUsEffective = "cpuset.cpus.effective"
+	// _sysPathOnlineCPUs is the sysfs file listing the CPUs online on the
+	// system.
+	_sysPathOnlineCPUs = "/sys/devices/system/cpu/online"
+
+	_cpuListSep      = ","
+	_cpuListRangeSep = "-"
+)
+
+// HasCPUSetController returns true if the cpuset cgroup controller is
+// mounted on a v1 hierarchy.
+func (cg CGroups) HasCPUSetController() bool {
+	_, exists := cg[_cgroupSubsysCPUSet]
+	return exists
+}
+
+// CPUSetCPUs returns the number of CPUs in the `cpuset.cpus` file of the
+// cpuset cgroup controller. An empty file means the cgroup uses the CPUs of
+// its parent, so the closest ancestor with a non-empty file is used instead.
+// If the controller isn't mounted, the file doesn't exist or every ancestor
+// is empty, the method returns `(-1, false, nil)`.
+func (cg CGroups) CPUSetCPUs() (int, bool, error) {
+	cpusetCGroup, exists := cg[_cgroupSubsysCPUSet]
+	if !exists {
+		return -1, false, nil
+	}
+	return cpusetCGroup.cpuSetCPUs(_cgroupCPUSetCPUsParam)
+}
+
+// CPUSetCPUsV2 returns the number of CPUs in the `cpuset.cpus.effective`
+// file of the cgroup2 directory of the current process. See
+// CGroup.CPUSetCPUsV2 for details.
+func (s Source) CPUSetCPUsV2() (int, bool, error) {
+	cgroup, err := s.NewUnifiedCGroupForCurrentProcess()
+	if cgroup == nil || err != nil {
+		return -1, false, err
+	}
+	return cgroup.CPUSetCPUsV2()
+}
+
+// CPUSetCPUsV2 returns the number of CPUs in the `cpuset.cpus.effective`
+// file of a cgroup2 directory. Like CGroups.CPUSetCPUs, an empty file is
+// resolved through the ancestors of the directory. If the cpuset controller
+// isn't enabled for the directory, the file doesn't exist and the method
+// returns `(-1, false, nil)`.
+func (cg *CGroup) CPUSetCPUsV2() (int, bool, error) {
+	return cg.cpuSetCPUs(_cgroupv2CPUSetCPUsEffective)
+}
+
+// cpuSetCPUs counts the CPUs listed in param, walking up to the parent of
+// each cgroup whose file is empty. The walk stops without an error at an
+// ancestor whose file is missing or can't be read, as is the case above the
+// delegation boundary of a hierarchy mounted with nsdelegate.
+func (cg *CGroup) cpuSetCPUs(param string) (int, bool, error) {
+	for c := cg; c != nil; c = c.parent() {
+		content, err := c.ReadFile(param)
+		text := string(content)
+		if err == nil && strings.TrimSpace(text) == "" {
+			continue
+		}
+		if err != nil {
+			if os.IsNotExist(err) || (c != cg && os.IsPermission(err)) {
+				return -1, false, nil
+			}
+			return -1, false, err
+		}
+
+		cpus, err := parseCPUList(text)
+		if err != nil {
+			return -1, false, err
+		}
+		return cpus, true, nil
+	}
+	return -1, false, nil
+}
+
+// OnlineCPUs returns the number of CPUs online on the system, which unlike
+// the cpuset isn't restricted by the cgroup of the current process. If the
+// sysfs file listing them doesn't exist, the method returns
+// `(-1, false, nil)`.
+func (s Source) OnlineCPUs() (int, bool, error) {
+	content, err := s.ReadFile(_sysPathOnlineCPUs)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return -1, false, nil
+		}
+		return -1, false, err
+	}
+	cpus, err := parseCPUList(string(content))
+	if err != nil {
+		return -1, false, err
+	}
+	return cpus, true, nil
+}
+
+// parseCPUList returns the number of CPUs in a list such as `0-2,5,7-8`, in
+// the format of cpuset(7). Whitespace around the ranges is ignored, and
+// ranges may also be separated by newlines, as some kernels format the list
+// that way. A trailing comma is ignored too, but not an empty range between
+// two commas.
+func parseCPUList(list string) (int, error) {
+	cpus := 0
+	segments := strings.Split(strings.TrimSpace(list), _cpuListSep)
+	for i, segment := range segments {
+		ranges := strings.Fields(segment)
+		if len(ranges) == 0 && (i < len(segments)-1 || i == 0) {
+			return 0, cpuListFormatInvalidError{list}
+		}
+		for _, r := range ranges {
+			n, err := countCPURange(r)
+			if err != nil {
+				return 0, cpuListFormatInvalidError{list}
+			}
+			cpus += n
+		}
+	}
+	return cpus, nil
+}
+
+// countCPURange returns the number of CPUs in a range such as `0-2` or `5`.
+func countCPURange(r string) (int, error) {
+	bounds := strings.SplitN(r, _cpuListRangeSep, 2)
+	first, err := strconv.Atoi(bounds[0])
+	if err != nil || first < 0 {
+		return 0, cpuListFormatInvalidError{r}
+	}
+	last := first
+	if len(bounds) == 2 {
+		last, err = strconv.Atoi(bounds[1])
+		if err != nil || last < first {
+			return 0, cpuListFormatInvalidError{r}
+		}
+	}
+	return last - first + 1, nil
+}
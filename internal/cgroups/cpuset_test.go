@@ -0,0 +1,214 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCPUList(t *testing.T) {
+	testTable := []struct {
+		list            string
+		expectedCPUs    int
+		shouldHaveError bool
+	}{
+		{list: "0", expectedCPUs: 1},
+		{list: "3", expectedCPUs: 1},
+		{list: "0-3", expectedCPUs: 4},
+		{list: "0-2,5", expectedCPUs: 4},
+		{list: "0-2,5,7-8", expectedCPUs: 6},
+		{list: "0-2,5\n", expectedCPUs: 4},
+		{list: "0-1, 2 , 4\n", expectedCPUs: 4},
+		{list: " 0-3 ", expectedCPUs: 4},
+		{list: "0-3,", expectedCPUs: 4},
+		{list: "0-3,\n", expectedCPUs: 4},
+		{list: "0-1,\n2-3\n6\n", expectedCPUs: 5},
+		{list: "0-1\t4", expectedCPUs: 3},
+		{list: "", shouldHaveError: true},
+		{list: "a", shouldHaveError: true},
+		{list: "0-", shouldHaveError: true},
+		{list: "3-1", shouldHaveError: true},
+		{list: "-1", shouldHaveError: true},
+		{list: "0,,1", shouldHaveError: true},
+		{list: ",", shouldHaveError: true},
+		{list: ",0", shouldHaveError: true},
+		{list: "0 - 3", shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		cpus, err := parseCPUList(tt.list)
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.list)
+			continue
+		}
+		assert.NoError(t, err, tt.list)
+		assert.Equal(t, tt.expectedCPUs, cpus, tt.list)
+	}
+}
+
+func TestCGroupCPUSetCPUsWhitespace(t *testing.T) {
+	testTable := []struct {
+		name         string
+		expectedCPUs int
+	}{
+		{name: "cpuset-spaces", expectedCPUs: 4},
+		{name: "cpuset-trailing-comma", expectedCPUs: 4},
+		{name: "cpuset-multiline", expectedCPUs: 5},
+	}
+
+	for _, tt := range testTable {
+		cgroup := NewCGroup(filepath.Join(testDataCGroupsPath, tt.name))
+		cpus, defined, err := cgroup.cpuSetCPUs(_cgroupCPUSetCPUsParam)
+		assert.Equal(t, tt.expectedCPUs, cpus, tt.name)
+		assert.True(t, defined, tt.name)
+		assert.NoError(t, err, tt.name)
+	}
+}
+
+func TestCGroupsCPUSetCPUs(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedCPUs    int
+		expectedDefined bool
+	}{
+		{name: "cpuset-only", expectedCPUs: 4, expectedDefined: true},
+		{name: "cpuset-inherit", expectedCPUs: 5, expectedDefined: true},
+		{name: "v1", expectedCPUs: -1, expectedDefined: false},
+	}
+
+	for _, tt := range testTable {
+		src := Source{Root: filepath.Join(testDataPath, "root", tt.name)}
+		cgroups, err := src.NewCGroupsForCurrentProcess()
+		require.NoError(t, err, tt.name)
+		assert.True(t, cgroups.HasCPUSetController(), tt.name)
+
+		cpus, defined, err := cgroups.CPUSetCPUs()
+		assert.Equal(t, tt.expectedCPUs, cpus, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+		assert.NoError(t, err, tt.name)
+	}
+
+	cpus, defined, err := CGroups{}.CPUSetCPUs()
+	assert.Equal(t, -1, cpus, "no controller")
+	assert.False(t, defined, "no controller")
+	assert.NoError(t, err, "no controller")
+}
+
+func TestCGroupsCPUSetCPUsV2(t *testing.T) {
+	cpus, defined, err := Source{Root: filepath.Join(testDataPath, "root", "cpuset-inherit-v2")}.CPUSetCPUsV2()
+	assert.Equal(t, 2, cpus, "inherited")
+	assert.True(t, defined, "inherited")
+	assert.NoError(t, err, "inherited")
+
+	cpus, defined, err = Source{Root: filepath.Join(testDataPath, "root", "v2")}.CPUSetCPUsV2()
+	assert.Equal(t, -1, cpus, "no cpuset")
+	assert.False(t, defined, "no cpuset")
+	assert.NoError(t, err, "no cpuset")
+}
+
+func TestCPUSetCPUsEmptyHierarchy(t *testing.T) {
+	mountPoint := t.TempDir()
+	leaf := filepath.Join(mountPoint, "kubepods", "pod1")
+	require.NoError(t, os.MkdirAll(leaf, 0o755))
+	for _, dir := range []string{mountPoint, filepath.Dir(leaf), leaf} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, _cgroupCPUSetCPUsParam), nil, 0o644))
+	}
+
+	cpus, defined, err := Source{}.newMountedCGroup(mountPoint, leaf).cpuSetCPUs(_cgroupCPUSetCPUsParam)
+	assert.Equal(t, -1, cpus)
+	assert.False(t, defined, "an empty hierarchy shouldn't define a cpuset")
+	assert.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(leaf, _cgroupCPUSetCPUsParam), []byte("0-1,x\n"), 0o644))
+	_, _, err = Source{}.newMountedCGroup(mountPoint, leaf).cpuSetCPUs(_cgroupCPUSetCPUsParam)
+	assert.Error(t, err, "an invalid list should be reported")
+}
+
+func TestCGroupParent(t *testing.T) {
+	cg := Source{}.newMountedCGroup("/sys/fs/cgroup/cpuset", "/sys/fs/cgroup/cpuset/kubepods/pod1")
+
+	var paths []string
+	for c := cg; c != nil; c = c.parent() {
+		paths = append(paths, c.Path())
+	}
+	assert.Equal(t, []string{
+		"/sys/fs/cgroup/cpuset/kubepods/pod1",
+		"/sys/fs/cgroup/cpuset/kubepods",
+		"/sys/fs/cgroup/cpuset",
+	}, paths)
+
+	assert.Nil(t, NewCGroup("/sys/fs/cgroup/cpuset/kubepods").parent(), "unknown mount point")
+}
+
+func TestCPUSetCPUsNSDelegate(t *testing.T) {
+	// Above the delegation boundary, the root of the hierarchy doesn't
+	// expose cpuset.cpus.effective to the namespace.
+	cpus, defined, err := Source{Root: filepath.Join(testDataPath, "root", "cpuset-nsdelegate-v2")}.CPUSetCPUsV2()
+	assert.Equal(t, -1, cpus)
+	assert.False(t, defined)
+	assert.NoError(t, err)
+}
+
+func TestCPUSetCPUsUnreadableAncestor(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("file permissions don't apply to root")
+	}
+
+	mountPoint := t.TempDir()
+	leaf := filepath.Join(mountPoint, "delegated")
+	require.NoError(t, os.MkdirAll(leaf, 0o755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(leaf, _cgroupCPUSetCPUsParam), nil, 0o644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(mountPoint, _cgroupCPUSetCPUsParam), []byte("0-3\n"), 0o000))
+
+	cpus, defined, err := Source{}.newMountedCGroup(mountPoint, leaf).cpuSetCPUs(_cgroupCPUSetCPUsParam)
+	assert.Equal(t, -1, cpus)
+	assert.False(t, defined, "an unreadable ancestor should stop the walk")
+	assert.NoError(t, err, "an unreadable ancestor shouldn't fail the walk")
+
+	require.NoError(t, os.Chmod(filepath.Join(mountPoint, _cgroupCPUSetCPUsParam), 0o644))
+	require.NoError(t, os.Chmod(filepath.Join(leaf, _cgroupCPUSetCPUsParam), 0o000))
+	_, _, err = Source{}.newMountedCGroup(mountPoint, leaf).cpuSetCPUs(_cgroupCPUSetCPUsParam)
+	assert.Error(t, err, "an unreadable leaf should be reported")
+}
+
+func TestOnlineCPUs(t *testing.T) {
+	cpus, defined, err := Source{Root: filepath.Join(testDataPath, "root", "cpuset-full-host-v2")}.OnlineCPUs()
+	assert.Equal(t, 8, cpus)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+
+	cpus, defined, err = Source{Root: filepath.Join(testDataPath, "root", "v2")}.OnlineCPUs()
+	assert.Equal(t, -1, cpus)
+	assert.False(t, defined, "a missing file should leave the count undefined")
+	assert.NoError(t, err)
+
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "sys", "devices", "system", "cpu"), 0o755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "sys", "devices", "system", "cpu", "online"), []byte("a\n"), 0o644))
+	_, _, err = Source{Root: root}.OnlineCPUs()
+	assert.Error(t, err, "an invalid list should be reported")
+}
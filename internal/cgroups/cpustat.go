@@ -0,0 +1,167 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// _cgroupCPUAcctUsageParam is the file name for the total CPU time, in
+	// nanoseconds, consumed by the tasks of a v1 cpuacct cgroup.
+	_cgroupCPUAcctUsageParam = "cpuacct.usage"
+	// _cgroupv2CPUStat is the file name for the CGroup-V2 CPU statistics.
+	_cgroupv2CPUStat = "cpu.stat"
+	// _cgroupv2CPUStatUsageUsec is the key of the total CPU time, in
+	// microseconds, in cpu.stat.
+	_cgroupv2CPUStatUsageUsec = "usage_usec"
+
+	_cpuStatNrPeriods     = "nr_periods"
+	_cpuStatNrThrottled   = "nr_throttled"
+	_cpuStatThrottledTime = "throttled_time"
+	_cpuStatThrottledUsec = "throttled_usec"
+)
+
+// CPUStat holds the CFS throttling statistics of a cpu.stat file.
+type CPUStat struct {
+	// NrPeriods is the number of enforcement periods that have elapsed.
+	NrPeriods int64
+	// NrThrottled is the number of periods in which the cgroup was
+	// throttled.
+	NrThrottled int64
+	// ThrottledTime is the total time the tasks of the cgroup were
+	// throttled for.
+	ThrottledTime time.Duration
+}
+
+// ParseCPUStat parses the content of a cpu.stat file read from r, either
+// from cgroup v1, which reports the throttled time in nanoseconds as
+// throttled_time, or from cgroup2, which reports it in microseconds as
+// throttled_usec. Keys that aren't known are ignored, and missing ones are
+// reported as zero.
+func ParseCPUStat(r io.Reader) (CPUStat, error) {
+	var stat CPUStat
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return CPUStat{}, cpuStatFormatInvalidError{scanner.Text()}
+		}
+
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		switch fields[0] {
+		case _cpuStatNrPeriods:
+			stat.NrPeriods = value
+		case _cpuStatNrThrottled:
+			stat.NrThrottled = value
+		case _cpuStatThrottledTime:
+			stat.ThrottledTime = time.Duration(value)
+		case _cpuStatThrottledUsec:
+			stat.ThrottledTime = time.Duration(value) * time.Microsecond
+		default:
+			continue
+		}
+		if err != nil {
+			return CPUStat{}, cpuStatFormatInvalidError{scanner.Text()}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return CPUStat{}, err
+	}
+	return stat, nil
+}
+
+// CPUUsage returns the total CPU time consumed by the tasks of the cpuacct
+// cgroup, read from `cpuacct.usage`. If the cpuacct controller isn't
+// mounted, the method returns `(0, false, nil)`.
+func (cg CGroups) CPUUsage() (time.Duration, bool, error) {
+	cpuAcctCGroup, exists := cg[_cgroupSubsysCPUAcct]
+	if !exists {
+		return 0, false, nil
+	}
+
+	text, err := cpuAcctCGroup.readFirstLine(_cgroupCPUAcctUsageParam)
+	if err != nil {
+		return 0, false, err
+	}
+	usageNs, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return time.Duration(usageNs), true, nil
+}
+
+// CPUUsageV2 returns the total CPU time consumed by the tasks of the cgroup2
+// directory of the current process. See CGroup.CPUUsageV2.
+func (s Source) CPUUsageV2() (time.Duration, bool, error) {
+	cgroup, err := s.NewUnifiedCGroupForCurrentProcess()
+	if cgroup == nil || err != nil {
+		return 0, false, err
+	}
+	return cgroup.CPUUsageV2()
+}
+
+// CPUUsageV2 returns the total CPU time consumed by the tasks of a cgroup2
+// directory, read from the usage_usec key of its cpu.stat file. If cpu.stat
+// doesn't exist, the method returns `(0, false, nil)`.
+func (cg *CGroup) CPUUsageV2() (time.Duration, bool, error) {
+	cpuStat, err := cg.src.open(cg.ParamPath(_cgroupv2CPUStat))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	usageUsec, err := readCPUStatKey(cpuStat, _cgroupv2CPUStatUsageUsec)
+	if err != nil {
+		return 0, false, err
+	}
+	return time.Duration(usageUsec) * time.Microsecond, true, nil
+}
+
+// readCPUStatKey returns the value of key in r, which holds one "<key>
+// <value>" pair per line as cpu.stat does.
+func readCPUStatKey(r io.Reader, key string) (int64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			return 0, cpuStatFormatInvalidError{scanner.Text()}
+		}
+		if fields[0] != key {
+			continue
+		}
+		return strconv.ParseInt(fields[1], 10, 64)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, cpuStatKeyNotFoundError{key}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCGroupsCPUUsage(t *testing.T) {
+	cgroups := make(CGroups)
+
+	usage, defined, err := cgroups.CPUUsage()
+	assert.Equal(t, time.Duration(0), usage, "nonexistent")
+	assert.False(t, defined, "nonexistent")
+	assert.NoError(t, err, "nonexistent")
+
+	cgroups[_cgroupSubsysCPUAcct] = NewCGroup(filepath.Join(testDataCGroupsPath, "cpuacct"))
+	usage, defined, err = cgroups.CPUUsage()
+	assert.Equal(t, 123456789*time.Microsecond, usage, "cpuacct")
+	assert.True(t, defined, "cpuacct")
+	assert.NoError(t, err, "cpuacct")
+
+	cgroups[_cgroupSubsysCPUAcct] = NewCGroup(filepath.Join(testDataCGroupsPath, "empty"))
+	_, defined, err = cgroups.CPUUsage()
+	assert.False(t, defined, "empty")
+	assert.Error(t, err, "empty")
+}
+
+func TestCGroupCPUUsageV2(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedUsage   time.Duration
+		expectedDefined bool
+		shouldHaveError bool
+	}{
+		{
+			name:            "cpu-stat-v2",
+			expectedUsage:   2500 * time.Millisecond,
+			expectedDefined: true,
+		},
+		{
+			name:            "cpu-stat-v2-invalid",
+			shouldHaveError: true,
+		},
+		{
+			name:            "cpu-stat-v2-missing",
+			shouldHaveError: true,
+		},
+		{
+			// cpu.stat doesn't exist.
+			name: "memory-v2",
+		},
+	}
+
+	for _, tt := range testTable {
+		usage, defined, err := NewCGroup(filepath.Join(testDataCGroupsPath, tt.name)).CPUUsageV2()
+		assert.Equal(t, tt.expectedUsage, usage, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
+
+func TestParseCPUStat(t *testing.T) {
+	testTable := []struct {
+		name            string
+		content         string
+		expectedStat    CPUStat
+		shouldHaveError bool
+	}{
+		{
+			name:         "v1",
+			content:      "nr_periods 120\nnr_throttled 30\nthrottled_time 4500000000\nnr_bursts 0\nburst_time 0\n",
+			expectedStat: CPUStat{NrPeriods: 120, NrThrottled: 30, ThrottledTime: 4500 * time.Millisecond},
+		},
+		{
+			name:         "v2",
+			content:      "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\nnr_periods 80\nnr_throttled 8\nthrottled_usec 250000\n",
+			expectedStat: CPUStat{NrPeriods: 80, NrThrottled: 8, ThrottledTime: 250 * time.Millisecond},
+		},
+		{
+			name:         "no-throttling-keys",
+			content:      "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n",
+			expectedStat: CPUStat{},
+		},
+		{name: "nothing", content: "", expectedStat: CPUStat{}},
+		{name: "missing-value", content: "nr_periods\n", shouldHaveError: true},
+		{name: "invalid-value", content: "nr_throttled many\n", shouldHaveError: true},
+		{name: "invalid-unknown-key", content: "usage_usec 1 2\n", shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		stat, err := ParseCPUStat(strings.NewReader(tt.content))
+		assert.Equal(t, tt.expectedStat, stat, tt.name)
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+
+	f, err := os.Open(filepath.Join(testDataCGroupsPath, "cpu-stat-v2", "cpu.stat"))
+	require.NoError(t, err)
+	defer f.Close()
+	stat, err := ParseCPUStat(f)
+	assert.NoError(t, err, "cpu-stat-v2")
+	assert.Equal(t, CPUStat{}, stat, "cpu-stat-v2 hasn't been throttled")
+}
@@ -18,9 +18,6 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-//go:build linux
-// +build linux
-
 package cgroups
 
 import "fmt"
@@ -33,6 +30,46 @@ type mountPointFormatInvalidError struct {
 	line string
 }
 
+type controllerNotMountedError struct {
+	subsys string
+}
+
+type paramNameInvalidError struct {
+	name string
+}
+
+type cpuPeriodInvalidError struct {
+	period int64
+}
+
+type cpuMaxFormatInvalidError struct {
+	line string
+}
+
+type cpuFilesNotFoundError struct {
+	path string
+}
+
+type cpuStatFormatInvalidError struct {
+	line string
+}
+
+type cpuStatKeyNotFoundError struct {
+	key string
+}
+
+type eventsFormatInvalidError struct {
+	line string
+}
+
+type pressureFormatInvalidError struct {
+	line string
+}
+
+type cpuListFormatInvalidError struct {
+	list string
+}
+
 type pathNotExposedFromMountPointError struct {
 	mountPoint string
 	root       string
@@ -47,6 +84,46 @@ func (err mountPointFormatInvalidError) Error() string {
 	return fmt.Sprintf("invalid format for MountPoint: %q", err.line)
 }
 
+func (err controllerNotMountedError) Error() string {
+	return fmt.Sprintf("cgroup controller %q is not mounted", err.subsys)
+}
+
+func (err paramNameInvalidError) Error() string {
+	return fmt.Sprintf("invalid cgroup param name: %q", err.name)
+}
+
+func (err cpuPeriodInvalidError) Error() string {
+	return fmt.Sprintf("invalid CPU period: %d, expected a positive number of microseconds", err.period)
+}
+
+func (err cpuMaxFormatInvalidError) Error() string {
+	return fmt.Sprintf("invalid format for cpu.max: %q, expected \"<quota> <period>\" or \"max <period>\"", err.line)
+}
+
+func (err cpuFilesNotFoundError) Error() string {
+	return fmt.Sprintf("cgroup directory %q has neither cpu.max nor cpu.cfs_quota_us", err.path)
+}
+
+func (err cpuStatFormatInvalidError) Error() string {
+	return fmt.Sprintf("invalid format for cpu.stat: %q", err.line)
+}
+
+func (err cpuStatKeyNotFoundError) Error() string {
+	return fmt.Sprintf("cpu.stat has no %q key", err.key)
+}
+
+func (err eventsFormatInvalidError) Error() string {
+	return fmt.Sprintf("invalid format for cgroup.events: %q", err.line)
+}
+
+func (err pressureFormatInvalidError) Error() string {
+	return fmt.Sprintf("invalid format for pressure stall information: %q", err.line)
+}
+
+func (err cpuListFormatInvalidError) Error() string {
+	return fmt.Sprintf("invalid format for CPU list: %q", err.list)
+}
+
 func (err pathNotExposedFromMountPointError) Error() string {
 	return fmt.Sprintf("path %q is not a descendant of mount point root %q and cannot be exposed from %q", err.path, err.root, err.mountPoint)
 }
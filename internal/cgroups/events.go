@@ -0,0 +1,104 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// _cgroupv2Events is the file name for the CGroup-V2 events of a cgroup,
+	// whose modification is notified whenever one of its values changes.
+	_cgroupv2Events = "cgroup.events"
+
+	_cgroupv2EventsPopulated = "populated"
+	_cgroupv2EventsFrozen    = "frozen"
+)
+
+// Events holds the values of a cgroup2 `cgroup.events` file.
+type Events struct {
+	// Populated is true if the cgroup or one of its descendants has live
+	// processes.
+	Populated bool
+	// Frozen is true if the cgroup is frozen, see `cgroup.freeze`.
+	Frozen bool
+}
+
+// ParseEvents parses the content of a `cgroup.events` file read from r, such
+// as "populated 1\nfrozen 0\n". Keys that aren't known are ignored and
+// missing ones are reported as false, since older kernels don't expose
+// every key.
+func ParseEvents(r io.Reader) (Events, error) {
+	var events Events
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || (fields[1] != "0" && fields[1] != "1") {
+			return Events{}, eventsFormatInvalidError{scanner.Text()}
+		}
+
+		value := fields[1] == "1"
+		switch fields[0] {
+		case _cgroupv2EventsPopulated:
+			events.Populated = value
+		case _cgroupv2EventsFrozen:
+			events.Frozen = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Events{}, err
+	}
+	return events, nil
+}
+
+// EventsV2 returns the events of the cgroup2 directory of the current
+// process. See CGroup.EventsV2.
+func (s Source) EventsV2() (Events, bool, error) {
+	cgroup, err := s.NewUnifiedCGroupForCurrentProcess()
+	if cgroup == nil || err != nil {
+		return Events{}, false, err
+	}
+	return cgroup.EventsV2()
+}
+
+// EventsV2 returns the events read from the `cgroup.events` file of a
+// cgroup2 directory. The root cgroup has no such file, in which case the
+// method returns `(Events{}, false, nil)`.
+func (cg *CGroup) EventsV2() (Events, bool, error) {
+	r, err := cg.src.open(cg.ParamPath(_cgroupv2Events))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Events{}, false, nil
+		}
+		return Events{}, false, err
+	}
+	events, err := ParseEvents(r)
+	if err != nil {
+		return Events{}, false, err
+	}
+	return events, true, nil
+}
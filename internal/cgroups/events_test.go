@@ -0,0 +1,83 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEvents(t *testing.T) {
+	testTable := []struct {
+		name            string
+		content         string
+		expectedEvents  Events
+		shouldHaveError bool
+	}{
+		{name: "populated", content: "populated 1\nfrozen 0\n", expectedEvents: Events{Populated: true}},
+		{name: "frozen", content: "populated 1\nfrozen 1\n", expectedEvents: Events{Populated: true, Frozen: true}},
+		{name: "empty", content: "populated 0\nfrozen 0\n", expectedEvents: Events{}},
+		{name: "no-frozen", content: "populated 1\n", expectedEvents: Events{Populated: true}},
+		{name: "unknown-key", content: "populated 1\nfrozen 0\nfuture 1\n", expectedEvents: Events{Populated: true}},
+		{name: "blank-line", content: "populated 1\n\nfrozen 1\n", expectedEvents: Events{Populated: true, Frozen: true}},
+		{name: "nothing", content: "", expectedEvents: Events{}},
+		{name: "missing-value", content: "populated\n", shouldHaveError: true},
+		{name: "invalid-value", content: "populated yes\n", shouldHaveError: true},
+		{name: "extra-field", content: "populated 1 0\n", shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		events, err := ParseEvents(strings.NewReader(tt.content))
+		assert.Equal(t, tt.expectedEvents, events, tt.name)
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
+
+func TestCGroupEventsV2(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedEvents  Events
+		expectedDefined bool
+	}{
+		{name: "events-populated", expectedEvents: Events{Populated: true}, expectedDefined: true},
+		{name: "events-frozen", expectedEvents: Events{Populated: true, Frozen: true}, expectedDefined: true},
+		{name: "memory-v2"},
+	}
+
+	for _, tt := range testTable {
+		events, defined, err := NewCGroup(filepath.Join(testDataCGroupsPath, tt.name)).EventsV2()
+		assert.Equal(t, tt.expectedEvents, events, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+		assert.NoError(t, err, tt.name)
+	}
+
+	events, defined, err := Source{Root: filepath.Join(testDataPath, "root", "v2")}.EventsV2()
+	assert.Equal(t, Events{Populated: true}, events, "v2 root")
+	assert.True(t, defined, "v2 root")
+	assert.NoError(t, err, "v2 root")
+}
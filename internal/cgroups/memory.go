@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"os"
+	"strconv"
+)
+
+const (
+	// _cgroupMemoryLimitInBytesParam is the file name for the CGroup memory
+	// limit parameter.
+	_cgroupMemoryLimitInBytesParam = "memory.limit_in_bytes"
+	// _cgroupv2MemoryMax is the file name for the CGroup-V2 memory limit
+	// parameter.
+	_cgroupv2MemoryMax = "memory.max"
+	// _cgroupv2MemoryMaxUnlimited is the value of memory.max when no limit
+	// is set.
+	_cgroupv2MemoryMaxUnlimited = "max"
+
+	// _cgroupMemoryUnlimited is the lowest value of memory.limit_in_bytes
+	// considered as no limit. The kernel reports an unset limit as the
+	// largest page-aligned int64, whose exact value depends on the page
+	// size.
+	_cgroupMemoryUnlimited = 1 << 62
+)
+
+// HasMemoryController returns true if the memory cgroup controller is
+// mounted on a v1 hierarchy.
+func (cg CGroups) HasMemoryController() bool {
+	_, exists := cg[_cgroupSubsysMemory]
+	return exists
+}
+
+// MemoryLimit returns the memory limit applied with the memory cgroup
+// controller, in bytes. If no limit is set or the controller isn't mounted,
+// the method returns `(-1, false, nil)`.
+func (cg CGroups) MemoryLimit() (int64, bool, error) {
+	memCGroup, exists := cg[_cgroupSubsysMemory]
+	if !exists {
+		return -1, false, nil
+	}
+
+	text, err := memCGroup.readFirstLine(_cgroupMemoryLimitInBytesParam)
+	if err != nil {
+		return -1, false, err
+	}
+	limit, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return -1, false, err
+	}
+	if limit <= 0 || limit >= _cgroupMemoryUnlimited {
+		return -1, false, nil
+	}
+	return limit, true, nil
+}
+
+// MemoryLimitV2 returns the memory limit of the cgroup2 directory of the
+// current process, read from its memory.max file, in bytes. If memory.max is
+// set to max or doesn't exist, it returns (-1, false, nil).
+func (s Source) MemoryLimitV2() (int64, bool, error) {
+	cgroup, err := s.NewUnifiedCGroupForCurrentProcess()
+	if cgroup == nil || err != nil {
+		return -1, false, err
+	}
+	return cgroup.MemoryLimitV2()
+}
+
+// MemoryLimitV2 returns the memory limit read from the memory.max file of a
+// cgroup2 directory. See Source.MemoryLimitV2 for details.
+func (cg *CGroup) MemoryLimitV2() (int64, bool, error) {
+	text, err := cg.readFirstLine(_cgroupv2MemoryMax)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return -1, false, nil
+		}
+		return -1, false, err
+	}
+	if text == _cgroupv2MemoryMaxUnlimited {
+		return -1, false, nil
+	}
+	limit, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return -1, false, err
+	}
+	return limit, true, nil
+}
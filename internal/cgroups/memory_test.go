@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCGroupsMemoryLimit(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedLimit   int64
+		expectedDefined bool
+		shouldHaveError bool
+	}{
+		{
+			name:            "memory",
+			expectedLimit:   268435456,
+			expectedDefined: true,
+		},
+		{
+			name:            "memory-unlimited",
+			expectedLimit:   -1,
+			expectedDefined: false,
+		},
+		{
+			name:            "memory-invalid",
+			expectedLimit:   -1,
+			shouldHaveError: true,
+		},
+		{
+			name:            "nonexistent",
+			expectedLimit:   -1,
+			shouldHaveError: true,
+		},
+	}
+
+	for _, tt := range testTable {
+		cgroups := CGroups{
+			_cgroupSubsysMemory: NewCGroup(filepath.Join(testDataCGroupsPath, tt.name)),
+		}
+		limit, defined, err := cgroups.MemoryLimit()
+		assert.Equal(t, tt.expectedLimit, limit, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+
+	limit, defined, err := CGroups{}.MemoryLimit()
+	assert.Equal(t, int64(-1), limit, "no memory controller")
+	assert.False(t, defined, "no memory controller")
+	assert.NoError(t, err, "no memory controller")
+}
+
+func TestCGroupMemoryLimitV2(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedLimit   int64
+		expectedDefined bool
+		shouldHaveError bool
+	}{
+		{
+			name:            "memory-v2",
+			expectedLimit:   268435456,
+			expectedDefined: true,
+		},
+		{
+			name:            "memory-v2-max",
+			expectedLimit:   -1,
+			expectedDefined: false,
+		},
+		{
+			name:            "memory-invalid",
+			expectedLimit:   -1,
+			shouldHaveError: true,
+		},
+		{
+			name:            "nonexistent",
+			expectedLimit:   -1,
+			expectedDefined: false,
+		},
+	}
+
+	for _, tt := range testTable {
+		cgroup := NewCGroup(filepath.Join(testDataCGroupsPath, tt.name))
+		limit, defined, err := cgroup.MemoryLimitV2()
+		assert.Equal(t, tt.expectedLimit, limit, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
+
+func TestMemoryLimitUnderRoot(t *testing.T) {
+	cgroups, err := Source{Root: filepath.Join(testDataPath, "root", "v1")}.NewCGroupsForCurrentProcess()
+	assert.NoError(t, err)
+	limit, defined, err := cgroups.MemoryLimit()
+	assert.Equal(t, int64(536870912), limit, "v1")
+	assert.True(t, defined, "v1")
+	assert.NoError(t, err, "v1")
+
+	limit, defined, err = Source{Root: filepath.Join(testDataPath, "root", "v2")}.MemoryLimitV2()
+	assert.Equal(t, int64(1073741824), limit, "v2")
+	assert.True(t, defined, "v2")
+	assert.NoError(t, err, "v2")
+}
@@ -18,14 +18,11 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-//go:build linux
-// +build linux
-
 package cgroups
 
 import (
 	"bufio"
-	"os"
+	"io"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -59,6 +56,12 @@ const (
 
 const _miFieldCountMin = _miFieldCountFirstHalf + _miFieldCountSecondHalf
 
+// _mountInfoMaxLineSize bounds the length of a line of
+// `/proc/$PID/mountinfo`. Overlay mounts list every image layer in their
+// super options, so their lines can be much longer than the default limit of
+// bufio.Scanner.
+const _mountInfoMaxLineSize = 4 << 20
+
 // MountPoint is the data structure for the mount points in
 // `/proc/$PID/mountinfo`. See also proc(5) for more information.
 type MountPoint struct {
@@ -109,12 +112,12 @@ func NewMountPointFromLine(line string) (*MountPoint, error) {
 				MountID:        mountID,
 				ParentID:       parentID,
 				DeviceID:       fields[_miFieldIDDeviceID],
-				Root:           fields[_miFieldIDRoot],
-				MountPoint:     fields[_miFieldIDMountPoint],
+				Root:           unescapeMountInfoField(fields[_miFieldIDRoot]),
+				MountPoint:     unescapeMountInfoField(fields[_miFieldIDMountPoint]),
 				Options:        strings.Split(fields[_miFieldIDOptions], _mountInfoOptsSep),
 				OptionalFields: fields[_miFieldIDOptionalFields:(fsTypeStart - 1)],
 				FSType:         fields[miFieldIDFSType],
-				MountSource:    fields[miFieldIDMountSource],
+				MountSource:    unescapeMountInfoField(fields[miFieldIDMountSource]),
 				SuperOptions:   strings.Split(fields[miFieldIDSuperOptions], _mountInfoOptsSep),
 			}, nil
 		}
@@ -123,6 +126,36 @@ func NewMountPointFromLine(line string) (*MountPoint, error) {
 	return nil, mountPointFormatInvalidError{line}
 }
 
+// unescapeMountInfoField decodes the octal escape sequences the kernel uses
+// for whitespace and backslashes in the paths and mount sources of
+// `/proc/$PID/mountinfo`, such as `\040` for a space. Invalid sequences are
+// kept as is.
+func unescapeMountInfoField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) && isOctalEscape(field[i+1:i+4]) {
+			v, _ := strconv.ParseUint(field[i+1:i+4], 8, 8)
+			b.WriteByte(byte(v))
+			i += 3
+			continue
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
+
+// isOctalEscape reports whether s is made of three octal digits that fit in
+// a byte.
+func isOctalEscape(s string) bool {
+	return s[0] >= '0' && s[0] <= '3' &&
+		s[1] >= '0' && s[1] <= '7' &&
+		s[2] >= '0' && s[2] <= '7'
+}
+
 // Translate converts an absolute path inside the *MountPoint's file system to
 // the host file system path in the mount namespace the *MountPoint belongs to.
 func (mp *MountPoint) Translate(absPath string) (string, error) {
@@ -142,16 +175,11 @@ func (mp *MountPoint) Translate(absPath string) (string, error) {
 	return filepath.Join(mp.MountPoint, relPath), nil
 }
 
-// parseMountInfo parses procPathMountInfo (usually at `/proc/$PID/mountinfo`)
-// and yields parsed *MountPoint into newMountPoint.
-func parseMountInfo(procPathMountInfo string, newMountPoint func(*MountPoint) error) error {
-	mountInfoFile, err := os.Open(procPathMountInfo)
-	if err != nil {
-		return err
-	}
-	defer mountInfoFile.Close()
-
-	scanner := bufio.NewScanner(mountInfoFile)
+// ParseMountInfo parses the content of a `/proc/$PID/mountinfo` file read
+// from r and yields parsed *MountPoint into newMountPoint.
+func ParseMountInfo(r io.Reader, newMountPoint func(*MountPoint) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, _mountInfoMaxLineSize)
 
 	for scanner.Scan() {
 		mountPoint, err := NewMountPointFromLine(scanner.Text())
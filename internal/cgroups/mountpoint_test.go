@@ -18,15 +18,17 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-//go:build linux
-// +build linux
-
 package cgroups
 
 import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewMountPointFromLine(t *testing.T) {
@@ -67,6 +69,22 @@ func TestNewMountPointFromLine(t *testing.T) {
 				SuperOptions:   []string{"rw", "cpu"},
 			},
 		},
+		{
+			name: "escaped",
+			line: `32 23 0:25 /a\134b /mnt/test\040env\011cgroup rw,relatime shared:2 - cgroup cgroup rw,cpu`,
+			expected: &MountPoint{
+				MountID:        32,
+				ParentID:       23,
+				DeviceID:       "0:25",
+				Root:           `/a\b`,
+				MountPoint:     "/mnt/test env\tcgroup",
+				Options:        []string{"rw", "relatime"},
+				OptionalFields: []string{"shared:2"},
+				FSType:         "cgroup",
+				MountSource:    "cgroup",
+				SuperOptions:   []string{"rw", "cpu"},
+			},
+		},
 	}
 
 	for _, tt := range testTable {
@@ -76,6 +94,97 @@ func TestNewMountPointFromLine(t *testing.T) {
 	}
 }
 
+func TestUnescapeMountInfoField(t *testing.T) {
+	testTable := []struct {
+		field    string
+		expected string
+	}{
+		{`/sys/fs/cgroup`, "/sys/fs/cgroup"},
+		{`/mnt/a\040b`, "/mnt/a b"},
+		{`/mnt/a\011b`, "/mnt/a\tb"},
+		{`/mnt/a\012b`, "/mnt/a\nb"},
+		{`/mnt/a\134b`, `/mnt/a\b`},
+		{`/mnt/\040\040`, "/mnt/  "},
+		{`/mnt/a\04`, `/mnt/a\04`},
+		{`/mnt/a\xyz`, `/mnt/a\xyz`},
+		{`/mnt/a\400`, `/mnt/a\400`},
+	}
+
+	for _, tt := range testTable {
+		assert.Equal(t, tt.expected, unescapeMountInfoField(tt.field), tt.field)
+	}
+}
+
+func TestNewCGroupsEscapedMountPoint(t *testing.T) {
+	cgroups, err := NewCGroups(
+		filepath.Join(testDataProcPath, "escaped", "mountinfo"),
+		filepath.Join(testDataProcPath, "escaped", "cgroup"),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "/mnt/test env/cgroup/cpu,cpuacct/docker", cgroups[_cgroupSubsysCPU].Path())
+}
+
+func TestNewCGroupsMixedMounts(t *testing.T) {
+	// Overlay, shiftfs, FUSE and other mounts with unusual fields surround
+	// the few cgroup lines.
+	mountInfoPath := filepath.Join(testDataProcPath, "mixed-mounts", "mountinfo")
+	cgroups, err := NewCGroups(mountInfoPath, filepath.Join(testDataProcPath, "mixed-mounts", "cgroup"))
+	require.NoError(t, err)
+	assert.Len(t, cgroups, 3, "name=systemd should be left out")
+	assert.Equal(t, "/sys/fs/cgroup/cpu,cpuacct", cgroups[_cgroupSubsysCPU].Path())
+	assert.Equal(t, "/sys/fs/cgroup/cpu,cpuacct", cgroups[_cgroupSubsysCPUAcct].Path())
+	assert.Equal(t, "/sys/fs/cgroup/memory", cgroups[_cgroupSubsysMemory].Path())
+
+	isV2, err := Source{}.isCGroupV2(mountInfoPath)
+	assert.False(t, isV2)
+	assert.NoError(t, err)
+
+	mountInfo, err := Source{}.open(mountInfoPath)
+	require.NoError(t, err)
+	var mountPoints []*MountPoint
+	err = ParseMountInfo(mountInfo, func(mp *MountPoint) error {
+		mountPoints = append(mountPoints, mp)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, mountPoints, 43, "every line should be parsed")
+
+	byMountPoint := make(map[string]*MountPoint)
+	for _, mp := range mountPoints {
+		byMountPoint[mp.MountPoint] = mp
+	}
+	assert.Equal(t, "shiftfs", byMountPoint["/mnt/shifted data"].FSType)
+	assert.Equal(t, "/var/lib/lxd/storage-pools/default/custom/data set", byMountPoint["/mnt/shifted data"].MountSource)
+	assert.Equal(t, "deploy@build-host:/srv/artifacts (ro)", byMountPoint["/mnt/remote"].MountSource)
+	assert.Equal(t, "", byMountPoint["/mnt/empty-source"].MountSource)
+	assert.Equal(t, []string{"rw", "user_id=0", "group_id=0"}, byMountPoint["/mnt/empty-source"].SuperOptions)
+	assert.Equal(t, "tmpfs", byMountPoint["/mnt/-"].FSType)
+	assert.Equal(t, "-", byMountPoint["/mnt/-"].MountSource)
+	assert.Equal(t, []string{"shared:326", "master:30", "propagate_from:12", "unbindable"}, byMountPoint["/run"].OptionalFields)
+	assert.Equal(t, "tmpfs", byMountPoint["/mnt/cgroup"].FSType)
+}
+
+func TestParseMountInfoLongLine(t *testing.T) {
+	// Overlay mounts of images with many layers list every layer in their
+	// super options, which can exceed the default line limit of
+	// bufio.Scanner.
+	layers := make([]string, 2000)
+	for i := range layers {
+		layers[i] = fmt.Sprintf("/var/lib/docker/overlay2/l/LAYER%027d", i)
+	}
+	mountInfo := "1 0 0:50 / / rw,relatime - overlay overlay rw,lowerdir=" + strings.Join(layers, ":") + "\n" +
+		"2 1 0:29 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime - cgroup2 cgroup2 rw\n"
+	require.True(t, len(mountInfo) > bufio.MaxScanTokenSize)
+
+	var fsTypes []string
+	err := ParseMountInfo(strings.NewReader(mountInfo), func(mp *MountPoint) error {
+		fsTypes = append(fsTypes, mp.FSType)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"overlay", "cgroup2"}, fsTypes)
+}
+
 func TestNewMountPointFromLineErr(t *testing.T) {
 	linesWithInvalidIDs := []string{
 		"invalidMountID 0 252:0 / / rw,noatime - ext4 /dev/dm-0 rw,errors=remount-ro,data=ordered",
@@ -0,0 +1,86 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// _sysPathNodes is the sysfs directory listing the NUMA nodes of the
+	// system.
+	_sysPathNodes = "/sys/devices/system/node"
+	// _nodeDirPrefix is the prefix of the directory of each NUMA node, which
+	// is followed by the node number.
+	_nodeDirPrefix = "node"
+	// _nodeCPUList is the file listing the CPUs of a NUMA node.
+	_nodeCPUList = "cpulist"
+)
+
+// NUMANodeCPUs returns the number of CPUs of every NUMA node of the system,
+// ordered by node number. It returns nil without an error if the NUMA sysfs
+// directory doesn't exist, e.g. on kernels built without NUMA support.
+func (s Source) NUMANodeCPUs() ([]int, error) {
+	names, err := s.readDir(_sysPathNodes)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var nodes []int
+	for _, name := range names {
+		if !strings.HasPrefix(name, _nodeDirPrefix) {
+			continue
+		}
+		if node, err := strconv.Atoi(strings.TrimPrefix(name, _nodeDirPrefix)); err == nil {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Ints(nodes)
+
+	cpus := make([]int, 0, len(nodes))
+	for _, node := range nodes {
+		list, err := s.open(filepath.Join(_sysPathNodes, _nodeDirPrefix+strconv.Itoa(node), _nodeCPUList))
+		if err != nil {
+			return nil, err
+		}
+		text, err := ioutil.ReadAll(list)
+		if err != nil {
+			return nil, err
+		}
+		n := 0
+		if strings.TrimSpace(string(text)) != "" {
+			// Memory-only nodes have no CPUs.
+			if n, err = parseCPUList(string(text)); err != nil {
+				return nil, err
+			}
+		}
+		cpus = append(cpus, n)
+	}
+	return cpus, nil
+}
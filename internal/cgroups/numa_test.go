@@ -0,0 +1,48 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNUMANodeCPUs(t *testing.T) {
+	cpus, err := Source{Root: filepath.Join(testDataPath, "root", "numa")}.NUMANodeCPUs()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4, 5, 0}, cpus)
+
+	cpus, err = Source{Root: filepath.Join(testDataPath, "root", "v2")}.NUMANodeCPUs()
+	assert.NoError(t, err, "missing NUMA sysfs")
+	assert.Nil(t, cpus, "missing NUMA sysfs")
+
+	root := t.TempDir()
+	node := filepath.Join(root, "sys", "devices", "system", "node", "node0")
+	require.NoError(t, os.MkdirAll(node, 0o755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(node, _nodeCPUList), []byte("0-x\n"), 0o644))
+	_, err = Source{Root: root}.NUMANodeCPUs()
+	assert.Error(t, err, "invalid cpulist")
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// _cgroupv2MemoryPressure is the file name for the CGroup-V2 pressure
+	// stall information (PSI) of memory.
+	_cgroupv2MemoryPressure = "memory.pressure"
+
+	_pressureSome   = "some"
+	_pressureFull   = "full"
+	_pressureAvg10  = "avg10"
+	_pressureAvg60  = "avg60"
+	_pressureAvg300 = "avg300"
+	_pressureTotal  = "total"
+)
+
+// Pressure holds one line of a pressure stall information (PSI) file.
+type Pressure struct {
+	// Avg10, Avg60 and Avg300 are the percentages of time tasks were
+	// stalled, averaged over the last 10, 60 and 300 seconds.
+	Avg10, Avg60, Avg300 float64
+	// Total is the total stall time, in microseconds.
+	Total uint64
+}
+
+// PressureStats holds the values of a PSI file such as `memory.pressure`.
+type PressureStats struct {
+	// Some is the stall time of at least some tasks.
+	Some Pressure
+	// Full is the stall time of all non-idle tasks at once.
+	Full Pressure
+}
+
+// ParsePressure parses the content of a PSI file read from r, such as
+// "some avg10=0.00 avg60=0.00 avg300=0.00 total=0\nfull ...". Lines and keys
+// that aren't known are ignored, and missing ones are reported as zero.
+func ParsePressure(r io.Reader) (PressureStats, error) {
+	var stats PressureStats
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var p *Pressure
+		switch fields[0] {
+		case _pressureSome:
+			p = &stats.Some
+		case _pressureFull:
+			p = &stats.Full
+		default:
+			continue
+		}
+		for _, field := range fields[1:] {
+			i := strings.IndexByte(field, '=')
+			if i < 0 {
+				return PressureStats{}, pressureFormatInvalidError{scanner.Text()}
+			}
+			key, value := field[:i], field[i+1:]
+
+			var err error
+			switch key {
+			case _pressureAvg10:
+				p.Avg10, err = strconv.ParseFloat(value, 64)
+			case _pressureAvg60:
+				p.Avg60, err = strconv.ParseFloat(value, 64)
+			case _pressureAvg300:
+				p.Avg300, err = strconv.ParseFloat(value, 64)
+			case _pressureTotal:
+				p.Total, err = strconv.ParseUint(value, 10, 64)
+			}
+			if err != nil {
+				return PressureStats{}, pressureFormatInvalidError{scanner.Text()}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return PressureStats{}, err
+	}
+	return stats, nil
+}
+
+// MemoryPressureV2 returns the memory pressure of the cgroup2 directory of
+// the current process. See CGroup.MemoryPressureV2.
+func (s Source) MemoryPressureV2() (PressureStats, bool, error) {
+	cgroup, err := s.NewUnifiedCGroupForCurrentProcess()
+	if cgroup == nil || err != nil {
+		return PressureStats{}, false, err
+	}
+	return cgroup.MemoryPressureV2()
+}
+
+// MemoryPressureV2 returns the memory pressure read from the
+// `memory.pressure` file of a cgroup2 directory. Kernels built without PSI
+// support have no such file, in which case the method returns
+// `(PressureStats{}, false, nil)`.
+func (cg *CGroup) MemoryPressureV2() (PressureStats, bool, error) {
+	r, err := cg.src.open(cg.ParamPath(_cgroupv2MemoryPressure))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return PressureStats{}, false, nil
+		}
+		return PressureStats{}, false, err
+	}
+	stats, err := ParsePressure(r)
+	if err != nil {
+		return PressureStats{}, false, err
+	}
+	return stats, true, nil
+}
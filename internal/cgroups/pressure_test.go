@@ -0,0 +1,116 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePressure(t *testing.T) {
+	testTable := []struct {
+		name            string
+		content         string
+		expectedStats   PressureStats
+		shouldHaveError bool
+	}{
+		{
+			name:    "some-and-full",
+			content: "some avg10=1.50 avg60=0.75 avg300=0.25 total=1000\nfull avg10=0.50 avg60=0.25 avg300=0.00 total=400\n",
+			expectedStats: PressureStats{
+				Some: Pressure{Avg10: 1.5, Avg60: 0.75, Avg300: 0.25, Total: 1000},
+				Full: Pressure{Avg10: 0.5, Avg60: 0.25, Total: 400},
+			},
+		},
+		{
+			name:          "some-only",
+			content:       "some avg10=2.00 avg60=1.00 avg300=0.50 total=10\n",
+			expectedStats: PressureStats{Some: Pressure{Avg10: 2, Avg60: 1, Avg300: 0.5, Total: 10}},
+		},
+		{
+			name:          "unknown-key",
+			content:       "some avg10=2.00 avg30=1.00 total=10\n",
+			expectedStats: PressureStats{Some: Pressure{Avg10: 2, Total: 10}},
+		},
+		{
+			name:          "unknown-line",
+			content:       "future avg10=9.00\nsome avg10=2.00\n",
+			expectedStats: PressureStats{Some: Pressure{Avg10: 2}},
+		},
+		{name: "nothing", content: "", expectedStats: PressureStats{}},
+		{name: "missing-value", content: "some avg10\n", shouldHaveError: true},
+		{name: "invalid-avg", content: "some avg10=high\n", shouldHaveError: true},
+		{name: "invalid-total", content: "some total=-1\n", shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		stats, err := ParsePressure(strings.NewReader(tt.content))
+		assert.Equal(t, tt.expectedStats, stats, tt.name)
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
+
+func TestCGroupMemoryPressureV2(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedStats   PressureStats
+		expectedDefined bool
+		shouldHaveError bool
+	}{
+		{
+			name: "memory-pressure",
+			expectedStats: PressureStats{
+				Some: Pressure{Avg10: 12.5, Avg60: 8, Avg300: 2.25, Total: 123456},
+				Full: Pressure{Avg10: 3, Avg60: 1, Avg300: 0.5, Total: 6789},
+			},
+			expectedDefined: true,
+		},
+		{name: "memory-pressure-invalid", shouldHaveError: true},
+		{name: "memory-v2"},
+	}
+
+	for _, tt := range testTable {
+		stats, defined, err := NewCGroup(filepath.Join(testDataCGroupsPath, tt.name)).MemoryPressureV2()
+		assert.Equal(t, tt.expectedStats, stats, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+
+	stats, defined, err := Source{Root: filepath.Join(testDataPath, "root", "v2-pressure")}.MemoryPressureV2()
+	assert.Equal(t, 42.0, stats.Some.Avg10, "v2-pressure root")
+	assert.True(t, defined, "v2-pressure root")
+	assert.NoError(t, err, "v2-pressure root")
+
+	_, defined, err = Source{Root: filepath.Join(testDataPath, "root", "v1")}.MemoryPressureV2()
+	assert.False(t, defined, "v1 root")
+	assert.NoError(t, err, "v1 root")
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// The functions of this file parse `/proc/$PID/mountinfo` and
+// `/proc/$PID/cgroup` on the detection path. Unlike ParseMountInfo and
+// NewCGroupSubsysFromLine, they scan the content of the files in place
+// rather than through bufio.Scanner and strings.Split, so that lines which
+// don't concern cgroups cost no allocation. They accept exactly the lines
+// the exported parsers accept, and defer to them to build the errors of the
+// lines they reject.
+
+// mountInfoEntry holds the fields of a line of `/proc/$PID/mountinfo` that
+// cgroup detection uses, as subslices of the line. They are only valid
+// until the next line is scanned.
+type mountInfoEntry struct {
+	root         []byte
+	mountPoint   []byte
+	fsType       []byte
+	superOptions []byte
+}
+
+// translate is like MountPoint.Translate for the mount point of e. Inside a
+// cgroup namespace, `/proc/$PID/cgroup` lists the process at the root of the
+// namespace, "/", while a hierarchy mounted from outside the namespace has a
+// root that isn't an ancestor of it. The cgroup of the process is then
+// assumed to be the one mounted, and the mount point is returned instead of
+// an error.
+func (e *mountInfoEntry) translate(absPath string) (string, string, error) {
+	mp := MountPoint{
+		Root:       unescapeMountInfoField(string(e.root)),
+		MountPoint: unescapeMountInfoField(string(e.mountPoint)),
+	}
+	cgroupPath, err := mp.Translate(absPath)
+	if _, notExposed := err.(pathNotExposedFromMountPointError); notExposed && absPath == _cgroupNamespaceRoot {
+		return mp.MountPoint, mp.MountPoint, nil
+	}
+	return mp.MountPoint, cgroupPath, err
+}
+
+// scanMountInfo reads procPathMountInfo and calls f with every line.
+func (s Source) scanMountInfo(procPathMountInfo string, f func(*mountInfoEntry) error) error {
+	data, err := s.ReadFile(procPathMountInfo)
+	if err != nil {
+		return err
+	}
+
+	var e mountInfoEntry
+	return forEachLine(data, _mountInfoMaxLineSize, func(line []byte) error {
+		if !parseMountInfoEntry(line, &e) {
+			_, err := NewMountPointFromLine(string(line))
+			return err
+		}
+		return f(&e)
+	})
+}
+
+// parseMountInfoEntry fills e from line and reports whether
+// NewMountPointFromLine would accept line.
+func parseMountInfoEntry(line []byte, e *mountInfoEntry) bool {
+	// Fields are separated by single spaces, so that two spaces in a row
+	// make an empty field, as with strings.Split.
+	rest := line
+	for i := 0; ; i++ {
+		field, next, last := cutField(rest)
+		switch {
+		case i == _miFieldIDMountID || i == _miFieldIDParentID:
+			if !isInt(field) {
+				return false
+			}
+		case i == _miFieldIDRoot:
+			e.root = field
+		case i == _miFieldIDMountPoint:
+			e.mountPoint = field
+		case i >= _miFieldIDOptionalFields && len(field) == 1 && field[0] == _mountInfoOptionalFieldsSep[0]:
+			return parseMountInfoSecondHalf(next, last, e)
+		}
+		if last {
+			return false
+		}
+		rest = next
+	}
+}
+
+// parseMountInfoSecondHalf fills e from the fields following the separator
+// of the optional fields, which must be exactly three.
+func parseMountInfoSecondHalf(rest []byte, last bool, e *mountInfoEntry) bool {
+	if last {
+		return false
+	}
+	fsType, rest, last := cutField(rest)
+	if last {
+		return false
+	}
+	_, rest, last = cutField(rest)
+	if last {
+		return false
+	}
+	superOptions, _, last := cutField(rest)
+	if !last {
+		return false
+	}
+	e.fsType, e.superOptions = fsType, superOptions
+	return true
+}
+
+// cutField returns the first field of the space-separated fields, the
+// fields that follow it, and whether it's the last one.
+func cutField(fields []byte) (field, rest []byte, last bool) {
+	i := bytes.IndexByte(fields, _mountInfoSep[0])
+	if i < 0 {
+		return fields, nil, true
+	}
+	return fields[:i], fields[i+1:], false
+}
+
+// isInt reports whether strconv.Atoi accepts b. The conversion to a string
+// doesn't escape, so it doesn't allocate for numbers of usual sizes.
+func isInt(b []byte) bool {
+	_, err := strconv.Atoi(string(b))
+	return err == nil
+}
+
+// forEachSubslice calls f with every subslice of list separated by sep.
+func forEachSubslice(list []byte, sep byte, f func([]byte)) {
+	for {
+		i := bytes.IndexByte(list, sep)
+		if i < 0 {
+			f(list)
+			return
+		}
+		f(list[:i])
+		list = list[i+1:]
+	}
+}
+
+// forEachLine calls f with every line of data, without its line ending,
+// splitting data like a bufio.Scanner with a maximum token size of
+// maxLineSize would.
+func forEachLine(data []byte, maxLineSize int, f func(line []byte) error) error {
+	for len(data) > 0 {
+		// The scanner needs room for the line ending, or for one more byte
+		// to find out that the last line has none.
+		line, size := data, len(data)+1
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, size = data[:i], i+1
+		}
+		if size > maxLineSize {
+			return bufio.ErrTooLong
+		}
+		data = data[len(line):]
+		if len(data) > 0 {
+			data = data[1:]
+		}
+
+		if n := len(line); n > 0 && line[n-1] == '\r' {
+			line = line[:n-1]
+		}
+		if err := f(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addCGroupSubsys parses line like NewCGroupSubsysFromLine and registers the
+// result in subsystems under every subsystem it lists that s wants. Lines
+// that list none of them are only validated.
+func (s Source) addCGroupSubsys(subsystems map[string]*CGroupSubsys, line []byte) error {
+	idEnd := bytes.IndexByte(line, _cgroupSep[0])
+	if idEnd < 0 {
+		return cgroupSubsysLineError(line)
+	}
+	listEnd := bytes.IndexByte(line[idEnd+1:], _cgroupSep[0])
+	if listEnd < 0 {
+		return cgroupSubsysLineError(line)
+	}
+	listEnd += idEnd + 1
+	id, err := strconv.Atoi(string(line[:idEnd]))
+	if err != nil {
+		return cgroupSubsysLineError(line)
+	}
+
+	wanted := false
+	forEachSubslice(line[idEnd+1:listEnd], _cgroupSubsysSep[0], func(subsys []byte) {
+		wanted = wanted || s.wantsSubsys(string(subsys))
+	})
+	if !wanted {
+		return nil
+	}
+
+	text := string(line)
+	cgroup := &CGroupSubsys{
+		ID:         id,
+		Subsystems: strings.Split(text[idEnd+1:listEnd], _cgroupSubsysSep),
+		Name:       text[listEnd+1:],
+	}
+	for _, subsys := range cgroup.Subsystems {
+		if s.wantsSubsys(subsys) {
+			subsystems[subsys] = cgroup
+		}
+	}
+	return nil
+}
+
+// cgroupSubsysLineError returns the error NewCGroupSubsysFromLine returns
+// for an invalid line.
+func cgroupSubsysLineError(line []byte) error {
+	_, err := NewCGroupSubsysFromLine(string(line))
+	return err
+}
+
+// wantsSubsys reports whether a subsystem listed in `/proc/$PID/cgroup`
+// should be registered: the cgroup2 hierarchy always is, v1 controllers if s
+// wants them.
+func (s Source) wantsSubsys(subsys string) bool {
+	return subsys == _cgroupv2SubsysName || s.wants(subsys)
+}
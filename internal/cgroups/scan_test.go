@@ -0,0 +1,240 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixtureFiles returns the content of every fixture with the given base
+// name, keyed by path.
+func fixtureFiles(t *testing.T, base string) map[string][]byte {
+	files := make(map[string][]byte)
+	err := fs.WalkDir(testDataFS, "testdata", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Base(name) != base {
+			return err
+		}
+		files[name], err = testDataFS.ReadFile(name)
+		return err
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	return files
+}
+
+// scanLines splits data like forEachLine, with bufio.Scanner.
+func scanLines(data []byte, maxLineSize int) ([]string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, maxLineSize)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+func TestForEachLine(t *testing.T) {
+	inputs := []string{
+		"",
+		"\n",
+		"\n\n",
+		"a",
+		"a\n",
+		"a\nb",
+		"a\r\nb\r\n",
+		"a\r\r\n",
+		"\r",
+		"1234567",
+		"12345678",
+		"1234567\n",
+		"12345678\n",
+		"a\n1234567",
+		"a\n12345678\nb",
+		"123456\r\n",
+		"1234567\r\n",
+	}
+
+	for _, input := range inputs {
+		expectedLines, expectedErr := scanLines([]byte(input), 8)
+
+		var lines []string
+		err := forEachLine([]byte(input), 8, func(line []byte) error {
+			lines = append(lines, string(line))
+			return nil
+		})
+		assert.Equal(t, expectedErr, err, "%q", input)
+		if expectedErr == nil {
+			assert.Equal(t, expectedLines, lines, "%q", input)
+		}
+	}
+}
+
+func TestScanMountInfoMatchesParseMountInfo(t *testing.T) {
+	files := fixtureFiles(t, "mountinfo")
+	files["invalid"] = []byte(strings.Join([]string{
+		"1 0 8:1 / / rw - ext4 /dev/sda1 rw",
+		"2  1 8:1 / / rw - ext4 /dev/sda1 rw",
+		"3 1 8:1 / / rw shared:1 - ext4 /dev/sda1",
+		"4 1 8:1 / / rw - ext4 /dev/sda1 rw extra",
+		"5 1 8:1 / / rw shared:1 master:2 ext4 /dev/sda1 rw",
+		"x 1 8:1 / / rw - ext4 /dev/sda1 rw",
+	}, "\n"))
+	files["escaped"] = []byte(`1 0 0:5 /a\040b /mnt/c\011d rw - cgroup c\134g rw,cpu` + "\r\n")
+	files["separator"] = []byte("1 0 0:5 - - rw - - - - -\n\n")
+
+	for name, data := range files {
+		var expected []*MountPoint
+		expectedErr := ParseMountInfo(bytes.NewReader(data), func(mp *MountPoint) error {
+			expected = append(expected, mp)
+			return nil
+		})
+
+		var actual []*MountPoint
+		var e mountInfoEntry
+		err := forEachLine(data, _mountInfoMaxLineSize, func(line []byte) error {
+			if !parseMountInfoEntry(line, &e) {
+				_, err := NewMountPointFromLine(string(line))
+				return err
+			}
+			mountPoint, _, _ := e.translate("/")
+			actual = append(actual, &MountPoint{
+				Root:         unescapeMountInfoField(string(e.root)),
+				MountPoint:   mountPoint,
+				FSType:       string(e.fsType),
+				SuperOptions: strings.Split(string(e.superOptions), _mountInfoOptsSep),
+			})
+			return nil
+		})
+
+		assert.Equal(t, expectedErr, err, name)
+		if !assert.Equal(t, len(expected), len(actual), name) {
+			continue
+		}
+		for i, mp := range expected {
+			assert.Equal(t, mp.Root, actual[i].Root, "%v: line %v", name, i+1)
+			assert.Equal(t, mp.MountPoint, actual[i].MountPoint, "%v: line %v", name, i+1)
+			assert.Equal(t, mp.FSType, actual[i].FSType, "%v: line %v", name, i+1)
+			assert.Equal(t, mp.SuperOptions, actual[i].SuperOptions, "%v: line %v", name, i+1)
+		}
+	}
+}
+
+func TestParseCGroupSubsystemsMatchesNewCGroupSubsysFromLine(t *testing.T) {
+	files := fixtureFiles(t, "cgroup")
+	files["invalid-id"] = []byte("1:cpu:/\nx:memory:/\n")
+	files["missing-field"] = []byte("1:cpu:/\n2:memory\n")
+	files["crlf"] = []byte("1:cpu,cpuacct:/docker\r\n0::/\r\n")
+	files["empty-line"] = []byte("1:cpu:/\n\n")
+
+	for name, data := range files {
+		for _, src := range []Source{{}, Source{}.WantControllers(DefaultControllers), Source{}.WantControllers([]string{})} {
+			expected := make(map[string]*CGroupSubsys)
+			lines, expectedErr := scanLines(data, bufio.MaxScanTokenSize)
+			for _, line := range lines {
+				cgroup, err := NewCGroupSubsysFromLine(line)
+				if err != nil {
+					expectedErr = err
+					break
+				}
+				for _, subsys := range cgroup.Subsystems {
+					if subsys == _cgroupv2SubsysName || src.wants(subsys) {
+						expected[subsys] = cgroup
+					}
+				}
+			}
+
+			actual := make(map[string]*CGroupSubsys)
+			err := forEachLine(data, bufio.MaxScanTokenSize, func(line []byte) error {
+				return src.addCGroupSubsys(actual, line)
+			})
+			assert.Equal(t, expectedErr, err, "%v: %v", name, src.controllers)
+			if expectedErr == nil {
+				assert.Equal(t, expected, actual, "%v: %v", name, src.controllers)
+			}
+		}
+	}
+}
+
+func TestScanAllocations(t *testing.T) {
+	mountInfo, err := testDataFS.ReadFile("testdata/proc/many-controllers/mountinfo")
+	require.NoError(t, err)
+	cgroup, err := testDataFS.ReadFile("testdata/proc/many-controllers/cgroup")
+	require.NoError(t, err)
+
+	var e mountInfoEntry
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = forEachLine(mountInfo, _mountInfoMaxLineSize, func(line []byte) error {
+			parseMountInfoEntry(line, &e)
+			return nil
+		})
+	})
+	assert.Zero(t, allocs, "scanning mountinfo shouldn't allocate")
+
+	// The cgroup2 hierarchy is always registered, so leave it out.
+	cgroup = cgroup[bytes.IndexByte(cgroup, '\n')+1:]
+	require.True(t, bytes.HasPrefix(cgroup, []byte("1:")))
+	src := Source{}.WantControllers([]string{})
+	subsystems := make(map[string]*CGroupSubsys)
+	allocs = testing.AllocsPerRun(100, func() {
+		_ = forEachLine(cgroup, bufio.MaxScanTokenSize, func(line []byte) error {
+			return src.addCGroupSubsys(subsystems, line)
+		})
+	})
+	assert.Zero(t, allocs, "lines of unwanted controllers shouldn't allocate")
+}
+
+func BenchmarkScanMountInfo(b *testing.B) {
+	mountInfo, err := testDataFS.ReadFile("testdata/proc/many-controllers/mountinfo")
+	require.NoError(b, err)
+
+	b.Run("ParseMountInfo", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			err := ParseMountInfo(bytes.NewReader(mountInfo), func(*MountPoint) error { return nil })
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		b.ReportAllocs()
+		var e mountInfoEntry
+		for i := 0; i < b.N; i++ {
+			err := forEachLine(mountInfo, _mountInfoMaxLineSize, func(line []byte) error {
+				if !parseMountInfoEntry(line, &e) {
+					b.Fatalf("invalid line %q", line)
+				}
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
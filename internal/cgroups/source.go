@@ -0,0 +1,263 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// _readRetries is how many times a read failing with EINTR or EAGAIN is
+// retried right away before its error is returned.
+const _readRetries = 2
+
+// _reads holds, for every sourceKey, a channel with room for a single token
+// that the read in progress with a context holds until it returns.
+var _reads sync.Map
+
+// sourceKey identifies the file system a Source reads from.
+type sourceKey struct {
+	root, procMount, cgroupMount string
+}
+
+// _readFile reads a file in full. It's a variable so that tests can inject
+// transient errors.
+var _readFile = ioutil.ReadFile
+
+// Source describes where the cgroup and proc files of a process are read
+// from. The zero value reads them from the host file system without any
+// deadline.
+type Source struct {
+	// Root, if non-empty, is the directory every path is resolved relative
+	// to, typically the root directory of another mount namespace (e.g.
+	// `/proc/$PID/root`). Paths such as CGroup.Path stay relative to the
+	// namespace.
+	Root string
+	// ProcMount, if non-empty, is the directory proc is mounted at in place
+	// of `/proc`, e.g. `/host/proc` for node agents, that the cgroup and
+	// mountinfo files of the current process are read from. It's resolved
+	// relative to Root like any other path.
+	ProcMount string
+	// CGroupMount, if non-empty, is the directory the cgroup hierarchies
+	// are mounted at in place of `/sys/fs/cgroup`, e.g.
+	// `/host/sys/fs/cgroup` for agents that bind-mount the host's tree.
+	// Mount points that mountinfo lists under `/sys/fs/cgroup` are moved
+	// under it, and it's resolved relative to Root like any other path.
+	CGroupMount string
+	// Context, if non-nil, bounds every file read. Once it is done, reads
+	// in progress are abandoned and return its error. An abandoned read
+	// keeps running until the file system answers, and no other read with a
+	// context starts from the same Root and mounts until it does: later
+	// reads wait for it, bounded by their own context, so that a hung mount
+	// costs a single goroutine however often it's read.
+	Context context.Context
+	// OnRead, if non-nil, is called with the name of every file read or
+	// checked for existence, before it's resolved relative to Root, e.g. to
+	// find out which files a result depends on.
+	OnRead func(name string)
+
+	// controllers, if non-nil, lists the only v1 controllers NewCGroups
+	// registers. See WantControllers.
+	controllers []string
+}
+
+// DefaultControllers are the v1 controllers the CPU quota, cpuset and memory
+// limit detection relies on.
+var DefaultControllers = []string{
+	_cgroupSubsysCPU,
+	_cgroupSubsysCPUAcct,
+	_cgroupSubsysCPUSet,
+	_cgroupSubsysMemory,
+}
+
+// WantControllers returns a copy of s with which NewCGroups only registers
+// the given v1 controllers, skipping the others while parsing. Without it,
+// every mounted controller is registered.
+func (s Source) WantControllers(controllers []string) Source {
+	s.controllers = append([]string{}, controllers...)
+	return s
+}
+
+// wants reports whether the v1 controller subsys should be registered.
+func (s Source) wants(subsys string) bool {
+	if s.controllers == nil {
+		return true
+	}
+	for _, c := range s.controllers {
+		if c == subsys {
+			return true
+		}
+	}
+	return false
+}
+
+// procPath returns the path of the proc file name, one of the _procPath
+// constants, with `/proc` replaced by s.ProcMount if set.
+func (s Source) procPath(name string) string {
+	if s.ProcMount == "" {
+		return name
+	}
+	return filepath.Join(s.ProcMount, strings.TrimPrefix(name, _procMount))
+}
+
+// cgroupMountPath returns path with its `/sys/fs/cgroup` prefix, if any,
+// replaced by s.CGroupMount if set.
+func (s Source) cgroupMountPath(path string) string {
+	if s.CGroupMount == "" {
+		return path
+	}
+	if path != _cgroupMount && !strings.HasPrefix(path, _cgroupMount+"/") {
+		return path
+	}
+	return filepath.Join(s.CGroupMount, strings.TrimPrefix(path, _cgroupMount))
+}
+
+// path resolves name relative to s.Root. The result is cleaned, so that
+// names joined from cgroup paths with trailing or repeated slashes are
+// opened as single-slash paths, which strict file systems require.
+func (s Source) path(name string) string {
+	if s.Root == "" {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(s.Root, name)
+}
+
+// ReadFile reads the named file in full, resolved relative to s.Root and
+// bounded by s.Context. Reads that fail with EINTR or EAGAIN are retried a
+// couple of times. Symlinks are followed, as with os.Open, since some
+// container setups expose the cgroup hierarchy through them.
+func (s Source) ReadFile(name string) ([]byte, error) {
+	if s.OnRead != nil {
+		s.OnRead(name)
+	}
+	res, err := s.run(func() (interface{}, error) {
+		return readFileRetrying(s.path(name))
+	})
+	data, _ := res.([]byte)
+	return data, err
+}
+
+// readFileRetrying reads the file at path in full, retrying up to
+// _readRetries times if the read is interrupted (EINTR) or would block
+// (EAGAIN), which busy hosts occasionally report for proc and cgroup files.
+func readFileRetrying(path string) ([]byte, error) {
+	data, err := _readFile(path)
+	for i := 0; i < _readRetries && isTransient(err); i++ {
+		data, err = _readFile(path)
+	}
+	return data, err
+}
+
+// isTransient reports whether err is worth retrying the read for.
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN)
+}
+
+// open reads the named file in full and returns a reader for its contents.
+func (s Source) open(name string) (io.Reader, error) {
+	data, err := s.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// stat reports whether the named file exists.
+func (s Source) stat(name string) error {
+	if s.OnRead != nil {
+		s.OnRead(name)
+	}
+	_, err := s.run(func() (interface{}, error) {
+		_, err := os.Stat(s.path(name))
+		return nil, err
+	})
+	return err
+}
+
+// readDir returns the names of the entries of the named directory, sorted.
+func (s Source) readDir(name string) ([]string, error) {
+	res, err := s.run(func() (interface{}, error) {
+		infos, err := ioutil.ReadDir(s.path(name))
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		return names, err
+	})
+	names, _ := res.([]string)
+	return names, err
+}
+
+// run calls f and returns its result, returning early if s.Context is done
+// first. Reads from pseudo file systems can block indefinitely (e.g. on a
+// hung FUSE mount), so f runs in its own goroutine rather than checking the
+// context between reads. The result is sent back over a channel, so that an
+// abandoned f never writes to memory the caller still uses. Only one f runs
+// at a time per sourceKey, so that reads abandoned on a hung mount don't
+// pile up.
+func (s Source) run(f func() (interface{}, error)) (interface{}, error) {
+	if s.Context == nil {
+		return f()
+	}
+	if err := s.Context.Err(); err != nil {
+		return nil, err
+	}
+
+	token := s.readToken()
+	select {
+	case token <- struct{}{}:
+	case <-s.Context.Done():
+		return nil, s.Context.Err()
+	}
+
+	type result struct {
+		val interface{}
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		val, err := f()
+		<-token
+		done <- result{val, err}
+	}()
+	select {
+	case r := <-done:
+		return r.val, r.err
+	case <-s.Context.Done():
+		return nil, s.Context.Err()
+	}
+}
+
+// readToken returns the channel holding the token of the read in progress
+// from the file system of s.
+func (s Source) readToken() chan struct{} {
+	key := sourceKey{root: s.Root, procMount: s.ProcMount, cgroupMount: s.CGroupMount}
+	token, _ := _reads.LoadOrStore(key, make(chan struct{}, 1))
+	return token.(chan struct{})
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceRoot(t *testing.T) {
+	src := Source{Root: testDataCGroupsPath}
+	cgroup := src.NewCGroup("/cpu")
+	assert.Equal(t, "/cpu", cgroup.Path())
+
+	quota, err := cgroup.readInt(_cgroupCPUCFSQuotaUsParam)
+	assert.Equal(t, int64(600000), quota)
+	assert.NoError(t, err)
+}
+
+func TestSourceContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	src := Source{Root: filepath.Join(testDataPath, "root", "v1"), Context: ctx}
+	cgroups, err := src.NewCGroupsForCurrentProcess()
+	assert.Nil(t, cgroups)
+	assert.Equal(t, context.Canceled, err)
+
+	isV2, err := src.IsCGroupV2()
+	assert.False(t, isV2)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestSourceContextAbandonsRead(t *testing.T) {
+	defer func(f func(string) ([]byte, error)) { _readFile = f }(_readFile)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	_readFile = func(path string) ([]byte, error) {
+		defer close(finished)
+		// The read completes only after ReadFile gave up on it, so the race
+		// detector flags any write it makes to the values returned.
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		return []byte("max 100000\n"), nil
+	}
+
+	data, err := Source{Context: ctx}.ReadFile("/sys/fs/cgroup/cpu.max")
+	assert.Nil(t, data)
+	assert.Equal(t, context.Canceled, err)
+	<-finished
+}
+
+func TestSourceContextSingleRead(t *testing.T) {
+	defer func(f func(string) ([]byte, error)) { _readFile = f }(_readFile)
+
+	release := make(chan struct{})
+	calls := make(chan string, 3)
+	_readFile = func(path string) ([]byte, error) {
+		calls <- path
+		<-release
+		return []byte("max 100000\n"), nil
+	}
+	src := Source{Root: t.TempDir()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	src.Context = ctx
+	go func() {
+		<-calls
+		cancel()
+	}()
+	_, err := src.ReadFile("/sys/fs/cgroup/cpu.max")
+	assert.Equal(t, context.Canceled, err)
+
+	// The hung read is still in progress, so the next one waits for it
+	// instead of starting another.
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	src.Context = ctx
+	_, err = src.ReadFile("/sys/fs/cgroup/cpu.max")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Empty(t, calls, "shouldn't start a read while one is in progress")
+
+	close(release)
+	src.Context = context.Background()
+	data, err := src.ReadFile("/sys/fs/cgroup/cpu.max")
+	require.NoError(t, err)
+	assert.Equal(t, "max 100000\n", string(data))
+	assert.Len(t, calls, 1, "should read once the hung read returned")
+}
+
+func TestSourceWithoutContext(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join(testDataCGroupsPath, "cpu", _cgroupCPUCFSQuotaUsParam))
+	require.NoError(t, err)
+
+	r, err := Source{}.open(filepath.Join(testDataCGroupsPath, "cpu", _cgroupCPUCFSQuotaUsParam))
+	require.NoError(t, err)
+	got, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
+
+func TestSourceOnRead(t *testing.T) {
+	var names []string
+	src := Source{
+		Root:   filepath.Join(testDataPath, "root", "v2"),
+		OnRead: func(name string) { names = append(names, name) },
+	}
+
+	quota, defined, err := src.CPUQuotaV2()
+	require.NoError(t, err)
+	assert.True(t, defined)
+	assert.Equal(t, 3.0, quota)
+	assert.Contains(t, names, _procPathMountInfo)
+	assert.Contains(t, names, _procPathCGroup)
+	assert.Contains(t, names, "/sys/fs/cgroup/cpu.max")
+}
+
+func TestSourceProcMount(t *testing.T) {
+	// host-proc mounts proc at /host/proc, as node agents often do.
+	var names []string
+	src := Source{
+		Root:      filepath.Join(testDataPath, "root", "host-proc"),
+		ProcMount: "/host/proc",
+		OnRead:    func(name string) { names = append(names, name) },
+	}
+
+	isV2, err := src.IsCGroupV2()
+	assert.True(t, isV2)
+	assert.NoError(t, err)
+
+	quota, defined, err := src.CPUQuotaV2()
+	require.NoError(t, err)
+	assert.True(t, defined)
+	assert.Equal(t, 2.0, quota)
+	assert.Contains(t, names, "/host/proc/self/mountinfo")
+	assert.Contains(t, names, "/host/proc/self/cgroup")
+	assert.NotContains(t, names, _procPathMountInfo)
+
+	src.ProcMount = ""
+	_, _, err = src.CPUQuotaV2()
+	assert.Error(t, err, "proc isn't mounted at /proc")
+}
+
+func TestSourceCGroupMount(t *testing.T) {
+	// host-cgroup and host-cgroup-v1 expose the hierarchies listed under
+	// /sys/fs/cgroup in mountinfo at /host/sys/fs/cgroup.
+	src := Source{
+		Root:        filepath.Join(testDataPath, "root", "host-cgroup"),
+		CGroupMount: "/host/sys/fs/cgroup",
+	}
+	quota, defined, err := src.CPUQuotaV2()
+	require.NoError(t, err)
+	assert.True(t, defined)
+	assert.Equal(t, 2.5, quota)
+
+	cgroup, err := src.NewUnifiedCGroupForCurrentProcess()
+	require.NoError(t, err)
+	assert.Equal(t, "/host/sys/fs/cgroup/pod", cgroup.Path())
+
+	src.Root = filepath.Join(testDataPath, "root", "host-cgroup-v1")
+	cgroups, err := src.NewCGroupsForCurrentProcess()
+	require.NoError(t, err)
+	quota, defined, err = cgroups.CPUQuota()
+	require.NoError(t, err)
+	assert.True(t, defined)
+	assert.Equal(t, 1.5, quota)
+	_, defined, err = cgroups.MemoryLimit()
+	require.NoError(t, err)
+	assert.True(t, defined)
+
+	src.CGroupMount = ""
+	cgroups, err = src.NewCGroupsForCurrentProcess()
+	require.NoError(t, err)
+	_, _, err = cgroups.CPUQuota()
+	assert.Error(t, err, "cgroups aren't mounted at /sys/fs/cgroup")
+
+	src.CGroupMount = "/host/sys/fs/cgroup"
+	assert.Equal(t, "/host/sys/fs/cgroup", src.cgroupMountPath("/sys/fs/cgroup"))
+	assert.Equal(t, "/host/sys/fs/cgroup/cpu", src.cgroupMountPath("/sys/fs/cgroup/cpu"))
+	assert.Equal(t, "/sys/fs/cgroupfoo", src.cgroupMountPath("/sys/fs/cgroupfoo"))
+	assert.Equal(t, "/cgroup/cpu", src.cgroupMountPath("/cgroup/cpu"))
+}
+
+func TestSourceReadFileRetries(t *testing.T) {
+	defer func(f func(string) ([]byte, error)) { _readFile = f }(_readFile)
+
+	// failing returns a read function that fails with err the first n times
+	// it's called, counting the calls in calls.
+	failing := func(n int, err error, calls *int) func(string) ([]byte, error) {
+		return func(path string) ([]byte, error) {
+			*calls++
+			if *calls <= n {
+				return nil, &os.PathError{Op: "read", Path: path, Err: err}
+			}
+			return ioutil.ReadFile(path)
+		}
+	}
+	src := Source{Root: filepath.Join(testDataPath, "root", "v2")}
+
+	testTable := []struct {
+		name            string
+		failures        int
+		err             error
+		expectedCalls   int
+		shouldHaveError bool
+	}{
+		{name: "eintr", failures: 1, err: syscall.EINTR, expectedCalls: 2},
+		{name: "eagain", failures: 2, err: syscall.EAGAIN, expectedCalls: 3},
+		{name: "persistent", failures: 3, err: syscall.EINTR, expectedCalls: 3, shouldHaveError: true},
+		{name: "permanent", failures: 1, err: syscall.EACCES, expectedCalls: 1, shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		calls := 0
+		_readFile = failing(tt.failures, tt.err, &calls)
+		data, err := src.ReadFile("/sys/fs/cgroup/cpu.max")
+		assert.Equal(t, tt.expectedCalls, calls, tt.name)
+		if tt.shouldHaveError {
+			assert.True(t, errors.Is(err, tt.err), "%v: unexpected error %v", tt.name, err)
+			continue
+		}
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, "300000 100000\n", string(data), tt.name)
+	}
+
+	calls := 0
+	_readFile = failing(1, syscall.EINTR, &calls)
+	quota, defined, err := src.CPUQuotaV2()
+	assert.Equal(t, 3.0, quota, "a transient error shouldn't fail detection")
+	assert.True(t, defined)
+	assert.NoError(t, err)
+}
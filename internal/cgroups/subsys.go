@@ -18,14 +18,10 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-//go:build linux
-// +build linux
-
 package cgroups
 
 import (
 	"bufio"
-	"os"
 	"strconv"
 	"strings"
 )
@@ -75,29 +71,18 @@ func NewCGroupSubsysFromLine(line string) (*CGroupSubsys, error) {
 
 // parseCGroupSubsystems parses procPathCGroup (usually at `/proc/$PID/cgroup`)
 // and returns a new map[string]*CGroupSubsys.
-func parseCGroupSubsystems(procPathCGroup string) (map[string]*CGroupSubsys, error) {
-	cgroupFile, err := os.Open(procPathCGroup)
+func (s Source) parseCGroupSubsystems(procPathCGroup string) (map[string]*CGroupSubsys, error) {
+	data, err := s.ReadFile(procPathCGroup)
 	if err != nil {
 		return nil, err
 	}
-	defer cgroupFile.Close()
 
-	scanner := bufio.NewScanner(cgroupFile)
 	subsystems := make(map[string]*CGroupSubsys)
-
-	for scanner.Scan() {
-		cgroup, err := NewCGroupSubsysFromLine(scanner.Text())
-		if err != nil {
-			return nil, err
-		}
-		for _, subsys := range cgroup.Subsystems {
-			subsystems[subsys] = cgroup
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
+	err = forEachLine(data, bufio.MaxScanTokenSize, func(line []byte) error {
+		return s.addCGroupSubsys(subsystems, line)
+	})
+	if err != nil {
 		return nil, err
 	}
-
 	return subsystems, nil
 }
@@ -18,12 +18,10 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-//go:build linux
-// +build linux
-
 package cgroups
 
 import (
+	"path/filepath"
 	"strconv"
 	"testing"
 
@@ -72,6 +70,25 @@ func TestNewCGroupSubsysFromLine(t *testing.T) {
 	}
 }
 
+func TestParseCGroupSubsystemsWithColons(t *testing.T) {
+	const name = "/kubepods.slice/kubepods-pod1.slice:cri-containerd:abc"
+
+	subsystems, err := Source{}.parseCGroupSubsystems(filepath.Join(testDataProcPath, "colons", "cgroup"))
+	assert.NoError(t, err)
+	assert.Equal(t, name, subsystems[_cgroupSubsysCPU].Name)
+	assert.Equal(t, name, subsystems[_cgroupSubsysMemory].Name)
+	assert.Equal(t, "/", subsystems[_cgroupSubsysCPUSet].Name)
+	// A trailing separator is kept as part of the path rather than rejected.
+	assert.Equal(t, name+":", subsystems[_cgroupv2SubsysName].Name)
+
+	cgroups, err := NewCGroups(
+		filepath.Join(testDataProcPath, "colons", "mountinfo"),
+		filepath.Join(testDataProcPath, "colons", "cgroup"),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "/sys/fs/cgroup/cpu,cpuacct"+name, cgroups[_cgroupSubsysCPU].Path())
+}
+
 func TestNewCGroupSubsysFromLineErr(t *testing.T) {
 	lines := []string{
 		"1:cpu",
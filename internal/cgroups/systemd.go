@@ -0,0 +1,203 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// _systemdCPUQuotaKey is the unit setting systemd derives the
+	// CPUQuotaPerSecUSec property from, e.g. `CPUQuota=150%`. An empty
+	// value resets it to infinity.
+	_systemdCPUQuotaKey = "CPUQuota"
+	// _systemdDropInSuffix suffixes the directories of the drop-ins of a
+	// unit, and _systemdDropInExt the drop-ins themselves.
+	_systemdDropInSuffix = ".d"
+	_systemdDropInExt    = ".conf"
+	// _cgroupSubsysNameSystemd is the named hierarchy systemd tracks units
+	// in with cgroup v1.
+	_cgroupSubsysNameSystemd = "name=systemd"
+)
+
+// _systemdUnitDirs are the directories systemd loads units and their
+// drop-ins from, by decreasing precedence. `systemctl set-property` writes
+// to the `system.control` ones, and transient units such as those of
+// container runtimes are written to `/run/systemd/transient`.
+var _systemdUnitDirs = []string{
+	"/etc/systemd/system.control",
+	"/run/systemd/system.control",
+	"/run/systemd/transient",
+	"/etc/systemd/system",
+	"/run/systemd/system",
+	"/usr/lib/systemd/system",
+	"/lib/systemd/system",
+}
+
+// _systemdUnitSuffixes are the suffixes of the units a cgroup path is made
+// of: slices, and the service or scope of the process.
+var _systemdUnitSuffixes = []string{".slice", ".service", ".scope"}
+
+// SystemdCPUQuota returns the CPU quota systemd applies to the unit of the
+// calling process, for hosts where its cgroup files can't be read. The
+// units are taken from the cgroup path of the process, e.g. `system.slice`
+// and `app.service` for `/system.slice/app.service`, and the quota is read
+// from the `CPUQuota=` setting of their unit files and drop-ins, which is
+// what the CPUQuotaPerSecUSec property of the unit reflects. The quota is a
+// fraction of a second of CPU time per second, so the enforcement period
+// set with CPUQuotaPeriodSec doesn't change it. The lowest quota of the
+// unit and its slices wins. It returns false if the process runs outside
+// of systemd units or none of them sets a quota.
+func (s Source) SystemdCPUQuota() (float64, bool, error) {
+	subsystems, err := s.parseCGroupSubsystems(s.procPath(_procPathCGroup))
+	if err != nil {
+		return -1, false, err
+	}
+	subsys, ok := subsystems[_cgroupv2SubsysName]
+	if !ok {
+		subsys, ok = subsystems[_cgroupSubsysNameSystemd]
+	}
+	if !ok {
+		return -1, false, nil
+	}
+
+	quota, defined := -1.0, false
+	for _, unit := range strings.Split(subsys.Name, "/") {
+		if !isSystemdUnit(unit) {
+			continue
+		}
+		unitQuota, unitDefined, err := s.systemdUnitCPUQuota(unit)
+		if err != nil {
+			return -1, false, err
+		}
+		if unitDefined && (!defined || unitQuota < quota) {
+			quota, defined = unitQuota, true
+		}
+	}
+	return quota, defined, nil
+}
+
+// isSystemdUnit reports whether name, a component of a cgroup path, is the
+// name of a systemd unit.
+func isSystemdUnit(name string) bool {
+	for _, suffix := range _systemdUnitSuffixes {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// systemdUnitCPUQuota returns the CPU quota set for unit. As with systemd,
+// the unit file is the first one found in _systemdUnitDirs, and is amended
+// by the drop-ins of every directory in the order of their names, a
+// drop-in hiding those with the same name in directories of lower
+// precedence.
+func (s Source) systemdUnitCPUQuota(unit string) (float64, bool, error) {
+	var files []string
+	for _, dir := range _systemdUnitDirs {
+		name := path.Join(dir, unit)
+		if err := s.stat(name); err == nil {
+			files = append(files, name)
+			break
+		} else if !os.IsNotExist(err) {
+			return -1, false, err
+		}
+	}
+
+	dropIns := make(map[string]string)
+	for _, dir := range _systemdUnitDirs {
+		dropInDir := path.Join(dir, unit+_systemdDropInSuffix)
+		names, err := s.readDir(dropInDir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return -1, false, err
+		}
+		for _, name := range names {
+			if _, hidden := dropIns[name]; !hidden && strings.HasSuffix(name, _systemdDropInExt) {
+				dropIns[name] = path.Join(dropInDir, name)
+			}
+		}
+	}
+	names := make([]string, 0, len(dropIns))
+	for name := range dropIns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		files = append(files, dropIns[name])
+	}
+
+	quota, defined := -1.0, false
+	for _, name := range files {
+		data, err := s.ReadFile(name)
+		if err != nil {
+			return -1, false, err
+		}
+		forEachSystemdSetting(data, _systemdCPUQuotaKey, func(value string) {
+			if value == "" {
+				quota, defined = -1, false
+			} else if q, ok := parseSystemdCPUQuota(value); ok {
+				quota, defined = q, true
+			}
+		})
+	}
+	return quota, defined, nil
+}
+
+// forEachSystemdSetting calls f with the value of every assignment of key in
+// the unit file data, in order.
+func forEachSystemdSetting(data []byte, key string, f func(value string)) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 || strings.TrimSpace(line[:eq]) != key {
+			continue
+		}
+		f(strings.TrimSpace(line[eq+1:]))
+	}
+}
+
+// parseSystemdCPUQuota converts the value of a `CPUQuota=` setting, a
+// percentage of one CPU such as `150%`, to a number of CPUs. It returns
+// false for invalid values, which systemd ignores.
+func parseSystemdCPUQuota(value string) (float64, bool) {
+	if !strings.HasSuffix(value, "%") {
+		return -1, false
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil || percent <= 0 {
+		return -1, false
+	}
+	return percent / 100, true
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceSystemdCPUQuota(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedQuota   float64
+		expectedDefined bool
+		shouldHaveError bool
+	}{
+		// The set-property drop-in overrides the unit file and the other
+		// drop-ins, and the slice allows more.
+		{name: "systemd-service", expectedQuota: 1.5, expectedDefined: true},
+		// An empty CPUQuota= resets the quota to infinity.
+		{name: "systemd-infinity", expectedQuota: -1},
+		// A transient scope in the name=systemd hierarchy of cgroup v1.
+		{name: "systemd-scope-v1", expectedQuota: 0.75, expectedDefined: true},
+		// Not running in a systemd unit.
+		{name: "v2", expectedQuota: -1},
+		{name: "nonexistent", expectedQuota: -1, shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		src := Source{Root: filepath.Join(testDataPath, "root", tt.name)}
+		quota, defined, err := src.SystemdCPUQuota()
+		assert.Equal(t, tt.expectedQuota, quota, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
+
+func TestParseSystemdCPUQuota(t *testing.T) {
+	testTable := []struct {
+		value           string
+		expectedQuota   float64
+		expectedDefined bool
+	}{
+		{value: "150%", expectedQuota: 1.5, expectedDefined: true},
+		{value: "20%", expectedQuota: 0.2, expectedDefined: true},
+		{value: "12.5%", expectedQuota: 0.125, expectedDefined: true},
+		{value: "0%", expectedQuota: -1},
+		{value: "150", expectedQuota: -1},
+		{value: "lots%", expectedQuota: -1},
+		{value: "infinity", expectedQuota: -1},
+	}
+
+	for _, tt := range testTable {
+		quota, defined := parseSystemdCPUQuota(tt.value)
+		assert.Equal(t, tt.expectedQuota, quota, tt.value)
+		assert.Equal(t, tt.expectedDefined, defined, tt.value)
+	}
+}
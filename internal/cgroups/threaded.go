@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// _cgroupv2Type is the file name for the type of a CGroup-V2 directory,
+	// e.g. "domain" or "threaded".
+	_cgroupv2Type = "cgroup.type"
+	// _cgroupv2TypeThreaded is contained in the type of the directories of
+	// a threaded subtree: "domain threaded" for its root and "threaded"
+	// below it.
+	_cgroupv2TypeThreaded = "threaded"
+
+	// _procPathTaskCGroup is the format of the path of the cgroup file of a
+	// thread of the current process, given its ID.
+	_procPathTaskCGroup = "/proc/self/task/%d/cgroup"
+)
+
+// IsThreadedV2 returns true if the cgroup2 directory is part of a threaded
+// subtree, whose threads may be placed in cgroups of their own, each with
+// its own cpu.max. If cgroup.type doesn't exist, as for the root cgroup, the
+// method returns `(false, nil)`.
+func (cg *CGroup) IsThreadedV2() (bool, error) {
+	text, err := cg.readFirstLine(_cgroupv2Type)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return strings.Contains(text, _cgroupv2TypeThreaded), nil
+}
+
+// IsThreadedV2 returns true if the cgroup2 directory of the current process
+// is part of a threaded subtree. See CGroup.IsThreadedV2.
+func (s Source) IsThreadedV2() (bool, error) {
+	cgroup, err := s.NewUnifiedCGroupForCurrentProcess()
+	if cgroup == nil || err != nil {
+		return false, err
+	}
+	return cgroup.IsThreadedV2()
+}
+
+// NewUnifiedCGroupForThread returns the *CGroup of the cgroup2 unified
+// hierarchy that the thread tid of the current process belongs to, read from
+// `/proc/self/task/<tid>/cgroup`. It differs from that of the process only
+// in threaded subtrees. See NewUnifiedCGroup.
+func (s Source) NewUnifiedCGroupForThread(tid int) (*CGroup, error) {
+	return s.NewUnifiedCGroup(s.procPath(_procPathMountInfo), s.procPath(fmt.Sprintf(_procPathTaskCGroup, tid)))
+}
+
+// ThreadCPUQuotaV2 returns the CPU quota applied with the CPU cgroup2
+// controller to the thread tid of the current process. See CGroup.CPUQuotaV2.
+func (s Source) ThreadCPUQuotaV2(tid int) (float64, bool, error) {
+	cgroup, err := s.NewUnifiedCGroupForThread(tid)
+	if cgroup == nil || err != nil {
+		return -1, false, err
+	}
+	return cgroup.CPUQuotaV2()
+}
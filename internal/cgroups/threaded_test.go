@@ -0,0 +1,75 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cgroups
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceIsThreadedV2(t *testing.T) {
+	testTable := []struct {
+		name             string
+		expectedThreaded bool
+		shouldHaveError  bool
+	}{
+		{name: "v2-threaded", expectedThreaded: true},
+		{name: "v2", expectedThreaded: false},
+		{name: "v1", expectedThreaded: false},
+		{name: "nonexistent", shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		threaded, err := Source{Root: filepath.Join(testDataPath, "root", tt.name)}.IsThreadedV2()
+		assert.Equal(t, tt.expectedThreaded, threaded, tt.name)
+
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
+
+func TestSourceThreadCPUQuotaV2(t *testing.T) {
+	src := Source{Root: filepath.Join(testDataPath, "root", "v2-threaded")}
+
+	quota, defined, err := src.CPUQuotaV2()
+	assert.NoError(t, err, "process")
+	assert.True(t, defined, "process")
+	assert.Equal(t, 4.0, quota, "process")
+
+	quota, defined, err = src.ThreadCPUQuotaV2(42)
+	assert.NoError(t, err, "thread")
+	assert.True(t, defined, "thread")
+	assert.Equal(t, 1.0, quota, "thread")
+
+	cgroup, err := src.NewUnifiedCGroupForThread(42)
+	assert.NoError(t, err, "thread cgroup")
+	threaded, err := cgroup.IsThreadedV2()
+	assert.NoError(t, err, "thread cgroup")
+	assert.True(t, threaded, "thread cgroup")
+
+	_, _, err = src.ThreadCPUQuotaV2(7)
+	assert.Error(t, err, "unknown thread")
+}
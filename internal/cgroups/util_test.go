@@ -18,27 +18,81 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-//go:build linux
-// +build linux
-
 package cgroups
 
 import (
+	"embed"
+	"io/fs"
+	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// testDataFS holds every fixture so that the test binary carries its own
+// cgroup layouts and doesn't depend on the working directory.
+//
+//go:embed testdata
+var testDataFS embed.FS
+
 var (
-	pwd                 = mustGetWd()
-	testDataPath        = filepath.Join(pwd, "testdata")
-	testDataCGroupsPath = filepath.Join(testDataPath, "cgroups")
-	testDataProcPath    = filepath.Join(testDataPath, "proc")
+	testDataPath        string
+	testDataCGroupsPath string
+	testDataProcPath    string
 )
 
-func mustGetWd() string {
-	pwd, err := os.Getwd()
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "cgroups-testdata")
 	if err != nil {
-		panic(err)
+		log.Fatalf("couldn't create testdata directory: %v", err)
+	}
+	if err := extractTestData(testDataFS, dir); err != nil {
+		log.Fatalf("couldn't extract testdata: %v", err)
 	}
-	return pwd
+
+	testDataPath = filepath.Join(dir, "testdata")
+	testDataCGroupsPath = filepath.Join(testDataPath, "cgroups")
+	testDataProcPath = filepath.Join(testDataPath, "proc")
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// extractTestData writes every file of fsys into dir, preserving the
+// directory layout.
+func extractTestData(fsys fs.FS, dir string) error {
+	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, data, 0o644)
+	})
+}
+
+func TestExtractTestData(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, extractTestData(testDataFS, dir))
+
+	want, err := testDataFS.ReadFile("testdata/cgroups/cpu/cpu.cfs_quota_us")
+	require.NoError(t, err)
+	got, err := ioutil.ReadFile(filepath.Join(dir, "testdata", "cgroups", "cpu", "cpu.cfs_quota_us"))
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	info, err := os.Stat(filepath.Join(dir, "testdata", "proc", "cgroups"))
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
 }
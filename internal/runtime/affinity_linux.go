@@ -24,43 +24,35 @@
 package runtime
 
 import (
-	"math"
-
-	cg "github.com/emadolsky/automaxprocs/internal/cgroups"
+	"math/bits"
+	"syscall"
+	"unsafe"
 )
 
-// CPUQuotaToGOMAXPROCS converts the CPU quota applied to the calling process
-// to a valid GOMAXPROCS value.
-func CPUQuotaToGOMAXPROCS(minValue int) (int, CPUQuotaStatus, error) {
-	var quota float64
-	var defined bool
-	var err error
-
-	isV2, err := cg.IsCGroupV2()
-	if err != nil {
-		return -1, CPUQuotaUndefined, err
-	}
-
-	if isV2 {
-		quota, defined, err = cg.CPUQuotaV2()
-		if !defined || err != nil {
-			return -1, CPUQuotaUndefined, err
-		}
-	} else {
-		cgroups, err := cg.NewCGroupsForCurrentProcess()
-		if err != nil {
-			return -1, CPUQuotaUndefined, err
-		}
-
-		quota, defined, err = cgroups.CPUQuota()
-		if !defined || err != nil {
-			return -1, CPUQuotaUndefined, err
-		}
+// _affinityMaskWords is the size of the CPU mask passed to
+// sched_getaffinity(2), in 64-bit words. It covers 1024 CPUs, like glibc's
+// cpu_set_t.
+const _affinityMaskWords = 1024 / 64
+
+// SchedAffinityCPUs returns the number of CPUs the calling thread is allowed
+// to run on, as set with sched_setaffinity(2) (e.g. by taskset). It returns
+// an error if the syscall fails, e.g. on hosts with more than 1024 CPUs or
+// when it's blocked by a seccomp profile.
+func SchedAffinityCPUs() (int, error) {
+	var mask [_affinityMaskWords]uint64
+	_, _, errno := syscall.RawSyscall(
+		syscall.SYS_SCHED_GETAFFINITY,
+		0, // the calling thread
+		uintptr(len(mask)*8),
+		uintptr(unsafe.Pointer(&mask[0])),
+	)
+	if errno != 0 {
+		return 0, errno
 	}
 
-	maxProcs := int(math.Floor(quota))
-	if minValue > 0 && maxProcs < minValue {
-		return minValue, CPUQuotaMinUsed, nil
+	var n int
+	for _, word := range mask {
+		n += bits.OnesCount64(word)
 	}
-	return maxProcs, CPUQuotaUsed, nil
+	return n, nil
 }
@@ -0,0 +1,55 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build linux
+// +build linux
+
+package runtime
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedAffinityCPUs(t *testing.T) {
+	cpus, err := SchedAffinityCPUs()
+	require.NoError(t, err)
+	assert.True(t, cpus >= 1, "at least one CPU should be allowed")
+}
+
+func TestCPUQuotaToGOMAXPROCSWithSchedAffinity(t *testing.T) {
+	cpus, err := SchedAffinityCPUs()
+	require.NoError(t, err)
+
+	// The v2 fixture has a quota of 3 CPUs.
+	expectedMaxProcs, expectedStatus := 3, CPUQuotaUsed
+	if cpus < 3 {
+		expectedMaxProcs, expectedStatus = cpus, CPUAffinityUsed
+	}
+
+	opts := Options{RootPrefix: filepath.Join(testDataRootPath, "v2"), SchedAffinity: true}
+	maxProcs, status, err := CPUQuotaToGOMAXPROCS(1, DefaultRoundFunc, opts)
+	assert.Equal(t, expectedMaxProcs, maxProcs)
+	assert.Equal(t, expectedStatus, status)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	cg "github.com/emadolsky/automaxprocs/internal/cgroups"
+)
+
+// _cacheVersion is bumped whenever the format or the meaning of a cache
+// entry changes, so that entries written by other versions are ignored.
+const _cacheVersion = 1
+
+// cacheEntry is the content of Options.CacheFile.
+type cacheEntry struct {
+	Version         int            `json:"version"`
+	RootPrefix      string         `json:"rootPrefix"`
+	ProcMount       string         `json:"procMount,omitempty"`
+	CGroupMount     string         `json:"cgroupMount,omitempty"`
+	AddBurst        bool           `json:"addBurst"`
+	WalkCPUMax      bool           `json:"walkCPUMax,omitempty"`
+	SystemdFallback bool           `json:"systemdFallback,omitempty"`
+	Files           []cachedFile   `json:"files"`
+	Quota           float64        `json:"quota"`
+	Status          CPUQuotaStatus `json:"status"`
+}
+
+// cachedFile records the content of a file the cached quota was read from.
+type cachedFile struct {
+	Name string `json:"name"`
+	// Sum is the SHA-256 of the content of the file, or empty if it didn't
+	// exist.
+	Sum string `json:"sum"`
+}
+
+// cachedCPUQuota is like detectCPUQuota, but reuses the result cached in
+// opts.CacheFile by a previous call, possibly from another process, as long
+// as every cgroup and proc file it was read from is unchanged. Otherwise,
+// the quota is detected and the cache is rewritten.
+//
+// Files are compared by content rather than modification time, since cgroup
+// file systems don't update the latter when a limit is written. A cache hit
+// still reads the files, but skips parsing mountinfo and resolving the
+// hierarchies. The cache is rewritten with an atomic rename, so concurrent
+// processes never see a partial entry; failures to read or write it are
+// ignored and only cost a full detection.
+func cachedCPUQuota(opts Options) (float64, CPUQuotaStatus, error) {
+	if !opts.readable() {
+		return detectCPUQuota(opts)
+	}
+
+	src := opts.source()
+	if entry, ok := readCache(opts); ok && entry.valid(src) {
+		return entry.Quota, entry.Status, nil
+	}
+
+	read := make(map[string]struct{})
+	opts.OnRead = recordReads(read, opts.OnRead)
+	quota, status, err := detectCPUQuota(opts)
+	if err != nil {
+		return quota, status, err
+	}
+
+	entry := cacheEntry{
+		Version:         _cacheVersion,
+		RootPrefix:      opts.RootPrefix,
+		ProcMount:       opts.ProcMount,
+		CGroupMount:     opts.CGroupMount,
+		AddBurst:        opts.AddBurst,
+		WalkCPUMax:      opts.WalkCPUMax,
+		SystemdFallback: opts.SystemdFallback,
+		Quota:           quota,
+		Status:          status,
+	}
+	for name := range read {
+		entry.Files = append(entry.Files, cachedFile{Name: name, Sum: fileSum(src, name)})
+	}
+	sort.Slice(entry.Files, func(i, j int) bool { return entry.Files[i].Name < entry.Files[j].Name })
+	// Failing to write the cache only disables it.
+	WriteJSONFile(opts.CacheFile, entry)
+	return quota, status, nil
+}
+
+// readCache returns the entry of opts.CacheFile, if it exists and was
+// written for the same options.
+func readCache(opts Options) (cacheEntry, bool) {
+	data, err := ioutil.ReadFile(opts.CacheFile)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return cacheEntry{}, false
+	}
+	ok := entry.Version == _cacheVersion &&
+		entry.RootPrefix == opts.RootPrefix &&
+		entry.ProcMount == opts.ProcMount &&
+		entry.CGroupMount == opts.CGroupMount &&
+		entry.AddBurst == opts.AddBurst &&
+		entry.WalkCPUMax == opts.WalkCPUMax &&
+		entry.SystemdFallback == opts.SystemdFallback &&
+		len(entry.Files) > 0
+	return entry, ok
+}
+
+// valid reports whether every file e was read from is unchanged.
+func (e cacheEntry) valid(src cg.Source) bool {
+	for _, f := range e.Files {
+		if fileSum(src, f.Name) != f.Sum {
+			return false
+		}
+	}
+	return true
+}
+
+// fileSum returns the SHA-256 of the content of the named file, or an empty
+// string if it doesn't exist. Files that can't be read otherwise get a sum
+// no content has, so that entries depending on them are never valid.
+func fileSum(src cg.Source, name string) string {
+	data, err := src.ReadFile(name)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		return "unreadable"
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
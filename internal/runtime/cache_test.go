@@ -0,0 +1,192 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// copyRoot copies the fixture root name into a temporary directory, so that
+// tests can modify its files.
+func copyRoot(t testing.TB, name string) string {
+	dst := t.TempDir()
+	src := filepath.Join(testDataRootPath, name)
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, data, 0o644)
+	})
+	require.NoError(t, err, "couldn't copy %v", name)
+	return dst
+}
+
+func readCacheEntry(t *testing.T, path string) cacheEntry {
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err, "cache should have been written")
+	var entry cacheEntry
+	require.NoError(t, json.Unmarshal(data, &entry))
+	return entry
+}
+
+func TestCachedCPUQuota(t *testing.T) {
+	root := copyRoot(t, "v2")
+	cacheFile := filepath.Join(t.TempDir(), "maxprocs.cache")
+	opts := Options{RootPrefix: root, CacheFile: cacheFile}
+
+	quota, defined, err := CPUQuota(opts)
+	require.NoError(t, err)
+	assert.True(t, defined)
+	assert.Equal(t, 3.0, quota, "cold")
+
+	entry := readCacheEntry(t, cacheFile)
+	assert.Equal(t, 3.0, entry.Quota)
+	assert.Equal(t, CPUQuotaUsed, entry.Status)
+	var names []string
+	for _, f := range entry.Files {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"/proc/self/cgroup", "/proc/self/mountinfo", "/sys/fs/cgroup/cpu.max"}, names)
+
+	// Tamper with the cached quota to tell a cache hit from a detection.
+	entry.Quota = 7
+	data, err := json.Marshal(entry)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(cacheFile, data, 0o644))
+
+	quota, _, err = CPUQuota(opts)
+	require.NoError(t, err)
+	assert.Equal(t, 7.0, quota, "warm")
+
+	// Changing the quota invalidates the cache.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "sys", "fs", "cgroup", "cpu.max"), []byte("200000 100000\n"), 0o644))
+	quota, _, err = CPUQuota(opts)
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, quota, "after the quota changed")
+	assert.Equal(t, 2.0, readCacheEntry(t, cacheFile).Quota, "cache should have been rewritten")
+
+	// Options that change the result don't share the cache.
+	opts.AddBurst = true
+	_, ok := readCache(opts)
+	assert.False(t, ok, "AddBurst should be part of the key")
+}
+
+func TestCachedCPUQuotaCGroupMigration(t *testing.T) {
+	// Agents may migrate a running process to another cgroup by writing its
+	// PID to cgroup.procs. The cache depends on /proc/self/cgroup, so the
+	// migration invalidates it and the new cgroup is resolved.
+	root := copyRoot(t, "v2")
+	cacheFile := filepath.Join(t.TempDir(), "maxprocs.cache")
+	opts := Options{RootPrefix: root, CacheFile: cacheFile}
+
+	quota, _, err := CPUQuota(opts)
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, quota, "before the migration")
+
+	target := filepath.Join(root, "sys", "fs", "cgroup", "app")
+	require.NoError(t, os.MkdirAll(target, 0o755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(target, "cpu.max"), []byte("100000 100000\n"), 0o644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "proc", "self", "cgroup"), []byte("0::/app\n"), 0o644))
+
+	quota, _, err = CPUQuota(opts)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, quota, "after the migration")
+
+	var names []string
+	for _, f := range readCacheEntry(t, cacheFile).Files {
+		names = append(names, f.Name)
+	}
+	assert.Contains(t, names, "/sys/fs/cgroup/app/cpu.max", "cache should depend on the new cgroup")
+}
+
+func TestCachedCPUQuotaInvalidCache(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "maxprocs.cache")
+	opts := Options{RootPrefix: filepath.Join(testDataRootPath, "v1"), CacheFile: cacheFile}
+
+	for _, content := range []string{"", "{", `{"version":0,"quota":7}`} {
+		require.NoError(t, ioutil.WriteFile(cacheFile, []byte(content), 0o644))
+		quota, defined, err := CPUQuota(opts)
+		assert.NoError(t, err, "%q", content)
+		assert.True(t, defined, "%q", content)
+		assert.Equal(t, 1.5, quota, "%q should be ignored", content)
+	}
+
+	// A cache that can't be written doesn't fail detection.
+	opts.CacheFile = filepath.Join(t.TempDir(), "nonexistent", "maxprocs.cache")
+	quota, _, err := CPUQuota(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, quota)
+
+	// Errors aren't cached.
+	opts = Options{RootPrefix: filepath.Join(testDataRootPath, "nonexistent"), CacheFile: cacheFile}
+	require.NoError(t, os.Remove(cacheFile))
+	_, _, err = CPUQuota(opts)
+	assert.Error(t, err)
+	_, err = os.Stat(cacheFile)
+	assert.True(t, os.IsNotExist(err), "errors shouldn't be cached")
+}
+
+func BenchmarkCPUQuotaCache(b *testing.B) {
+	root := copyRoot(b, "v1")
+
+	b.Run("cold", func(b *testing.B) {
+		opts := Options{RootPrefix: root}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := CPUQuota(opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("warm", func(b *testing.B) {
+		opts := Options{RootPrefix: root, CacheFile: filepath.Join(b.TempDir(), "maxprocs.cache")}
+		if _, _, err := CPUQuota(opts); err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := CPUQuota(opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
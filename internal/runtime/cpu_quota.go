@@ -0,0 +1,368 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+import (
+	"errors"
+	"os"
+	goruntime "runtime"
+
+	cg "github.com/emadolsky/automaxprocs/internal/cgroups"
+)
+
+// CPUQuotaToGOMAXPROCS converts the CPU quota applied to the calling process
+// to a valid GOMAXPROCS value. The quota is converted from float to int
+// using round, once capped by the cpuset if opts.CPUSet is set and by the CPU
+// affinity mask if opts.SchedAffinity is set. The quota throttles the process
+// however many CPUs it may run on, so the smallest of these limits wins,
+// unless opts.CPUSetMax picks the larger of the quota and the cpuset; if no
+// quota is defined, the cpuset is used on its own when it has fewer CPUs
+// than the host.
+func CPUQuotaToGOMAXPROCS(minValue int, round func(v float64) int, opts Options) (int, CPUQuotaStatus, error) {
+	quota, status, err := cpuQuota(opts)
+	if err != nil {
+		return -1, status, err
+	}
+
+	cpuSetUsed := false
+	if opts.CPUSet && !opts.quotaOverridden() {
+		cpus, defined, err := CPUSetCPUs(opts)
+		if err != nil && opts.systemdFallback(err) {
+			cpus, defined, err = -1, false, nil
+		}
+		if err != nil {
+			return -1, CPUQuotaUndefined, err
+		}
+		useCPUSet := float64(cpus) < quota
+		if opts.CPUSetMax {
+			useCPUSet = float64(cpus) > quota
+		}
+		if status != CPUQuotaUsed {
+			// A cpuset spanning every CPU of the host doesn't limit the
+			// process, so the quota stays undefined.
+			useCPUSet = defined && cpus < hostCPUs(opts)
+		}
+		if defined && useCPUSet {
+			quota, status, cpuSetUsed = float64(cpus), CPUQuotaUsed, true
+		}
+	}
+	if status != CPUQuotaUsed {
+		return -1, status, nil
+	}
+
+	affinityUsed := false
+	if opts.SchedAffinity {
+		if cpus, err := SchedAffinityCPUs(); err == nil && cpus > 0 && float64(cpus) < quota {
+			quota, affinityUsed = float64(cpus), true
+		}
+	}
+
+	maxProcs, status := QuotaToGOMAXPROCS(quota, minValue, round)
+	if status == CPUQuotaUsed {
+		switch {
+		case affinityUsed:
+			status = CPUAffinityUsed
+		case cpuSetUsed:
+			status = CPUSetUsed
+		}
+	}
+	return maxProcs, status, nil
+}
+
+// CPUSetCPUs returns the number of CPUs in the cpuset of the calling
+// process, reading cpuset.cpus.effective from cgroup2 if the system uses it
+// or the cpuset controller is attached to the unified hierarchy, and
+// cpuset.cpus from the cgroup v1 cpuset controller otherwise. It returns
+// false if no cpuset is defined.
+func CPUSetCPUs(opts Options) (int, bool, error) {
+	cpus, status, err := memoized(opts, _memoCPUSet, func() (float64, CPUQuotaStatus, error) {
+		cpus, defined, err := cpuSetCPUs(opts)
+		return float64(cpus), quotaStatus(defined), err
+	})
+	return int(cpus), status == CPUQuotaUsed, err
+}
+
+// cpuSetCPUs reads the cpuset like CPUSetCPUs, without memoizing it.
+func cpuSetCPUs(opts Options) (int, bool, error) {
+	if !opts.readable() {
+		return -1, false, nil
+	}
+
+	src := opts.source()
+	isV2, err := src.IsCGroupV2()
+	if err != nil {
+		return -1, false, err
+	}
+	if isV2 {
+		return src.CPUSetCPUsV2()
+	}
+
+	cgroups, err := src.NewCGroupsForCurrentProcess()
+	if err != nil {
+		return -1, false, err
+	}
+	if !cgroups.HasCPUSetController() {
+		return src.CPUSetCPUsV2()
+	}
+	return cgroups.CPUSetCPUs()
+}
+
+// hostCPUs returns the number of CPUs online on the host, or runtime.NumCPU
+// if that can't be read.
+func hostCPUs(opts Options) int {
+	if opts.readable() {
+		if cpus, defined, err := opts.source().OnlineCPUs(); err == nil && defined {
+			return cpus
+		}
+	}
+	return goruntime.NumCPU()
+}
+
+// CPUQuota returns the CPU quota applied to the calling process, reading it
+// from cgroup2 if the system uses it and from the cgroup v1 CPU controller
+// otherwise.
+func CPUQuota(opts Options) (float64, bool, error) {
+	quota, status, err := cpuQuota(opts)
+	return quota, status == CPUQuotaUsed, err
+}
+
+// CPUQuotaStatusOf returns the CPU quota applied to the calling process like
+// CPUQuota, along with the status cpuQuota describes, so that callers can
+// tell an undefined quota from an unavailable CPU controller.
+func CPUQuotaStatusOf(opts Options) (float64, CPUQuotaStatus, error) {
+	return cpuQuota(opts)
+}
+
+// CPUBurst returns the CPU burst applied to the calling process on top of
+// its CPU quota, as a number of CPUs, reading it from the same hierarchy as
+// CPUQuota. It returns false if no burst is set, the kernel doesn't support
+// burst or no CPU quota is defined.
+func CPUBurst(opts Options) (float64, bool, error) {
+	burst, status, err := memoized(opts, _memoCPUBurst, func() (float64, CPUQuotaStatus, error) {
+		_, burst, _, err := cpuLimits(opts, true)
+		return burst, quotaStatus(burst > 0), err
+	})
+	return burst, status == CPUQuotaUsed, err
+}
+
+// cpuQuota reads the CPU quota of the calling process, adding the CPU burst
+// to it if opts.AddBurst is set. The returned status is CPUQuotaUsed if a
+// quota is defined, CPUQuotaControllerUnavailable if no hierarchy has the CPU
+// controller, and CPUQuotaUndefined otherwise.
+func cpuQuota(opts Options) (float64, CPUQuotaStatus, error) {
+	return memoized(opts, _memoCPUQuota, func() (float64, CPUQuotaStatus, error) {
+		if opts.CacheFile != "" && !opts.quotaOverridden() {
+			return cachedCPUQuota(opts)
+		}
+		return detectCPUQuota(opts)
+	})
+}
+
+// detectCPUQuota reads the CPU quota like cpuQuota, without a cache.
+func detectCPUQuota(opts Options) (float64, CPUQuotaStatus, error) {
+	quota, burst, status, err := cpuLimits(opts, opts.AddBurst)
+	if err != nil && opts.systemdFallback(err) {
+		return systemdCPUQuota(opts, err)
+	}
+	if status == CPUQuotaUsed && err == nil {
+		quota += burst
+	}
+	return quota, status, err
+}
+
+// cpuLimits reads the CPU quota of the calling process and, if withBurst is
+// set and a quota is defined, the CPU burst from the same hierarchy. See
+// cpuQuota for the returned status.
+func cpuLimits(opts Options, withBurst bool) (quota, burst float64, status CPUQuotaStatus, err error) {
+	if opts.CPUMaxFile != "" {
+		src := cg.Source{Context: opts.Context}
+		quota, defined, err := src.CPUQuotaFromFile(opts.CPUMaxFile)
+		return quota, 0, quotaStatus(defined), err
+	}
+	if opts.CGroupPath != "" {
+		src := cg.Source{Context: opts.Context}
+		quota, defined, err := src.CPUQuotaFromCGroup(opts.CGroupPath)
+		return quota, 0, quotaStatus(defined), err
+	}
+	if !opts.readable() {
+		// Outside of Linux, Windows job objects may restrict the CPUs the
+		// process runs on instead.
+		quota, status, err := jobLimits(_queryJobLimit)
+		return quota, 0, status, err
+	}
+
+	src := opts.source()
+	mode, unified, err := src.ModeAndUnifiedCGroup()
+	if err != nil {
+		return -1, 0, CPUQuotaUndefined, err
+	}
+
+	if mode == cg.ModeUnified {
+		if unified == nil {
+			return -1, 0, CPUQuotaUndefined, nil
+		}
+		return unifiedLimits(unified, withBurst, opts.WalkCPUMax)
+	}
+
+	cgroups, err := src.NewCGroupsForCurrentProcess()
+	if err != nil {
+		return -1, 0, CPUQuotaUndefined, err
+	}
+	if mode == cg.ModeHybrid {
+		// In hybrid mode, the CPU controller may be attached to the cgroup2
+		// unified hierarchy rather than to a v1 one, so a quota defined
+		// there is used first.
+		if unified != nil && unified.HasCPUQuotaV2() {
+			quota, burst, status, err := unifiedLimits(unified, withBurst, opts.WalkCPUMax)
+			if err != nil || status == CPUQuotaUsed || !cgroups.HasCPUController() {
+				return quota, burst, status, err
+			}
+		}
+	}
+	if !cgroups.HasCPUController() {
+		return -1, 0, CPUQuotaControllerUnavailable, nil
+	}
+	quota, defined, err := cgroups.CPUQuota()
+	if !defined || err != nil || !withBurst {
+		return quota, 0, quotaStatus(defined), err
+	}
+	burst, _, err = cgroups.CPUBurst()
+	return quota, burst, CPUQuotaUsed, err
+}
+
+// unifiedLimits reads the CPU quota and, if withBurst is set, the CPU burst
+// of a cgroup2 directory. If walk is set, the quota is the most restrictive
+// one of the directory and its ancestors.
+func unifiedLimits(unified *cg.CGroup, withBurst, walk bool) (float64, float64, CPUQuotaStatus, error) {
+	readQuota := unified.CPUQuotaV2
+	if walk {
+		readQuota = unified.EffectiveCPUQuotaV2
+	}
+	quota, defined, err := readQuota()
+	if !defined || err != nil || !withBurst {
+		return quota, 0, quotaStatus(defined), err
+	}
+	burst, _, err := unified.CPUBurstV2()
+	return quota, burst, CPUQuotaUsed, err
+}
+
+// systemdFallback reports whether the CPU quota is to be read from systemd
+// after err, the error reading the cgroup files.
+func (o Options) systemdFallback(err error) bool {
+	return o.SystemdFallback && errors.Is(err, os.ErrPermission)
+}
+
+// systemdCPUQuota reads the CPU quota from the systemd units of the calling
+// process, after err denied reading its cgroup files. The quota is undefined
+// if the units set none, and err is returned if they can't be read either.
+func systemdCPUQuota(opts Options, err error) (float64, CPUQuotaStatus, error) {
+	quota, defined, systemdErr := opts.source().SystemdCPUQuota()
+	if systemdErr != nil {
+		return -1, CPUQuotaUndefined, err
+	}
+	return quota, quotaStatus(defined), nil
+}
+
+func quotaStatus(defined bool) CPUQuotaStatus {
+	if defined {
+		return CPUQuotaUsed
+	}
+	return CPUQuotaUndefined
+}
+
+// CGroupLayout returns the layout of the cgroup hierarchies the calling
+// process belongs to.
+func CGroupLayout(opts Options) (Layout, error) {
+	if !opts.readable() {
+		return Layout{}, nil
+	}
+
+	src := opts.source()
+	mode, err := src.Mode()
+	if err != nil || mode == cg.ModeUnified {
+		return Layout{CGroupV2: mode == cg.ModeUnified}, err
+	}
+
+	cgroups, err := src.NewCGroupsForCurrentProcess()
+	if err != nil {
+		return Layout{}, err
+	}
+	return Layout{
+		Hybrid:          mode == cg.ModeHybrid,
+		CPUControllerV1: cgroups.HasCPUController(),
+	}, nil
+}
+
+// CGroupVersion returns the version of the cgroup hierarchies mounted: "v1",
+// "v2" or, if both are, "hybrid". It returns an empty string where the
+// cgroup files aren't read.
+func CGroupVersion(opts Options) (string, error) {
+	if !opts.readable() {
+		return "", nil
+	}
+
+	mode, err := opts.source().Mode()
+	switch {
+	case err != nil:
+		return "", err
+	case mode == cg.ModeUnified:
+		return "v2", nil
+	case mode == cg.ModeHybrid:
+		return "hybrid", nil
+	default:
+		return "v1", nil
+	}
+}
+
+// ContainerID returns the ID of the container the calling process runs in,
+// or an empty string if its cgroup path doesn't contain one.
+func ContainerID(opts Options) (string, error) {
+	if !opts.readable() {
+		return "", nil
+	}
+	return opts.source().ContainerIDForCurrentProcess()
+}
+
+// Supported reports whether the limits of the calling process can be
+// detected on the current OS, from cgroups on Linux and from job objects on
+// Windows. Elsewhere, only files given with options are read.
+func Supported() bool {
+	return _hostCGroups || _jobObjects
+}
+
+// quotaOverridden reports whether the CPU quota is read from a file or
+// directory given by o rather than from the cgroup of the calling process.
+func (o Options) quotaOverridden() bool {
+	return o.CPUMaxFile != "" || o.CGroupPath != ""
+}
+
+// readable reports whether the cgroup and proc files described by o can be
+// read. The files of the host are only read on Linux, while files under a
+// root prefix are read on every OS, e.g. to test the detection with fake
+// cgroups.
+func (o Options) readable() bool {
+	return _hostCGroups || o.RootPrefix != ""
+}
+
+// source returns where and how the cgroup and proc files are read.
+func (o Options) source() cg.Source {
+	return cg.Source{Root: o.RootPrefix, ProcMount: o.ProcMount, CGroupMount: o.CGroupMount, Context: o.Context, OnRead: o.OnRead}.WantControllers(cg.DefaultControllers)
+}
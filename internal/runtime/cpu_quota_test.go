@@ -0,0 +1,492 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testDataRootPath = filepath.Join("..", "cgroups", "testdata", "root")
+
+func TestCPUQuotaToGOMAXPROCS(t *testing.T) {
+	testTable := []struct {
+		name             string
+		minValue         int
+		expectedMaxProcs int
+		expectedStatus   CPUQuotaStatus
+	}{
+		{
+			name:             "v1",
+			minValue:         1,
+			expectedMaxProcs: 1,
+			expectedStatus:   CPUQuotaUsed,
+		},
+		{
+			name:             "v1",
+			minValue:         2,
+			expectedMaxProcs: 2,
+			expectedStatus:   CPUQuotaMinUsed,
+		},
+		{
+			name:             "v2",
+			minValue:         1,
+			expectedMaxProcs: 3,
+			expectedStatus:   CPUQuotaUsed,
+		},
+		{
+			name:             "hybrid",
+			minValue:         1,
+			expectedMaxProcs: 2,
+			expectedStatus:   CPUQuotaUsed,
+		},
+		{
+			name:             "custom-mount",
+			minValue:         1,
+			expectedMaxProcs: 2,
+			expectedStatus:   CPUQuotaUsed,
+		},
+		{
+			name:             "systemd-user",
+			minValue:         1,
+			expectedMaxProcs: 2,
+			expectedStatus:   CPUQuotaUsed,
+		},
+		{
+			name:             "v2-root-cgroup",
+			minValue:         1,
+			expectedMaxProcs: -1,
+			expectedStatus:   CPUQuotaUndefined,
+		},
+		{
+			name:             "gvisor",
+			minValue:         1,
+			expectedMaxProcs: 2,
+			expectedStatus:   CPUQuotaUsed,
+		},
+		{
+			name:             "cpuset-only",
+			minValue:         1,
+			expectedMaxProcs: -1,
+			expectedStatus:   CPUQuotaControllerUnavailable,
+		},
+		{
+			name:             "trailing-slash",
+			minValue:         1,
+			expectedMaxProcs: 1,
+			expectedStatus:   CPUQuotaUsed,
+		},
+		{
+			name:             "trailing-slash-v2",
+			minValue:         1,
+			expectedMaxProcs: 2,
+			expectedStatus:   CPUQuotaUsed,
+		},
+		{
+			name:             "v1-split-period",
+			minValue:         1,
+			expectedMaxProcs: 2,
+			expectedStatus:   CPUQuotaUsed,
+		},
+		{
+			name:             "v1-cpuacct-quota",
+			minValue:         1,
+			expectedMaxProcs: 3,
+			expectedStatus:   CPUQuotaUsed,
+		},
+	}
+
+	for _, tt := range testTable {
+		opts := Options{RootPrefix: filepath.Join(testDataRootPath, tt.name)}
+		maxProcs, status, err := CPUQuotaToGOMAXPROCS(tt.minValue, DefaultRoundFunc, opts)
+		assert.Equal(t, tt.expectedMaxProcs, maxProcs, tt.name)
+		assert.Equal(t, tt.expectedStatus, status, tt.name)
+		assert.NoError(t, err, tt.name)
+	}
+}
+
+func TestCPUQuotaToGOMAXPROCSWithCPUSet(t *testing.T) {
+	testTable := []struct {
+		name             string
+		quota            string
+		cpuSet           string
+		cpuSetMax        bool
+		minValue         int
+		expectedMaxProcs int
+		expectedStatus   CPUQuotaStatus
+	}{
+		{
+			name:             "v1",
+			quota:            "1.5",
+			cpuSet:           "undefined",
+			minValue:         1,
+			expectedMaxProcs: 1,
+			expectedStatus:   CPUQuotaUsed,
+		},
+		{
+			name:             "v1-cpuset",
+			quota:            "2",
+			cpuSet:           "8",
+			minValue:         1,
+			expectedMaxProcs: 2,
+			expectedStatus:   CPUQuotaUsed,
+		},
+		{
+			name:             "v2-cpuset",
+			quota:            "4",
+			cpuSet:           "2",
+			minValue:         1,
+			expectedMaxProcs: 2,
+			expectedStatus:   CPUSetUsed,
+		},
+		{
+			name:             "cpuset-inherit-v2",
+			quota:            "undefined",
+			cpuSet:           "2",
+			minValue:         1,
+			expectedMaxProcs: 2,
+			expectedStatus:   CPUSetUsed,
+		},
+		{
+			name:             "cpuset-inherit-v2",
+			quota:            "undefined",
+			cpuSet:           "2",
+			minValue:         3,
+			expectedMaxProcs: 3,
+			expectedStatus:   CPUQuotaMinUsed,
+		},
+		{
+			name:             "cpuset-only",
+			quota:            "unavailable",
+			cpuSet:           "4",
+			minValue:         1,
+			expectedMaxProcs: 4,
+			expectedStatus:   CPUSetUsed,
+		},
+		{
+			name:             "v1-cpuset",
+			quota:            "2",
+			cpuSet:           "8",
+			cpuSetMax:        true,
+			minValue:         1,
+			expectedMaxProcs: 8,
+			expectedStatus:   CPUSetUsed,
+		},
+		{
+			name:             "v2-cpuset",
+			quota:            "4",
+			cpuSet:           "2",
+			cpuSetMax:        true,
+			minValue:         1,
+			expectedMaxProcs: 4,
+			expectedStatus:   CPUQuotaUsed,
+		},
+		{
+			name:             "cpuset-inherit-v2",
+			quota:            "undefined",
+			cpuSet:           "2",
+			cpuSetMax:        true,
+			minValue:         1,
+			expectedMaxProcs: 2,
+			expectedStatus:   CPUSetUsed,
+		},
+		{
+			name:             "cpuset-full-host-v2",
+			quota:            "undefined",
+			cpuSet:           "8 of 8",
+			minValue:         1,
+			expectedMaxProcs: -1,
+			expectedStatus:   CPUQuotaUndefined,
+		},
+		{
+			name:             "v2-root-cgroup",
+			quota:            "undefined",
+			cpuSet:           "undefined",
+			minValue:         1,
+			expectedMaxProcs: -1,
+			expectedStatus:   CPUQuotaUndefined,
+		},
+	}
+
+	for _, tt := range testTable {
+		desc := fmt.Sprintf("%v: quota %v, cpuset %v, max %v", tt.name, tt.quota, tt.cpuSet, tt.cpuSetMax)
+		opts := Options{RootPrefix: filepath.Join(testDataRootPath, tt.name), CPUSet: true, CPUSetMax: tt.cpuSetMax}
+		maxProcs, status, err := CPUQuotaToGOMAXPROCS(tt.minValue, DefaultRoundFunc, opts)
+		assert.Equal(t, tt.expectedMaxProcs, maxProcs, desc)
+		assert.Equal(t, tt.expectedStatus, status, desc)
+		assert.NoError(t, err, desc)
+	}
+
+	// The cpuset is read from the cgroup hierarchy, which CPUMaxFile
+	// bypasses.
+	opts := Options{
+		RootPrefix: filepath.Join(testDataRootPath, "v2-cpuset"),
+		CPUMaxFile: filepath.Join(testDataRootPath, "v2-cpuset", "sys", "fs", "cgroup", "cpu.max"),
+		CPUSet:     true,
+	}
+	maxProcs, status, err := CPUQuotaToGOMAXPROCS(1, DefaultRoundFunc, opts)
+	assert.Equal(t, 4, maxProcs, "cpu.max file")
+	assert.Equal(t, CPUQuotaUsed, status, "cpu.max file")
+	assert.NoError(t, err, "cpu.max file")
+}
+
+func TestCPUSetCPUs(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedCPUs    int
+		expectedDefined bool
+	}{
+		{name: "v1", expectedCPUs: -1},
+		{name: "v1-cpuset", expectedCPUs: 8, expectedDefined: true},
+		{name: "v2", expectedCPUs: -1},
+		{name: "v2-cpuset", expectedCPUs: 2, expectedDefined: true},
+		{name: "cpuset-only", expectedCPUs: 4, expectedDefined: true},
+		{name: "cpuset-inherit", expectedCPUs: 5, expectedDefined: true},
+		{name: "cpuset-inherit-v2", expectedCPUs: 2, expectedDefined: true},
+		{name: "gvisor", expectedCPUs: 4, expectedDefined: true},
+	}
+
+	for _, tt := range testTable {
+		cpus, defined, err := CPUSetCPUs(Options{RootPrefix: filepath.Join(testDataRootPath, tt.name)})
+		assert.Equal(t, tt.expectedCPUs, cpus, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+		assert.NoError(t, err, tt.name)
+	}
+
+	_, defined, err := CPUSetCPUs(Options{RootPrefix: filepath.Join(testDataRootPath, "nonexistent")})
+	assert.False(t, defined)
+	assert.Error(t, err)
+}
+
+func TestCPUQuota(t *testing.T) {
+	quota, defined, err := CPUQuota(Options{RootPrefix: filepath.Join(testDataRootPath, "v2")})
+	assert.Equal(t, 3.0, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+
+	// Inside a cgroup namespace, the quota is read at the mount root.
+	quota, defined, err = CPUQuota(Options{RootPrefix: filepath.Join(testDataRootPath, "cgroupns")})
+	assert.Equal(t, 1.5, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+
+	quota, defined, err = CPUQuota(Options{RootPrefix: filepath.Join(testDataRootPath, "cgroupns-v2")})
+	assert.Equal(t, 2.0, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+
+	quota, defined, err = CPUQuota(Options{RootPrefix: filepath.Join(testDataRootPath, "cpuset-only")})
+	assert.Equal(t, -1.0, quota)
+	assert.False(t, defined)
+	assert.NoError(t, err)
+
+	_, defined, err = CPUQuota(Options{RootPrefix: filepath.Join(testDataRootPath, "nonexistent")})
+	assert.False(t, defined)
+	assert.Error(t, err)
+}
+
+func TestCPUQuotaHybrid(t *testing.T) {
+	testTable := []struct {
+		name          string
+		expectedQuota float64
+	}{
+		// The cpu controller is only attached to the unified hierarchy.
+		{name: "hybrid", expectedQuota: 2},
+		// Both hierarchies have cpu files, but only the unified one defines
+		// a quota.
+		{name: "hybrid-unified-quota", expectedQuota: 1.5},
+		// The unified cpu.max is unlimited, so the v1 quota is used.
+		{name: "hybrid-v1-quota", expectedQuota: 3},
+	}
+
+	for _, tt := range testTable {
+		quota, defined, err := CPUQuota(Options{RootPrefix: filepath.Join(testDataRootPath, tt.name)})
+		assert.NoError(t, err, tt.name)
+		assert.True(t, defined, tt.name)
+		assert.Equal(t, tt.expectedQuota, quota, tt.name)
+	}
+}
+
+func TestSystemdFallback(t *testing.T) {
+	denied := &os.PathError{Op: "open", Path: "/sys/fs/cgroup/cpu.max", Err: os.ErrPermission}
+
+	t.Run("errors", func(t *testing.T) {
+		assert.True(t, Options{SystemdFallback: true}.systemdFallback(denied))
+		assert.False(t, Options{}.systemdFallback(denied), "should require SystemdFallback")
+		assert.False(t, Options{SystemdFallback: true}.systemdFallback(os.ErrNotExist), "should only engage on permission errors")
+	})
+
+	t.Run("units", func(t *testing.T) {
+		testTable := []struct {
+			name           string
+			expectedQuota  float64
+			expectedStatus CPUQuotaStatus
+			expectedErr    error
+		}{
+			{name: "systemd-service", expectedQuota: 1.5, expectedStatus: CPUQuotaUsed},
+			{name: "systemd-infinity", expectedQuota: -1, expectedStatus: CPUQuotaUndefined},
+			{name: "nonexistent", expectedQuota: -1, expectedStatus: CPUQuotaUndefined, expectedErr: denied},
+		}
+		for _, tt := range testTable {
+			quota, status, err := systemdCPUQuota(Options{RootPrefix: filepath.Join(testDataRootPath, tt.name)}, denied)
+			assert.Equal(t, tt.expectedQuota, quota, tt.name)
+			assert.Equal(t, tt.expectedStatus, status, tt.name)
+			assert.Equal(t, tt.expectedErr, err, tt.name)
+		}
+	})
+
+	t.Run("unreadable cgroup", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("root can read files without permission")
+		}
+		root := copyRoot(t, "systemd-service")
+		require.NoError(t, os.Chmod(filepath.Join(root, "sys", "fs", "cgroup", "system.slice", "app.service", "cpu.max"), 0))
+
+		_, _, err := CPUQuota(Options{RootPrefix: root})
+		assert.True(t, errors.Is(err, os.ErrPermission), "should fail without SystemdFallback")
+
+		quota, defined, err := CPUQuota(Options{RootPrefix: root, SystemdFallback: true})
+		require.NoError(t, err)
+		assert.True(t, defined)
+		assert.Equal(t, 1.5, quota)
+	})
+}
+
+func TestCPUQuotaWalkCPUMax(t *testing.T) {
+	root := filepath.Join(testDataRootPath, "v2-delegated")
+
+	_, defined, err := CPUQuota(Options{RootPrefix: root})
+	assert.False(t, defined, "only the leaf should be read by default")
+	assert.NoError(t, err)
+
+	quota, defined, err := CPUQuota(Options{RootPrefix: root, WalkCPUMax: true})
+	assert.Equal(t, 2.0, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err)
+}
+
+func TestCPUQuotaFromCPUMaxFile(t *testing.T) {
+	cpuMax := filepath.Join(testDataRootPath, "..", "cgroups", "v2", "set")
+	opts := Options{
+		RootPrefix: filepath.Join(testDataRootPath, "nonexistent"),
+		CPUMaxFile: cpuMax,
+	}
+
+	quota, defined, err := CPUQuota(opts)
+	assert.Equal(t, 2.5, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err, "the root prefix shouldn't apply to the file")
+
+	maxProcs, status, err := CPUQuotaToGOMAXPROCS(1, DefaultRoundFunc, opts)
+	assert.Equal(t, 2, maxProcs)
+	assert.Equal(t, CPUQuotaUsed, status)
+	assert.NoError(t, err)
+
+	_, defined, err = CPUQuota(Options{CPUMaxFile: filepath.Join(testDataRootPath, "nonexistent")})
+	assert.False(t, defined)
+	assert.Error(t, err)
+}
+
+func TestCPUQuotaFromCGroupPath(t *testing.T) {
+	opts := Options{
+		RootPrefix: filepath.Join(testDataRootPath, "nonexistent"),
+		CGroupPath: filepath.Join(testDataRootPath, "..", "cgroups", "cpu"),
+		CPUSet:     true,
+	}
+
+	quota, defined, err := CPUQuota(opts)
+	assert.Equal(t, 6.0, quota)
+	assert.True(t, defined)
+	assert.NoError(t, err, "the root prefix shouldn't apply to the directory")
+
+	maxProcs, status, err := CPUQuotaToGOMAXPROCS(1, DefaultRoundFunc, opts)
+	assert.Equal(t, 6, maxProcs)
+	assert.Equal(t, CPUQuotaUsed, status, "the cpuset shouldn't be read")
+	assert.NoError(t, err)
+
+	_, defined, err = CPUQuota(Options{CGroupPath: filepath.Join(testDataRootPath, "..", "cgroups", "v2")})
+	assert.False(t, defined)
+	assert.Error(t, err, "a directory without CPU files should be rejected")
+}
+
+func TestCPUBurst(t *testing.T) {
+	testTable := []struct {
+		name          string
+		expectedBurst float64
+		expectedQuota float64
+	}{
+		{name: "v1", expectedBurst: 0, expectedQuota: 1.5},
+		{name: "v1-burst", expectedBurst: 0.5, expectedQuota: 2},
+		{name: "v2", expectedBurst: 0, expectedQuota: 3},
+		{name: "v2-burst", expectedBurst: 1, expectedQuota: 4},
+	}
+
+	for _, tt := range testTable {
+		opts := Options{RootPrefix: filepath.Join(testDataRootPath, tt.name)}
+		burst, defined, err := CPUBurst(opts)
+		assert.Equal(t, tt.expectedBurst, burst, tt.name)
+		assert.Equal(t, tt.expectedBurst > 0, defined, tt.name)
+		assert.NoError(t, err, tt.name)
+
+		quota, _, err := CPUQuota(opts)
+		assert.Equal(t, tt.expectedQuota-tt.expectedBurst, quota, "%v: burst shouldn't be added by default", tt.name)
+		assert.NoError(t, err, tt.name)
+
+		opts.AddBurst = true
+		quota, defined, err = CPUQuota(opts)
+		assert.Equal(t, tt.expectedQuota, quota, "%v: with burst", tt.name)
+		assert.True(t, defined, tt.name)
+		assert.NoError(t, err, tt.name)
+	}
+
+	burst, defined, err := CPUBurst(Options{RootPrefix: filepath.Join(testDataRootPath, "cpuset-only")})
+	assert.Equal(t, 0.0, burst, "cpuset-only")
+	assert.False(t, defined, "cpuset-only")
+	assert.NoError(t, err, "cpuset-only")
+}
+
+func TestCGroupLayout(t *testing.T) {
+	testTable := []struct {
+		name           string
+		expectedLayout Layout
+	}{
+		{name: "v1", expectedLayout: Layout{CPUControllerV1: true}},
+		{name: "v2", expectedLayout: Layout{CGroupV2: true}},
+		{name: "hybrid", expectedLayout: Layout{Hybrid: true}},
+		{name: "hybrid-v1-quota", expectedLayout: Layout{Hybrid: true, CPUControllerV1: true}},
+		{name: "cpuset-only", expectedLayout: Layout{}},
+	}
+
+	for _, tt := range testTable {
+		layout, err := CGroupLayout(Options{RootPrefix: filepath.Join(testDataRootPath, tt.name)})
+		assert.Equal(t, tt.expectedLayout, layout, tt.name)
+		assert.NoError(t, err, tt.name)
+	}
+
+	_, err := CGroupLayout(Options{RootPrefix: filepath.Join(testDataRootPath, "nonexistent")})
+	assert.Error(t, err)
+}
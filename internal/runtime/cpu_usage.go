@@ -0,0 +1,54 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+import "time"
+
+// CPUUsage returns the total CPU time consumed by the cgroup of the calling
+// process, reading it from cpu.stat with cgroup2 and from the cgroup v1
+// cpuacct controller otherwise. In hybrid mode, the cgroup2 unified
+// hierarchy is used if no v1 hierarchy has the cpuacct controller. It
+// returns false if no usage is accounted for the process.
+func CPUUsage(opts Options) (time.Duration, bool, error) {
+	if !opts.readable() {
+		return 0, false, nil
+	}
+
+	src := opts.source()
+	isV2, err := src.IsCGroupV2()
+	if err != nil {
+		return 0, false, err
+	}
+
+	if isV2 {
+		return src.CPUUsageV2()
+	}
+
+	cgroups, err := src.NewCGroupsForCurrentProcess()
+	if err != nil {
+		return 0, false, err
+	}
+	usage, defined, err := cgroups.CPUUsage()
+	if !defined && err == nil {
+		return src.CPUUsageV2()
+	}
+	return usage, defined, err
+}
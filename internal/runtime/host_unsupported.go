@@ -23,9 +23,6 @@
 
 package runtime
 
-// CPUQuotaToGOMAXPROCS converts the CPU quota applied to the calling process
-// to a valid GOMAXPROCS value. This is Linux-specific and not supported in the
-// current OS.
-func CPUQuotaToGOMAXPROCS(_ int) (int, CPUQuotaStatus, error) {
-	return -1, CPUQuotaUndefined, nil
-}
+// _hostCGroups is false because cgroups are Linux-specific: without a root
+// prefix, no CPU quota or other limit is detected in the current OS.
+const _hostCGroups = false
@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+import "math/bits"
+
+// _jobCPURateScale is the CPU rate of a job object that allows it all the
+// cycles of all the processors: rates are percentages times 100.
+const _jobCPURateScale = 10000
+
+// jobLimit holds the CPU limits of the Windows job object the calling
+// process belongs to.
+type jobLimit struct {
+	// InJob is false if the process doesn't belong to a job.
+	InJob bool
+	// Affinity is the mask of the CPUs the processes of the job may run on,
+	// or 0 if the job doesn't restrict them.
+	Affinity uint64
+	// CPURate is the portion of the processor cycles the job may use, in
+	// units of _jobCPURateScale, or 0 if the job doesn't cap its CPU rate.
+	CPURate uint32
+	// Processors is the number of logical processors of the system, which
+	// CPURate is relative to.
+	Processors int
+}
+
+// _queryJobLimit returns the limits of the job object of the calling
+// process. It's a variable so that tests can stub the syscalls.
+var _queryJobLimit = queryJobLimit
+
+// jobLimits returns the CPU quota of the calling process set by its Windows
+// job object, as set for containers: the number of CPUs in the affinity mask
+// of the job in process-isolation mode, or its CPU rate cap converted to a
+// number of CPUs in Hyper-V isolation and with docker --cpus. If the job sets
+// both, the lower one is used. The quota is undefined if the process doesn't
+// belong to a job or the job sets neither. It's also undefined if the job
+// can't be queried, e.g. because IsProcessInJob or QueryInformationJobObject
+// is denied in a sandbox: the limits of a job are a hint that Windows
+// doesn't strictly need honored, unlike a cgroup quota, so a failed query
+// leaves GOMAXPROCS alone rather than failing Set.
+func jobLimits(query func() (jobLimit, error)) (float64, CPUQuotaStatus, error) {
+	limit, err := query()
+	if err != nil {
+		return -1, CPUQuotaUndefined, nil
+	}
+	if !limit.InJob {
+		return -1, CPUQuotaUndefined, nil
+	}
+
+	quota := -1.0
+	if limit.Affinity != 0 {
+		quota = float64(bits.OnesCount64(limit.Affinity))
+	}
+	if limit.CPURate > 0 && limit.Processors > 0 {
+		rate := float64(limit.CPURate) / _jobCPURateScale * float64(limit.Processors)
+		if quota < 0 || rate < quota {
+			quota = rate
+		}
+	}
+	if quota < 0 {
+		return -1, CPUQuotaUndefined, nil
+	}
+	return quota, CPUQuotaUsed, nil
+}
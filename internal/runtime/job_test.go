@@ -0,0 +1,108 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobLimits(t *testing.T) {
+	testTable := []struct {
+		name           string
+		limit          jobLimit
+		err            error
+		expectedQuota  float64
+		expectedStatus CPUQuotaStatus
+	}{
+		{
+			name:           "not-in-job",
+			limit:          jobLimit{Affinity: 0xf},
+			expectedQuota:  -1,
+			expectedStatus: CPUQuotaUndefined,
+		},
+		{
+			name:           "affinity",
+			limit:          jobLimit{InJob: true, Affinity: 0b1011},
+			expectedQuota:  3,
+			expectedStatus: CPUQuotaUsed,
+		},
+		{
+			name:           "all-cpus",
+			limit:          jobLimit{InJob: true, Affinity: ^uint64(0)},
+			expectedQuota:  64,
+			expectedStatus: CPUQuotaUsed,
+		},
+		{
+			name:           "no-affinity",
+			limit:          jobLimit{InJob: true},
+			expectedQuota:  -1,
+			expectedStatus: CPUQuotaUndefined,
+		},
+		{
+			name:           "cpu-rate",
+			limit:          jobLimit{InJob: true, CPURate: 2500, Processors: 8},
+			expectedQuota:  2,
+			expectedStatus: CPUQuotaUsed,
+		},
+		{
+			name:           "fractional-cpu-rate",
+			limit:          jobLimit{InJob: true, CPURate: 1875, Processors: 8},
+			expectedQuota:  1.5,
+			expectedStatus: CPUQuotaUsed,
+		},
+		{
+			name:           "cpu-rate-below-affinity",
+			limit:          jobLimit{InJob: true, Affinity: 0xf, CPURate: 2500, Processors: 4},
+			expectedQuota:  1,
+			expectedStatus: CPUQuotaUsed,
+		},
+		{
+			name:           "affinity-below-cpu-rate",
+			limit:          jobLimit{InJob: true, Affinity: 0x3, CPURate: 5000, Processors: 8},
+			expectedQuota:  2,
+			expectedStatus: CPUQuotaUsed,
+		},
+		{
+			name:           "cpu-rate-without-processors",
+			limit:          jobLimit{InJob: true, CPURate: 2500},
+			expectedQuota:  -1,
+			expectedStatus: CPUQuotaUndefined,
+		},
+		{
+			name:           "query-error",
+			err:            errors.New("access denied"),
+			expectedQuota:  -1,
+			expectedStatus: CPUQuotaUndefined,
+		},
+	}
+
+	for _, tt := range testTable {
+		quota, status, err := jobLimits(func() (jobLimit, error) {
+			return tt.limit, tt.err
+		})
+		assert.Equal(t, tt.expectedQuota, quota, tt.name)
+		assert.Equal(t, tt.expectedStatus, status, tt.name)
+		assert.NoError(t, err, tt.name)
+	}
+}
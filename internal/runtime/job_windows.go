@@ -0,0 +1,147 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build windows
+// +build windows
+
+package runtime
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// _jobObjects is true because the limits of the job object of the calling
+// process are read on Windows.
+const _jobObjects = true
+
+const (
+	// _jobObjectBasicLimitInformation and
+	// _jobObjectCpuRateControlInformation are the JOBOBJECTINFOCLASS values
+	// passed to QueryInformationJobObject.
+	_jobObjectBasicLimitInformation     = 2
+	_jobObjectCpuRateControlInformation = 15
+
+	_jobObjectLimitAffinity = 0x00000010
+
+	// The JOB_OBJECT_CPU_RATE_CONTROL_* flags of
+	// JOBOBJECT_CPU_RATE_CONTROL_INFORMATION.
+	_jobObjectCpuRateControlEnable      = 0x00000001
+	_jobObjectCpuRateControlWeightBased = 0x00000002
+	_jobObjectCpuRateControlMinMaxRate  = 0x00000010
+
+	// _allProcessorGroups makes GetActiveProcessorCount count the
+	// processors of all the processor groups.
+	_allProcessorGroups = 0xffff
+)
+
+var (
+	_kernel32                      = syscall.NewLazyDLL("kernel32.dll")
+	_procGetActiveProcessorCount   = _kernel32.NewProc("GetActiveProcessorCount")
+	_procIsProcessInJob            = _kernel32.NewProc("IsProcessInJob")
+	_procQueryInformationJobObject = _kernel32.NewProc("QueryInformationJobObject")
+)
+
+// jobObjectBasicLimitInformation mirrors JOBOBJECT_BASIC_LIMIT_INFORMATION.
+type jobObjectBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+// jobObjectCPURateControlInformation mirrors
+// JOBOBJECT_CPU_RATE_CONTROL_INFORMATION. Value holds the union of CpuRate,
+// Weight, and MinRate and MaxRate in its low and high words.
+type jobObjectCPURateControlInformation struct {
+	ControlFlags uint32
+	Value        uint32
+}
+
+// cpuRate returns the CPU rate cap set by info, or 0 if it sets none. A
+// weight only shares the CPUs between jobs, so it doesn't cap the rate.
+func (info jobObjectCPURateControlInformation) cpuRate() uint32 {
+	switch {
+	case info.ControlFlags&_jobObjectCpuRateControlEnable == 0:
+		return 0
+	case info.ControlFlags&_jobObjectCpuRateControlWeightBased != 0:
+		return 0
+	case info.ControlFlags&_jobObjectCpuRateControlMinMaxRate != 0:
+		return info.Value >> 16
+	default:
+		return info.Value
+	}
+}
+
+// queryJobLimit reads the limits of the job object of the calling process
+// with IsProcessInJob and QueryInformationJobObject.
+func queryJobLimit() (jobLimit, error) {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return jobLimit{}, err
+	}
+	var inJob int32
+	if r, _, err := _procIsProcessInJob.Call(uintptr(process), 0, uintptr(unsafe.Pointer(&inJob))); r == 0 {
+		return jobLimit{}, err
+	}
+	if inJob == 0 {
+		return jobLimit{}, nil
+	}
+
+	var rate jobObjectCPURateControlInformation
+	if err := queryJobObject(_jobObjectCpuRateControlInformation, unsafe.Pointer(&rate), unsafe.Sizeof(rate)); err != nil {
+		return jobLimit{}, err
+	}
+	var basic jobObjectBasicLimitInformation
+	if err := queryJobObject(_jobObjectBasicLimitInformation, unsafe.Pointer(&basic), unsafe.Sizeof(basic)); err != nil {
+		return jobLimit{}, err
+	}
+
+	limit := jobLimit{
+		InJob:   true,
+		CPURate: rate.cpuRate(),
+	}
+	if limit.CPURate > 0 {
+		r, _, err := _procGetActiveProcessorCount.Call(_allProcessorGroups)
+		if r == 0 {
+			return jobLimit{}, err
+		}
+		limit.Processors = int(r)
+	}
+	if basic.LimitFlags&_jobObjectLimitAffinity != 0 {
+		limit.Affinity = uint64(basic.Affinity)
+	}
+	return limit, nil
+}
+
+// queryJobObject queries the information of class about the job object of
+// the calling process into info, which is size bytes long.
+func queryJobObject(class uint32, info unsafe.Pointer, size uintptr) error {
+	r, _, err := _procQueryInformationJobObject.Call(0, uintptr(class), uintptr(info), size, 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
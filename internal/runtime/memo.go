@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+import (
+	"sync"
+	"time"
+)
+
+// A memoKind identifies a read memoized with Options.CacheTTL.
+type memoKind int
+
+const (
+	_memoCPUQuota memoKind = iota
+	_memoCPUBurst
+	_memoCPUSet
+	_memoThreaded
+)
+
+// memoKey identifies a memoized read by its kind, the options it depends on,
+// which determine the mountinfo and cgroup files read, and the cgroups the
+// process belongs to.
+type memoKey struct {
+	kind        memoKind
+	rootPrefix  string
+	procMount   string
+	cgroupMount string
+	cpuMaxFile  string
+	cgroupPath  string
+	cacheFile   string
+	addBurst    bool
+	walkCPUMax  bool
+	systemd     bool
+	membership  string
+}
+
+// memoEntry is the result of a memoized read: a number of CPUs and its
+// status, or quotaStatus of a boolean result.
+type memoEntry struct {
+	value   float64
+	status  CPUQuotaStatus
+	expires time.Time
+}
+
+// _memoNow returns the current time. It's a variable so that tests can
+// control the expiry of memoized reads.
+var _memoNow = time.Now
+
+var _memo struct {
+	sync.Mutex
+	entries map[memoKey]memoEntry
+}
+
+// memoized returns the result of read, reusing the result of a previous
+// call of the same kind with the same options as long as it's younger than
+// opts.CacheTTL and the process wasn't moved to another cgroup since, which
+// costs a read of `/proc/self/cgroup` per call. Failed reads aren't
+// memoized, so a transient failure only affects the call that hit it. read
+// runs without holding the lock, so that concurrent callers may read the
+// files concurrently on a miss.
+func memoized(opts Options, kind memoKind, read func() (float64, CPUQuotaStatus, error)) (float64, CPUQuotaStatus, error) {
+	if opts.CacheTTL <= 0 {
+		return read()
+	}
+
+	key := memoKey{
+		kind:        kind,
+		rootPrefix:  opts.RootPrefix,
+		procMount:   opts.ProcMount,
+		cgroupMount: opts.CGroupMount,
+		cpuMaxFile:  opts.CPUMaxFile,
+		cgroupPath:  opts.CGroupPath,
+		cacheFile:   opts.CacheFile,
+		addBurst:    opts.AddBurst,
+		walkCPUMax:  opts.WalkCPUMax,
+		systemd:     opts.SystemdFallback,
+	}
+	if opts.CPUMaxFile == "" && opts.CGroupPath == "" && opts.readable() {
+		membership, err := opts.source().CGroupMembership()
+		if err != nil {
+			return read()
+		}
+		key.membership = string(membership)
+	}
+	now := _memoNow()
+	_memo.Lock()
+	entry, ok := _memo.entries[key]
+	_memo.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.value, entry.status, nil
+	}
+
+	value, status, err := read()
+	if err != nil {
+		return value, status, err
+	}
+	_memo.Lock()
+	defer _memo.Unlock()
+	if _memo.entries == nil {
+		_memo.entries = make(map[memoKey]memoEntry)
+	}
+	_memo.entries[key] = memoEntry{value: value, status: status, expires: now.Add(opts.CacheTTL)}
+	return value, status, nil
+}
+
+// InvalidateCache discards every read memoized with Options.CacheTTL, so
+// that the next calls read the cgroup files again.
+func InvalidateCache() {
+	_memo.Lock()
+	defer _memo.Unlock()
+	_memo.entries = nil
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withMemoNow stubs the clock of memoized reads, starting from an empty
+// memo, for the duration of f.
+func withMemoNow(now *time.Time, f func()) {
+	prev := _memoNow
+	_memoNow = func() time.Time { return *now }
+	InvalidateCache()
+	defer func() {
+		_memoNow = prev
+		InvalidateCache()
+	}()
+	f()
+}
+
+func TestMemoized(t *testing.T) {
+	now := time.Unix(1000, 0)
+	withMemoNow(&now, func() {
+		root := copyRoot(t, "v2")
+		cpuMax := filepath.Join(root, "sys", "fs", "cgroup", "cpu.max")
+		opts := Options{RootPrefix: root, CacheTTL: time.Minute}
+
+		quota, defined, err := CPUQuota(opts)
+		require.NoError(t, err)
+		assert.True(t, defined)
+		assert.Equal(t, 3.0, quota, "cold")
+
+		require.NoError(t, ioutil.WriteFile(cpuMax, []byte("500000 100000\n"), 0o644))
+		quota, _, err = CPUQuota(opts)
+		require.NoError(t, err)
+		assert.Equal(t, 3.0, quota, "should reuse the memoized quota")
+
+		quota, _, err = CPUQuota(Options{RootPrefix: root})
+		require.NoError(t, err)
+		assert.Equal(t, 5.0, quota, "should read the files without CacheTTL")
+
+		now = now.Add(time.Minute)
+		quota, _, err = CPUQuota(opts)
+		require.NoError(t, err)
+		assert.Equal(t, 5.0, quota, "should read the files once expired")
+
+		require.NoError(t, ioutil.WriteFile(cpuMax, []byte("200000 100000\n"), 0o644))
+		InvalidateCache()
+		quota, _, err = CPUQuota(opts)
+		require.NoError(t, err)
+		assert.Equal(t, 2.0, quota, "should read the files once invalidated")
+	})
+}
+
+func TestMemoizedReads(t *testing.T) {
+	now := time.Unix(1000, 0)
+	withMemoNow(&now, func() {
+		root := copyRoot(t, "v2-burst")
+		var reads []string
+		opts := Options{RootPrefix: root, CPUSet: true, CacheTTL: time.Minute}
+		opts.OnRead = func(name string) { reads = append(reads, name) }
+
+		read := func() {
+			_, _, err := CPUQuotaToGOMAXPROCS(1, DefaultRoundFunc, opts)
+			require.NoError(t, err)
+			_, _, err = CPUBurst(opts)
+			require.NoError(t, err)
+			_, err = ThreadedCGroup(opts)
+			require.NoError(t, err)
+		}
+		read()
+		assert.NotEmpty(t, reads, "cold reads should read files")
+		reads = nil
+		read()
+		for _, name := range reads {
+			assert.Equal(t, "/proc/self/cgroup", name, "memoized reads should only check the cgroup of the process")
+		}
+	})
+}
+
+func TestMemoizedCGroupMove(t *testing.T) {
+	now := time.Unix(1000, 0)
+	withMemoNow(&now, func() {
+		root := copyRoot(t, "v2-delegated")
+		procCGroup := filepath.Join(root, "proc", "self", "cgroup")
+		opts := Options{RootPrefix: root, CacheTTL: time.Hour}
+
+		move := func(path string) {
+			require.NoError(t, ioutil.WriteFile(procCGroup, []byte("0::"+path+"\n"), 0o644))
+		}
+		quota := func() float64 {
+			quota, _, err := CPUQuota(opts)
+			require.NoError(t, err)
+			return quota
+		}
+
+		move("/kubepods.slice/pod.slice")
+		assert.Equal(t, 2.0, quota(), "cold")
+		move("/kubepods.slice")
+		assert.Equal(t, 4.0, quota(), "should read the quota of the new cgroup")
+		move("/kubepods.slice/pod.slice")
+		assert.Equal(t, 2.0, quota(), "should reuse the quota of the former cgroup")
+	})
+}
+
+func TestMemoizedErrors(t *testing.T) {
+	now := time.Unix(1000, 0)
+	withMemoNow(&now, func() {
+		root := copyRoot(t, "v2")
+		mountInfo := filepath.Join(root, "proc", "self", "mountinfo")
+		data, err := ioutil.ReadFile(mountInfo)
+		require.NoError(t, err)
+		require.NoError(t, os.Remove(mountInfo))
+		opts := Options{RootPrefix: root, CacheTTL: time.Minute}
+
+		_, _, err = CPUQuota(opts)
+		assert.Error(t, err, "should fail without mountinfo")
+
+		require.NoError(t, ioutil.WriteFile(mountInfo, data, 0o644))
+		quota, defined, err := CPUQuota(opts)
+		require.NoError(t, err, "shouldn't memoize the failure")
+		assert.True(t, defined)
+		assert.Equal(t, 3.0, quota)
+	})
+}
+
+func TestMemoizedConcurrent(t *testing.T) {
+	now := time.Unix(1000, 0)
+	withMemoNow(&now, func() {
+		opts := Options{RootPrefix: filepath.Join(testDataRootPath, "v2"), CacheTTL: time.Minute}
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				quota, _, err := CPUQuota(opts)
+				assert.NoError(t, err)
+				assert.Equal(t, 3.0, quota)
+				InvalidateCache()
+			}()
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+// MemoryLimit returns the memory limit applied to the calling process, in
+// bytes, reading it from cgroup2 if the system uses it and from the cgroup
+// v1 memory controller otherwise. In hybrid mode, the cgroup2 unified
+// hierarchy is used if no v1 hierarchy has the memory controller.
+func MemoryLimit(opts Options) (int64, bool, error) {
+	if !opts.readable() {
+		return -1, false, nil
+	}
+
+	src := opts.source()
+	isV2, err := src.IsCGroupV2()
+	if err != nil {
+		return -1, false, err
+	}
+
+	if isV2 {
+		return src.MemoryLimitV2()
+	}
+
+	cgroups, err := src.NewCGroupsForCurrentProcess()
+	if err != nil {
+		return -1, false, err
+	}
+	if !cgroups.HasMemoryController() {
+		return src.MemoryLimitV2()
+	}
+	return cgroups.MemoryLimit()
+}
+
+// MemoryPressure returns the percentage of time, averaged over the last 10
+// seconds, that some tasks of the cgroup of the calling process were stalled
+// on memory, read from the cgroup2 memory.pressure file. It returns false if
+// no cgroup2 unified hierarchy is mounted or the kernel doesn't report
+// pressure stall information.
+func MemoryPressure(opts Options) (float64, bool, error) {
+	if !opts.readable() {
+		return -1, false, nil
+	}
+
+	stats, defined, err := opts.source().MemoryPressureV2()
+	if !defined || err != nil {
+		return -1, false, err
+	}
+	return stats.Some.Avg10, true, nil
+}
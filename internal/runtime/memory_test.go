@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLimit(t *testing.T) {
+	testTable := []struct {
+		name            string
+		expectedLimit   int64
+		expectedDefined bool
+		shouldHaveError bool
+	}{
+		{name: "v1", expectedLimit: 536870912, expectedDefined: true},
+		{name: "v2", expectedLimit: 1073741824, expectedDefined: true},
+		{name: "hybrid", expectedLimit: -1, expectedDefined: false},
+		{name: "cpuset-only", expectedLimit: -1, expectedDefined: false},
+		{name: "gvisor", expectedLimit: 1073741824, expectedDefined: true},
+		{name: "trailing-slash", expectedLimit: 536870912, expectedDefined: true},
+		{name: "trailing-slash-v2", expectedLimit: 1073741824, expectedDefined: true},
+		{name: "nonexistent", expectedLimit: -1, shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		limit, defined, err := MemoryLimit(Options{RootPrefix: filepath.Join(testDataRootPath, tt.name)})
+		assert.Equal(t, tt.expectedLimit, limit, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
+
+func TestMemoryPressure(t *testing.T) {
+	testTable := []struct {
+		name             string
+		expectedPressure float64
+		expectedDefined  bool
+		shouldHaveError  bool
+	}{
+		{name: "v2-pressure", expectedPressure: 42, expectedDefined: true},
+		{name: "v2", expectedPressure: -1},
+		{name: "v1", expectedPressure: -1},
+		{name: "nonexistent", expectedPressure: -1, shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		pressure, defined, err := MemoryPressure(Options{RootPrefix: filepath.Join(testDataRootPath, tt.name)})
+		assert.Equal(t, tt.expectedPressure, pressure, tt.name)
+		assert.Equal(t, tt.expectedDefined, defined, tt.name)
+
+		if tt.shouldHaveError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
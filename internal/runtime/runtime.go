@@ -20,6 +20,12 @@
 
 package runtime
 
+import (
+	"context"
+	"math"
+	"time"
+)
+
 // CPUQuotaStatus presents the status of how CPU quota is used
 type CPUQuotaStatus int
 
@@ -30,4 +36,109 @@ const (
 	CPUQuotaUsed
 	// CPUQuotaMinUsed is return when CPU quota is smaller than the min value
 	CPUQuotaMinUsed
+	// CPUQuotaControllerUnavailable is returned when the CPU cgroup
+	// controller isn't available, so no CPU quota can be defined
+	CPUQuotaControllerUnavailable
+	// CPUAffinityUsed is returned when the CPU affinity mask allows fewer
+	// CPUs than the CPU quota
+	CPUAffinityUsed
+	// CPUSetUsed is returned when the cpuset of the cgroup allows fewer CPUs
+	// than the CPU quota, or fewer CPUs than the host when it's the only
+	// limit defined
+	CPUSetUsed
 )
+
+// Options configures where the CPU quota of the calling process is read
+// from.
+type Options struct {
+	// RootPrefix, if non-empty, is prepended to every cgroup and proc path
+	// read during detection. The host's own paths are only read on Linux,
+	// but a root prefix is honored on every OS.
+	RootPrefix string
+	// ProcMount, if non-empty, replaces `/proc` in the paths of the cgroup
+	// and mountinfo files of the calling process. It's resolved relative to
+	// RootPrefix.
+	ProcMount string
+	// CGroupMount, if non-empty, replaces `/sys/fs/cgroup` in the mount
+	// points of the cgroup hierarchies. It's resolved relative to
+	// RootPrefix.
+	CGroupMount string
+	// Context, if non-nil, bounds every file read during detection.
+	Context context.Context
+	// SchedAffinity caps the CPU quota by the number of CPUs allowed by the
+	// affinity mask of the calling thread. The mask is ignored if it can't
+	// be read.
+	SchedAffinity bool
+	// CPUSet caps the CPU quota by the number of CPUs in the cpuset of the
+	// calling process, and uses that number when no CPU quota is defined
+	// and the cpuset has fewer CPUs than the host.
+	// It has no effect with CPUMaxFile or CGroupPath.
+	CPUSet bool
+	// CPUSetMax, with CPUSet, replaces the CPU quota by the number of CPUs
+	// in the cpuset when that number is larger, rather than when it's
+	// smaller.
+	CPUSetMax bool
+	// CPUMaxFile, if non-empty, is the exact path of a file in the format of
+	// the cgroup2 cpu.max file the CPU quota is read from, bypassing the
+	// cgroup hierarchy and RootPrefix.
+	CPUMaxFile string
+	// CGroupPath, if non-empty, is the exact path of the cgroup directory
+	// the CPU quota is read from, bypassing the cgroup of the calling
+	// process and RootPrefix. See cgroups.Source.CPUQuotaFromCGroup. It has
+	// no effect with CPUMaxFile.
+	CGroupPath string
+	// AddBurst adds the CPU burst, read from cpu.cfs_burst_us with cgroup v1
+	// and cpu.max.burst with cgroup2, to the CPU quota. It has no effect
+	// with CPUMaxFile or CGroupPath.
+	AddBurst bool
+	// WalkCPUMax reads the cgroup2 CPU quota as the most restrictive one
+	// among the cpu.max files of the cgroup of the calling process and its
+	// ancestors, rather than from the innermost cpu.max only.
+	WalkCPUMax bool
+	// SystemdFallback reads the CPU quota from the systemd units of the
+	// calling process when its cgroup files can't be read for lack of
+	// permission, and ignores the cpuset then. See
+	// cgroups.Source.SystemdCPUQuota.
+	SystemdFallback bool
+	// CacheFile, if non-empty, is the path of a file the CPU quota is cached
+	// in across processes. See cachedCPUQuota.
+	CacheFile string
+	// CacheTTL, if positive, is how long the CPU quota, burst and cpuset
+	// read by a call, and whether the cgroup is threaded, are reused by
+	// later calls with the same options in the calling process. See
+	// memoized.
+	CacheTTL time.Duration
+
+	// OnRead, if non-nil, is called with the name of every cgroup and proc
+	// file read during detection.
+	OnRead func(name string)
+}
+
+// Layout describes the cgroup hierarchies of the calling process.
+type Layout struct {
+	// CGroupV2 is true if only the cgroup2 unified hierarchy is mounted.
+	CGroupV2 bool
+	// Hybrid is true if the cgroup2 unified hierarchy is mounted next to v1
+	// hierarchies.
+	Hybrid bool
+	// CPUControllerV1 is true if the cpu controller is attached to a v1
+	// hierarchy.
+	CPUControllerV1 bool
+}
+
+// QuotaToGOMAXPROCS converts a CPU quota to a valid GOMAXPROCS value. The
+// quota is converted from float to int using round, and raised to minValue if
+// it's lower.
+func QuotaToGOMAXPROCS(quota float64, minValue int, round func(v float64) int) (int, CPUQuotaStatus) {
+	maxProcs := round(quota)
+	if minValue > 0 && maxProcs < minValue {
+		return minValue, CPUQuotaMinUsed
+	}
+	return maxProcs, CPUQuotaUsed
+}
+
+// DefaultRoundFunc is the default function for converting CPU quota from
+// float to int. It rounds the value down (floor).
+func DefaultRoundFunc(v float64) int {
+	return int(math.Floor(v))
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+import (
+	"sort"
+
+	cg "github.com/emadolsky/automaxprocs/internal/cgroups"
+)
+
+// _cpuCGroupFiles are the files CPUCGroupFiles returns, those the CPU quota
+// is read from with cgroup2 and cgroup v1.
+var _cpuCGroupFiles = []string{"cpu.max", "cpu.cfs_quota_us", "cpu.cfs_period_us"}
+
+// File is the content of a cgroup or proc file read during detection.
+type File struct {
+	// Name is the path of the file, relative to Options.RootPrefix.
+	Name string
+	// Content is the content of the file, or nil if it couldn't be read.
+	Content []byte
+	// Err is the error reading the file, if any. It satisfies os.IsNotExist
+	// if the file doesn't exist.
+	Err error
+}
+
+// Snapshot runs the CPU quota, CPU burst, cpuset and memory limit detections
+// described by opts and returns every cgroup and proc file they read, with
+// its content at the time of the call, sorted by name. Errors of the
+// detections are ignored: the files read until they failed are returned,
+// which is when a snapshot is the most useful. The cache of
+// Options.CacheFile is bypassed so that the files are actually read, and
+// Options.CPUMaxFile and Options.CGroupPath are ignored since they bypass
+// the cgroup of the calling process.
+func Snapshot(opts Options) []File {
+	if !opts.readable() {
+		return nil
+	}
+
+	read := make(map[string]struct{})
+	opts.OnRead = recordReads(read, opts.OnRead)
+	opts.CacheFile = ""
+	opts.CPUMaxFile = ""
+	opts.CGroupPath = ""
+	cpuLimits(opts, true)
+	CPUSetCPUs(opts)
+	MemoryLimit(opts)
+
+	src := opts.source()
+	files := make([]File, 0, len(read))
+	for name := range read {
+		content, err := src.ReadFile(name)
+		if err != nil {
+			content = nil
+		}
+		files = append(files, File{Name: name, Content: content, Err: err})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
+
+// CPUCGroupFiles returns the path of the cgroup directory the CPU quota of
+// the calling process is read from, see
+// cgroups.Source.CPUCGroupForCurrentProcess, or Options.CGroupPath if set,
+// and its cpu.max, cpu.cfs_quota_us and cpu.cfs_period_us files, most of
+// which don't exist on a given host. With Options.CPUMaxFile, the path is
+// empty and only that file is returned. The path is also empty if there's
+// no such directory.
+func CPUCGroupFiles(opts Options) (string, []File, error) {
+	if opts.CPUMaxFile != "" {
+		src := cg.Source{Context: opts.Context}
+		content, err := src.ReadFile(opts.CPUMaxFile)
+		return "", []File{{Name: opts.CPUMaxFile, Content: content, Err: err}}, nil
+	}
+
+	var cgroup *cg.CGroup
+	switch {
+	case opts.CGroupPath != "":
+		cgroup = cg.Source{Context: opts.Context}.NewCGroup(opts.CGroupPath)
+	case opts.readable():
+		var err error
+		if cgroup, err = opts.source().CPUCGroupForCurrentProcess(); err != nil {
+			return "", nil, err
+		}
+	}
+	if cgroup == nil {
+		return "", nil, nil
+	}
+
+	files := make([]File, len(_cpuCGroupFiles))
+	for i, name := range _cpuCGroupFiles {
+		content, err := cgroup.ReadFile(name)
+		files[i] = File{Name: cgroup.ParamPath(name), Content: content, Err: err}
+	}
+	return cgroup.Path(), files, nil
+}
+
+// recordReads returns an Options.OnRead callback adding the name of every
+// file read to read, and passing it on to next if it's non-nil.
+func recordReads(read map[string]struct{}, next func(name string)) func(name string) {
+	return func(name string) {
+		read[name] = struct{}{}
+		if next != nil {
+			next(name)
+		}
+	}
+}
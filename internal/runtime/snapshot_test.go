@@ -0,0 +1,65 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	files := Snapshot(Options{RootPrefix: filepath.Join(testDataRootPath, "v2"), CPUMaxFile: "ignored", CacheFile: "ignored"})
+
+	var names []string
+	byName := make(map[string]File)
+	for _, f := range files {
+		names = append(names, f.Name)
+		byName[f.Name] = f
+	}
+	assert.Equal(t, []string{
+		"/proc/self/cgroup",
+		"/proc/self/mountinfo",
+		"/sys/fs/cgroup/cpu.max",
+		"/sys/fs/cgroup/cpu.max.burst",
+		"/sys/fs/cgroup/cpuset.cpus.effective",
+		"/sys/fs/cgroup/memory.max",
+	}, names, "unexpected files")
+
+	assert.Equal(t, "300000 100000\n", string(byName["/sys/fs/cgroup/cpu.max"].Content))
+	assert.NoError(t, byName["/sys/fs/cgroup/cpu.max"].Err)
+	burst := byName["/sys/fs/cgroup/cpu.max.burst"]
+	assert.Nil(t, burst.Content, "missing file shouldn't have content")
+	assert.True(t, os.IsNotExist(burst.Err), "expected a not-exist error, got %v", burst.Err)
+}
+
+func TestSnapshotFailedDetection(t *testing.T) {
+	// Without mountinfo, detection fails right away, but the files it tried
+	// to read are still reported.
+	files := Snapshot(Options{RootPrefix: t.TempDir()})
+	require.NotEmpty(t, files, "expected the files detection tried to read")
+	for _, f := range files {
+		assert.True(t, os.IsNotExist(f.Err), "%v: expected a not-exist error, got %v", f.Name, f.Err)
+	}
+}
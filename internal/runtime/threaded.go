@@ -0,0 +1,46 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+// ThreadedCGroup returns true if the cgroup2 directory of the calling process
+// is part of a threaded subtree, in which threads may be moved into cgroups
+// with CPU quotas of their own. It returns false if no cgroup2 unified
+// hierarchy is mounted.
+func ThreadedCGroup(opts Options) (bool, error) {
+	_, status, err := memoized(opts, _memoThreaded, func() (float64, CPUQuotaStatus, error) {
+		if !opts.readable() {
+			return 0, CPUQuotaUndefined, nil
+		}
+		threaded, err := opts.source().IsThreadedV2()
+		return 0, quotaStatus(threaded), err
+	})
+	return status == CPUQuotaUsed, err
+}
+
+// ThreadCPUQuota returns the CPU quota applied to the thread tid of the
+// calling process, read from the cgroup2 directory the thread belongs to. It
+// only differs from CPUQuota in threaded subtrees.
+func ThreadCPUQuota(opts Options, tid int) (float64, bool, error) {
+	if !opts.readable() {
+		return -1, false, nil
+	}
+	return opts.source().ThreadCPUQuotaV2(tid)
+}
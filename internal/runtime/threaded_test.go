@@ -0,0 +1,45 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtime
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThreadedCGroup(t *testing.T) {
+	threaded, err := ThreadedCGroup(Options{RootPrefix: filepath.Join(testDataRootPath, "v2-threaded")})
+	assert.NoError(t, err)
+	assert.True(t, threaded)
+
+	threaded, err = ThreadedCGroup(Options{RootPrefix: filepath.Join(testDataRootPath, "v2")})
+	assert.NoError(t, err)
+	assert.False(t, threaded)
+}
+
+func TestThreadCPUQuota(t *testing.T) {
+	quota, defined, err := ThreadCPUQuota(Options{RootPrefix: filepath.Join(testDataRootPath, "v2-threaded")}, 42)
+	assert.NoError(t, err)
+	assert.True(t, defined)
+	assert.Equal(t, 1.0, quota)
+}
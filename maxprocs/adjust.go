@@ -0,0 +1,50 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+// Adjust sets a function that decides the GOMAXPROCS value Set installs. It
+// runs last, once the CPU quota was detected, rounded, scaled and clamped,
+// and receives the proposed value along with the complete Decision, so it
+// can apply rules that can't be expressed with the other options. The value
+// it returns is installed instead of the proposed one; values lower than 1
+// are logged and ignored.
+//
+// Adjust isn't called when GOMAXPROCS is left unchanged, e.g. because the
+// GOMAXPROCS environment variable is set or no CPU quota is defined.
+func Adjust(f func(proposed int, d Decision) int) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.adjust = f
+	})
+}
+
+// adjusted returns the GOMAXPROCS value to install for d.
+func (c *config) adjusted(d Decision) int {
+	if c.adjust == nil {
+		return d.GOMAXPROCS
+	}
+
+	maxProcs := c.adjust(d.GOMAXPROCS, d)
+	if maxProcs < 1 {
+		c.log("maxprocs: Ignoring adjusted GOMAXPROCS=%v: must be at least 1", maxProcs)
+		return d.GOMAXPROCS
+	}
+	return maxProcs
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdjust(t *testing.T) {
+	quotaOpt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 4, iruntime.CPUQuotaUsed, nil
+	})
+
+	t.Run("adjusted", func(t *testing.T) {
+		var got Decision
+		adjust := Adjust(func(proposed int, d Decision) int {
+			got = d
+			return proposed - 1
+		})
+		buf, logOpt := testLogger()
+		undo, err := Set(logOpt, quotaOpt, adjust, ContainerInfo(true), stubEnvironment("node-1", "abcdef", nil))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+
+		assert.Equal(t, Decision{
+			GOMAXPROCS:  4,
+			Hostname:    "node-1",
+			ContainerID: "abcdef",
+			Quota:       -1,
+			Trace: []Step{
+				{Stage: StageMinClamped, Source: "Min(1)", Value: 4},
+			},
+		}, got, "Adjust should see the proposed decision")
+		assert.Equal(t, 3, currentMaxProcs(), "should install the adjusted value")
+		assert.Contains(t, buf.String(), "Updating GOMAXPROCS=3: adjusted from 4", "unexpected log output")
+
+		decision, ok := LastDecision()
+		require.True(t, ok, "Set should record its decision")
+		assert.Equal(t, 3, decision.GOMAXPROCS)
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		buf, logOpt := testLogger()
+		undo, err := Set(logOpt, quotaOpt, Adjust(func(proposed int, _ Decision) int { return proposed }))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 4, currentMaxProcs())
+		assert.Contains(t, buf.String(), "determined from CPU quota", "unexpected log output")
+	})
+
+	t.Run("below-one", func(t *testing.T) {
+		buf, logOpt := testLogger()
+		undo, err := Set(logOpt, quotaOpt, Adjust(func(int, Decision) int { return 0 }))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 4, currentMaxProcs(), "should ignore values below 1")
+		assert.Contains(t, buf.String(), "Ignoring adjusted GOMAXPROCS=0", "unexpected log output")
+	})
+
+	t.Run("quota-undefined", func(t *testing.T) {
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		called := false
+		undo, err := Set(opt, Adjust(func(proposed int, _ Decision) int {
+			called = true
+			return proposed
+		}))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.False(t, called, "Adjust shouldn't run when GOMAXPROCS is left unchanged")
+	})
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecisionContext(t *testing.T) {
+	d, ok := FromContext(context.Background())
+	assert.False(t, ok, "a bare context shouldn't carry a decision")
+	assert.Equal(t, Decision{}, d)
+
+	want := Decision{
+		GOMAXPROCS: 4,
+		Trace:      []Step{{Stage: StageQuota, Source: "CPU quota", Value: 4}},
+	}
+	ctx := NewContext(context.Background(), want)
+	d, ok = FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, want, d)
+
+	child, cancel := context.WithCancel(ctx)
+	defer cancel()
+	d, ok = FromContext(child)
+	assert.True(t, ok, "derived contexts should carry the decision")
+	assert.Equal(t, want, d)
+
+	d, ok = FromContext(NewContext(ctx, Decision{GOMAXPROCS: 2}))
+	assert.True(t, ok)
+	assert.Equal(t, 2, d.GOMAXPROCS, "the innermost decision should win")
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+// A CPUSourcePolicy selects how CPUSource combines the CPU quota with the
+// cpuset of the process when both are defined.
+type CPUSourcePolicy int
+
+const (
+	// SourceMin uses the smaller of the CPU quota and the number of CPUs in
+	// the cpuset, since either bounds the parallelism of the process.
+	SourceMin CPUSourcePolicy = iota
+	// SourceMax uses the larger of the CPU quota and the number of CPUs in
+	// the cpuset.
+	//
+	// GOMAXPROCS then exceeds the quota whenever the cpuset is wider, so the
+	// process gets throttled by CFS as soon as all its threads are busy,
+	// which usually hurts latency badly. It's only meant for workloads that
+	// spin on every CPU they're assigned and are known to cope with that.
+	SourceMax
+)
+
+// CPUSource sets how the CPU quota and the cpuset are combined when both are
+// defined; when only one of them is, it's used on its own. The CPU affinity
+// mask still caps the result if UseSchedAffinity is enabled. It has no effect
+// with IgnoreCPUSet, CPUMaxFile or CGroupPath. Set returns an error for an
+// unknown policy. Defaults to SourceMin.
+//
+// Beware that SourceMax deliberately oversubscribes the CPU quota whenever
+// the cpuset is wider, which leads to CFS throttling; see SourceMax.
+func CPUSource(policy CPUSourcePolicy) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.cpuSource = policy
+	})
+}
+
+// IgnoreCPUSet disregards the cpuset of the process entirely when enabled, so
+// that GOMAXPROCS is derived from the CPU quota alone, whatever the CPUSource
+// policy, capped by the CPU affinity mask if UseSchedAffinity is enabled,
+// however narrow the cpuset. Without a CPU quota, GOMAXPROCS is then left
+// unchanged even if a cpuset is defined. This also disables MinFromCPUSet.
+// By default, the cpuset is taken into account as described in Set.
+func IgnoreCPUSet(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.cpuSet = !enabled
+	})
+}
+
+// MinFromCPUSet raises the minimum GOMAXPROCS to the number of CPUs in the
+// cpuset of the process, so that a process whose cpuset allows more CPUs
+// than its CPU quota still gets a P per CPU it may run on. This suits
+// latency-sensitive workloads that spin-wait: with a cpuset of 8 CPUs and a
+// quota of 2, GOMAXPROCS becomes 8 instead of 2.
+//
+// This is an advanced knob: running more Ps than the quota allows lets the
+// process exhaust its quota early in each CFS period and be throttled for the
+// rest of it, which is only worth it for workloads that are meant to trade
+// throughput for latency. The minimum set with Min still applies if it's
+// larger, and nothing changes if no cpuset is defined. Disabled by default.
+func MinFromCPUSet(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.minFromCPUSet = enabled
+	})
+}
+
+// raiseMinToCPUSet raises c.minGOMAXPROCS to the number of CPUs in the
+// cpuset of the process if MinFromCPUSet is enabled and the cpuset isn't
+// ignored.
+func (c *config) raiseMinToCPUSet() error {
+	if !c.minFromCPUSet || !c.cpuSet {
+		return nil
+	}
+
+	cpus, defined, err := c.cpuSetCPUs(c.runtimeOptions())
+	if err != nil || !defined {
+		return err
+	}
+	if cpus > c.minGOMAXPROCS {
+		c.minGOMAXPROCS = cpus
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubCPUSetCPUs(cpus int, defined bool, err error) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.cpuSetCPUs = func(iruntime.Options) (int, bool, error) {
+			return cpus, defined, err
+		}
+	})
+}
+
+func TestMinFromCPUSet(t *testing.T) {
+	testTable := []struct {
+		name             string
+		opts             []Option
+		expectedMaxProcs int
+		expectedLog      string
+	}{
+		{
+			// v1-cpuset has a quota of 2 CPUs and a cpuset of 8 CPUs.
+			name:             "cpuset-above-quota",
+			opts:             []Option{MinFromCPUSet(true)},
+			expectedMaxProcs: 8,
+			expectedLog:      "using minimum allowed GOMAXPROCS",
+		},
+		{
+			name:             "disabled",
+			opts:             []Option{MinFromCPUSet(false)},
+			expectedMaxProcs: 2,
+			expectedLog:      "determined from CPU quota",
+		},
+		{
+			name:             "larger-min",
+			opts:             []Option{MinFromCPUSet(true), Min(10)},
+			expectedMaxProcs: 10,
+			expectedLog:      "using minimum allowed GOMAXPROCS",
+		},
+		{
+			name:             "ignored",
+			opts:             []Option{MinFromCPUSet(true), IgnoreCPUSet(true)},
+			expectedMaxProcs: 2,
+			expectedLog:      "determined from CPU quota",
+		},
+		{
+			name:             "cpuset-undefined",
+			opts:             []Option{MinFromCPUSet(true), stubCPUSetCPUs(-1, false, nil)},
+			expectedMaxProcs: 2,
+			expectedLog:      "determined from CPU quota",
+		},
+	}
+
+	prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v1-cpuset")
+	for _, tt := range testTable {
+		buf, logOpt := testLogger()
+		opts := append([]Option{logOpt, RootPrefix(prefix), UseSchedAffinity(false)}, tt.opts...)
+		undo, err := Set(opts...)
+		require.NoError(t, err, "%v: Set failed", tt.name)
+		assert.Equal(t, tt.expectedMaxProcs, currentMaxProcs(), tt.name)
+		assert.Contains(t, buf.String(), tt.expectedLog, "%v: unexpected log output", tt.name)
+		undo()
+	}
+}
+
+func TestMinFromCPUSetError(t *testing.T) {
+	failure := errors.New("failed")
+	prev := currentMaxProcs()
+	undo, err := Set(MinFromCPUSet(true), stubCPUSetCPUs(-1, false, failure), stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		t.Fatal("CPU quota shouldn't be read after the cpuset failed")
+		return -1, iruntime.CPUQuotaUndefined, nil
+	}))
+	defer undo()
+	assert.Equal(t, failure, err)
+	assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+}
+
+func TestIgnoreCPUSet(t *testing.T) {
+	testTable := []struct {
+		name             string
+		ignore           bool
+		expectedMaxProcs int
+		expectedLog      string
+	}{
+		// v2-cpuset has a quota of 4 CPUs and a cpuset of 2 CPUs.
+		{name: "v2-cpuset", expectedMaxProcs: 2, expectedLog: "limited by cpuset"},
+		{name: "v2-cpuset", ignore: true, expectedMaxProcs: 4, expectedLog: "determined from CPU quota"},
+		// cpuset-inherit-v2 has no quota and a cpuset of 2 CPUs.
+		{name: "cpuset-inherit-v2", ignore: true, expectedLog: "CPU quota undefined"},
+	}
+
+	for _, tt := range testTable {
+		buf, logOpt := testLogger()
+		prev := currentMaxProcs()
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", tt.name)
+		undo, err := Set(logOpt, RootPrefix(prefix), UseSchedAffinity(false), IgnoreCPUSet(tt.ignore))
+		require.NoError(t, err, "%v: Set failed", tt.name)
+		expected := tt.expectedMaxProcs
+		if expected == 0 {
+			expected = prev
+		}
+		assert.Equal(t, expected, currentMaxProcs(), "%v, ignore=%v", tt.name, tt.ignore)
+		assert.Contains(t, buf.String(), tt.expectedLog, "%v, ignore=%v: unexpected log output", tt.name, tt.ignore)
+		undo()
+	}
+}
+
+func TestCPUSetFullHost(t *testing.T) {
+	// cpuset-full-host-v2 has no quota and a cpuset spanning the 8 CPUs of
+	// the host, which doesn't limit the process.
+	prev := currentMaxProcs()
+	prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "cpuset-full-host-v2")
+	opts := []Option{RootPrefix(prefix), UseSchedAffinity(false)}
+
+	_, source, err := Query(opts...)
+	require.NoError(t, err, "Query failed")
+	assert.Equal(t, SourceRuntimeDefault, source)
+
+	buf, logOpt := testLogger()
+	result, undo, err := SetWithResult(append(opts, logOpt)...)
+	require.NoError(t, err, "SetWithResult failed")
+	defer undo()
+	assert.Equal(t, ReasonQuotaUndefined, result.Code)
+	assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+	assert.Contains(t, buf.String(), "CPU quota undefined")
+}
+
+func TestQuotaAndCPUSet(t *testing.T) {
+	testTable := []struct {
+		name             string
+		expectedMaxProcs int
+		expectedQuota    float64
+		expectedSource   Source
+		expectedCode     Reason
+	}{
+		// v2-cpuset has a quota of 4 CPUs and a cpuset of 2 CPUs.
+		{name: "v2-cpuset", expectedMaxProcs: 2, expectedQuota: 4, expectedSource: SourceCGroupCPUSet, expectedCode: ReasonCPUSet},
+		// v1-cpuset has a quota of 2 CPUs and a cpuset of 8 CPUs.
+		{name: "v1-cpuset", expectedMaxProcs: 2, expectedQuota: 2, expectedSource: SourceCGroupQuota, expectedCode: ReasonQuotaApplied},
+	}
+
+	for _, tt := range testTable {
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", tt.name)
+		opts := []Option{RootPrefix(prefix), UseSchedAffinity(false)}
+
+		maxProcs, source, err := Query(opts...)
+		require.NoError(t, err, "%v: Query failed", tt.name)
+		assert.Equal(t, tt.expectedMaxProcs, maxProcs, tt.name)
+		assert.Equal(t, tt.expectedSource, source, tt.name)
+
+		result, undo, err := SetWithResult(opts...)
+		require.NoError(t, err, "%v: SetWithResult failed", tt.name)
+		assert.Equal(t, tt.expectedMaxProcs, result.GOMAXPROCS, tt.name)
+		assert.Equal(t, tt.expectedQuota, result.Quota, tt.name)
+		assert.Equal(t, tt.expectedCode, result.Code, tt.name)
+		undo()
+	}
+}
+
+func TestCPUSource(t *testing.T) {
+	testTable := []struct {
+		name             string
+		policy           CPUSourcePolicy
+		expectedMaxProcs int
+		expectedLog      string
+	}{
+		// v1-cpuset has a quota of 2 CPUs and a cpuset of 8 CPUs, v2-cpuset a
+		// quota of 4 CPUs and a cpuset of 2 CPUs.
+		{name: "v1-cpuset", policy: SourceMin, expectedMaxProcs: 2, expectedLog: "determined from CPU quota"},
+		{name: "v1-cpuset", policy: SourceMax, expectedMaxProcs: 8, expectedLog: "determined from cpuset with SourceMax"},
+		{name: "v2-cpuset", policy: SourceMin, expectedMaxProcs: 2, expectedLog: "limited by cpuset"},
+		{name: "v2-cpuset", policy: SourceMax, expectedMaxProcs: 4, expectedLog: "determined from CPU quota"},
+		// With a single source, it's used whatever the policy.
+		{name: "v2", policy: SourceMax, expectedMaxProcs: 3, expectedLog: "determined from CPU quota"},
+		{name: "cpuset-inherit-v2", policy: SourceMax, expectedMaxProcs: 2, expectedLog: "determined from cpuset"},
+	}
+
+	for _, tt := range testTable {
+		buf, logOpt := testLogger()
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", tt.name)
+		undo, err := Set(logOpt, RootPrefix(prefix), UseSchedAffinity(false), CPUSource(tt.policy))
+		require.NoError(t, err, "%v: Set failed", tt.name)
+		assert.Equal(t, tt.expectedMaxProcs, currentMaxProcs(), "%v, policy=%v", tt.name, tt.policy)
+		assert.Contains(t, buf.String(), tt.expectedLog, "%v, policy=%v: unexpected log output", tt.name, tt.policy)
+		undo()
+	}
+
+	prev := currentMaxProcs()
+	undo, err := Set(CPUSource(CPUSourcePolicy(7)))
+	defer undo()
+	assert.EqualError(t, err, "maxprocs: unknown CPU source policy 7")
+	assert.Equal(t, prev, currentMaxProcs())
+}
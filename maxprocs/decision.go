@@ -0,0 +1,249 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+)
+
+// Decision describes the GOMAXPROCS value chosen by Set and the environment
+// it was chosen in.
+type Decision struct {
+	// GOMAXPROCS is the value in effect once Set returned, or the value it
+	// computed but didn't apply with DryRun.
+	GOMAXPROCS int `json:"gomaxprocs"`
+	// MinBinding is true if the CPU quota, once rounded, was strictly less
+	// than the configured minimum, so GOMAXPROCS was raised to the minimum.
+	// It's false if the quota was equal to the minimum or larger. A binding
+	// minimum usually means that the quota is misconfigured.
+	MinBinding bool `json:"minBinding"`
+	// Hostname is the name of the host Set ran on. It's only populated when
+	// the ContainerInfo option is enabled.
+	Hostname string `json:"hostname,omitempty"`
+	// ContainerID is the ID of the container Set ran in, parsed from the
+	// process' cgroup path. It's only populated when the ContainerInfo
+	// option is enabled and the path contains a recognizable ID.
+	ContainerID string `json:"containerID,omitempty"`
+	// Quota is the CPU quota of the process as a fraction of CPUs, e.g.
+	// 2.5, as read from cgroups, before rounding and before the cpuset, the
+	// affinity mask or any option capped it, or as supplied with the CPU
+	// environment variable or FromFile. It's -1 if no quota is defined or
+	// none was read, e.g. because the GOMAXPROCS environment variable is
+	// set.
+	Quota float64 `json:"quota"`
+	// Burst is the CFS burst allowed on top of the CPU quota, as a number of
+	// CPUs, or 0 if none is set or the kernel doesn't support burst. It's
+	// only added to the quota with the AddBurst option.
+	Burst float64 `json:"burst"`
+	// Trace lists how GOMAXPROCS was derived from the CPU quota, one Step
+	// per stage in order. It's empty when Set leaves GOMAXPROCS unchanged.
+	Trace []Step `json:"trace,omitempty"`
+	// Duration is how long detection took, from reading the first cgroup
+	// file to the decision. See LogDetectionDuration. It's formatted like
+	// time.Duration.String in JSON.
+	Duration time.Duration `json:"-"`
+}
+
+// decisionFields has the fields of Decision without its methods, so that
+// they're encoded as usual by the JSON methods of Decision.
+type decisionFields Decision
+
+// decisionJSON is the JSON form of a Decision.
+type decisionJSON struct {
+	decisionFields
+	Duration string `json:"duration,omitempty"`
+}
+
+// MarshalJSON encodes d as JSON, formatting its Duration as a string like
+// the durations of the maxprocshttp.Handler report.
+func (d Decision) MarshalJSON() ([]byte, error) {
+	j := decisionJSON{decisionFields: decisionFields(d)}
+	if d.Duration > 0 {
+		j.Duration = d.Duration.String()
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes a Decision encoded with MarshalJSON.
+func (d *Decision) UnmarshalJSON(data []byte) error {
+	var j decisionJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*d = Decision(j.decisionFields)
+	if j.Duration != "" {
+		duration, err := time.ParseDuration(j.Duration)
+		if err != nil {
+			return err
+		}
+		d.Duration = duration
+	}
+	return nil
+}
+
+// logSuffix formats the environment of the decision for log lines. It
+// returns an empty string if there is nothing to report.
+func (d Decision) logSuffix() string {
+	var fields []string
+	if d.Hostname != "" {
+		fields = append(fields, "hostname="+d.Hostname)
+	}
+	if d.ContainerID != "" {
+		fields = append(fields, "container="+d.ContainerID)
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", strings.Join(fields, ", "))
+}
+
+var _lastDecision struct {
+	sync.Mutex
+
+	decision Decision
+	ok       bool
+}
+
+func recordDecision(d Decision) {
+	_lastDecision.Lock()
+	defer _lastDecision.Unlock()
+	_lastDecision.decision = d
+	_lastDecision.ok = true
+}
+
+// record records d as the last decision, unless c runs with DryRun, and
+// passes it to the function set with OnDecision and the channel set with
+// LogChan, if any.
+func (c *config) record(d Decision) {
+	if !c.dryRun {
+		recordDecision(d)
+	}
+	c.traceDecision(d)
+	c.writeDecisionFile(d)
+	if c.onDecision != nil {
+		c.onDecision(d)
+	}
+	if c.logChan != nil {
+		select {
+		case c.logChan <- d:
+		default:
+		}
+	}
+}
+
+// LastDecision returns the Decision made by the most recent successful call
+// to Set, ignoring calls with DryRun. It returns false if Set hasn't
+// succeeded yet.
+func LastDecision() (Decision, bool) {
+	_lastDecision.Lock()
+	defer _lastDecision.Unlock()
+	return _lastDecision.decision, _lastDecision.ok
+}
+
+// Reset forgets the Decision recorded by Set, so that LastDecision reports
+// false until Set succeeds again, zeroes the counters returned by Stats and
+// discards the values cached with CacheInMemory, so that after a reload of
+// the application the next call re-runs detection from scratch. The file
+// written by CacheToFile is kept, since it's only reused while the files it
+// was read from are unchanged. Reset is safe to call concurrently with Set.
+func Reset() {
+	iruntime.InvalidateCache()
+	_lastDecision.Lock()
+	defer _lastDecision.Unlock()
+	_lastDecision.decision = Decision{}
+	_lastDecision.ok = false
+	resetStats()
+}
+
+// OnDecision sets a function that receives the Decision of every successful
+// call to Set, once GOMAXPROCS was applied or left unchanged, e.g. to report
+// it to a metrics or tracing system. It runs synchronously within Set.
+func OnDecision(f func(Decision)) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.onDecision = f
+	})
+}
+
+// LogChan sends the Decision of every successful call to Set to ch, for
+// programs whose logging is asynchronous and that don't want Set to call a
+// logger inline. It can be used instead of Logger. The send never blocks: if
+// ch is full, the Decision is dropped, so ch should be buffered and drained
+// by the receiver to avoid losing records. Set never closes ch.
+func LogChan(ch chan<- Decision) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.logChan = ch
+	})
+}
+
+// ContainerInfo includes the hostname and the ID of the container the process
+// runs in in the Decision and in the log lines emitted by Set. The container
+// ID is parsed from the process' cgroup path and omitted if none is found.
+// Disabled by default.
+func ContainerInfo(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.containerInfo = enabled
+	})
+}
+
+// environment resolves the hostname and container ID, if enabled.
+func (c *config) environment() Decision {
+	var d Decision
+	if !c.containerInfo {
+		return d
+	}
+
+	if hostname, err := c.hostname(); err == nil {
+		d.Hostname = hostname
+	} else {
+		c.log("maxprocs: Couldn't determine hostname: %v", err)
+	}
+	if containerID, err := c.containerID(c.runtimeOptions()); err == nil {
+		d.ContainerID = containerID
+	} else {
+		c.log("maxprocs: Couldn't determine container ID: %v", err)
+	}
+	return d
+}
+
+// With DryRun, logDecision logs lines that start with _updatingPrefix with
+// _dryRunPrefix instead.
+const (
+	_updatingPrefix = "maxprocs: Updating GOMAXPROCS=%v"
+	_dryRunPrefix   = "maxprocs: Computed GOMAXPROCS=%v but not applied (dry run)"
+)
+
+// logDecision logs the line of reason about d, followed by its environment,
+// or hands it to the structured logger set with WithSlog.
+func (c *config) logDecision(d Decision, reason Reason, args ...interface{}) {
+	c.setReason(reason, args...)
+	format := c.reasonFormat(reason)
+	if c.decisionLog != nil {
+		c.decisionLog(d, fmt.Sprintf(format, args...))
+		return
+	}
+	c.log(format+"%s", append(args, d.logSuffix())...)
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubEnvironment(hostname string, containerID string, err error) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.hostname = func() (string, error) { return hostname, err }
+		cfg.containerID = func(iruntime.Options) (string, error) { return containerID, err }
+	})
+}
+
+func TestDecisionLogSuffix(t *testing.T) {
+	assert.Equal(t, "", Decision{GOMAXPROCS: 2}.logSuffix())
+	assert.Equal(t, " (hostname=node-1)", Decision{Hostname: "node-1"}.logSuffix())
+	assert.Equal(t, " (container=abcdef)", Decision{ContainerID: "abcdef"}.logSuffix())
+	assert.Equal(t, " (hostname=node-1, container=abcdef)",
+		Decision{Hostname: "node-1", ContainerID: "abcdef"}.logSuffix())
+}
+
+func TestDecisionJSON(t *testing.T) {
+	d := Decision{
+		GOMAXPROCS: 3,
+		Hostname:   "host",
+		Quota:      3,
+		Trace:      []Step{{Stage: StageQuota, Source: "CPU quota", Value: 3}},
+		Duration:   1500 * time.Microsecond,
+	}
+	data, err := json.Marshal(d)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"gomaxprocs": 3,
+		"minBinding": false,
+		"hostname": "host",
+		"quota": 3,
+		"burst": 0,
+		"trace": [{"stage": "quota", "source": "CPU quota", "value": 3}],
+		"duration": "1.5ms"
+	}`, string(data))
+
+	var got Decision
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, d, got, "should round-trip")
+
+	assert.Error(t, json.Unmarshal([]byte(`{"duration": "soon"}`), &got), "should reject invalid durations")
+}
+
+func TestContainerInfo(t *testing.T) {
+	quotaOpt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 3, iruntime.CPUQuotaUsed, nil
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		buf, logOpt := testLogger()
+		undo, err := Set(logOpt, quotaOpt, ContainerInfo(true), stubEnvironment("node-1", "abcdef", nil))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Contains(t, buf.String(), "determined from CPU quota (hostname=node-1, container=abcdef)",
+			"unexpected log output")
+
+		decision, ok := LastDecision()
+		require.True(t, ok, "Set should record its decision")
+		assert.Equal(t, 3, decision.GOMAXPROCS)
+		assert.Equal(t, "node-1", decision.Hostname)
+		assert.Equal(t, "abcdef", decision.ContainerID)
+	})
+
+	t.Run("no-container", func(t *testing.T) {
+		buf, logOpt := testLogger()
+		undo, err := Set(logOpt, quotaOpt, ContainerInfo(true), stubEnvironment("node-1", "", nil))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Contains(t, buf.String(), "determined from CPU quota (hostname=node-1)", "unexpected log output")
+		assert.NotContains(t, buf.String(), "container=", "unexpected log output")
+	})
+
+	t.Run("error", func(t *testing.T) {
+		buf, logOpt := testLogger()
+		undo, err := Set(logOpt, quotaOpt, ContainerInfo(true), stubEnvironment("", "", errors.New("failed")))
+		defer undo()
+		require.NoError(t, err, "failing to resolve the environment shouldn't fail Set")
+		assert.Contains(t, buf.String(), "Couldn't determine container ID: failed", "unexpected log output")
+		assert.Equal(t, 3, currentMaxProcs(), "should still apply the quota")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		buf, logOpt := testLogger()
+		undo, err := Set(logOpt, quotaOpt, stubEnvironment("node-1", "abcdef", nil))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.NotContains(t, buf.String(), "hostname=", "unexpected log output")
+
+		decision, ok := LastDecision()
+		require.True(t, ok, "Set should record its decision")
+		assert.Equal(t, 3, decision.GOMAXPROCS)
+		assert.Empty(t, decision.Hostname)
+		assert.Empty(t, decision.ContainerID)
+	})
+}
+
+func TestDecisionMinBinding(t *testing.T) {
+	testTable := []struct {
+		name            string
+		status          iruntime.CPUQuotaStatus
+		expectedBinding bool
+		expectedLog     string
+	}{
+		{
+			name:            "quota-below-min",
+			status:          iruntime.CPUQuotaMinUsed,
+			expectedBinding: true,
+			expectedLog:     "using minimum allowed GOMAXPROCS, CPU quota is below it",
+		},
+		{
+			name:            "quota-equal-to-min",
+			status:          iruntime.CPUQuotaUsed,
+			expectedBinding: false,
+			expectedLog:     "determined from CPU quota",
+		},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, logOpt := testLogger()
+			opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+				return 2, tt.status, nil
+			})
+			undo, err := Set(logOpt, opt, Min(2))
+			defer undo()
+			require.NoError(t, err, "Set failed")
+			assert.Contains(t, buf.String(), tt.expectedLog, "unexpected log output")
+
+			decision, ok := LastDecision()
+			require.True(t, ok, "Set should record its decision")
+			assert.Equal(t, tt.expectedBinding, decision.MinBinding)
+		})
+	}
+}
+
+func TestReset(t *testing.T) {
+	calls := 0
+	opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		calls++
+		return 3, iruntime.CPUQuotaUsed, nil
+	})
+
+	undo, err := Set(opt)
+	require.NoError(t, err, "Set failed")
+	undo()
+	_, ok := LastDecision()
+	assert.True(t, ok, "Set should record its decision")
+
+	Reset()
+	decision, ok := LastDecision()
+	assert.False(t, ok, "Reset should forget the last decision")
+	assert.Equal(t, Decision{}, decision)
+
+	undo, err = Set(opt)
+	require.NoError(t, err, "Set failed")
+	undo()
+	assert.Equal(t, 2, calls, "Set should detect the CPU quota again")
+	decision, ok = LastDecision()
+	assert.True(t, ok, "Set should record its decision after a reset")
+	assert.Equal(t, 3, decision.GOMAXPROCS)
+}
+
+func TestOnDecision(t *testing.T) {
+	var got []Decision
+	onDecision := OnDecision(func(d Decision) { got = append(got, d) })
+
+	undo, err := Set(onDecision, stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 3, iruntime.CPUQuotaUsed, nil
+	}))
+	require.NoError(t, err, "Set failed")
+	undo()
+	require.Len(t, got, 1, "OnDecision should be called once")
+	decision, _ := LastDecision()
+	assert.Equal(t, decision, got[0], "OnDecision should receive the recorded decision")
+	assert.Equal(t, 3, got[0].GOMAXPROCS)
+
+	prev := currentMaxProcs()
+	undo, err = Set(onDecision, stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return -1, iruntime.CPUQuotaUndefined, nil
+	}))
+	require.NoError(t, err, "Set failed")
+	undo()
+	require.Len(t, got, 2, "OnDecision should be called when GOMAXPROCS is left unchanged")
+	assert.Equal(t, prev, got[1].GOMAXPROCS)
+
+	_, err = Set(onDecision, stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return -1, iruntime.CPUQuotaUndefined, errors.New("failed")
+	}))
+	require.Error(t, err, "Set should have failed")
+	assert.Len(t, got, 2, "OnDecision shouldn't be called when Set fails")
+}
+
+func TestLogChan(t *testing.T) {
+	procs := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 3, iruntime.CPUQuotaUsed, nil
+	})
+
+	ch := make(chan Decision, 1)
+	undo, err := Set(procs, LogChan(ch))
+	require.NoError(t, err, "Set failed")
+	undo()
+	require.Len(t, ch, 1, "the decision should have been sent")
+
+	// The channel is full: the next decision is dropped rather than
+	// blocking Set.
+	undo, err = Set(procs, LogChan(ch))
+	require.NoError(t, err, "Set failed")
+	undo()
+	assert.Len(t, ch, 1, "the decision should have been dropped")
+	assert.Equal(t, 3, (<-ch).GOMAXPROCS)
+
+	undo, err = Set(procs, LogChan(make(chan Decision)))
+	require.NoError(t, err, "Set shouldn't block on an unbuffered channel without receiver")
+	undo()
+}
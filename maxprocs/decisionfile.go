@@ -0,0 +1,46 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+// WriteDecisionFile writes every Decision made by Set, or by the function
+// returned by Prepare, to path as JSON, e.g. so that a sidecar sharing a
+// volume with the process can read it. The file is written to a temporary
+// file in the same directory first and renamed over path, which is atomic,
+// so that readers see either the old or the new decision. The file is
+// readable by every user. Failing to write the file is logged and doesn't
+// fail Set.
+func WriteDecisionFile(path string) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.decisionFile = path
+	})
+}
+
+// writeDecisionFile writes d to c.decisionFile if WriteDecisionFile is set.
+func (c *config) writeDecisionFile(d Decision) {
+	if c.decisionFile == "" {
+		return
+	}
+	if err := iruntime.WriteJSONFile(c.decisionFile, d); err != nil {
+		c.log("maxprocs: Couldn't write decision to %v: %v", c.decisionFile, err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDecisionFile(t *testing.T) {
+	procs := func(n int) Option {
+		return stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return n, iruntime.CPUQuotaUsed, nil
+		})
+	}
+	readDecision := func(t *testing.T, path string) Decision {
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err, "decision file should exist")
+		var d Decision
+		require.NoError(t, json.Unmarshal(data, &d), "decision file should hold JSON")
+		return d
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "decision.json")
+	for _, n := range []int{3, 2} {
+		undo, err := Set(procs(n), WriteDecisionFile(path))
+		require.NoError(t, err, "Set failed")
+		undo()
+
+		want, ok := LastDecision()
+		require.True(t, ok)
+		got := readDecision(t, path)
+		assert.Equal(t, n, got.GOMAXPROCS)
+		assert.Equal(t, want, got, "file should hold the latest decision")
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o644), info.Mode().Perm(), "a sidecar running as another user should be able to read the file")
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, matches, "temporary files should be cleaned up")
+
+	t.Run("environment", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "decision.json")
+		withMax(t, 5, func() {
+			undo, err := Set(WriteDecisionFile(path))
+			defer undo()
+			require.NoError(t, err, "Set failed")
+		})
+		assert.Equal(t, currentMaxProcs(), readDecision(t, path).GOMAXPROCS, "should write decisions that honor GOMAXPROCS")
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		buf, logOpt := testLogger()
+		path := filepath.Join(t.TempDir(), "nonexistent", "decision.json")
+		undo, err := Set(logOpt, procs(3), WriteDecisionFile(path))
+		defer undo()
+		require.NoError(t, err, "a write error shouldn't fail Set")
+		assert.Equal(t, 3, currentMaxProcs())
+		assert.Contains(t, buf.String(), "maxprocs: Couldn't write decision to "+path)
+	})
+}
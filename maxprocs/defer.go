@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// _containerMaxProcsSetting is the GODEBUG setting that controls
+	// whether the Go runtime derives its default GOMAXPROCS from the cgroup
+	// CPU limit.
+	_containerMaxProcsSetting = "containermaxprocs"
+	// _containerMaxProcsMinor is the first Go 1.x release whose runtime
+	// derives its default GOMAXPROCS from the cgroup CPU limit.
+	_containerMaxProcsMinor = 25
+)
+
+var _goVersionPattern = regexp.MustCompile(`\bgo1\.(\d+)`)
+
+// DeferToRuntime makes Set a logged no-op when the Go runtime already sets
+// its default GOMAXPROCS from the cgroup CPU limit, as it does since Go 1.25
+// unless disabled with GODEBUG=containermaxprocs=0. This lets programs keep
+// calling Set across Go upgrades without the two conflicting. Max still
+// lowers the runtime's default if it exceeds it. Disabled by default.
+func DeferToRuntime(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.deferToRuntime = enabled
+	})
+}
+
+// runtimeSetsContainerDefault reports whether the running Go runtime derives
+// its default GOMAXPROCS from the cgroup CPU limit.
+func runtimeSetsContainerDefault() bool {
+	return containerDefaultEnabled(runtime.Version(), defaultGODEBUG(), os.Getenv("GODEBUG"))
+}
+
+// containerDefaultEnabled reports whether a runtime of the given version,
+// with the given default and environment GODEBUG settings, derives its
+// default GOMAXPROCS from the cgroup CPU limit.
+func containerDefaultEnabled(version, defaultGODEBUG, envGODEBUG string) bool {
+	match := _goVersionPattern.FindStringSubmatch(version)
+	if match == nil {
+		return false
+	}
+	if minor, err := strconv.Atoi(match[1]); err != nil || minor < _containerMaxProcsMinor {
+		return false
+	}
+
+	// The environment overrides the defaults built into the binary, and
+	// later settings override earlier ones.
+	enabled := true
+	for _, setting := range strings.Split(defaultGODEBUG+","+envGODEBUG, ",") {
+		if value := strings.TrimPrefix(setting, _containerMaxProcsSetting+"="); value != setting {
+			enabled = value != "0"
+		}
+	}
+	return enabled
+}
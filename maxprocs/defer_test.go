@@ -0,0 +1,118 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"runtime"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubRuntimeDefault(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.runtimeDefault = func() bool { return enabled }
+	})
+}
+
+func TestContainerDefaultEnabled(t *testing.T) {
+	testTable := []struct {
+		name     string
+		version  string
+		defaults string
+		env      string
+		expected bool
+	}{
+		{name: "go1.24", version: "go1.24.3", expected: false},
+		{name: "go1.25", version: "go1.25.0", expected: true},
+		{name: "go1.26-rc", version: "go1.26rc1", expected: true},
+		{name: "go1.3", version: "go1.3", expected: false},
+		{name: "devel", version: "devel go1.26-abcdef Tue Jan 1 00:00:00 2026 +0000", expected: true},
+		{name: "unknown", version: "gccgo", expected: false},
+		{
+			name:     "disabled-by-default",
+			version:  "go1.25.0",
+			defaults: "httpmuxgo121=1,containermaxprocs=0,updatemaxprocs=0",
+			expected: false,
+		},
+		{
+			name:     "disabled-by-env",
+			version:  "go1.25.0",
+			env:      "containermaxprocs=0",
+			expected: false,
+		},
+		{
+			name:     "enabled-by-env",
+			version:  "go1.25.0",
+			defaults: "containermaxprocs=0",
+			env:      "gctrace=1,containermaxprocs=1",
+			expected: true,
+		},
+	}
+
+	for _, tt := range testTable {
+		assert.Equal(t, tt.expected, containerDefaultEnabled(tt.version, tt.defaults, tt.env), tt.name)
+	}
+}
+
+func TestDeferToRuntime(t *testing.T) {
+	quotaOpt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 3, iruntime.CPUQuotaUsed, nil
+	})
+
+	t.Run("runtime-default", func(t *testing.T) {
+		buf, logOpt := testLogger()
+		prev := currentMaxProcs()
+		undo, err := Set(logOpt, quotaOpt, DeferToRuntime(true), stubRuntimeDefault(true))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+		assert.Contains(t, buf.String(), "deferring to the Go runtime", "unexpected log output")
+	})
+
+	t.Run("runtime-default-capped", func(t *testing.T) {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+		buf, logOpt := testLogger()
+		undo, err := Set(logOpt, quotaOpt, DeferToRuntime(true), stubRuntimeDefault(true), Max(2))
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 2, currentMaxProcs(), "should lower the runtime's default to Max")
+		assert.Contains(t, buf.String(), "maxprocs: Updating GOMAXPROCS=2: Go runtime's container-aware default exceeds Max(2)")
+		undo()
+		assert.Equal(t, 4, currentMaxProcs(), "undo should restore the runtime's default")
+	})
+
+	t.Run("no-runtime-default", func(t *testing.T) {
+		undo, err := Set(quotaOpt, DeferToRuntime(true), stubRuntimeDefault(false))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 3, currentMaxProcs(), "should apply the CPU quota")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		undo, err := Set(quotaOpt, stubRuntimeDefault(true))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 3, currentMaxProcs(), "shouldn't defer by default")
+	})
+}
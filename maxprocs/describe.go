@@ -0,0 +1,125 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+)
+
+// description is the JSON document returned by Describe. Fields that
+// couldn't be determined are left empty, with the error in the matching
+// Error field.
+type description struct {
+	CGroupVersion      string          `json:"cgroupVersion,omitempty"`
+	CGroupVersionError string          `json:"cgroupVersionError,omitempty"`
+	CPUCGroupPath      string          `json:"cpuCGroupPath,omitempty"`
+	CPUCGroupError     string          `json:"cpuCGroupError,omitempty"`
+	Files              []describedFile `json:"files"`
+	// Quota is null if no CPU quota is defined.
+	Quota      *float64 `json:"quota"`
+	QuotaError string   `json:"quotaError,omitempty"`
+	NumCPU     int      `json:"numCPU"`
+	GOMAXPROCS int      `json:"gomaxprocs"`
+	// GOMAXPROCSEnv is null if the GOMAXPROCS environment variable isn't
+	// set.
+	GOMAXPROCSEnv *string `json:"gomaxprocsEnv"`
+}
+
+// describedFile is the JSON representation of a file in a description.
+type describedFile struct {
+	Name    string `json:"name"`
+	Content string `json:"content,omitempty"`
+	Missing bool   `json:"missing,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// newDescribedFile returns the JSON representation of f.
+func newDescribedFile(f File) describedFile {
+	df := describedFile{Name: f.Name, Content: string(f.Content)}
+	switch {
+	case os.IsNotExist(f.Err):
+		df.Missing = true
+	case f.Err != nil:
+		df.Error = f.Err.Error()
+	}
+	return df
+}
+
+// Describe returns a JSON document describing what the detection of the CPU
+// quota sees with the given options, to attach to a bug report when the
+// detected GOMAXPROCS is unexpected: the cgroup version ("v1", "v2" or
+// "hybrid"), the path of the cgroup directory the quota is read from and
+// the raw content of its cpu.max, cpu.cfs_quota_us and cpu.cfs_period_us
+// files, the quota, runtime.NumCPU, the current GOMAXPROCS and the
+// GOMAXPROCS environment variable. A field that can't be determined doesn't
+// fail Describe: its error is recorded in the document instead. Describe
+// only returns an error if the options are invalid.
+//
+// Describe doesn't change GOMAXPROCS. Unlike Snapshot, it only covers the
+// CPU quota, but interprets the files rather than listing every file read.
+func Describe(opts ...Option) ([]byte, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	cancel := cfg.startTimeout()
+	defer cancel()
+
+	ropts := cfg.runtimeOptions()
+	desc := description{
+		Files:      []describedFile{},
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: currentMaxProcs(),
+	}
+	if v, ok := os.LookupEnv(_maxProcsKey); ok {
+		desc.GOMAXPROCSEnv = &v
+	}
+
+	version, err := iruntime.CGroupVersion(ropts)
+	desc.CGroupVersion = version
+	if err != nil {
+		desc.CGroupVersionError = err.Error()
+	}
+
+	path, files, err := iruntime.CPUCGroupFiles(ropts)
+	desc.CPUCGroupPath = path
+	if err != nil {
+		desc.CPUCGroupError = err.Error()
+	}
+	for _, f := range files {
+		desc.Files = append(desc.Files, newDescribedFile(File{Name: f.Name, Content: f.Content, Err: f.Err}))
+	}
+
+	quota, defined, err := cfg.quotaCPUs(ropts)
+	switch {
+	case err != nil:
+		desc.QuotaError = err.Error()
+	case defined:
+		desc.Quota = &quota
+	}
+
+	return json.MarshalIndent(desc, "", "  ")
+}
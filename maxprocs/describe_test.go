@@ -0,0 +1,92 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func describe(t *testing.T, opts ...Option) description {
+	data, err := Describe(opts...)
+	require.NoError(t, err, "Describe failed")
+	var desc description
+	require.NoError(t, json.Unmarshal(data, &desc), "invalid JSON: %s", data)
+	return desc
+}
+
+func TestDescribe(t *testing.T) {
+	root := filepath.Join("..", "internal", "cgroups", "testdata", "root")
+
+	t.Run("v2", func(t *testing.T) {
+		desc := describe(t, RootPrefix(filepath.Join(root, "v2")))
+		assert.Equal(t, "v2", desc.CGroupVersion)
+		assert.Equal(t, "/sys/fs/cgroup", desc.CPUCGroupPath)
+		require.Len(t, desc.Files, 3)
+		assert.Equal(t, describedFile{Name: "/sys/fs/cgroup/cpu.max", Content: "300000 100000\n"}, desc.Files[0])
+		assert.Equal(t, describedFile{Name: "/sys/fs/cgroup/cpu.cfs_quota_us", Missing: true}, desc.Files[1])
+		require.NotNil(t, desc.Quota)
+		assert.Equal(t, 3.0, *desc.Quota)
+		assert.Equal(t, runtime.NumCPU(), desc.NumCPU)
+		assert.Equal(t, currentMaxProcs(), desc.GOMAXPROCS)
+	})
+
+	t.Run("v1", func(t *testing.T) {
+		desc := describe(t, RootPrefix(filepath.Join(root, "v1")))
+		assert.Equal(t, "v1", desc.CGroupVersion)
+		assert.Equal(t, "/sys/fs/cgroup/cpu,cpuacct", desc.CPUCGroupPath)
+		require.Len(t, desc.Files, 3)
+		assert.True(t, desc.Files[0].Missing, "cpu.max shouldn't exist")
+		assert.Equal(t, describedFile{Name: "/sys/fs/cgroup/cpu,cpuacct/cpu.cfs_quota_us", Content: "150000\n"}, desc.Files[1])
+		require.NotNil(t, desc.Quota)
+		assert.Equal(t, 1.5, *desc.Quota)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		desc := describe(t, RootPrefix(t.TempDir()))
+		assert.Empty(t, desc.CGroupVersion)
+		assert.NotEmpty(t, desc.CGroupVersionError)
+		assert.NotEmpty(t, desc.CPUCGroupError)
+		assert.Empty(t, desc.Files)
+		assert.Nil(t, desc.Quota)
+		assert.NotEmpty(t, desc.QuotaError)
+		assert.Equal(t, runtime.NumCPU(), desc.NumCPU, "should still be reported")
+	})
+
+	t.Run("env", func(t *testing.T) {
+		assert.Nil(t, describe(t).GOMAXPROCSEnv)
+		withMax(t, 42, func() {
+			desc := describe(t)
+			require.NotNil(t, desc.GOMAXPROCSEnv)
+			assert.Equal(t, "42", *desc.GOMAXPROCSEnv)
+		})
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := Describe(RootPrefix(filepath.Join(root, "nonexistent")))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import "time"
+
+// LogDetectionDuration logs how long detection took, from reading the first
+// cgroup file to the decision, after every detection run by Set or Prepare,
+// including failed ones, e.g. to spot hosts whose proc file system is slow.
+// The duration is also reported in Decision.Duration and, failed detections
+// included, Counters.LastDuration, whether this option is enabled or not.
+// Disabled by default.
+func LogDetectionDuration(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.logDuration = enabled
+	})
+}
+
+// detected records d as the duration of the detection that just ran,
+// successful or not.
+func (c *config) detected(d time.Duration) {
+	if !c.forQuery {
+		recordDuration(d)
+	}
+	if c.logDuration {
+		c.log("maxprocs: Detection took %v", d)
+	}
+}
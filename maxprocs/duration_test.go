@@ -0,0 +1,69 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectionDuration(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	const delay = 10 * time.Millisecond
+	slowProcs := func(err error) Option {
+		return stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			time.Sleep(delay)
+			return 2, iruntime.CPUQuotaUsed, err
+		})
+	}
+
+	buf, logOpt := testLogger()
+	undo, err := Set(logOpt, slowProcs(nil), LogDetectionDuration(true))
+	require.NoError(t, err, "Set failed")
+	undo()
+
+	d, ok := LastDecision()
+	require.True(t, ok)
+	assert.GreaterOrEqual(t, int64(d.Duration), int64(delay), "duration should span detection")
+	assert.Equal(t, d.Duration, Stats().LastDuration)
+	assert.Contains(t, buf.String(), "maxprocs: Detection took "+d.Duration.String())
+
+	buf, logOpt = testLogger()
+	_, err = Set(logOpt, slowProcs(errors.New("failed")), LogDetectionDuration(true))
+	require.Error(t, err, "Set should have failed")
+	failed := Stats().LastDuration
+	assert.GreaterOrEqual(t, int64(failed), int64(delay), "failed detection should be timed too")
+	assert.Contains(t, buf.String(), "maxprocs: Detection took "+failed.String())
+
+	buf, logOpt = testLogger()
+	undo, err = Set(logOpt, slowProcs(nil))
+	require.NoError(t, err, "Set failed")
+	undo()
+	assert.NotContains(t, buf.String(), "Detection took", "duration shouldn't be logged by default")
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+)
+
+// EnvVar makes Set take GOMAXPROCS from the environment variable with the
+// given name, e.g. MYSVC_GOMAXPROCS, before the GOMAXPROCS environment
+// variable and the CPU quota, so that services sharing a container can be
+// overridden one by one. Like GOMAXPROCS, the value must be a positive
+// integer, is capped by Max but not raised to Min, and is ignored, with a
+// log line, if invalid. Set then falls back to GOMAXPROCS and the CPU
+// quota, as it does when the variable is unset. Disabled by default.
+func EnvVar(name string) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.envVar = name
+	})
+}
+
+// prepareEnvVar returns a function that applies the GOMAXPROCS value set in
+// the variable named with EnvVar, or false if there's none or it's unset or
+// invalid.
+func (c *config) prepareEnvVar(decision *Decision) (func() (int, func(), error), bool) {
+	if c.envVar == "" {
+		return nil, false
+	}
+	value, exists := os.LookupEnv(c.envVar)
+	if !exists {
+		return nil, false
+	}
+	procs, err := strconv.Atoi(value)
+	if err != nil || procs <= 0 {
+		c.log("maxprocs: Ignoring %s=%q: not a positive integer", c.envVar, value)
+		return nil, false
+	}
+
+	capped := c.maxGOMAXPROCS > 0 && procs > c.maxGOMAXPROCS
+	if capped {
+		procs = c.maxGOMAXPROCS
+	}
+	c.source = SourceEnv
+	decision.GOMAXPROCS = procs
+	return func() (int, func(), error) {
+		prev := currentMaxProcs()
+		if c.noDowngrade && procs < prev {
+			decision.GOMAXPROCS = prev
+			c.logDecision(*decision, ReasonNoDowngrade, prev, procs)
+			c.record(*decision)
+			return prev, c.undoNoop, nil
+		}
+		if capped {
+			c.logDecision(*decision, ReasonEnvOverrideCapped, procs, c.envVar, value, c.maxGOMAXPROCS)
+		} else {
+			c.logDecision(*decision, ReasonEnvOverride, c.envVar, value)
+		}
+		c.record(*decision)
+		if c.dryRun {
+			return prev, c.undoNoop, nil
+		}
+
+		if runtime.GOMAXPROCS(procs) != procs {
+			recordChange()
+		}
+		return procs, func() {
+			c.log("maxprocs: Resetting GOMAXPROCS to %v", prev)
+			runtime.GOMAXPROCS(prev)
+		}, nil
+	}, true
+}
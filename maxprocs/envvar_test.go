@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const _testEnvVar = "MAXPROCS_TEST_GOMAXPROCS"
+
+func withEnvVar(t *testing.T, value string, f func()) {
+	require.NoError(t, os.Setenv(_testEnvVar, value))
+	defer os.Unsetenv(_testEnvVar)
+	f()
+}
+
+func TestEnvVar(t *testing.T) {
+	prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2")
+	detect := []Option{RootPrefix(prefix), UseSchedAffinity(false), EnvVar(_testEnvVar)}
+
+	t.Run("set", func(t *testing.T) {
+		withEnvVar(t, "5", func() {
+			withMax(t, 42, func() {
+				buf, logOpt := testLogger()
+				result, undo, err := SetWithResult(append(detect, logOpt)...)
+				defer undo()
+				require.NoError(t, err, "SetWithResult failed")
+				assert.Equal(t, 5, currentMaxProcs(), "should take precedence over GOMAXPROCS and the quota")
+				assert.Equal(t, ReasonEnvOverride, result.Code)
+				assert.Contains(t, buf.String(), `maxprocs: Honoring MAXPROCS_TEST_GOMAXPROCS="5" as set in environment`)
+			})
+		})
+	})
+
+	t.Run("max", func(t *testing.T) {
+		withEnvVar(t, "5", func() {
+			buf, logOpt := testLogger()
+			undo, err := Set(append(detect, logOpt, Max(2))...)
+			defer undo()
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, 2, currentMaxProcs())
+			assert.Contains(t, buf.String(), `maxprocs: Updating GOMAXPROCS=2: MAXPROCS_TEST_GOMAXPROCS="5" set in environment exceeds Max(2)`)
+		})
+	})
+
+	t.Run("undo", func(t *testing.T) {
+		prev := currentMaxProcs()
+		withEnvVar(t, "5", func() {
+			undo, err := Set(detect...)
+			require.NoError(t, err, "Set failed")
+			undo()
+		})
+		assert.Equal(t, prev, currentMaxProcs(), "undo should restore GOMAXPROCS")
+	})
+
+	t.Run("query", func(t *testing.T) {
+		prev := currentMaxProcs()
+		withEnvVar(t, "5", func() {
+			maxProcs, source, err := Query(detect...)
+			require.NoError(t, err, "Query failed")
+			assert.Equal(t, 5, maxProcs)
+			assert.Equal(t, SourceEnv, source)
+		})
+		assert.Equal(t, prev, currentMaxProcs(), "Query shouldn't alter GOMAXPROCS")
+	})
+
+	for _, value := range []string{"0", "-1", "many", ""} {
+		t.Run("invalid "+value, func(t *testing.T) {
+			withEnvVar(t, value, func() {
+				buf, logOpt := testLogger()
+				undo, err := Set(append(detect, logOpt)...)
+				defer undo()
+				require.NoError(t, err, "Set failed")
+				assert.Equal(t, 3, currentMaxProcs(), "should fall back to the quota")
+				assert.Contains(t, buf.String(), "maxprocs: Ignoring MAXPROCS_TEST_GOMAXPROCS=")
+			})
+		})
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		undo, err := Set(detect...)
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 3, currentMaxProcs(), "should fall back to the quota")
+	})
+}
@@ -44,3 +44,18 @@ func ExampleLogger() {
 		log.Fatalf("failed to set GOMAXPROCS: %v", err)
 	}
 }
+
+func ExamplePrepare() {
+	// Read the CPU quota early...
+	apply, err := maxprocs.Prepare(maxprocs.Logger(log.Printf))
+	if err != nil {
+		log.Printf("failed to detect CPU quota: %v", err)
+	}
+
+	// ...and change GOMAXPROCS later.
+	_, undo, err := apply()
+	defer undo()
+	if err != nil {
+		log.Fatalf("failed to set GOMAXPROCS: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package expvar publishes the decisions of maxprocs.Set as expvar
+// variables. It's kept out of the maxprocs package because importing the
+// standard expvar package registers /debug/vars on http.DefaultServeMux,
+// which exposes the command line and memory statistics of every process
+// importing maxprocs.
+package expvar // import "github.com/emadolsky/automaxprocs/maxprocs/expvar"
+
+import (
+	"expvar"
+	"sync"
+
+	"github.com/emadolsky/automaxprocs/maxprocs"
+)
+
+var _publish sync.Once
+
+// Publish publishes the Decision returned by maxprocs.LastDecision as
+// expvar variables, so that it shows up on /debug/vars:
+//
+//	automaxprocs.gomaxprocs  the GOMAXPROCS value chosen by Set
+//	automaxprocs.quota       the CPU quota detected, as a fraction of CPUs
+//
+// Variables are evaluated whenever they're read, and are null until Set
+// succeeds; the quota is also null when no quota is defined. Since
+// expvar variables are global, nothing is published until Publish is
+// called; calling it again has no effect.
+func Publish() {
+	_publish.Do(func() {
+		expvar.Publish("automaxprocs.gomaxprocs", expvar.Func(func() interface{} {
+			d, ok := maxprocs.LastDecision()
+			if !ok {
+				return nil
+			}
+			return d.GOMAXPROCS
+		}))
+		expvar.Publish("automaxprocs.quota", expvar.Func(func() interface{} {
+			d, ok := maxprocs.LastDecision()
+			if !ok || d.Quota < 0 {
+				return nil
+			}
+			return d.Quota
+		}))
+	})
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package expvar
+
+import (
+	"expvar"
+	"os"
+	"testing"
+
+	"github.com/emadolsky/automaxprocs/maxprocs"
+	"github.com/emadolsky/automaxprocs/maxprocs/maxprocstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublish(t *testing.T) {
+	if _, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		t.Skip("GOMAXPROCS is set in the environment")
+	}
+	maxprocs.Reset()
+	defer maxprocs.Reset()
+
+	Publish()
+	Publish()
+	gomaxprocs := expvar.Get("automaxprocs.gomaxprocs")
+	quota := expvar.Get("automaxprocs.quota")
+	require.NotNil(t, gomaxprocs, "gomaxprocs should be published")
+	require.NotNil(t, quota, "quota should be published")
+	assert.Equal(t, "null", gomaxprocs.String(), "no decision before Set")
+	assert.Equal(t, "null", quota.String(), "no decision before Set")
+
+	undo, err := maxprocs.Set(maxprocstest.FakeCGroups{CPUQuota: 3.5}.Options(t)...)
+	require.NoError(t, err, "Set failed")
+	defer undo()
+	assert.Equal(t, "3", gomaxprocs.String())
+	assert.Equal(t, "3.5", quota.String())
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+)
+
+// FromFile reads the CPU count of the process from the file at path, in
+// place of the CPU quota read from cgroups. The file holds a positive,
+// possibly fractional number of CPUs (e.g. "2.5"), optionally surrounded by
+// whitespace, and the count goes through the same rounding and minimum as a
+// CPU quota. This suits limits exposed by a Kubernetes downward API volume,
+// e.g. `/etc/podinfo/cpu-limit` with a divisor of 1.
+//
+// The file is read as is: RootPrefix doesn't apply to it. If it doesn't
+// exist, the CPU quota is read from cgroups as usual; if its content is
+// invalid, it's logged and ignored the same way. Other errors reading it make
+// Set fail. The AUTOMAXPROCS_CPU environment variable takes precedence over
+// the file.
+func FromFile(path string) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.cpuFile = path
+	})
+}
+
+// procsFromFile converts the CPU count read from c.cpuFile to a GOMAXPROCS
+// value using round. It returns false if the file doesn't exist or is
+// invalid.
+func (c *config) procsFromFile(round func(v float64) int) (int, iruntime.CPUQuotaStatus, bool, error) {
+	data, err := ioutil.ReadFile(c.cpuFile)
+	if os.IsNotExist(err) {
+		c.log("maxprocs: CPU count file %q doesn't exist, reading the CPU quota from cgroups", c.cpuFile)
+		return -1, iruntime.CPUQuotaUndefined, false, nil
+	}
+	if err != nil {
+		return -1, iruntime.CPUQuotaUndefined, false, fmt.Errorf("maxprocs: couldn't read CPU count file: %v", err)
+	}
+
+	value := strings.TrimSpace(string(data))
+	cpus, ok := parseCPUs(value)
+	if !ok {
+		c.log("maxprocs: Ignoring CPU count file %q holding %q: not a positive CPU count", c.cpuFile, value)
+		return -1, iruntime.CPUQuotaUndefined, false, nil
+	}
+	maxProcs, status := iruntime.QuotaToGOMAXPROCS(cpus, c.minGOMAXPROCS, round)
+	return maxProcs, status, true, nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromFile(t *testing.T) {
+	detected := false
+	opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		detected = true
+		return 7, iruntime.CPUQuotaUsed, nil
+	})
+
+	testTable := []struct {
+		name             string
+		content          string
+		missing          bool
+		expectedMaxProcs int
+		expectedDetected bool
+		expectedLog      string
+	}{
+		{
+			name:             "integer",
+			content:          "3",
+			expectedMaxProcs: 3,
+			expectedLog:      "Updating GOMAXPROCS=3: determined from ",
+		},
+		{
+			name:             "fractional-newline",
+			content:          " 2.5\n",
+			expectedMaxProcs: 2,
+			expectedLog:      "Updating GOMAXPROCS=2: determined from ",
+		},
+		{
+			name:             "below-min",
+			content:          "0.5",
+			expectedMaxProcs: 1,
+			expectedLog:      "using minimum allowed GOMAXPROCS",
+		},
+		{
+			name:             "invalid",
+			content:          "two",
+			expectedMaxProcs: 7,
+			expectedDetected: true,
+			expectedLog:      `holding "two": not a positive CPU count`,
+		},
+		{
+			name:             "missing",
+			missing:          true,
+			expectedMaxProcs: 7,
+			expectedDetected: true,
+			expectedLog:      "doesn't exist, reading the CPU quota from cgroups",
+		},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cpu-limit")
+			if !tt.missing {
+				require.NoError(t, ioutil.WriteFile(path, []byte(tt.content), 0o644))
+			}
+
+			detected = false
+			buf, logOpt := testLogger()
+			undo, err := Set(logOpt, opt, FromFile(path))
+			defer undo()
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, tt.expectedMaxProcs, currentMaxProcs(), "unexpected GOMAXPROCS")
+			assert.Equal(t, tt.expectedDetected, detected, "unexpected cgroups detection")
+			assert.Contains(t, buf.String(), tt.expectedLog, "unexpected log output")
+		})
+	}
+
+	t.Run("unreadable", func(t *testing.T) {
+		prev := currentMaxProcs()
+		undo, err := Set(opt, FromFile(t.TempDir()))
+		defer undo()
+		assert.Error(t, err, "reading a directory should fail")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+	})
+
+	t.Run("CPUEnvPrecedence", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cpu-limit")
+		require.NoError(t, ioutil.WriteFile(path, []byte("3"), 0o644))
+		withCPUEnv(t, "2", func() {
+			undo, err := Set(opt, FromFile(path))
+			defer undo()
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, 2, currentMaxProcs(), "AUTOMAXPROCS_CPU should take precedence")
+		})
+	})
+}
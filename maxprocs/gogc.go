@@ -0,0 +1,111 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"runtime"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+)
+
+const (
+	// _defaultGOGC is the GOGC value of the Go runtime.
+	_defaultGOGC = 100
+	// _maxRecommendedGOGC bounds the GOGC value RecommendGOGC suggests for
+	// CPU-constrained processes.
+	_maxRecommendedGOGC = 200
+
+	// Below _lowMemoryPerProc and _veryLowMemoryPerProc bytes of memory limit
+	// per P, RecommendGOGC caps its suggestion at 100 and 50 respectively.
+	_lowMemoryPerProc     = 512 << 20
+	_veryLowMemoryPerProc = 256 << 20
+)
+
+// RecommendGOGC returns a GOGC value suggested for the CPU quota and memory
+// limit of the calling process, without applying it; programs that want to
+// follow it can call debug.SetGCPercent. The suggestion is a heuristic, not
+// a measurement of the workload, and profiling remains the way to tune GOGC.
+//
+// When the CPU quota leaves the process fewer Ps than the machine has CPUs,
+// the garbage collector competes with the program for a smaller CPU budget,
+// so collecting less often pays off. The suggestion grows linearly from 100,
+// the runtime's default, with the share of CPUs the quota takes away:
+//
+//	GOGC = 100 + 100 * (1 - GOMAXPROCS/NumCPU)
+//
+// which peaks at 200. A larger GOGC lets the heap grow further between
+// collections, so the memory limit, if any, bounds it: with less than
+// 512MiB per P, the suggestion is at most 100, and with less than 256MiB per
+// P, it's 50 to keep clear of the limit.
+//
+// GOMAXPROCS is derived from the CPU quota the way Set derives it, with the
+// same options, but without changing it. Without a CPU quota, GOMAXPROCS is
+// taken to be NumCPU.
+func RecommendGOGC(opts ...Option) (int, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return 0, err
+	}
+
+	cancel := cfg.startTimeout()
+	defer cancel()
+
+	numCPU := runtime.NumCPU()
+	procs, status, err := cfg.procs(cfg.minGOMAXPROCS, cfg.round, cfg.runtimeOptions())
+	if err != nil {
+		return 0, err
+	}
+	if status == iruntime.CPUQuotaUndefined || status == iruntime.CPUQuotaControllerUnavailable {
+		procs = numCPU
+	}
+
+	limit, defined, err := cfg.memoryLimit(cfg.runtimeOptions())
+	if err != nil {
+		return 0, err
+	}
+	if !defined {
+		limit = 0
+	}
+	return recommendGOGC(procs, numCPU, limit), nil
+}
+
+// recommendGOGC implements the heuristic of RecommendGOGC for procs Ps on
+// numCPU CPUs with a memory limit of limit bytes, or none if limit isn't
+// positive.
+func recommendGOGC(procs, numCPU int, limit int64) int {
+	gogc := _defaultGOGC
+	if procs > 0 && procs < numCPU {
+		gogc += _defaultGOGC * (numCPU - procs) / numCPU
+	}
+	if gogc > _maxRecommendedGOGC {
+		gogc = _maxRecommendedGOGC
+	}
+
+	if limit > 0 && procs > 0 {
+		switch perProc := limit / int64(procs); {
+		case perProc < _veryLowMemoryPerProc:
+			gogc = _defaultGOGC / 2
+		case perProc < _lowMemoryPerProc && gogc > _defaultGOGC:
+			gogc = _defaultGOGC
+		}
+	}
+	return gogc
+}
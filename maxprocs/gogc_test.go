@@ -0,0 +1,99 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const _gib = 1 << 30
+
+func TestRecommendGOGCHeuristic(t *testing.T) {
+	testTable := []struct {
+		name     string
+		procs    int
+		numCPU   int
+		limit    int64
+		expected int
+	}{
+		{name: "unconstrained", procs: 8, numCPU: 8, expected: 100},
+		{name: "quarter", procs: 6, numCPU: 8, expected: 125},
+		{name: "half", procs: 4, numCPU: 8, expected: 150},
+		{name: "three-quarters", procs: 2, numCPU: 8, expected: 175},
+		{name: "one-of-many", procs: 1, numCPU: 64, expected: 198},
+		{name: "above-numcpu", procs: 16, numCPU: 8, expected: 100},
+		{name: "plenty-of-memory", procs: 2, numCPU: 8, limit: 4 * _gib, expected: 175},
+		{name: "low-memory", procs: 2, numCPU: 8, limit: 768 * _mib, expected: 100},
+		{name: "low-memory-unconstrained", procs: 8, numCPU: 8, limit: 3 * _gib, expected: 100},
+		{name: "very-low-memory", procs: 2, numCPU: 8, limit: 256 * _mib, expected: 50},
+		{name: "very-low-memory-unconstrained", procs: 8, numCPU: 8, limit: 1 * _gib, expected: 50},
+		{name: "boundary-low", procs: 1, numCPU: 2, limit: 512 * _mib, expected: 150},
+		{name: "boundary-very-low", procs: 1, numCPU: 2, limit: 256 * _mib, expected: 100},
+	}
+
+	for _, tt := range testTable {
+		assert.Equal(t, tt.expected, recommendGOGC(tt.procs, tt.numCPU, tt.limit), tt.name)
+	}
+}
+
+func TestRecommendGOGC(t *testing.T) {
+	numCPU := runtime.NumCPU()
+	noMemoryLimit := stubMemoryLimit(-1, false, nil, new(int))
+
+	t.Run("quota", func(t *testing.T) {
+		gogc, err := RecommendGOGC(noMemoryLimit, stubProcs(func(min int, round func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			maxProcs, status := iruntime.QuotaToGOMAXPROCS(float64(numCPU)/2, min, round)
+			return maxProcs, status, nil
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, recommendGOGC(numCPU/2, numCPU, 0), gogc)
+	})
+
+	t.Run("undefined", func(t *testing.T) {
+		gogc, err := RecommendGOGC(noMemoryLimit, stubStatus(-1, iruntime.CPUQuotaUndefined, nil))
+		require.NoError(t, err)
+		assert.Equal(t, 100, gogc)
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		gogc, err := RecommendGOGC(stubMemoryLimit(128*_mib, true, nil, new(int)), stubStatus(1, iruntime.CPUQuotaUsed, nil))
+		require.NoError(t, err)
+		assert.Equal(t, 50, gogc)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := RecommendGOGC(noMemoryLimit, stubStatus(-1, iruntime.CPUQuotaUndefined, errors.New("failed")))
+		assert.Error(t, err)
+
+		_, err = RecommendGOGC(stubMemoryLimit(-1, false, errors.New("failed"), new(int)), stubStatus(1, iruntime.CPUQuotaUsed, nil))
+		assert.Error(t, err)
+
+		_, err = RecommendGOGC(TargetUtilization(2))
+		assert.Error(t, err)
+	})
+}
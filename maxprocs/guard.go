@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// Guard checks every interval, until ctx is done, that GOMAXPROCS still
+// holds the value of the Decision returned by LastDecision, and restores
+// that value if something else, such as a third-party library or profiler,
+// changed it since, logging the correction with the Logger among opts.
+// Other options have no effect. It blocks, so it's typically run in its own
+// goroutine, and returns ctx.Err() once ctx is done; interval must be
+// positive.
+//
+// Guard only defends the last decision against outside changes and never
+// reads a cgroup file itself. It picks up every later decision, so calling
+// Set again, e.g. after the CPU quota changed, moves the value it defends.
+// Nothing is checked until Set succeeds, and Guard should be stopped before
+// calling the undo function returned by Set, which it would revert.
+func Guard(ctx context.Context, interval time.Duration, opts ...Option) error {
+	if interval <= 0 {
+		return fmt.Errorf("maxprocs: interval %v must be positive", interval)
+	}
+	cfg := newConfig(opts)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			cfg.guard()
+		}
+	}
+}
+
+// guard restores GOMAXPROCS to the value of the last decision if it differs.
+func (c *config) guard() {
+	d, ok := LastDecision()
+	if !ok || d.GOMAXPROCS < 1 {
+		return
+	}
+	if prev := runtime.GOMAXPROCS(d.GOMAXPROCS); prev != d.GOMAXPROCS {
+		recordChange()
+		c.log("maxprocs: Restoring GOMAXPROCS=%v: changed to %v since Set", d.GOMAXPROCS, prev)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuard(t *testing.T) {
+	Reset()
+	defer Reset()
+	prev := currentMaxProcs()
+	defer runtime.GOMAXPROCS(prev)
+
+	t.Run("invalid interval", func(t *testing.T) {
+		assert.Error(t, Guard(context.Background(), 0))
+	})
+
+	t.Run("no decision", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		runtime.GOMAXPROCS(5)
+		assert.Equal(t, context.DeadlineExceeded, Guard(ctx, time.Millisecond))
+		assert.Equal(t, 5, currentMaxProcs(), "shouldn't change GOMAXPROCS before Set")
+	})
+
+	opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 3, iruntime.CPUQuotaUsed, nil
+	})
+	_, err := Set(opt)
+	require.NoError(t, err, "Set failed")
+
+	buf, logOpt := testLogger()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Guard(ctx, time.Millisecond, logOpt)
+	}()
+
+	runtime.GOMAXPROCS(7)
+	deadline := time.Now().Add(5 * time.Second)
+	for currentMaxProcs() != 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.Equal(t, 3, currentMaxProcs(), "should restore the last decision")
+	assert.Contains(t, buf.String(), "maxprocs: Restoring GOMAXPROCS=3: changed to 7 since Set")
+	assert.Equal(t, int64(2), Stats().Changes, "the correction should count as a change")
+}
+
+func TestGuardDryRun(t *testing.T) {
+	Reset()
+	defer Reset()
+	prev := currentMaxProcs()
+	defer runtime.GOMAXPROCS(prev)
+
+	runtime.GOMAXPROCS(8)
+	opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 2, iruntime.CPUQuotaUsed, nil
+	})
+	_, err := Set(opt, DryRun(true))
+	require.NoError(t, err, "Set failed")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	buf, logOpt := testLogger()
+	assert.Equal(t, context.DeadlineExceeded, Guard(ctx, time.Millisecond, logOpt))
+	assert.Equal(t, 8, currentMaxProcs(), "shouldn't enforce a value computed in a dry run")
+	assert.Empty(t, buf.String())
+}
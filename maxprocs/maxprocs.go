@@ -24,22 +24,245 @@
 package maxprocs // import "github.com/emadolsky/automaxprocs/maxprocs"
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"math"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"sync"
+	"time"
 
 	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
 )
 
-const _maxProcsKey = "GOMAXPROCS"
+const (
+	_maxProcsKey = "GOMAXPROCS"
+	_cpuKey      = "AUTOMAXPROCS_CPU"
+)
+
+// DefaultMin is the minimum GOMAXPROCS value used by Set when no Min option
+// is supplied.
+const DefaultMin = 1
+
+// DefaultRoundFunc is the function used by Set to convert the CPU quota from
+// float to int when no RoundQuotaFunc option is supplied, unless
+// SetDefaultRoundFunc sets another one. It rounds the quota down.
+func DefaultRoundFunc(v float64) int {
+	return iruntime.DefaultRoundFunc(v)
+}
+
+// RoundUpWithTolerance returns a function, to be used with RoundQuotaFunc,
+// that rounds the CPU quota up unless it exceeds an integer by at most eps:
+// with eps = 0.05, 2.04 and 2.05 yield 2 but 2.06 and 2.3 yield 3. This
+// rounds up in general while tolerating measurement noise just above an
+// integer. The result is at least 1. It panics if eps isn't in [0, 1).
+func RoundUpWithTolerance(eps float64) func(v float64) int {
+	if !(eps >= 0 && eps < 1) {
+		panic(fmt.Sprintf("maxprocs: tolerance %v must be in [0, 1)", eps))
+	}
+	return func(v float64) int {
+		procs := int(math.Ceil(v - eps))
+		if procs < 1 {
+			return 1
+		}
+		return procs
+	}
+}
 
 func currentMaxProcs() int {
 	return runtime.GOMAXPROCS(0)
 }
 
 type config struct {
-	printf        func(string, ...interface{})
-	procs         func(int) (int, iruntime.CPUQuotaStatus, error)
-	minGOMAXPROCS int
+	printf         func(string, ...interface{})
+	decisionLog    func(d Decision, msg string)
+	procs          func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error)
+	quota          func(iruntime.Options) (float64, iruntime.CPUQuotaStatus, error)
+	burst          func(iruntime.Options) (float64, bool, error)
+	usage          func(iruntime.Options) (time.Duration, bool, error)
+	containerID    func(iruntime.Options) (string, error)
+	layout         func(iruntime.Options) (iruntime.Layout, error)
+	memoryLimit    func(iruntime.Options) (int64, bool, error)
+	memoryPressure func(iruntime.Options) (float64, bool, error)
+	numaNodeCPUs   func(iruntime.Options) ([]int, error)
+	cpuSetCPUs     func(iruntime.Options) (int, bool, error)
+	threaded       func(iruntime.Options) (bool, error)
+	runtimeDefault func() bool
+	hostname       func() (string, error)
+	onRead         func(name string)
+	minGOMAXPROCS  int
+	maxGOMAXPROCS  int
+	roundQuotaFunc func(v float64) int
+	rounding       *RoundingMode
+	utilization    float64
+	multiple       int
+	rootPrefix     string
+	procMount      string
+	cgroupMount    string
+	cpuMaxFile     string
+	cgroupPath     string
+	envVar         string
+	supported      bool
+	cpuFile        string
+	cacheFile      string
+	cacheTTL       time.Duration
+	decisionFile   string
+	ctx            context.Context
+
+	changeThreshold float64
+	containerInfo   bool
+	exportEnv       bool
+	schedAffinity   bool
+	cpuSet          bool
+	cpuSource       CPUSourcePolicy
+	minFromCPUSet   bool
+	logDuration     bool
+	runtimeTrace    bool
+	minAtMostQuota  bool
+	dryRun          bool
+	forQuery        bool
+	source          Source
+	reason          string
+	code            Reason
+	previous        int
+	compareAndSet   bool
+	noDowngrade     bool
+	addBurst        bool
+	walkCPUMax      bool
+	systemdFallback bool
+	adjust          func(proposed int, d Decision) int
+	onDecision      func(Decision)
+	onQuota         func(quota float64, defined bool)
+	logChan         chan<- Decision
+	bytesPerProc    int64
+	memoryHeadroom  float64
+	numaNodes       int
+	psiThreshold    float64
+	deferToRuntime  bool
+	quotaWait       time.Duration
+	debounce        time.Duration
+
+	quotaPollInterval time.Duration
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		procs:          iruntime.CPUQuotaToGOMAXPROCS,
+		supported:      iruntime.Supported(),
+		quota:          iruntime.CPUQuotaStatusOf,
+		burst:          iruntime.CPUBurst,
+		usage:          iruntime.CPUUsage,
+		containerID:    iruntime.ContainerID,
+		layout:         iruntime.CGroupLayout,
+		memoryLimit:    iruntime.MemoryLimit,
+		memoryPressure: iruntime.MemoryPressure,
+		numaNodeCPUs:   iruntime.NUMANodeCPUs,
+		cpuSetCPUs:     iruntime.CPUSetCPUs,
+		threaded:       iruntime.ThreadedCGroup,
+		runtimeDefault: runtimeSetsContainerDefault,
+		hostname:       os.Hostname,
+		minGOMAXPROCS:  DefaultMin,
+		utilization:    1,
+		multiple:       1,
+		schedAffinity:  true,
+		cpuSet:         true,
+		memoryHeadroom: _defaultMemoryHeadroom,
+
+		quotaPollInterval: _quotaPollInterval,
+	}
+	for _, o := range opts {
+		o.apply(cfg)
+	}
+	if cfg.roundQuotaFunc == nil {
+		cfg.roundQuotaFunc = defaultRoundFunc()
+		if cfg.rounding != nil {
+			if rf := cfg.rounding.roundFunc(); rf != nil {
+				cfg.roundQuotaFunc = rf
+			}
+		}
+	}
+	return cfg
+}
+
+// runtimeOptions returns the options used to detect the CPU quota.
+func (c *config) runtimeOptions() iruntime.Options {
+	return iruntime.Options{
+		RootPrefix:      c.rootPrefix,
+		ProcMount:       c.procMount,
+		CGroupMount:     c.cgroupMount,
+		Context:         c.ctx,
+		SchedAffinity:   c.schedAffinity,
+		CPUSet:          c.cpuSet,
+		CPUSetMax:       c.cpuSource == SourceMax,
+		CPUMaxFile:      c.cpuMaxFile,
+		CGroupPath:      c.cgroupPath,
+		AddBurst:        c.addBurst,
+		WalkCPUMax:      c.walkCPUMax,
+		CacheFile:       c.cacheFile,
+		CacheTTL:        c.cacheTTL,
+		SystemdFallback: c.systemdFallback,
+		OnRead:          c.onRead,
+	}
+}
+
+// validate reports an error if the configuration can't be used for
+// detection.
+func (c *config) validate() error {
+	if c.maxGOMAXPROCS > 0 && c.minGOMAXPROCS > c.maxGOMAXPROCS {
+		return fmt.Errorf("maxprocs: minimum GOMAXPROCS %d exceeds maximum %d", c.minGOMAXPROCS, c.maxGOMAXPROCS)
+	}
+	if c.cpuSource != SourceMin && c.cpuSource != SourceMax {
+		return fmt.Errorf("maxprocs: unknown CPU source policy %d", int(c.cpuSource))
+	}
+	if c.rounding != nil && c.rounding.roundFunc() == nil {
+		return fmt.Errorf("maxprocs: unknown rounding mode %v", *c.rounding)
+	}
+	if !(c.utilization > 0 && c.utilization <= 1) {
+		return fmt.Errorf("maxprocs: target utilization %v must be in (0, 1]", c.utilization)
+	}
+	if !(c.memoryHeadroom >= 0 && c.memoryHeadroom < 100) {
+		return fmt.Errorf("maxprocs: memory headroom %v must be in [0, 100)", c.memoryHeadroom)
+	}
+	if c.multiple < 1 {
+		return fmt.Errorf("maxprocs: multiple %v must be at least 1", c.multiple)
+	}
+	if c.rootPrefix != "" {
+		info, err := os.Stat(c.rootPrefix)
+		if err != nil {
+			return fmt.Errorf("maxprocs: invalid root prefix: %v", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("maxprocs: root prefix %q is not a directory", c.rootPrefix)
+		}
+	}
+	if c.procMount != "" {
+		cgroupPath := filepath.Join(c.rootPrefix, c.procMount, "self", "cgroup")
+		if _, err := os.Stat(cgroupPath); err != nil {
+			return fmt.Errorf("maxprocs: invalid proc mount: %v", err)
+		}
+	}
+	if c.cgroupMount != "" {
+		if _, err := os.Stat(filepath.Join(c.rootPrefix, c.cgroupMount)); err != nil {
+			return fmt.Errorf("maxprocs: invalid cgroup mount: %v", err)
+		}
+	}
+	return nil
+}
+
+// round scales the CPU quota by the target utilization, converts it to an
+// int and rounds that down to a multiple of c.multiple, but not below it.
+func (c *config) round(v float64) int {
+	procs := c.roundQuotaFunc(v * c.utilization)
+	if c.multiple == 1 {
+		return procs
+	}
+	if procs < c.multiple {
+		return c.multiple
+	}
+	return procs - procs%c.multiple
 }
 
 func (c *config) log(fmt string, args ...interface{}) {
@@ -58,6 +281,7 @@ type Option interface {
 func Logger(printf func(string, ...interface{})) Option {
 	return optionFunc(func(cfg *config) {
 		cfg.printf = printf
+		cfg.decisionLog = nil
 	})
 }
 
@@ -71,6 +295,284 @@ func Min(n int) Option {
 	})
 }
 
+// Max sets the maximum GOMAXPROCS value that will be used, for programs
+// whose contention grows past some parallelism on large nodes. It applies
+// after rounding and the minimum, and also lowers a GOMAXPROCS environment
+// variable or the runtime's default that exceeds it, with a log line. Set
+// returns an error if the minimum exceeds it. Any value below 1 is ignored.
+func Max(n int) Option {
+	return optionFunc(func(cfg *config) {
+		if n >= 1 {
+			cfg.maxGOMAXPROCS = n
+		}
+	})
+}
+
+// RoundQuotaFunc sets the function that will be used to convert the CPU quota
+// from float to int. It takes precedence over Rounding. By default, the
+// function set with SetDefaultRoundFunc is used, or DefaultRoundFunc.
+func RoundQuotaFunc(rf func(v float64) int) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.roundQuotaFunc = rf
+	})
+}
+
+// TargetUtilization multiplies the CPU quota by f before it's rounded, so
+// that GOMAXPROCS leaves headroom below the quota: with f = 0.8, a quota of 4
+// CPUs yields GOMAXPROCS=3. f must be greater than 0 and at most 1, otherwise
+// Set returns an error. The minimum GOMAXPROCS still applies to the result.
+// Defaults to 1.
+func TargetUtilization(f float64) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.utilization = f
+	})
+}
+
+// RoundToMultiple rounds GOMAXPROCS down to a multiple of n, such as the
+// number of cores per socket: with n = 4, a quota of 6 CPUs yields
+// GOMAXPROCS=4 and a quota of 9 CPUs yields GOMAXPROCS=8. A quota below n
+// yields n. The minimum GOMAXPROCS still applies to the result. n must be
+// at least 1, otherwise Set returns an error. Defaults to 1.
+func RoundToMultiple(n int) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.multiple = n
+	})
+}
+
+// RootPrefix reads every cgroup and proc file relative to the given
+// directory instead of `/`. This lets a process that shares the host's mount
+// namespace inspect a container's view through `/proc/$PID/root`. Unlike the
+// host's own files, which are only read on Linux, a root prefix is read on
+// every OS. Set returns an error if the prefix isn't an existing directory.
+func RootPrefix(prefix string) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.rootPrefix = prefix
+	})
+}
+
+// ProcMount reads the cgroup and mountinfo files of the current process from
+// `self/cgroup` and `self/mountinfo` under the given directory instead of
+// `/proc`, for environments that mount proc elsewhere, such as node agents
+// seeing it at `/host/proc`. The directory is resolved relative to
+// RootPrefix, if any. Set returns an error if `self/cgroup` doesn't exist
+// under it.
+func ProcMount(path string) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.procMount = path
+	})
+}
+
+// CGroupMount reads the cgroup hierarchies from under the given directory
+// instead of `/sys/fs/cgroup`, for environments that bind-mount the host's
+// cgroup tree elsewhere, such as `/host/sys/fs/cgroup`. The mount points
+// listed in mountinfo under `/sys/fs/cgroup` are moved under it; others are
+// left as is. The directory is resolved relative to RootPrefix, if any. Set
+// returns an error if it doesn't exist.
+func CGroupMount(path string) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.cgroupMount = path
+	})
+}
+
+// CPUMaxFile reads the CPU quota from the file at path instead of the cgroup
+// hierarchy. The file must be in the format of the cgroup2 cpu.max file,
+// "<quota> <period>" or "max <period>", and is read as is: mountinfo isn't
+// consulted and RootPrefix doesn't apply to it. This suits environments that
+// bind-mount a single cpu.max file rather than a whole hierarchy. Set returns
+// an error if the file can't be read or has an invalid format.
+func CPUMaxFile(path string) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.cpuMaxFile = path
+	})
+}
+
+// CGroupPath reads the CPU quota from the cgroup directory at path instead
+// of the cgroup of the process, e.g. to size a pool for child workloads
+// running in other cgroups, or in integration tests. /proc/self/cgroup and
+// mountinfo aren't consulted and RootPrefix doesn't apply to it. The
+// directory is read as a cgroup2 one if it has a cpu.max file, and as a
+// cgroup v1 cpu one if it has cpu.cfs_quota_us. Set returns an error if it
+// has neither. The cpuset is ignored then, and CPUMaxFile takes precedence.
+func CGroupPath(path string) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.cgroupPath = path
+	})
+}
+
+// CacheToFile caches the CPU quota in the file at path, so that later calls,
+// typically from other invocations of the same short-lived program in the
+// same container, reuse it instead of parsing the cgroup hierarchies again.
+// The cache is keyed by the content of every cgroup and proc file the quota
+// was read from, and detection runs again as soon as one of them changes.
+// Concurrent processes may share the file safely. Errors reading or writing
+// the cache only disable it. The file is trusted, so it should be in a
+// directory that only the user running the process can write to. It doesn't
+// apply to CPUMaxFile or CGroupPath. Disabled by default.
+func CacheToFile(path string) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.cacheFile = path
+	})
+}
+
+// SystemdFallback reads the CPU quota from the systemd units the process
+// runs in when its cgroup files can't be read for lack of permission, as on
+// some hardened hosts. The units are found from /proc/self/cgroup, and the
+// quota is read from the CPUQuota= setting of their unit files and drop-ins,
+// which the CPUQuotaPerSecUSec property reflects, with the lowest quota of
+// the service or scope and its slices winning. The cpuset is ignored then.
+// If no unit sets a quota, GOMAXPROCS is left at the runtime default. Other
+// errors, and an undefined quota, don't engage it. Disabled by default.
+func SystemdFallback(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.systemdFallback = enabled
+	})
+}
+
+// CacheInMemory reuses the CPU quota, burst and cpuset read by a call for ttl
+// in later calls with the same file locations, e.g. from Set, Query and
+// Watch across the initialization paths of a program, instead of parsing
+// mountinfo and reading the cgroup files again each time. Failed reads are
+// never reused, and cached values are only reused while the process stays
+// in the same cgroups, which costs a read of `/proc/self/cgroup` per call.
+// InvalidateCache discards the cached values. Disabled by default.
+func CacheInMemory(ttl time.Duration) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.cacheTTL = ttl
+	})
+}
+
+// InvalidateCache discards the values cached with CacheInMemory, so that the
+// next calls read the cgroup files again, e.g. after the CPU limit of the
+// container changed. It doesn't affect CacheToFile.
+func InvalidateCache() {
+	iruntime.InvalidateCache()
+}
+
+// ExportEnv sets the GOMAXPROCS environment variable of the current process to
+// the value Set applies, so that child processes started afterwards inherit
+// the decision instead of detecting the CPU quota again. This mutates the
+// process environment; the undo function returned by Set unsets the variable
+// again. Later calls to Set in the same process, and the ticks of Watch,
+// don't take the exported value for an override and detect the CPU quota as
+// usual, unless the variable was changed since. Disabled by default.
+func ExportEnv(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.exportEnv = enabled
+	})
+}
+
+// _exportedEnv holds the GOMAXPROCS value ExportEnv last set in the
+// environment.
+var _exportedEnv struct {
+	sync.Mutex
+
+	value string
+	ok    bool
+}
+
+func setExportedEnv(value string) {
+	_exportedEnv.Lock()
+	defer _exportedEnv.Unlock()
+	_exportedEnv.value, _exportedEnv.ok = value, true
+}
+
+func clearExportedEnv() {
+	_exportedEnv.Lock()
+	defer _exportedEnv.Unlock()
+	_exportedEnv.value, _exportedEnv.ok = "", false
+}
+
+// lookupMaxProcsEnv returns the GOMAXPROCS environment variable, or false if
+// it's unset or holds the value exported with ExportEnv.
+func lookupMaxProcsEnv() (string, bool) {
+	value, exists := os.LookupEnv(_maxProcsKey)
+	if !exists {
+		return "", false
+	}
+	_exportedEnv.Lock()
+	defer _exportedEnv.Unlock()
+	if _exportedEnv.ok && value == _exportedEnv.value {
+		return "", false
+	}
+	return value, true
+}
+
+// UseSchedAffinity caps the CPU quota by the number of CPUs the process is
+// allowed to run on by its CPU affinity mask, which catches processes pinned
+// with taskset(1) or sched_setaffinity(2). If the mask can't be read, e.g.
+// because of a seccomp profile, the quota is used as is. Enabled by default.
+func UseSchedAffinity(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.schedAffinity = enabled
+	})
+}
+
+// WalkCPUMax reads the cgroup2 CPU quota as the most restrictive one among
+// the cpu.max files of the process' cgroup and all of its ancestors, for
+// systemd delegation setups where the leaf's cpu.max is max while a parent
+// slice sets the limit. By default, only the innermost cpu.max is read. It
+// has no effect with cgroup v1, CPUMaxFile or CGroupPath. Disabled by
+// default.
+func WalkCPUMax(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.walkCPUMax = enabled
+	})
+}
+
+// AddBurst adds the CFS burst to the CPU quota before it's converted to
+// GOMAXPROCS, for processes whose sustained parallelism relies on the burst
+// allowance. The burst is read from cpu.cfs_burst_us with cgroup v1 and from
+// cpu.max.burst with cgroup2; without a burst file the quota is used as is.
+// Whether enabled or not, the burst is reported in Decision.Burst. It doesn't
+// apply to CPUMaxFile or CGroupPath. Disabled by default.
+func AddBurst(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.addBurst = enabled
+	})
+}
+
+// DryRun makes Set and the apply function of Prepare run the detection and
+// log their decision as usual, but leave GOMAXPROCS unchanged, so that the
+// decision can be evaluated before it's enforced. The log line says the
+// value was computed but not applied, e.g. "maxprocs: Computed GOMAXPROCS=2
+// but not applied (dry run): determined from CPU quota", and the values in
+// effect and computed are reported in Result.GOMAXPROCS and
+// Decision.GOMAXPROCS respectively. The decision is passed to OnDecision and
+// LogChan, but isn't returned by LastDecision, so that Guard and the
+// reporters built on it never treat the computed value as applied. The
+// returned undo function is a no-op. Disabled by default.
+func DryRun(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.dryRun = enabled
+	})
+}
+
+// NoDowngrade makes Set raise GOMAXPROCS to the detected value but never
+// lower it below the value in effect when it's called, e.g. one set high on
+// purpose with the GOMAXPROCS environment variable or by the program itself.
+// This includes the cap set with Max. A suppressed change is logged with both
+// values, e.g. "maxprocs: Leaving GOMAXPROCS=8: NoDowngrade suppressed
+// lowering it to 2", and the undo function is then a no-op. Disabled by
+// default.
+func NoDowngrade(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.noDowngrade = enabled
+	})
+}
+
+// CompareAndSet only applies the detected GOMAXPROCS if GOMAXPROCS still has
+// the value it had when detection started, so that a value set by another
+// component in the meantime, e.g. between Prepare and its apply function,
+// isn't overridden. On a conflict, the change is logged and skipped, and the
+// value in effect is returned along with a no-op undo function. The runtime
+// offers no atomic compare-and-set, so a change racing with the apply call
+// itself can still be overridden. Disabled by default.
+func CompareAndSet(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.compareAndSet = enabled
+	})
+}
+
 type optionFunc func(*config)
 
 func (of optionFunc) apply(cfg *config) { of(cfg) }
@@ -78,53 +580,479 @@ func (of optionFunc) apply(cfg *config) { of(cfg) }
 // Set GOMAXPROCS to match the Linux container CPU quota (if any), returning
 // any error encountered and an undo function.
 //
-// Set is a no-op on non-Linux systems and in Linux environments without a
-// configured CPU quota.
+// If the AUTOMAXPROCS_CPU environment variable holds a positive, possibly
+// fractional CPU count (e.g. "2.5"), it's used in place of the CPU quota
+// read from cgroups and goes through the same rounding and minimum. This
+// lets the limit be injected through the environment, e.g. from the
+// Kubernetes downward API. Invalid values are logged and ignored. The
+// GOMAXPROCS environment variable still takes precedence.
+//
+// The CPU quota is capped by the number of CPUs in the cpuset of the
+// process: a quota of 2 CPUs throttles the process even if its cpuset
+// allows 8, while a cpuset of 2 CPUs bounds its parallelism under a quota of
+// 8. Without a CPU quota, the cpuset is used on its own.
+//
+// Set is a no-op in Linux environments without a configured CPU quota or
+// cpuset, unless Max lowers the runtime's default. On systems other than
+// Linux and Windows, it returns an error wrapping ErrUnsupportedPlatform
+// unless RootPrefix points it at a cgroup hierarchy; see Supported.
+// On Windows, the CPUs the job object of the process may run on and its CPU
+// rate cap relative to the logical processors, as set for containers, are
+// used as its CPU quota, whichever is lower; if the job can't be queried,
+// the quota is undefined.
 func Set(opts ...Option) (func(), error) {
-	cfg := &config{
-		procs:         iruntime.CPUQuotaToGOMAXPROCS,
-		minGOMAXPROCS: 1,
+	return SetWithContext(context.Background(), opts...)
+}
+
+// SetWithStdLogger is like Set, but logs its decision with log.Printf from
+// the standard library, as the top-level automaxprocs package does. A Logger
+// among opts takes precedence.
+func SetWithStdLogger(opts ...Option) (func(), error) {
+	return Set(append([]Option{Logger(log.Printf)}, opts...)...)
+}
+
+// Prepare performs the detection Set would perform, reading every cgroup
+// file up front, and returns a function that applies the result. Calling
+// apply is cheap: it installs the computed GOMAXPROCS and returns it along
+// with an undo function, without reading any file. This lets programs detect
+// the CPU quota early but change GOMAXPROCS at a later, specific point of
+// their initialization.
+//
+// If detection fails, Prepare returns the error along with an apply function
+// that leaves GOMAXPROCS unchanged.
+func Prepare(opts ...Option) (apply func() (int, func(), error), err error) {
+	cfg := newConfig(opts)
+	apply, _, err = cfg.prepare()
+	if err != nil {
+		return func() (int, func(), error) {
+			return currentMaxProcs(), cfg.undoNoop, nil
+		}, err
 	}
-	for _, o := range opts {
-		o.apply(cfg)
+	return apply, nil
+}
+
+func (c *config) undoNoop() {
+	c.log("maxprocs: No GOMAXPROCS change to reset")
+}
+
+// prepare detects the GOMAXPROCS value to use and returns a function that
+// applies it, along with the Decision being made. The Decision is complete
+// once the function returned; until then, its GOMAXPROCS is 0 if the value
+// in effect is to be left unchanged.
+func (c *config) prepare() (func() (int, func(), error), *Decision, error) {
+	if !c.forQuery {
+		markSetCalled()
+	}
+	if err := c.validate(); err != nil {
+		return nil, nil, err
 	}
 
-	undoNoop := func() {
-		cfg.log("maxprocs: No GOMAXPROCS change to reset")
+	cancel := c.startTimeout()
+	defer cancel()
+
+	start, startProcs := time.Now(), currentMaxProcs()
+	c.previous = startProcs
+	decision := c.environment()
+	decision.Quota = -1
+	// The apply functions returned below only run once prepare returned,
+	// so they see the duration.
+	defer func() {
+		decision.Duration = time.Since(start)
+		c.detected(decision.Duration)
+	}()
+
+	c.observeQuota()
+
+	if apply, ok := c.prepareEnvVar(&decision); ok {
+		return apply, &decision, nil
 	}
 
 	// Honor the GOMAXPROCS environment variable if present. Otherwise, amend
 	// `runtime.GOMAXPROCS()` with the current process' CPU quota if the OS is
 	// Linux, and guarantee a minimum value of 1. The minimum guaranteed value
 	// can be overriden using `maxprocs.Min()`.
-	if max, exists := os.LookupEnv(_maxProcsKey); exists {
-		cfg.log("maxprocs: Honoring GOMAXPROCS=%q as set in environment", max)
-		return undoNoop, nil
+	if max, exists := lookupMaxProcsEnv(); exists {
+		c.source = SourceEnv
+		return func() (int, func(), error) {
+			undo, capped, suppressed := c.capCurrent()
+			decision.GOMAXPROCS = currentMaxProcs()
+			switch {
+			case capped:
+				decision.GOMAXPROCS = c.maxGOMAXPROCS
+				c.logDecision(decision, ReasonEnvOverrideCapped, decision.GOMAXPROCS, _maxProcsKey, max, c.maxGOMAXPROCS)
+			case suppressed:
+				c.logDecision(decision, ReasonNoDowngrade, decision.GOMAXPROCS, c.maxGOMAXPROCS)
+			default:
+				c.logDecision(decision, ReasonEnvOverride, _maxProcsKey, max)
+			}
+			c.record(decision)
+			return currentMaxProcs(), undo, nil
+		}, &decision, nil
+	}
+
+	if c.deferToRuntime && c.runtimeDefault() {
+		c.source = SourceRuntimeDefault
+		return func() (int, func(), error) {
+			undo, capped, suppressed := c.capCurrent()
+			decision.GOMAXPROCS = currentMaxProcs()
+			switch {
+			case capped:
+				decision.GOMAXPROCS = c.maxGOMAXPROCS
+				c.logDecision(decision, ReasonRuntimeDefaultCapped, decision.GOMAXPROCS, c.maxGOMAXPROCS)
+			case suppressed:
+				c.logDecision(decision, ReasonNoDowngrade, decision.GOMAXPROCS, c.maxGOMAXPROCS)
+			default:
+				c.logDecision(decision, ReasonRuntimeDefault, decision.GOMAXPROCS)
+			}
+			c.record(decision)
+			return currentMaxProcs(), undo, nil
+		}, &decision, nil
 	}
 
-	maxProcs, status, err := cfg.procs(cfg.minGOMAXPROCS)
+	if err := c.raiseMinToCPUSet(); err != nil {
+		c.recordError(err)
+		return nil, nil, err
+	}
+
+	origin := _cpuKey
+	maxProcs, status, ok := c.procsFromEnv(c.tracedRound(&decision.Trace, origin))
+	if !ok && c.cpuFile != "" {
+		origin = c.cpuFile
+		c.recordRead()
+		var err error
+		maxProcs, status, ok, err = c.procsFromFile(c.tracedRound(&decision.Trace, origin))
+		if err != nil {
+			c.recordError(err)
+			return nil, nil, err
+		}
+	}
+	if !ok {
+		if err := c.checkSupported(); err != nil {
+			c.recordError(err)
+			return nil, nil, err
+		}
+		origin = "CPU quota"
+		if c.addBurst {
+			origin = "CPU quota and burst"
+		}
+		c.recordRead()
+		round := c.tracedRound(&decision.Trace, origin)
+		var err error
+		maxProcs, status, err = c.procs(c.minGOMAXPROCS, round, c.runtimeOptions())
+		if err == nil {
+			maxProcs, status, err = c.waitForQuota(round, maxProcs, status)
+		}
+		if err != nil {
+			c.recordError(err)
+			return nil, nil, err
+		}
+		c.warnIfThreaded()
+	}
+
+	switch status {
+	case iruntime.CPUQuotaUndefined, iruntime.CPUQuotaControllerUnavailable:
+		reason, cappedReason := ReasonQuotaUndefined, ReasonQuotaUndefinedCapped
+		if status == iruntime.CPUQuotaControllerUnavailable {
+			reason, cappedReason = ReasonControllerUnavailable, ReasonControllerUnavailableCapped
+		}
+		c.source = SourceRuntimeDefault
+		return func() (int, func(), error) {
+			undo, capped, suppressed := c.capCurrent()
+			decision.GOMAXPROCS = currentMaxProcs()
+			decision.Trace = nil
+			switch {
+			case capped:
+				decision.GOMAXPROCS = c.maxGOMAXPROCS
+				c.logDecision(decision, cappedReason, decision.GOMAXPROCS, c.maxGOMAXPROCS)
+			case suppressed:
+				c.logDecision(decision, ReasonNoDowngrade, decision.GOMAXPROCS, c.maxGOMAXPROCS)
+			default:
+				c.logDecision(decision, reason, decision.GOMAXPROCS)
+			}
+			c.record(decision)
+			return currentMaxProcs(), undo, nil
+		}, &decision, nil
+	}
+
+	decision.Quota = c.detectedQuota(decision.Trace, status, !ok)
+	if !ok {
+		decision.Burst = c.cpuBurst()
+	}
+	maxProcs, status = c.capMinAtQuota(decision.Trace, maxProcs, status)
+	c.source = sourceOf(status)
+	proposed, maxBound, memoryBound, numaBound, pressure, err := c.decide(&decision, maxProcs, status)
 	if err != nil {
-		return undoNoop, err
+		c.recordError(err)
+		return nil, nil, err
 	}
+	maxProcs = decision.GOMAXPROCS
 
-	if status == iruntime.CPUQuotaUndefined {
-		cfg.log("maxprocs: Leaving GOMAXPROCS=%v: CPU quota undefined", currentMaxProcs())
-		return undoNoop, nil
+	return func() (int, func(), error) {
+		prev := currentMaxProcs()
+		if c.compareAndSet && prev != startProcs {
+			decision.GOMAXPROCS = prev
+			c.logDecision(decision, ReasonConflict, prev, startProcs, maxProcs)
+			c.record(decision)
+			return prev, c.undoNoop, nil
+		}
+		if c.noDowngrade && maxProcs < prev {
+			decision.GOMAXPROCS = prev
+			c.logDecision(decision, ReasonNoDowngrade, prev, maxProcs)
+			c.record(decision)
+			return prev, c.undoNoop, nil
+		}
+		exported := false
+		undo := func() {
+			c.log("maxprocs: Resetting GOMAXPROCS to %v", prev)
+			runtime.GOMAXPROCS(prev)
+			if exported {
+				os.Unsetenv(_maxProcsKey)
+				clearExportedEnv()
+			}
+		}
+
+		switch {
+		case maxProcs != proposed:
+			c.logDecision(decision, ReasonAdjusted, maxProcs, proposed)
+		case pressure > 0:
+			c.logDecision(decision, ReasonMemoryPressure, maxProcs, pressure, c.psiThreshold)
+		case numaBound:
+			c.logDecision(decision, ReasonNUMA, maxProcs, c.numaNodes)
+		case memoryBound:
+			c.logDecision(decision, ReasonMemoryLimit, maxProcs)
+		case maxBound:
+			c.logDecision(decision, ReasonMaxClamp, maxProcs, c.maxGOMAXPROCS)
+		case status == iruntime.CPUQuotaMinUsed:
+			c.logDecision(decision, ReasonMinClamp, maxProcs)
+		case status == iruntime.CPUAffinityUsed:
+			c.logDecision(decision, ReasonAffinity, maxProcs)
+		case status == iruntime.CPUSetUsed && c.cpuSource == SourceMax:
+			c.logDecision(decision, ReasonCPUSetMax, maxProcs)
+		case status == iruntime.CPUSetUsed:
+			c.logDecision(decision, ReasonCPUSet, maxProcs)
+		case status == iruntime.CPUQuotaUsed:
+			c.logDecision(decision, ReasonQuotaApplied, maxProcs, origin)
+		}
+
+		if c.dryRun {
+			c.record(decision)
+			return prev, c.undoNoop, nil
+		}
+		if runtime.GOMAXPROCS(maxProcs) != maxProcs {
+			recordChange()
+		}
+		if c.exportEnv {
+			value := strconv.Itoa(maxProcs)
+			if err := os.Setenv(_maxProcsKey, value); err != nil {
+				c.log("maxprocs: Couldn't export GOMAXPROCS=%v to environment: %v", maxProcs, err)
+			} else {
+				setExportedEnv(value)
+				exported = true
+			}
+		}
+		c.record(decision)
+		return maxProcs, undo, nil
+	}, &decision, nil
+}
+
+// decide derives GOMAXPROCS from maxProcs, the CPU quota once rounded and
+// clamped to the minimum with the given status, by applying the memory, NUMA
+// and memory pressure caps and the Adjust function. It sets d.GOMAXPROCS to
+// the result, records every stage in d.Trace and returns the value proposed
+// to Adjust along with which caps lowered it, including the maximum;
+// pressure is the memory pressure if its cap lowered it, and 0 otherwise.
+func (c *config) decide(d *Decision, maxProcs int, status iruntime.CPUQuotaStatus) (proposed int, maxBound, memoryBound, numaBound bool, pressure float64, err error) {
+	if len(d.Trace) > 0 {
+		switch status {
+		case iruntime.CPUAffinityUsed:
+			d.Trace[0].Source = "CPU affinity"
+		case iruntime.CPUSetUsed:
+			d.Trace[0].Source = "cpuset"
+		}
+	}
+	d.Trace = append(d.Trace, Step{
+		Stage:  StageMinClamped,
+		Source: c.minSource(),
+		Value:  float64(maxProcs),
+	})
+	if c.maxGOMAXPROCS > 0 {
+		if maxProcs > c.maxGOMAXPROCS {
+			maxProcs, maxBound = c.maxGOMAXPROCS, true
+		}
+		d.Trace = append(d.Trace, Step{
+			Stage:  StageMaxClamped,
+			Source: fmt.Sprintf("Max(%d)", c.maxGOMAXPROCS),
+			Value:  float64(maxProcs),
+		})
 	}
 
+	maxProcs, memoryBound, err = c.capByMemory(maxProcs)
+	if err != nil {
+		return 0, false, false, false, 0, err
+	}
+	if c.bytesPerProc > 0 {
+		d.Trace = append(d.Trace, Step{
+			Stage:  StageMemoryCapped,
+			Source: fmt.Sprintf("BalanceWithMemory(%d)", c.bytesPerProc),
+			Value:  float64(maxProcs),
+		})
+	}
+
+	maxProcs, numaBound, err = c.capByNUMA(maxProcs)
+	if err != nil {
+		return 0, false, false, false, 0, err
+	}
+	if c.numaNodes > 0 {
+		d.Trace = append(d.Trace, Step{
+			Stage:  StageNUMACapped,
+			Source: fmt.Sprintf("NUMANodes(%d)", c.numaNodes),
+			Value:  float64(maxProcs),
+		})
+	}
+
+	maxProcs, pressure, pressureBound, err := c.capByPressure(maxProcs)
+	if err != nil {
+		return 0, false, false, false, 0, err
+	}
+	if !pressureBound {
+		pressure = 0
+	}
+	if c.psiThreshold > 0 {
+		d.Trace = append(d.Trace, Step{
+			Stage:  StagePressureCapped,
+			Source: fmt.Sprintf("ReactToMemoryPSI(%v)", c.psiThreshold),
+			Value:  float64(maxProcs),
+		})
+	}
+
+	d.GOMAXPROCS = maxProcs
+	d.MinBinding = status == iruntime.CPUQuotaMinUsed
+	proposed = maxProcs
+	d.GOMAXPROCS = c.adjusted(*d)
+	d.Trace = append(d.Trace, Step{
+		Stage:  StageAdjusted,
+		Source: "Adjust",
+		Value:  float64(d.GOMAXPROCS),
+	})
+	return proposed, maxBound, memoryBound, numaBound, pressure, nil
+}
+
+// capCurrent lowers the GOMAXPROCS value in effect to the maximum set with
+// Max if it exceeds it, and returns a function that undoes the change along
+// with whether it was capped. With DryRun, it only reports whether it would
+// cap it, and with NoDowngrade, it leaves it unchanged and reports that the
+// cap was suppressed instead.
+func (c *config) capCurrent() (undo func(), capped, suppressed bool) {
 	prev := currentMaxProcs()
-	undo := func() {
-		cfg.log("maxprocs: Resetting GOMAXPROCS to %v", prev)
+	if c.maxGOMAXPROCS <= 0 || prev <= c.maxGOMAXPROCS {
+		return c.undoNoop, false, false
+	}
+	if c.noDowngrade {
+		return c.undoNoop, false, true
+	}
+	if c.dryRun {
+		return c.undoNoop, true, false
+	}
+	runtime.GOMAXPROCS(c.maxGOMAXPROCS)
+	recordChange()
+	return func() {
+		c.log("maxprocs: Resetting GOMAXPROCS to %v", prev)
 		runtime.GOMAXPROCS(prev)
+	}, true, false
+}
+
+// minSource describes the options that govern the minimum clamp in a Step.
+func (c *config) minSource() string {
+	if c.minAtMostQuota {
+		return fmt.Sprintf("Min(%d), MinNeverExceedsQuota", c.minGOMAXPROCS)
 	}
+	return fmt.Sprintf("Min(%d)", c.minGOMAXPROCS)
+}
 
-	switch status {
-	case iruntime.CPUQuotaMinUsed:
-		cfg.log("maxprocs: Updating GOMAXPROCS=%v: using minimum allowed GOMAXPROCS", maxProcs)
-	case iruntime.CPUQuotaUsed:
-		cfg.log("maxprocs: Updating GOMAXPROCS=%v: determined from CPU quota", maxProcs)
+// procsFromEnv converts the CPU count set in the AUTOMAXPROCS_CPU
+// environment variable to a GOMAXPROCS value using round. It returns false if
+// the variable isn't set or is invalid.
+func (c *config) procsFromEnv(round func(v float64) int) (int, iruntime.CPUQuotaStatus, bool) {
+	value, exists := os.LookupEnv(_cpuKey)
+	if !exists {
+		return -1, iruntime.CPUQuotaUndefined, false
+	}
+
+	cpus, ok := parseCPUs(value)
+	if !ok {
+		c.log("maxprocs: Ignoring %s=%q: not a positive CPU count", _cpuKey, value)
+		return -1, iruntime.CPUQuotaUndefined, false
+	}
+	maxProcs, status := iruntime.QuotaToGOMAXPROCS(cpus, c.minGOMAXPROCS, round)
+	return maxProcs, status, true
+}
+
+// parseCPUs parses a positive, possibly fractional CPU count, as found in
+// AUTOMAXPROCS_CPU and the file set with FromFile.
+func parseCPUs(value string) (float64, bool) {
+	cpus, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(cpus > 0) || math.IsInf(cpus, 0) {
+		return 0, false
+	}
+	return cpus, true
+}
+
+// QuotaCPUs returns the CPU quota applied to the calling process as a
+// fraction of CPUs (e.g. 2.5), before any rounding, and whether a quota is
+// defined at all. Unlike Set, it never changes GOMAXPROCS and doesn't honor
+// the GOMAXPROCS environment variable. Options that control where cgroup
+// information is read from are applied; the others are ignored.
+func QuotaCPUs(opts ...Option) (float64, bool, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return -1, false, err
 	}
 
-	runtime.GOMAXPROCS(maxProcs)
-	return undo, nil
+	cancel := cfg.startTimeout()
+	defer cancel()
+	return cfg.quotaCPUs(cfg.runtimeOptions())
+}
+
+// detectedQuota returns the CPU quota for Decision.Quota, given the trace
+// and status of a detection, read from cgroups if fromCGroups is set. The
+// first stage of the trace holds the count GOMAXPROCS was derived from,
+// which is the quota unless the cpuset or the affinity mask replaced it, in
+// which case the quota is read again on its own.
+func (c *config) detectedQuota(trace []Step, status iruntime.CPUQuotaStatus, fromCGroups bool) float64 {
+	if len(trace) == 0 || trace[0].Stage != StageQuota {
+		return -1
+	}
+	if !fromCGroups || status == iruntime.CPUQuotaUsed {
+		return trace[0].Value
+	}
+	quota, defined, err := c.quotaCPUs(c.runtimeOptions())
+	if err != nil {
+		c.log("maxprocs: Couldn't read CPU quota: %v", err)
+		return -1
+	}
+	if !defined {
+		return -1
+	}
+	return quota
+}
+
+// quotaCPUs reads the CPU quota like QuotaCPUs, with the options of c.
+func (c *config) quotaCPUs(opts iruntime.Options) (float64, bool, error) {
+	quota, status, err := c.quota(opts)
+	return quota, status == iruntime.CPUQuotaUsed, err
+}
+
+// cpuBurst returns the CFS burst of the current process for the Decision.
+// The burst is informational unless AddBurst is enabled, so a failure to read
+// it is only logged.
+func (c *config) cpuBurst() float64 {
+	if c.cpuMaxFile != "" || c.cgroupPath != "" {
+		return 0
+	}
+	burst, _, err := c.burst(c.runtimeOptions())
+	if err != nil {
+		c.log("maxprocs: Couldn't read CPU burst: %v", err)
+		return 0
+	}
+	return burst
 }
@@ -24,10 +24,15 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"testing"
+	"time"
 
 	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
 
@@ -55,9 +60,32 @@ func testLogger() (*bytes.Buffer, Option) {
 	return buf, Logger(printf)
 }
 
-func stubProcs(f func(int) (int, iruntime.CPUQuotaStatus, error)) Option {
+func stubProcs(f func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error)) Option {
 	return optionFunc(func(cfg *config) {
 		cfg.procs = f
+		// Stubbed detection runs on every OS.
+		cfg.supported = true
+	})
+}
+
+// recordReads returns an option adding the name of every cgroup and proc
+// file read to names.
+func recordReads(names *[]string) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.onRead = func(name string) { *names = append(*names, name) }
+	})
+}
+
+func stubQuota(f func(iruntime.Options) (float64, bool, error)) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.quota = func(opts iruntime.Options) (float64, iruntime.CPUQuotaStatus, error) {
+			quota, defined, err := f(opts)
+			if defined {
+				return quota, iruntime.CPUQuotaUsed, err
+			}
+			return quota, iruntime.CPUQuotaUndefined, err
+		}
+		cfg.supported = true
 	})
 }
 
@@ -66,10 +94,17 @@ func TestLogger(t *testing.T) {
 		// Calling Set without options should be safe.
 		undo, err := Set()
 		defer undo()
+		if !Supported() {
+			assert.True(t, errors.Is(err, ErrUnsupportedPlatform), "unexpected error %v", err)
+			return
+		}
 		require.NoError(t, err, "Set failed")
 	})
 
 	t.Run("override", func(t *testing.T) {
+		if !Supported() {
+			t.Skip("Set fails before logging on this OS")
+		}
 		buf, opt := testLogger()
 		undo, err := Set(opt)
 		defer undo()
@@ -96,7 +131,7 @@ func TestSet(t *testing.T) {
 	})
 
 	t.Run("ErrorReadingQuota", func(t *testing.T) {
-		opt := stubProcs(func(int) (int, iruntime.CPUQuotaStatus, error) {
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
 			return 0, iruntime.CPUQuotaUndefined, errors.New("failed")
 		})
 		prev := currentMaxProcs()
@@ -109,7 +144,7 @@ func TestSet(t *testing.T) {
 
 	t.Run("QuotaUndefined", func(t *testing.T) {
 		buf, logOpt := testLogger()
-		quotaOpt := stubProcs(func(int) (int, iruntime.CPUQuotaStatus, error) {
+		quotaOpt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
 			return 0, iruntime.CPUQuotaUndefined, nil
 		})
 		prev := currentMaxProcs()
@@ -117,12 +152,14 @@ func TestSet(t *testing.T) {
 		defer undo()
 		require.NoError(t, err, "Set failed")
 		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
-		assert.Contains(t, buf.String(), "quota undefined", "unexpected log output")
+		assert.Equal(t,
+			fmt.Sprintf("maxprocs: Leaving GOMAXPROCS=%v: CPU quota undefined; consider setting a CPU limit", prev),
+			buf.String(), "the remediation hint should be part of the decision line")
 	})
 
 	t.Run("QuotaUndefined return maxProcs=7", func(t *testing.T) {
 		buf, logOpt := testLogger()
-		quotaOpt := stubProcs(func(int) (int, iruntime.CPUQuotaStatus, error) {
+		quotaOpt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
 			return 7, iruntime.CPUQuotaUndefined, nil
 		})
 		prev := currentMaxProcs()
@@ -133,9 +170,23 @@ func TestSet(t *testing.T) {
 		assert.Contains(t, buf.String(), "quota undefined", "unexpected log output")
 	})
 
+	t.Run("CPUControllerUnavailable", func(t *testing.T) {
+		buf, logOpt := testLogger()
+		quotaOpt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return -1, iruntime.CPUQuotaControllerUnavailable, nil
+		})
+		prev := currentMaxProcs()
+		undo, err := Set(logOpt, quotaOpt)
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+		assert.Contains(t, buf.String(), "cpu controller unavailable", "unexpected log output")
+		assert.NotContains(t, buf.String(), "consider setting a CPU limit", "unexpected remediation hint")
+	})
+
 	t.Run("QuotaTooSmall", func(t *testing.T) {
 		buf, logOpt := testLogger()
-		quotaOpt := stubProcs(func(min int) (int, iruntime.CPUQuotaStatus, error) {
+		quotaOpt := stubProcs(func(min int, _ func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
 			return min, iruntime.CPUQuotaMinUsed, nil
 		})
 		undo, err := Set(logOpt, quotaOpt, Min(5))
@@ -147,7 +198,7 @@ func TestSet(t *testing.T) {
 
 	t.Run("Min unused", func(t *testing.T) {
 		buf, logOpt := testLogger()
-		quotaOpt := stubProcs(func(min int) (int, iruntime.CPUQuotaStatus, error) {
+		quotaOpt := stubProcs(func(min int, _ func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
 			return min, iruntime.CPUQuotaMinUsed, nil
 		})
 		// Min(-1) should be ignored.
@@ -159,7 +210,7 @@ func TestSet(t *testing.T) {
 	})
 
 	t.Run("QuotaUsed", func(t *testing.T) {
-		opt := stubProcs(func(min int) (int, iruntime.CPUQuotaStatus, error) {
+		opt := stubProcs(func(min int, _ func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
 			assert.Equal(t, 1, min, "Default minimum value should be 1")
 			return 42, iruntime.CPUQuotaUsed, nil
 		})
@@ -168,6 +219,1004 @@ func TestSet(t *testing.T) {
 		require.NoError(t, err, "Set failed")
 		assert.Equal(t, 42, currentMaxProcs(), "should change GOMAXPROCS to match quota")
 	})
+
+	t.Run("CustomRoundQuotaFunc", func(t *testing.T) {
+		opt := stubProcs(func(min int, round func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return round(6.3), iruntime.CPUQuotaUsed, nil
+		})
+		undo, err := Set(opt, RoundQuotaFunc(func(v float64) int { return int(math.Ceil(v)) }))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 7, currentMaxProcs(), "should use the custom round func")
+	})
+}
+
+func TestTargetUtilization(t *testing.T) {
+	opt := stubProcs(func(min int, round func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		maxProcs, status := iruntime.QuotaToGOMAXPROCS(4, min, round)
+		return maxProcs, status, nil
+	})
+
+	testTable := []struct {
+		name             string
+		utilization      float64
+		expectedMaxProcs int
+		shouldHaveError  bool
+	}{
+		{name: "full", utilization: 1, expectedMaxProcs: 4},
+		{name: "headroom", utilization: 0.8, expectedMaxProcs: 3},
+		{name: "below-min", utilization: 0.1, expectedMaxProcs: 1},
+		{name: "zero", utilization: 0, shouldHaveError: true},
+		{name: "negative", utilization: -0.5, shouldHaveError: true},
+		{name: "above-one", utilization: 1.5, shouldHaveError: true},
+		{name: "nan", utilization: math.NaN(), shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := currentMaxProcs()
+			undo, err := Set(opt, TargetUtilization(tt.utilization))
+			defer undo()
+
+			if tt.shouldHaveError {
+				assert.Error(t, err, "Set should reject the target utilization")
+				assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+				return
+			}
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, tt.expectedMaxProcs, currentMaxProcs(), "unexpected GOMAXPROCS")
+		})
+	}
+}
+
+func TestMax(t *testing.T) {
+	quotaOf := func(quota float64) Option {
+		return stubProcs(func(min int, round func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			maxProcs, status := iruntime.QuotaToGOMAXPROCS(quota, min, round)
+			return maxProcs, status, nil
+		})
+	}
+
+	t.Run("quota above", func(t *testing.T) {
+		buf, logOpt := testLogger()
+		undo, err := Set(logOpt, quotaOf(8), Max(4))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 4, currentMaxProcs())
+		assert.Contains(t, buf.String(), "maxprocs: Updating GOMAXPROCS=4: limited by Max(4)")
+	})
+
+	t.Run("quota below", func(t *testing.T) {
+		undo, err := Set(quotaOf(2), Max(4))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 2, currentMaxProcs())
+	})
+
+	t.Run("trace", func(t *testing.T) {
+		d := Simulate(64, 0, Min(2), Max(16))
+		assert.Equal(t, 16, d.GOMAXPROCS)
+		assert.Contains(t, d.Trace, Step{Stage: StageMaxClamped, Source: "Max(16)", Value: 16})
+		for _, step := range Simulate(64, 0).Trace {
+			assert.NotEqual(t, StageMaxClamped, step.Stage, "no step without a maximum")
+		}
+	})
+
+	t.Run("simulate undefined quota", func(t *testing.T) {
+		d := Simulate(0, 16, Max(4))
+		assert.Equal(t, 4, d.GOMAXPROCS, "should lower the runtime's default to Max")
+		assert.Equal(t, []Step{{Stage: StageMaxClamped, Source: "Max(4)", Value: 4}}, d.Trace)
+		assert.Equal(t, 2, Simulate(0, 2, Max(4)).GOMAXPROCS, "should keep a default below Max")
+		assert.Equal(t, 16, Simulate(0, 16).GOMAXPROCS)
+	})
+
+	t.Run("simulate runtime default", func(t *testing.T) {
+		opts := []Option{DeferToRuntime(true), stubRuntimeDefault(true)}
+		assert.Equal(t, 3, Simulate(2.5, 16, opts...).GOMAXPROCS, "should round the quota up")
+		assert.Equal(t, 2, Simulate(0.5, 16, opts...).GOMAXPROCS, "should raise the quota to 2")
+		assert.Equal(t, 16, Simulate(0, 16, opts...).GOMAXPROCS, "should use numCPU without a quota")
+		d := Simulate(8, 16, append(opts, Max(4))...)
+		assert.Equal(t, 4, d.GOMAXPROCS, "should lower the runtime's default to Max")
+		assert.Contains(t, d.Trace, Step{Stage: StageMaxClamped, Source: "Max(4)", Value: 4})
+	})
+
+	t.Run("min exceeds max", func(t *testing.T) {
+		prev := currentMaxProcs()
+		undo, err := Set(quotaOf(8), Min(6), Max(4))
+		defer undo()
+		assert.EqualError(t, err, "maxprocs: minimum GOMAXPROCS 6 exceeds maximum 4")
+		assert.Equal(t, prev, currentMaxProcs())
+	})
+
+	t.Run("EnvVarPresent", func(t *testing.T) {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+		withMax(t, 8, func() {
+			buf, logOpt := testLogger()
+			undo, err := Set(logOpt, Max(4))
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, 4, currentMaxProcs())
+			assert.Contains(t, buf.String(), `maxprocs: Updating GOMAXPROCS=4: GOMAXPROCS="8" set in environment exceeds Max(4)`)
+			undo()
+			assert.Equal(t, 8, currentMaxProcs(), "undo should restore the value from the environment")
+		})
+	})
+
+	t.Run("quota undefined", func(t *testing.T) {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		buf, logOpt := testLogger()
+		undo, err := Set(logOpt, opt, Max(4))
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 4, currentMaxProcs())
+		assert.Contains(t, buf.String(), "maxprocs: Updating GOMAXPROCS=4: CPU quota undefined, limited by Max(4)")
+		undo()
+		assert.Equal(t, 8, currentMaxProcs())
+	})
+}
+
+func TestRoundUpWithTolerance(t *testing.T) {
+	testTable := []struct {
+		eps      float64
+		quota    float64
+		expected int
+	}{
+		{eps: 0.05, quota: 2.0, expected: 2},
+		{eps: 0.05, quota: 2.04, expected: 2},
+		{eps: 0.05, quota: 2.05, expected: 2},
+		{eps: 0.05, quota: 2.06, expected: 3},
+		{eps: 0.05, quota: 2.3, expected: 3},
+		{eps: 0.05, quota: 0.02, expected: 1},
+		{eps: 0.05, quota: 0.5, expected: 1},
+		{eps: 0, quota: 2.0, expected: 2},
+		{eps: 0, quota: 2.01, expected: 3},
+		{eps: 0.5, quota: 2.5, expected: 2},
+		{eps: 0.5, quota: 2.51, expected: 3},
+	}
+
+	for _, tt := range testTable {
+		round := RoundUpWithTolerance(tt.eps)
+		assert.Equal(t, tt.expected, round(tt.quota), "eps=%v quota=%v", tt.eps, tt.quota)
+	}
+
+	for _, eps := range []float64{-0.1, 1, 1.5, math.NaN()} {
+		assert.Panics(t, func() { RoundUpWithTolerance(eps) }, "eps=%v", eps)
+	}
+
+	opt := stubProcs(func(min int, round func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		maxProcs, status := iruntime.QuotaToGOMAXPROCS(2.3, min, round)
+		return maxProcs, status, nil
+	})
+	undo, err := Set(opt, RoundQuotaFunc(RoundUpWithTolerance(0.05)))
+	defer undo()
+	require.NoError(t, err, "Set failed")
+	assert.Equal(t, 3, currentMaxProcs())
+}
+
+func TestRoundToMultiple(t *testing.T) {
+	testTable := []struct {
+		name             string
+		quota            float64
+		multiple         int
+		min              int
+		expectedMaxProcs int
+		shouldHaveError  bool
+	}{
+		{name: "one", quota: 9, multiple: 1, min: 1, expectedMaxProcs: 9},
+		{name: "round-down", quota: 6, multiple: 4, min: 1, expectedMaxProcs: 4},
+		{name: "round-down-twice", quota: 9, multiple: 4, min: 1, expectedMaxProcs: 8},
+		{name: "exact", quota: 8, multiple: 4, min: 1, expectedMaxProcs: 8},
+		{name: "below-multiple", quota: 3, multiple: 4, min: 1, expectedMaxProcs: 4},
+		{name: "above-min", quota: 9, multiple: 4, min: 6, expectedMaxProcs: 8},
+		{name: "below-min", quota: 6, multiple: 4, min: 6, expectedMaxProcs: 6},
+		{name: "zero", quota: 4, multiple: 0, min: 1, shouldHaveError: true},
+		{name: "negative", quota: 4, multiple: -4, min: 1, shouldHaveError: true},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := stubProcs(func(min int, round func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+				maxProcs, status := iruntime.QuotaToGOMAXPROCS(tt.quota, min, round)
+				return maxProcs, status, nil
+			})
+			prev := currentMaxProcs()
+			undo, err := Set(opt, RoundToMultiple(tt.multiple), Min(tt.min))
+			defer undo()
+
+			if tt.shouldHaveError {
+				assert.Error(t, err, "Set should reject the multiple")
+				assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+				return
+			}
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, tt.expectedMaxProcs, currentMaxProcs(), "unexpected GOMAXPROCS")
+		})
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	t.Run("QuotaUsed", func(t *testing.T) {
+		calls := 0
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			calls++
+			return 5, iruntime.CPUQuotaUsed, nil
+		})
+		prev := currentMaxProcs()
+		apply, err := Prepare(opt)
+		require.NoError(t, err, "Prepare failed")
+		assert.Equal(t, 1, calls, "Prepare should detect the quota")
+		assert.Equal(t, prev, currentMaxProcs(), "Prepare shouldn't alter GOMAXPROCS")
+
+		maxProcs, undo, err := apply()
+		require.NoError(t, err, "apply failed")
+		assert.Equal(t, 1, calls, "apply shouldn't detect the quota again")
+		assert.Equal(t, 5, maxProcs, "apply should return the installed value")
+		assert.Equal(t, 5, currentMaxProcs(), "apply should change GOMAXPROCS")
+		undo()
+		assert.Equal(t, prev, currentMaxProcs(), "undo should restore GOMAXPROCS")
+	})
+
+	t.Run("QuotaUndefined", func(t *testing.T) {
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		prev := currentMaxProcs()
+		apply, err := Prepare(opt)
+		require.NoError(t, err, "Prepare failed")
+		maxProcs, undo, err := apply()
+		defer undo()
+		require.NoError(t, err, "apply failed")
+		assert.Equal(t, prev, maxProcs, "apply should return the current value")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+	})
+
+	t.Run("ErrorReadingQuota", func(t *testing.T) {
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return 0, iruntime.CPUQuotaUndefined, errors.New("failed")
+		})
+		prev := currentMaxProcs()
+		apply, err := Prepare(opt)
+		require.Error(t, err, "Prepare should have failed")
+		require.NotNil(t, apply, "Prepare should always return an apply func")
+		maxProcs, undo, err := apply()
+		defer undo()
+		require.NoError(t, err, "apply failed")
+		assert.Equal(t, prev, maxProcs, "apply should return the current value")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+	})
+
+	t.Run("EnvVarPresent", func(t *testing.T) {
+		withMax(t, 42, func() {
+			prev := currentMaxProcs()
+			apply, err := Prepare()
+			require.NoError(t, err, "Prepare failed")
+			maxProcs, undo, err := apply()
+			defer undo()
+			require.NoError(t, err, "apply failed")
+			assert.Equal(t, prev, maxProcs, "apply should return the current value")
+			assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+		})
+	})
+}
+
+func TestExportEnv(t *testing.T) {
+	opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 3, iruntime.CPUQuotaUsed, nil
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		undo, err := Set(opt, ExportEnv(true))
+		require.NoError(t, err, "Set failed")
+		value, exists := os.LookupEnv(_maxProcsKey)
+		assert.True(t, exists, "GOMAXPROCS should be exported")
+		assert.Equal(t, "3", value, "unexpected GOMAXPROCS environment variable")
+
+		undo()
+		_, exists = os.LookupEnv(_maxProcsKey)
+		assert.False(t, exists, "undo should unset GOMAXPROCS")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		undo, err := Set(opt)
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		_, exists := os.LookupEnv(_maxProcsKey)
+		assert.False(t, exists, "GOMAXPROCS shouldn't be exported by default")
+	})
+
+	t.Run("EnvVarPresent", func(t *testing.T) {
+		withMax(t, 42, func() {
+			undo, err := Set(opt, ExportEnv(true))
+			require.NoError(t, err, "Set failed")
+			undo()
+			assert.Equal(t, "42", os.Getenv(_maxProcsKey), "shouldn't touch an existing GOMAXPROCS")
+		})
+	})
+
+	t.Run("later Set", func(t *testing.T) {
+		undo, err := Set(opt, ExportEnv(true))
+		require.NoError(t, err, "Set failed")
+		defer undo()
+
+		buf, logOpt := testLogger()
+		later, err := Set(logOpt, stubQuotaStatus(5, iruntime.CPUQuotaUsed))
+		require.NoError(t, err, "Set failed")
+		defer later()
+		assert.Equal(t, 5, currentMaxProcs(), "the exported value shouldn't count as an override")
+		assert.NotContains(t, buf.String(), "set in environment")
+
+		require.NoError(t, os.Setenv(_maxProcsKey, "4"))
+		buf.Reset()
+		again, err := Set(logOpt, stubQuotaStatus(5, iruntime.CPUQuotaUsed))
+		require.NoError(t, err, "Set failed")
+		defer again()
+		assert.Contains(t, buf.String(), `Honoring GOMAXPROCS="4" as set in environment`, "a changed value is an override")
+	})
+}
+
+func withCPUEnv(t testing.TB, value string, f func()) {
+	prev, ok := os.LookupEnv(_cpuKey)
+	require.NoError(t, os.Setenv(_cpuKey, value), "couldn't set AUTOMAXPROCS_CPU")
+	defer func() {
+		if ok {
+			require.NoError(t, os.Setenv(_cpuKey, prev), "couldn't restore AUTOMAXPROCS_CPU")
+			return
+		}
+		require.NoError(t, os.Unsetenv(_cpuKey), "couldn't clear AUTOMAXPROCS_CPU")
+	}()
+	f()
+}
+
+func TestCPUEnv(t *testing.T) {
+	detected := false
+	opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		detected = true
+		return 7, iruntime.CPUQuotaUsed, nil
+	})
+
+	testTable := []struct {
+		name             string
+		value            string
+		opts             []Option
+		expectedMaxProcs int
+		expectedDetected bool
+		expectedLog      string
+	}{
+		{
+			name:             "fractional",
+			value:            "2.5",
+			expectedMaxProcs: 2,
+			expectedLog:      "Updating GOMAXPROCS=2: determined from AUTOMAXPROCS_CPU",
+		},
+		{
+			name:             "custom-round",
+			value:            "2.5",
+			opts:             []Option{RoundQuotaFunc(func(v float64) int { return int(math.Ceil(v)) })},
+			expectedMaxProcs: 3,
+			expectedLog:      "Updating GOMAXPROCS=3: determined from AUTOMAXPROCS_CPU",
+		},
+		{
+			name:             "below-min",
+			value:            "0.5",
+			expectedMaxProcs: 1,
+			expectedLog:      "using minimum allowed GOMAXPROCS",
+		},
+		{
+			name:             "invalid",
+			value:            "two",
+			expectedMaxProcs: 7,
+			expectedDetected: true,
+			expectedLog:      `Ignoring AUTOMAXPROCS_CPU="two"`,
+		},
+		{
+			name:             "negative",
+			value:            "-1",
+			expectedMaxProcs: 7,
+			expectedDetected: true,
+			expectedLog:      `Ignoring AUTOMAXPROCS_CPU="-1"`,
+		},
+		{
+			name:             "infinite",
+			value:            "+Inf",
+			expectedMaxProcs: 7,
+			expectedDetected: true,
+			expectedLog:      `Ignoring AUTOMAXPROCS_CPU="+Inf"`,
+		},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			detected = false
+			buf, logOpt := testLogger()
+			withCPUEnv(t, tt.value, func() {
+				undo, err := Set(append([]Option{logOpt, opt}, tt.opts...)...)
+				defer undo()
+				require.NoError(t, err, "Set failed")
+				assert.Equal(t, tt.expectedMaxProcs, currentMaxProcs(), "unexpected GOMAXPROCS")
+			})
+			assert.Equal(t, tt.expectedDetected, detected, "unexpected cgroups detection")
+			assert.Contains(t, buf.String(), tt.expectedLog, "unexpected log output")
+		})
+	}
+
+	t.Run("GOMAXPROCSPrecedence", func(t *testing.T) {
+		withMax(t, 42, func() {
+			withCPUEnv(t, "2.5", func() {
+				prev := currentMaxProcs()
+				undo, err := Set(opt)
+				defer undo()
+				require.NoError(t, err, "Set failed")
+				assert.Equal(t, prev, currentMaxProcs(), "GOMAXPROCS should take precedence")
+			})
+		})
+	})
+}
+
+func TestCompareAndSet(t *testing.T) {
+	opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 5, iruntime.CPUQuotaUsed, nil
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		prev := currentMaxProcs()
+		undo, err := Set(opt, CompareAndSet(true))
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 5, currentMaxProcs(), "should apply the detected value")
+		undo()
+		assert.Equal(t, prev, currentMaxProcs(), "undo should restore GOMAXPROCS")
+	})
+
+	for _, enabled := range []bool{true, false} {
+		prev := currentMaxProcs()
+		buf, logOpt := testLogger()
+		apply, err := Prepare(logOpt, opt, CompareAndSet(enabled))
+		require.NoError(t, err, "Prepare failed")
+
+		// Another component changes GOMAXPROCS between detection and apply.
+		runtime.GOMAXPROCS(prev + 2)
+		maxProcs, undo, err := apply()
+		require.NoError(t, err, "apply failed")
+		if enabled {
+			assert.Equal(t, prev+2, maxProcs, "apply should return the value in effect")
+			assert.Equal(t, prev+2, currentMaxProcs(), "shouldn't override the later change")
+			assert.Contains(t, buf.String(), fmt.Sprintf("changed from %v since detection started, not applying 5", prev))
+			d, ok := LastDecision()
+			require.True(t, ok, "the conflict should be recorded")
+			assert.Equal(t, prev+2, d.GOMAXPROCS, "should record the value in effect")
+		} else {
+			assert.Equal(t, 5, currentMaxProcs(), "should override the later change without CompareAndSet")
+		}
+		undo()
+		runtime.GOMAXPROCS(prev)
+	}
+}
+
+func TestNoDowngrade(t *testing.T) {
+	opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 3, iruntime.CPUQuotaUsed, nil
+	})
+	prev := currentMaxProcs()
+	defer runtime.GOMAXPROCS(prev)
+
+	t.Run("suppressed", func(t *testing.T) {
+		runtime.GOMAXPROCS(8)
+		buf, logOpt := testLogger()
+		result, undo, err := SetWithResult(logOpt, opt, NoDowngrade(true))
+		require.NoError(t, err, "SetWithResult failed")
+		assert.Equal(t, 8, currentMaxProcs(), "shouldn't lower GOMAXPROCS")
+		assert.Equal(t, 8, result.GOMAXPROCS)
+		assert.Equal(t, "Leaving GOMAXPROCS=8: NoDowngrade suppressed lowering it to 3", result.Reason)
+		assert.Contains(t, buf.String(), "maxprocs: Leaving GOMAXPROCS=8: NoDowngrade suppressed lowering it to 3")
+		undo()
+		assert.Equal(t, 8, currentMaxProcs(), "undo should keep the prior value")
+	})
+
+	t.Run("raised", func(t *testing.T) {
+		runtime.GOMAXPROCS(2)
+		undo, err := Set(opt, NoDowngrade(true))
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 3, currentMaxProcs(), "should raise GOMAXPROCS")
+		undo()
+		assert.Equal(t, 2, currentMaxProcs(), "undo should restore the prior value")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		runtime.GOMAXPROCS(8)
+		undo, err := Set(opt, NoDowngrade(false))
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 3, currentMaxProcs(), "should lower GOMAXPROCS without NoDowngrade")
+		undo()
+		assert.Equal(t, 8, currentMaxProcs(), "undo should restore the prior value")
+	})
+
+	t.Run("Max", func(t *testing.T) {
+		runtime.GOMAXPROCS(4)
+		withMax(t, 4, func() {
+			buf, logOpt := testLogger()
+			undo, err := Set(logOpt, Max(2), NoDowngrade(true))
+			defer undo()
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, 4, currentMaxProcs(), "shouldn't lower GOMAXPROCS to Max")
+			assert.Equal(t, "maxprocs: Leaving GOMAXPROCS=4: NoDowngrade suppressed lowering it to 2", buf.String())
+
+			result, undo, err := SetWithResult(Max(2), NoDowngrade(true))
+			defer undo()
+			require.NoError(t, err, "SetWithResult failed")
+			assert.Equal(t, ReasonNoDowngrade, result.Code)
+		})
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 5, iruntime.CPUQuotaUsed, nil
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		Reset()
+		defer Reset()
+		prev := currentMaxProcs()
+		buf, logOpt := testLogger()
+		var decisions []Decision
+		onDecision := OnDecision(func(d Decision) { decisions = append(decisions, d) })
+		result, undo, err := SetWithResult(logOpt, opt, onDecision, DryRun(true), ExportEnv(true))
+		require.NoError(t, err, "SetWithResult failed")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't change GOMAXPROCS")
+		assert.Equal(t, prev, result.GOMAXPROCS, "should report the value in effect")
+		assert.Equal(t, "Computed GOMAXPROCS=5 but not applied (dry run): determined from CPU quota", result.Reason)
+		assert.Contains(t, buf.String(), "maxprocs: Computed GOMAXPROCS=5 but not applied (dry run)")
+		_, exported := os.LookupEnv(_maxProcsKey)
+		assert.False(t, exported, "shouldn't export GOMAXPROCS")
+
+		require.Len(t, decisions, 1, "should report the decision")
+		assert.Equal(t, 5, decisions[0].GOMAXPROCS, "should report the computed value")
+		_, ok := LastDecision()
+		assert.False(t, ok, "shouldn't publish a value that wasn't applied")
+
+		buf.Reset()
+		undo()
+		assert.Equal(t, prev, currentMaxProcs(), "undo shouldn't change GOMAXPROCS")
+		assert.Contains(t, buf.String(), "maxprocs: No GOMAXPROCS change to reset")
+	})
+
+	t.Run("Max", func(t *testing.T) {
+		prev := currentMaxProcs()
+		runtime.GOMAXPROCS(4)
+		defer runtime.GOMAXPROCS(prev)
+
+		withMax(t, 4, func() {
+			buf, logOpt := testLogger()
+			undo, err := Set(logOpt, Max(2), DryRun(true))
+			defer undo()
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, 4, currentMaxProcs(), "shouldn't lower GOMAXPROCS to Max")
+			assert.Contains(t, buf.String(), `maxprocs: Computed GOMAXPROCS=2 but not applied (dry run): GOMAXPROCS="4" set in environment exceeds Max(2)`)
+		})
+	})
+}
+
+func TestRootPrefix(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0o644), "couldn't create file")
+
+	t.Run("valid", func(t *testing.T) {
+		var root string
+		opt := stubProcs(func(_ int, _ func(v float64) int, opts iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			root = opts.RootPrefix
+			return 0, iruntime.CPUQuotaUndefined, nil
+		})
+		undo, err := Set(opt, RootPrefix(dir))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, dir, root, "root prefix should be passed to detection")
+	})
+
+	t.Run("v2-root-cgroup", func(t *testing.T) {
+		// A process in the cgroup2 root has no cpu.max to read and keeps
+		// the default GOMAXPROCS.
+		buf, logOpt := testLogger()
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2-root-cgroup")
+		prev := currentMaxProcs()
+		undo, err := Set(logOpt, RootPrefix(prefix))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+		assert.Contains(t, buf.String(), "quota undefined", "unexpected log output")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, prefix := range []string{filepath.Join(dir, "nonexistent"), file} {
+			called := false
+			opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+				called = true
+				return 0, iruntime.CPUQuotaUndefined, nil
+			})
+			prev := currentMaxProcs()
+			undo, err := Set(opt, RootPrefix(prefix))
+			defer undo()
+			assert.Error(t, err, "Set should have failed for %q", prefix)
+			assert.False(t, called, "shouldn't detect CPU quota with an invalid root prefix")
+			assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+		}
+	})
+}
+
+func TestSetWithStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 3, iruntime.CPUQuotaUsed, nil
+	})
+
+	undo, err := SetWithStdLogger(opt)
+	require.NoError(t, err, "SetWithStdLogger failed")
+	assert.Equal(t, 3, currentMaxProcs(), "should apply the quota")
+	assert.Contains(t, buf.String(), "maxprocs: Updating GOMAXPROCS=3: determined from CPU quota", "unexpected log output")
+	undo()
+
+	buf.Reset()
+	custom, logOpt := testLogger()
+	undo, err = SetWithStdLogger(opt, logOpt)
+	require.NoError(t, err, "SetWithStdLogger failed")
+	undo()
+	assert.Empty(t, buf.String(), "a Logger option should take precedence")
+	assert.Contains(t, custom.String(), "Updating GOMAXPROCS=3", "unexpected log output")
+}
+
+func TestAddBurst(t *testing.T) {
+	testTable := []struct {
+		name             string
+		addBurst         bool
+		expectedMaxProcs int
+		expectedBurst    float64
+	}{
+		// v1-burst has a quota of 1.5 CPUs and a burst of 0.5 CPUs.
+		{name: "v1-burst", addBurst: false, expectedMaxProcs: 1, expectedBurst: 0.5},
+		{name: "v1-burst", addBurst: true, expectedMaxProcs: 2, expectedBurst: 0.5},
+		// v2-burst has a quota of 3 CPUs and a burst of 1 CPU.
+		{name: "v2-burst", addBurst: false, expectedMaxProcs: 3, expectedBurst: 1},
+		{name: "v2-burst", addBurst: true, expectedMaxProcs: 4, expectedBurst: 1},
+		{name: "v2", addBurst: true, expectedMaxProcs: 3, expectedBurst: 0},
+	}
+
+	for _, tt := range testTable {
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", tt.name)
+		undo, err := Set(RootPrefix(prefix), UseSchedAffinity(false), AddBurst(tt.addBurst))
+		require.NoError(t, err, "%v: Set failed", tt.name)
+		assert.Equal(t, tt.expectedMaxProcs, currentMaxProcs(), "%v: addBurst=%v", tt.name, tt.addBurst)
+
+		d, ok := LastDecision()
+		require.True(t, ok, tt.name)
+		assert.Equal(t, tt.expectedBurst, d.Burst, "%v: burst should always be reported", tt.name)
+		undo()
+	}
+}
+
+func TestProcMount(t *testing.T) {
+	prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "host-proc")
+
+	undo, err := Set(RootPrefix(prefix), ProcMount("/host/proc"), UseSchedAffinity(false))
+	require.NoError(t, err, "Set failed")
+	assert.Equal(t, 2, currentMaxProcs(), "should read the quota through /host/proc")
+	undo()
+
+	for _, mount := range []string{"/proc", "/nonexistent"} {
+		called := false
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			called = true
+			return 0, iruntime.CPUQuotaUndefined, nil
+		})
+		undo, err := Set(opt, RootPrefix(prefix), ProcMount(mount))
+		undo()
+		assert.Error(t, err, "%v: expected missing self/cgroup to fail", mount)
+		assert.Contains(t, err.Error(), "invalid proc mount", mount)
+		assert.False(t, called, "%v: detection shouldn't run", mount)
+	}
+}
+
+func TestCGroupMount(t *testing.T) {
+	prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "host-cgroup")
+
+	undo, err := Set(RootPrefix(prefix), CGroupMount("/host/sys/fs/cgroup"), UseSchedAffinity(false))
+	require.NoError(t, err, "Set failed")
+	assert.Equal(t, 2, currentMaxProcs(), "should read the quota through /host/sys/fs/cgroup")
+	undo()
+
+	undo, err = Set(RootPrefix(prefix), CGroupMount("/nonexistent"))
+	undo()
+	require.Error(t, err, "expected a missing cgroup mount to fail")
+	assert.Contains(t, err.Error(), "invalid cgroup mount")
+}
+
+func TestWalkCPUMax(t *testing.T) {
+	prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2-delegated")
+
+	prev := currentMaxProcs()
+	undo, err := Set(RootPrefix(prefix), UseSchedAffinity(false), IgnoreCPUSet(true))
+	require.NoError(t, err, "Set failed")
+	assert.Equal(t, prev, currentMaxProcs(), "the leaf's max shouldn't change GOMAXPROCS")
+	undo()
+
+	undo, err = Set(RootPrefix(prefix), UseSchedAffinity(false), WalkCPUMax(true))
+	require.NoError(t, err, "Set failed")
+	assert.Equal(t, 2, currentMaxProcs(), "should use the quota of the parent slice")
+	undo()
+
+	// cpu-nsdelegate-v2 has no cpu.max at the root of the hierarchy.
+	prefix = filepath.Join("..", "internal", "cgroups", "testdata", "root", "cpu-nsdelegate-v2")
+	undo, err = Set(RootPrefix(prefix), UseSchedAffinity(false), WalkCPUMax(true))
+	require.NoError(t, err, "Set failed")
+	assert.Equal(t, 2, currentMaxProcs(), "should use the quota of the delegating slice")
+	undo()
+}
+
+func TestSetSkipsMemoryFiles(t *testing.T) {
+	for _, name := range []string{"v1", "v2"} {
+		var names []string
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", name)
+		undo, err := Set(RootPrefix(prefix), UseSchedAffinity(false), recordReads(&names))
+		require.NoError(t, err, "%v: Set failed", name)
+		undo()
+
+		assert.NotEmpty(t, names, "%v: should record the files read", name)
+		for _, read := range names {
+			assert.NotContains(t, filepath.Base(read), "memory.", "%v: Set shouldn't read the memory limit", name)
+		}
+	}
+}
+
+func TestSystemdFallback(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		opt := stubProcs(func(_ int, _ func(v float64) int, opts iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			assert.Equal(t, enabled, opts.SystemdFallback)
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		undo, err := Set(opt, SystemdFallback(enabled))
+		require.NoError(t, err, "Set failed")
+		undo()
+	}
+}
+
+func TestCPUSet(t *testing.T) {
+	testTable := []struct {
+		name             string
+		expectedMaxProcs int
+		expectedSource   string
+		expectedLog      string
+	}{
+		// v1-cpuset has a quota of 2 CPUs and a cpuset of 8 CPUs.
+		{name: "v1-cpuset", expectedMaxProcs: 2, expectedSource: "CPU quota", expectedLog: "determined from CPU quota"},
+		// v2-cpuset has a quota of 4 CPUs and a cpuset of 2 CPUs.
+		{name: "v2-cpuset", expectedMaxProcs: 2, expectedSource: "cpuset", expectedLog: "limited by cpuset"},
+		// cpuset-inherit-v2 has no quota and a cpuset of 2 CPUs.
+		{name: "cpuset-inherit-v2", expectedMaxProcs: 2, expectedSource: "cpuset", expectedLog: "limited by cpuset"},
+	}
+
+	for _, tt := range testTable {
+		buf, logOpt := testLogger()
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", tt.name)
+		undo, err := Set(logOpt, RootPrefix(prefix), UseSchedAffinity(false))
+		require.NoError(t, err, "%v: Set failed", tt.name)
+		assert.Equal(t, tt.expectedMaxProcs, currentMaxProcs(), tt.name)
+		assert.Contains(t, buf.String(), tt.expectedLog, "%v: unexpected log output", tt.name)
+
+		d, ok := LastDecision()
+		require.True(t, ok, tt.name)
+		require.NotEmpty(t, d.Trace, tt.name)
+		assert.Equal(t, tt.expectedSource, d.Trace[0].Source, tt.name)
+		undo()
+	}
+}
+
+func TestCacheToFile(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "maxprocs.cache")
+	prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2")
+
+	for _, run := range []string{"cold", "warm"} {
+		undo, err := Set(RootPrefix(prefix), UseSchedAffinity(false), CacheToFile(cacheFile))
+		require.NoError(t, err, "%v: Set failed", run)
+		assert.Equal(t, 3, currentMaxProcs(), run)
+		undo()
+
+		_, err = os.Stat(cacheFile)
+		assert.NoError(t, err, "%v: cache should have been written", run)
+	}
+}
+
+func TestCacheInMemory(t *testing.T) {
+	InvalidateCache()
+	defer InvalidateCache()
+
+	// A cgroup2 root whose cpu.max the test rewrites.
+	root := t.TempDir()
+	cpuMax := filepath.Join(root, "sys", "fs", "cgroup", "cpu.max")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "proc", "self"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Dir(cpuMax), 0o755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "proc", "self", "cgroup"), []byte("0::/\n"), 0o644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "proc", "self", "mountinfo"),
+		[]byte("34 33 0:29 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:10 - cgroup2 cgroup rw\n"), 0o644))
+	require.NoError(t, ioutil.WriteFile(cpuMax, []byte("300000 100000\n"), 0o644))
+
+	query := func() int {
+		maxProcs, _, err := Query(RootPrefix(root), UseSchedAffinity(false), CacheInMemory(time.Hour))
+		require.NoError(t, err, "Query failed")
+		return maxProcs
+	}
+	assert.Equal(t, 3, query(), "cold")
+
+	require.NoError(t, ioutil.WriteFile(cpuMax, []byte("500000 100000\n"), 0o644))
+	assert.Equal(t, 3, query(), "should reuse the cached quota")
+
+	undo, err := Set(RootPrefix(root), UseSchedAffinity(false))
+	defer undo()
+	require.NoError(t, err, "Set failed")
+	assert.Equal(t, 5, currentMaxProcs(), "should read the files without CacheInMemory")
+
+	InvalidateCache()
+	assert.Equal(t, 5, query(), "should read the files once invalidated")
+
+	require.NoError(t, ioutil.WriteFile(cpuMax, []byte("700000 100000\n"), 0o644))
+	assert.Equal(t, 5, query(), "should reuse the cached quota")
+	Reset()
+	assert.Equal(t, 7, query(), "should read the files once reset")
+}
+
+func TestCPUMaxFile(t *testing.T) {
+	dir := t.TempDir()
+	cpuMax := filepath.Join(dir, "cpu.max")
+
+	t.Run("valid", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(cpuMax, []byte("300000 100000\n"), 0o644))
+		undo, err := Set(CPUMaxFile(cpuMax), UseSchedAffinity(false))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 3, currentMaxProcs(), "should use the quota of the file")
+	})
+
+	t.Run("max", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(cpuMax, []byte("max 100000\n"), 0o644))
+		prev := currentMaxProcs()
+		undo, err := Set(CPUMaxFile(cpuMax))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(cpuMax, []byte("300000\n"), 0o644))
+		prev := currentMaxProcs()
+		undo, err := Set(CPUMaxFile(cpuMax))
+		defer undo()
+		assert.Error(t, err, "Set should reject an invalid file")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+	})
+}
+
+func TestCGroupPath(t *testing.T) {
+	t.Run("v2", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cpu.max"), []byte("300000 100000\n"), 0o644))
+		undo, err := Set(CGroupPath(dir), UseSchedAffinity(false))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 3, currentMaxProcs(), "should use the quota of the directory")
+	})
+
+	t.Run("v1", func(t *testing.T) {
+		dir := filepath.Join("..", "internal", "cgroups", "testdata", "cgroups", "cpu")
+		undo, err := Set(CGroupPath(dir), UseSchedAffinity(false))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 6, currentMaxProcs(), "should use the quota of the directory")
+	})
+
+	t.Run("no CPU files", func(t *testing.T) {
+		prev := currentMaxProcs()
+		undo, err := Set(CGroupPath(t.TempDir()))
+		defer undo()
+		assert.Error(t, err, "Set should reject a directory without CPU files")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+	})
+}
+
+func TestQuotaCPUs(t *testing.T) {
+	t.Run("defined", func(t *testing.T) {
+		var root string
+		opt := stubQuota(func(opts iruntime.Options) (float64, bool, error) {
+			root = opts.RootPrefix
+			return 2.5, true, nil
+		})
+		prev := currentMaxProcs()
+		dir := t.TempDir()
+		quota, defined, err := QuotaCPUs(opt, RootPrefix(dir))
+		require.NoError(t, err, "QuotaCPUs failed")
+		assert.Equal(t, 2.5, quota, "should return the unrounded quota")
+		assert.True(t, defined, "quota should be defined")
+		assert.Equal(t, dir, root, "root prefix should be passed to detection")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+	})
+
+	t.Run("undefined", func(t *testing.T) {
+		opt := stubQuota(func(iruntime.Options) (float64, bool, error) {
+			return -1, false, nil
+		})
+		quota, defined, err := QuotaCPUs(opt)
+		require.NoError(t, err, "QuotaCPUs failed")
+		assert.Equal(t, -1.0, quota, "unexpected quota")
+		assert.False(t, defined, "quota shouldn't be defined")
+	})
+
+	t.Run("error", func(t *testing.T) {
+		opt := stubQuota(func(iruntime.Options) (float64, bool, error) {
+			return -1, false, errors.New("failed")
+		})
+		_, _, err := QuotaCPUs(opt)
+		require.Error(t, err, "QuotaCPUs should have failed")
+		assert.Equal(t, "failed", err.Error(), "should pass errors up the stack")
+
+		_, _, err = QuotaCPUs(RootPrefix(filepath.Join(t.TempDir(), "nonexistent")))
+		assert.Error(t, err, "QuotaCPUs should validate the root prefix")
+	})
+
+	t.Run("EnvVarPresent", func(t *testing.T) {
+		withMax(t, 42, func() {
+			opt := stubQuota(func(iruntime.Options) (float64, bool, error) {
+				return 1.5, true, nil
+			})
+			quota, defined, err := QuotaCPUs(opt)
+			require.NoError(t, err, "QuotaCPUs failed")
+			assert.Equal(t, 1.5, quota, "should ignore GOMAXPROCS environment variable")
+			assert.True(t, defined, "quota should be defined")
+		})
+	})
+}
+
+func TestUseSchedAffinity(t *testing.T) {
+	var got []bool
+	opt := stubProcs(func(_ int, _ func(v float64) int, opts iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		got = append(got, opts.SchedAffinity)
+		return 2, iruntime.CPUAffinityUsed, nil
+	})
+
+	buf, logOpt := testLogger()
+	undo, err := Set(logOpt, opt)
+	require.NoError(t, err, "Set failed")
+	undo()
+	assert.Contains(t, buf.String(), "Updating GOMAXPROCS=2: limited by CPU affinity", "unexpected log output")
+
+	undo, err = Set(opt, UseSchedAffinity(false))
+	require.NoError(t, err, "Set failed")
+	undo()
+
+	assert.Equal(t, []bool{true, false}, got, "CPU affinity should be used by default")
+}
+
+func TestDefaults(t *testing.T) {
+	assert.Equal(t, 2, DefaultRoundFunc(2.9), "DefaultRoundFunc should round down")
+	assert.Equal(t, 0, DefaultRoundFunc(0.5), "DefaultRoundFunc should round down")
+
+	procs := func(got *[]int) Option {
+		return stubProcs(func(min int, round func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			*got = append(*got, min, round(3.7))
+			return 3, iruntime.CPUQuotaUsed, nil
+		})
+	}
+
+	var withoutOpts, withDefaults []int
+	undo, err := Set(procs(&withoutOpts))
+	require.NoError(t, err, "Set failed")
+	undo()
+
+	undo, err = Set(procs(&withDefaults), Min(DefaultMin), RoundQuotaFunc(DefaultRoundFunc))
+	require.NoError(t, err, "Set failed")
+	undo()
+
+	assert.Equal(t, []int{DefaultMin, 3}, withoutOpts, "unexpected defaults")
+	assert.Equal(t, withoutOpts, withDefaults, "Set() should equal Set(Min(DefaultMin))")
 }
 
 func TestMain(m *testing.M) {
@@ -176,3 +1225,24 @@ func TestMain(m *testing.M) {
 	}
 	os.Exit(m.Run())
 }
+
+func BenchmarkSetV1(b *testing.B) {
+	benchmarkSet(b, "v1")
+}
+
+func BenchmarkSetV2(b *testing.B) {
+	benchmarkSet(b, "v2")
+}
+
+func benchmarkSet(b *testing.B, root string) {
+	prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", root)
+	opts := []Option{RootPrefix(prefix), UseSchedAffinity(false), Logger(func(string, ...interface{}) {})}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		undo, err := Set(opts...)
+		if err != nil {
+			b.Fatal(err)
+		}
+		undo()
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package maxprocshttp serves the decisions of maxprocs.Set over HTTP, for
+// operators to find out why a process runs with its GOMAXPROCS value. It's
+// kept out of the maxprocs package so that importing maxprocs doesn't pull
+// in net/http.
+//
+//	mux.Handle("/debug/maxprocs", maxprocshttp.Handler())
+package maxprocshttp // import "github.com/emadolsky/automaxprocs/maxprocs/maxprocshttp"
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/emadolsky/automaxprocs/maxprocs"
+)
+
+// report is the JSON document served by Handler.
+type report struct {
+	Decision *maxprocs.Decision `json:"decision"`
+	Stats    reportStats        `json:"stats"`
+	Files    []reportFile       `json:"files"`
+	Error    string             `json:"error,omitempty"`
+}
+
+type reportStats struct {
+	Reads     int64  `json:"reads"`
+	Changes   int64  `json:"changes"`
+	Errors    int64  `json:"errors"`
+	LastError string `json:"lastError,omitempty"`
+	// LastDuration is formatted like time.Duration.String.
+	LastDuration string `json:"lastDuration,omitempty"`
+}
+
+type reportFile struct {
+	Name    string `json:"name"`
+	Content string `json:"content,omitempty"`
+	Missing bool   `json:"missing,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Handler returns an http.Handler that serves, as a single JSON document,
+// the Decision returned by maxprocs.LastDecision, or null if Set hasn't
+// succeeded yet, the counters returned by maxprocs.Stats, and the files
+// returned by maxprocs.Snapshot with the given options. Mount it on a debug
+// server, e.g. at /debug/maxprocs; like net/http/pprof, it exposes details
+// about the host and shouldn't be served publicly.
+//
+// The files are read anew on every request. Only GET and HEAD requests are
+// served.
+func Handler(opts ...maxprocs.Option) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newReport(opts))
+	})
+}
+
+// newReport collects the document served by Handler.
+func newReport(opts []maxprocs.Option) report {
+	var rep report
+	if d, ok := maxprocs.LastDecision(); ok {
+		rep.Decision = &d
+	}
+
+	stats := maxprocs.Stats()
+	rep.Stats = reportStats{Reads: stats.Reads, Changes: stats.Changes, Errors: stats.Errors}
+	if stats.LastError != nil {
+		rep.Stats.LastError = stats.LastError.Error()
+	}
+	if stats.LastDuration > 0 {
+		rep.Stats.LastDuration = stats.LastDuration.String()
+	}
+
+	files, err := maxprocs.Snapshot(opts...)
+	if err != nil {
+		rep.Error = err.Error()
+	}
+	rep.Files = make([]reportFile, len(files))
+	for i, f := range files {
+		rep.Files[i] = newReportFile(f)
+	}
+	return rep
+}
+
+// newReportFile returns the JSON representation of f.
+func newReportFile(f maxprocs.File) reportFile {
+	rf := reportFile{Name: f.Name, Content: string(f.Content)}
+	switch {
+	case os.IsNotExist(f.Err):
+		rf.Missing = true
+	case f.Err != nil:
+		rf.Error = f.Err.Error()
+	}
+	return rf
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocshttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/emadolsky/automaxprocs/maxprocs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	if _, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		t.Skip("GOMAXPROCS is set in the environment")
+	}
+	maxprocs.Reset()
+	defer maxprocs.Reset()
+
+	prefix := filepath.Join("..", "..", "internal", "cgroups", "testdata", "root", "v2")
+	handler := Handler(maxprocs.RootPrefix(prefix))
+
+	get := func() report {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/maxprocs", nil))
+		require.Equal(t, http.StatusOK, rec.Code, "unexpected status")
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+		var rep report
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rep), "invalid JSON: %s", rec.Body)
+		return rep
+	}
+
+	rep := get()
+	assert.Nil(t, rep.Decision, "no decision should be reported before Set")
+	assert.Equal(t, reportStats{}, rep.Stats)
+	assert.Contains(t, rep.Files, reportFile{Name: "/sys/fs/cgroup/cpu.max", Content: "300000 100000\n"})
+	assert.Contains(t, rep.Files, reportFile{Name: "/sys/fs/cgroup/cpu.max.burst", Missing: true})
+
+	undo, err := maxprocs.Set(maxprocs.RootPrefix(prefix), maxprocs.UseSchedAffinity(false))
+	require.NoError(t, err, "Set failed")
+	defer undo()
+	// Reading a directory as the CPU count fails the detection.
+	_, err = maxprocs.Set(maxprocs.FromFile(t.TempDir()))
+	require.Error(t, err, "Set should fail")
+
+	rep = get()
+	require.NotNil(t, rep.Decision, "expected the decision of Set")
+	assert.Equal(t, 3, rep.Decision.GOMAXPROCS)
+	assert.Equal(t, int64(2), rep.Stats.Reads)
+	assert.Equal(t, int64(1), rep.Stats.Errors)
+	assert.Equal(t, err.Error(), rep.Stats.LastError)
+	assert.NotEmpty(t, rep.Stats.LastDuration)
+}
+
+func TestHandlerMethod(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/maxprocs", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, HEAD", rec.Header().Get("Allow"))
+}
+
+func TestHandlerInvalidRootPrefix(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler(maxprocs.RootPrefix(filepath.Join(t.TempDir(), "nonexistent"))).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var rep report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rep))
+	assert.Contains(t, rep.Error, "invalid root prefix")
+	assert.Empty(t, rep.Files)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package maxprocstest provides a fake cgroup hierarchy for testing code that
+// calls maxprocs.Set, so that tests get a deterministic GOMAXPROCS value
+// without running in a container.
+//
+// A test describes the limits it wants with FakeCGroups and passes the
+// resulting options to maxprocs:
+//
+//	fake := maxprocstest.FakeCGroups{CPUQuota: 2.5}
+//	undo, err := maxprocs.Set(fake.Options(t)...)
+//	defer undo()
+//
+// The fake only replaces the cgroup files maxprocs reads, so it works on
+// every OS. The GOMAXPROCS and AUTOMAXPROCS_CPU environment variables keep
+// taking precedence.
+package maxprocstest // import "github.com/emadolsky/automaxprocs/maxprocs/maxprocstest"
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/emadolsky/automaxprocs/maxprocs"
+)
+
+// _cpuMaxPeriod is the CFS period written to the fake cpu.max file, in
+// microseconds. It's the kernel's default.
+const _cpuMaxPeriod = 100000
+
+// FakeCGroups describes the cgroup2 limits of a fake process.
+type FakeCGroups struct {
+	// CPUQuota is the CPU quota, as a fraction of CPUs (e.g. 2.5). Zero or
+	// less means no quota.
+	CPUQuota float64
+	// MemoryLimit is the memory limit, in bytes. Zero or less means no
+	// limit.
+	MemoryLimit int64
+}
+
+// Options writes a cgroup2 hierarchy matching f to a temporary directory,
+// removed once the test completes, and returns the options that make
+// maxprocs read from it. Other options can be appended to the result.
+//
+// Reading the CPU affinity mask is disabled as well, so that the result
+// doesn't depend on the machine running the test.
+func (f FakeCGroups) Options(t testing.TB) []maxprocs.Option {
+	t.Helper()
+
+	root := t.TempDir()
+	files := map[string]string{
+		"proc/self/mountinfo":      "1 0 0:1 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime - cgroup2 cgroup2 rw\n",
+		"proc/self/cgroup":         "0::/\n",
+		"sys/fs/cgroup/cpu.max":    f.cpuMax(),
+		"sys/fs/cgroup/memory.max": f.memoryMax(),
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("maxprocstest: couldn't create fake cgroups: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("maxprocstest: couldn't create fake cgroups: %v", err)
+		}
+	}
+
+	return []maxprocs.Option{
+		maxprocs.RootPrefix(root),
+		maxprocs.UseSchedAffinity(false),
+	}
+}
+
+func (f FakeCGroups) cpuMax() string {
+	if f.CPUQuota <= 0 {
+		return fmt.Sprintf("max %d\n", _cpuMaxPeriod)
+	}
+	return fmt.Sprintf("%d %d\n", int64(f.CPUQuota*_cpuMaxPeriod), _cpuMaxPeriod)
+}
+
+func (f FakeCGroups) memoryMax() string {
+	if f.MemoryLimit <= 0 {
+		return "max\n"
+	}
+	return fmt.Sprintf("%d\n", f.MemoryLimit)
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocstest
+
+import (
+	"log"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/emadolsky/automaxprocs/maxprocs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeCGroups(t *testing.T) {
+	testTable := []struct {
+		name             string
+		fake             FakeCGroups
+		expectedMaxProcs int
+		expectedQuota    float64
+		expectedDefined  bool
+	}{
+		{
+			name:             "fractional",
+			fake:             FakeCGroups{CPUQuota: 2.5},
+			expectedMaxProcs: 2,
+			expectedQuota:    2.5,
+			expectedDefined:  true,
+		},
+		{
+			name:             "below-one",
+			fake:             FakeCGroups{CPUQuota: 0.5},
+			expectedMaxProcs: 1,
+			expectedQuota:    0.5,
+			expectedDefined:  true,
+		},
+		{
+			name:             "large",
+			fake:             FakeCGroups{CPUQuota: 64},
+			expectedMaxProcs: 64,
+			expectedQuota:    64,
+			expectedDefined:  true,
+		},
+		{
+			name:             "no-quota",
+			fake:             FakeCGroups{},
+			expectedMaxProcs: runtime.GOMAXPROCS(0),
+			expectedQuota:    -1,
+			expectedDefined:  false,
+		},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			undo, err := maxprocs.Set(tt.fake.Options(t)...)
+			defer undo()
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, tt.expectedMaxProcs, runtime.GOMAXPROCS(0), "unexpected GOMAXPROCS")
+
+			quota, defined, err := maxprocs.QuotaCPUs(tt.fake.Options(t)...)
+			require.NoError(t, err, "QuotaCPUs failed")
+			assert.Equal(t, tt.expectedQuota, quota, "unexpected CPU quota")
+			assert.Equal(t, tt.expectedDefined, defined, "unexpected CPU quota")
+		})
+	}
+}
+
+func TestFakeCGroupsMemoryLimit(t *testing.T) {
+	fake := FakeCGroups{CPUQuota: 4, MemoryLimit: 1 << 30}
+	opts := append(fake.Options(t), maxprocs.BalanceWithMemory(512<<20))
+	undo, err := maxprocs.Set(opts...)
+	defer undo()
+	require.NoError(t, err, "Set failed")
+	assert.Equal(t, 2, runtime.GOMAXPROCS(0), "memory limit should cap GOMAXPROCS")
+}
+
+func TestMain(m *testing.M) {
+	// GOMAXPROCS takes precedence over the fake cgroups.
+	if err := os.Unsetenv("GOMAXPROCS"); err != nil {
+		log.Fatalf("Couldn't clear GOMAXPROCS: %v\n", err)
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import "os"
+
+const (
+	// _memLimitKey is the environment variable through which the Go runtime
+	// reads its memory limit.
+	_memLimitKey = "GOMEMLIMIT"
+	// _defaultMemoryHeadroom is the percentage of the memory limit that
+	// SetMemoryLimit keeps out of GOMEMLIMIT unless MemoryLimitHeadroom is
+	// supplied.
+	_defaultMemoryHeadroom = 10
+)
+
+// MemoryLimitHeadroom sets the percentage of the cgroup memory limit that
+// SetMemoryLimit keeps out of GOMEMLIMIT, for memory the Go runtime doesn't
+// account for, such as cgo allocations and the page cache charged to the
+// cgroup. It must be in [0, 100); the default is 10.
+func MemoryLimitHeadroom(percent float64) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.memoryHeadroom = percent
+	})
+}
+
+// SetMemoryLimit sets the soft memory limit of the Go runtime, as
+// debug.SetMemoryLimit does, to the memory limit applied to the calling
+// process, read from memory.max with cgroup2 and memory.limit_in_bytes with
+// cgroup v1, minus the headroom set with MemoryLimitHeadroom. With the
+// runtime collecting garbage more aggressively as the heap approaches the
+// limit, this lets processes running under a container memory limit avoid
+// being OOM-killed.
+//
+// It leaves the limit untouched if no memory limit is set, which includes
+// memory.max being max and memory.limit_in_bytes holding the kernel's
+// "unlimited" value, and if the GOMEMLIMIT environment variable is set. It
+// returns a function that restores the previous limit. SetMemoryLimit requires
+// Go 1.19 or later and returns an error with older releases.
+func SetMemoryLimit(opts ...Option) (func(), error) {
+	cfg := newConfig(opts)
+	undoNoop := func() {
+		cfg.log("maxprocs: No GOMEMLIMIT change to undo")
+	}
+	if err := cfg.validate(); err != nil {
+		return undoNoop, err
+	}
+
+	cancel := cfg.startTimeout()
+	defer cancel()
+
+	if limit, exists := os.LookupEnv(_memLimitKey); exists {
+		cfg.log("maxprocs: Honoring GOMEMLIMIT=%q as set in environment", limit)
+		return undoNoop, nil
+	}
+
+	limit, defined, err := cfg.memoryLimit(cfg.runtimeOptions())
+	if err != nil {
+		return undoNoop, err
+	}
+	if !defined {
+		cfg.log("maxprocs: Leaving GOMEMLIMIT unchanged: memory limit undefined")
+		return undoNoop, nil
+	}
+
+	memLimit := int64(float64(limit) * (1 - cfg.memoryHeadroom/100))
+	prev, err := setMemoryLimit(memLimit)
+	if err != nil {
+		return undoNoop, err
+	}
+	cfg.log("maxprocs: Updating GOMEMLIMIT=%v: memory limit of %v bytes less %v%% headroom", memLimit, limit, cfg.memoryHeadroom)
+	return func() {
+		cfg.log("maxprocs: Resetting GOMEMLIMIT to %v", prev)
+		_, _ = setMemoryLimit(prev)
+	}, nil
+}
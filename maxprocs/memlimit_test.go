@@ -0,0 +1,125 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build go1.19
+// +build go1.19
+
+package maxprocs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func currentMemoryLimit() int64 {
+	return debug.SetMemoryLimit(-1)
+}
+
+func TestSetMemoryLimit(t *testing.T) {
+	t.Run("headroom", func(t *testing.T) {
+		testTable := []struct {
+			name     string
+			opts     []Option
+			expected int64
+		}{
+			{name: "default", expected: 900 << 20},
+			{name: "none", opts: []Option{MemoryLimitHeadroom(0)}, expected: 1000 << 20},
+			{name: "quarter", opts: []Option{MemoryLimitHeadroom(25)}, expected: 750 << 20},
+		}
+
+		for _, tt := range testTable {
+			var calls int
+			prev := currentMemoryLimit()
+			buf, logOpt := testLogger()
+			opts := append([]Option{logOpt, stubMemoryLimit(1000<<20, true, nil, &calls)}, tt.opts...)
+			undo, err := SetMemoryLimit(opts...)
+			require.NoError(t, err, "%v: SetMemoryLimit failed", tt.name)
+			assert.Equal(t, tt.expected, currentMemoryLimit(), tt.name)
+			assert.Contains(t, buf.String(), "maxprocs: Updating GOMEMLIMIT=", tt.name)
+			undo()
+			assert.Equal(t, prev, currentMemoryLimit(), "%v: undo should restore the limit", tt.name)
+		}
+	})
+
+	t.Run("fixtures", func(t *testing.T) {
+		testTable := []struct {
+			name        string
+			expected    int64
+			expectedLog string
+		}{
+			{name: "v2", expected: 1073741824 * 9 / 10, expectedLog: "maxprocs: Updating GOMEMLIMIT="},
+			{name: "hybrid", expectedLog: "maxprocs: Leaving GOMEMLIMIT unchanged: memory limit undefined"},
+			{name: "cpuset-only", expectedLog: "maxprocs: Leaving GOMEMLIMIT unchanged: memory limit undefined"},
+		}
+
+		for _, tt := range testTable {
+			prev := currentMemoryLimit()
+			buf, logOpt := testLogger()
+			prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", tt.name)
+			undo, err := SetMemoryLimit(logOpt, RootPrefix(prefix))
+			require.NoError(t, err, "%v: SetMemoryLimit failed", tt.name)
+			expected := tt.expected
+			if expected == 0 {
+				expected = prev
+			}
+			assert.Equal(t, expected, currentMemoryLimit(), tt.name)
+			assert.Contains(t, buf.String(), tt.expectedLog, tt.name)
+			undo()
+		}
+	})
+
+	t.Run("EnvVarPresent", func(t *testing.T) {
+		require.NoError(t, os.Setenv(_memLimitKey, "1GiB"))
+		defer os.Unsetenv(_memLimitKey)
+
+		var calls int
+		prev := currentMemoryLimit()
+		buf, logOpt := testLogger()
+		undo, err := SetMemoryLimit(logOpt, stubMemoryLimit(1000<<20, true, nil, &calls))
+		defer undo()
+		require.NoError(t, err, "SetMemoryLimit failed")
+		assert.Equal(t, prev, currentMemoryLimit(), "shouldn't change the limit")
+		assert.Equal(t, 0, calls, "shouldn't read the memory limit")
+		assert.Contains(t, buf.String(), `maxprocs: Honoring GOMEMLIMIT="1GiB" as set in environment`)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var calls int
+		prev := currentMemoryLimit()
+		undo, err := SetMemoryLimit(stubMemoryLimit(-1, false, errors.New("failed"), &calls))
+		defer undo()
+		assert.EqualError(t, err, "failed")
+		assert.Equal(t, prev, currentMemoryLimit())
+	})
+
+	t.Run("invalid headroom", func(t *testing.T) {
+		for _, percent := range []float64{-1, 100, 150} {
+			undo, err := SetMemoryLimit(MemoryLimitHeadroom(percent))
+			undo()
+			assert.Error(t, err, "headroom=%v", percent)
+		}
+	})
+}
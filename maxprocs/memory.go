@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+// BalanceWithMemory caps GOMAXPROCS so that each P gets at least bytesPerProc
+// bytes of the memory limit applied to the process, which keeps per-P memory
+// budgets large enough to avoid GC thrashing in memory-heavy workloads. For
+// example, with 512MiB per P, a pod limited to 2 CPUs and 512MiB of memory
+// gets GOMAXPROCS=1. The cap only applies when both a CPU quota and a memory
+// limit are detected, and never lowers GOMAXPROCS below the minimum.
+//
+// Memory limit files are only read when this option is set. Disabled by
+// default; values of zero or less disable it.
+func BalanceWithMemory(bytesPerProc int64) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.bytesPerProc = bytesPerProc
+	})
+}
+
+// capByMemory lowers maxProcs to the number of Ps the memory limit allows
+// with BalanceWithMemory, if any. It returns true if the cap changed
+// maxProcs.
+func (c *config) capByMemory(maxProcs int) (int, bool, error) {
+	if c.bytesPerProc <= 0 {
+		return maxProcs, false, nil
+	}
+
+	limit, defined, err := c.memoryLimit(c.runtimeOptions())
+	if err != nil || !defined {
+		return maxProcs, false, err
+	}
+
+	procs := limit / c.bytesPerProc
+	if procs < int64(c.minGOMAXPROCS) {
+		procs = int64(c.minGOMAXPROCS)
+	}
+	if procs >= int64(maxProcs) {
+		return maxProcs, false, nil
+	}
+	return int(procs), true, nil
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const _mib = 1 << 20
+
+func stubMemoryLimit(limit int64, defined bool, err error, calls *int) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.memoryLimit = func(iruntime.Options) (int64, bool, error) {
+			*calls++
+			return limit, defined, err
+		}
+	})
+}
+
+func TestBalanceWithMemory(t *testing.T) {
+	quotaOpt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 4, iruntime.CPUQuotaUsed, nil
+	})
+
+	testTable := []struct {
+		name             string
+		bytesPerProc     int64
+		limit            int64
+		defined          bool
+		opts             []Option
+		expectedMaxProcs int
+		expectedCalls    int
+		expectedLog      string
+	}{
+		{
+			name:             "disabled",
+			limit:            512 * _mib,
+			defined:          true,
+			expectedMaxProcs: 4,
+			expectedCalls:    0,
+			expectedLog:      "determined from CPU quota",
+		},
+		{
+			name:             "binding",
+			bytesPerProc:     512 * _mib,
+			limit:            1024 * _mib,
+			defined:          true,
+			expectedMaxProcs: 2,
+			expectedCalls:    1,
+			expectedLog:      "Updating GOMAXPROCS=2: limited by memory limit",
+		},
+		{
+			name:             "not-binding",
+			bytesPerProc:     256 * _mib,
+			limit:            2048 * _mib,
+			defined:          true,
+			expectedMaxProcs: 4,
+			expectedCalls:    1,
+			expectedLog:      "determined from CPU quota",
+		},
+		{
+			name:             "below-min",
+			bytesPerProc:     512 * _mib,
+			limit:            256 * _mib,
+			defined:          true,
+			opts:             []Option{Min(2)},
+			expectedMaxProcs: 2,
+			expectedCalls:    1,
+			expectedLog:      "Updating GOMAXPROCS=2: limited by memory limit",
+		},
+		{
+			name:             "undefined",
+			bytesPerProc:     512 * _mib,
+			limit:            -1,
+			defined:          false,
+			expectedMaxProcs: 4,
+			expectedCalls:    1,
+			expectedLog:      "determined from CPU quota",
+		},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			buf, logOpt := testLogger()
+			opts := append([]Option{
+				logOpt,
+				quotaOpt,
+				stubMemoryLimit(tt.limit, tt.defined, nil, &calls),
+				BalanceWithMemory(tt.bytesPerProc),
+			}, tt.opts...)
+			undo, err := Set(opts...)
+			defer undo()
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, tt.expectedMaxProcs, currentMaxProcs(), "unexpected GOMAXPROCS")
+			assert.Equal(t, tt.expectedCalls, calls, "unexpected memory limit reads")
+			assert.Contains(t, buf.String(), tt.expectedLog, "unexpected log output")
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		calls := 0
+		prev := currentMaxProcs()
+		undo, err := Set(quotaOpt, stubMemoryLimit(-1, false, errors.New("failed"), &calls), BalanceWithMemory(_mib))
+		defer undo()
+		assert.Error(t, err, "Set should fail if the memory limit can't be read")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+	})
+
+	t.Run("quota-undefined", func(t *testing.T) {
+		calls := 0
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		undo, err := Set(opt, stubMemoryLimit(_mib, true, nil, &calls), BalanceWithMemory(_mib))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 0, calls, "memory limit shouldn't be read without a CPU quota")
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"math"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+)
+
+// MinNeverExceedsQuota caps the minimum set with Min at the CPU quota,
+// rounded up, when enabled, so that the minimum only makes up for rounding
+// and never oversubscribes the quota: with Min(4), a quota of 2 CPUs yields
+// GOMAXPROCS=2 and a quota of 2.5 CPUs yields 3, while a quota of 4.5 CPUs
+// still yields 4. This also applies to the CPU counts of AUTOMAXPROCS_CPU and
+// FromFile, and to the cpuset or CPU affinity mask when they bound the quota.
+// Disabled by default, so that Min raises GOMAXPROCS however small the
+// quota.
+func MinNeverExceedsQuota(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.minAtMostQuota = enabled
+	})
+}
+
+// capMinAtQuota lowers maxProcs to the CPU quota recorded in trace, rounded
+// up, if MinNeverExceedsQuota is enabled and the minimum raised maxProcs
+// above it. The status is then no longer CPUQuotaMinUsed.
+func (c *config) capMinAtQuota(trace []Step, maxProcs int, status iruntime.CPUQuotaStatus) (int, iruntime.CPUQuotaStatus) {
+	if !c.minAtMostQuota || status != iruntime.CPUQuotaMinUsed || len(trace) == 0 {
+		return maxProcs, status
+	}
+	capped := int(math.Ceil(trace[0].Value))
+	if capped >= maxProcs {
+		return maxProcs, status
+	}
+	if capped < 1 {
+		capped = 1
+	}
+	return capped, iruntime.CPUQuotaUsed
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMinNeverExceedsQuota(t *testing.T) {
+	testTable := []struct {
+		name       string
+		quota      float64
+		min        int
+		numCPU     int
+		opts       []Option
+		expected   int
+		minBinding bool
+	}{
+		{name: "quota below min", quota: 2, min: 4, expected: 2},
+		{name: "fractional quota below min", quota: 2.5, min: 4, expected: 3},
+		{name: "quota rounding below min", quota: 3.5, min: 4, expected: 4, minBinding: true},
+		{name: "quota equal to min", quota: 4, min: 4, expected: 4},
+		{name: "quota above min", quota: 6.5, min: 4, expected: 6},
+		{name: "tiny quota", quota: 0.2, min: 2, expected: 1},
+		{name: "utilization", quota: 4, min: 4, opts: []Option{TargetUtilization(0.5)}, expected: 4, minBinding: true},
+		{name: "affinity", quota: 8, min: 4, numCPU: 2, opts: []Option{UseSchedAffinity(true)}, expected: 2},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{Min(tt.min)}, tt.opts...)
+			without := Simulate(tt.quota, tt.numCPU, opts...)
+			d := Simulate(tt.quota, tt.numCPU, append(opts, MinNeverExceedsQuota(true))...)
+			assert.Equal(t, tt.expected, d.GOMAXPROCS)
+			assert.Equal(t, tt.minBinding, d.MinBinding)
+			assert.True(t, d.GOMAXPROCS <= without.GOMAXPROCS, "should never exceed the plain minimum")
+			if assert.NotEmpty(t, d.Trace) {
+				assert.Equal(t, fmt.Sprintf("Min(%d), MinNeverExceedsQuota", tt.min), d.Trace[3].Source)
+			}
+		})
+	}
+
+	assert.Equal(t, 4, Simulate(2, 0, Min(4)).GOMAXPROCS, "disabled by default")
+}
+
+func TestMinNeverExceedsQuotaSet(t *testing.T) {
+	t.Run("cgroups", func(t *testing.T) {
+		buf, logOpt := testLogger()
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v1")
+		undo, err := Set(logOpt, RootPrefix(prefix), UseSchedAffinity(false), Min(4), MinNeverExceedsQuota(true))
+		defer undo()
+		require.NoError(t, err)
+		assert.Equal(t, 2, currentMaxProcs(), "a quota of 1.5 CPUs should cap Min(4) at 2")
+		assert.Contains(t, buf.String(), "Updating GOMAXPROCS=2: determined from CPU quota")
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		withCPUEnv(t, "3", func() {
+			undo, err := Set(Min(8), MinNeverExceedsQuota(true))
+			defer undo()
+			require.NoError(t, err)
+			assert.Equal(t, 3, currentMaxProcs())
+		})
+	})
+
+	t.Run("cpuset", func(t *testing.T) {
+		opt := stubProcs(func(min int, round func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			maxProcs, status := iruntime.QuotaToGOMAXPROCS(1, min, round)
+			return maxProcs, status, nil
+		})
+		undo, err := Set(opt, Min(2), MinNeverExceedsQuota(true))
+		defer undo()
+		require.NoError(t, err)
+		assert.Equal(t, 1, currentMaxProcs())
+	})
+}
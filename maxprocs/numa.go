@@ -0,0 +1,63 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import "sort"
+
+// NUMANodes caps GOMAXPROCS at the number of CPUs of n NUMA nodes, so that a
+// memory-bandwidth-bound process doesn't spread its Ps over more nodes than
+// needed. The nodes with the most CPUs are counted, and the cap never lowers
+// GOMAXPROCS below the minimum. Set logs when the cap binds.
+//
+// The nodes are read from `/sys/devices/system/node`, which is Linux-specific;
+// no cap applies when it's absent. Disabled by default; values of zero or
+// less disable it.
+func NUMANodes(n int) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.numaNodes = n
+	})
+}
+
+// capByNUMA lowers maxProcs to the number of CPUs of c.numaNodes NUMA nodes,
+// if any. It returns true if the cap changed maxProcs.
+func (c *config) capByNUMA(maxProcs int) (int, bool, error) {
+	if c.numaNodes <= 0 {
+		return maxProcs, false, nil
+	}
+
+	nodeCPUs, err := c.numaNodeCPUs(c.runtimeOptions())
+	if err != nil || len(nodeCPUs) == 0 {
+		return maxProcs, false, err
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(nodeCPUs)))
+	procs := 0
+	for i := 0; i < c.numaNodes && i < len(nodeCPUs); i++ {
+		procs += nodeCPUs[i]
+	}
+	if procs < c.minGOMAXPROCS {
+		procs = c.minGOMAXPROCS
+	}
+	if procs >= maxProcs {
+		return maxProcs, false, nil
+	}
+	return procs, true, nil
+}
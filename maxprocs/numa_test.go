@@ -0,0 +1,140 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubNUMANodeCPUs(cpus []int, err error, calls *int) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.numaNodeCPUs = func(iruntime.Options) ([]int, error) {
+			*calls++
+			return append([]int(nil), cpus...), err
+		}
+	})
+}
+
+func TestNUMANodes(t *testing.T) {
+	quotaOpt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 12, iruntime.CPUQuotaUsed, nil
+	})
+
+	testTable := []struct {
+		name             string
+		nodes            int
+		nodeCPUs         []int
+		opts             []Option
+		expectedMaxProcs int
+		expectedCalls    int
+		expectedLog      string
+	}{
+		{
+			name:             "disabled",
+			nodeCPUs:         []int{4, 4, 4, 4},
+			expectedMaxProcs: 12,
+			expectedCalls:    0,
+			expectedLog:      "determined from CPU quota",
+		},
+		{
+			name:             "one-node",
+			nodes:            1,
+			nodeCPUs:         []int{4, 4, 4, 4},
+			expectedMaxProcs: 4,
+			expectedCalls:    1,
+			expectedLog:      "Updating GOMAXPROCS=4: limited by 1 NUMA node(s)",
+		},
+		{
+			name:             "largest-nodes",
+			nodes:            2,
+			nodeCPUs:         []int{2, 6, 0, 4},
+			expectedMaxProcs: 10,
+			expectedCalls:    1,
+			expectedLog:      "Updating GOMAXPROCS=10: limited by 2 NUMA node(s)",
+		},
+		{
+			name:             "not-binding",
+			nodes:            3,
+			nodeCPUs:         []int{8, 8, 8},
+			expectedMaxProcs: 12,
+			expectedCalls:    1,
+			expectedLog:      "determined from CPU quota",
+		},
+		{
+			name:             "more-than-available",
+			nodes:            4,
+			nodeCPUs:         []int{4, 4},
+			expectedMaxProcs: 8,
+			expectedCalls:    1,
+			expectedLog:      "Updating GOMAXPROCS=8: limited by 4 NUMA node(s)",
+		},
+		{
+			name:             "below-min",
+			nodes:            1,
+			nodeCPUs:         []int{2, 2},
+			opts:             []Option{Min(3)},
+			expectedMaxProcs: 3,
+			expectedCalls:    1,
+			expectedLog:      "Updating GOMAXPROCS=3: limited by 1 NUMA node(s)",
+		},
+		{
+			name:             "no-sysfs",
+			nodes:            1,
+			expectedMaxProcs: 12,
+			expectedCalls:    1,
+			expectedLog:      "determined from CPU quota",
+		},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			buf, logOpt := testLogger()
+			opts := append([]Option{
+				logOpt,
+				quotaOpt,
+				stubNUMANodeCPUs(tt.nodeCPUs, nil, &calls),
+				NUMANodes(tt.nodes),
+			}, tt.opts...)
+			undo, err := Set(opts...)
+			defer undo()
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, tt.expectedMaxProcs, currentMaxProcs(), "unexpected GOMAXPROCS")
+			assert.Equal(t, tt.expectedCalls, calls, "unexpected NUMA node reads")
+			assert.Contains(t, buf.String(), tt.expectedLog, "unexpected log output")
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		calls := 0
+		prev := currentMaxProcs()
+		undo, err := Set(quotaOpt, stubNUMANodeCPUs(nil, errors.New("failed"), &calls), NUMANodes(1))
+		defer undo()
+		assert.Error(t, err, "Set should fail if the NUMA nodes can't be read")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+	})
+}
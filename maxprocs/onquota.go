@@ -0,0 +1,48 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+// OnQuota sets a function that receives the CPU quota of the process as read
+// from cgroups, as a fraction of CPUs (e.g. 2.5), before any rounding,
+// clamping or cap by the cpuset, and whether a quota is defined at all. Set,
+// Prepare and Query call it once, before considering the GOMAXPROCS
+// environment variable, so that it always learns the limit of the container,
+// e.g. to report it to a metrics system. It isn't called if the quota can't
+// be read, which is logged.
+func OnQuota(f func(quota float64, defined bool)) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.onQuota = f
+	})
+}
+
+// observeQuota reads the CPU quota for the function set with OnQuota, if
+// any.
+func (c *config) observeQuota() {
+	if c.onQuota == nil {
+		return
+	}
+	quota, defined, err := c.quotaCPUs(c.runtimeOptions())
+	if err != nil {
+		c.log("maxprocs: Couldn't read CPU quota: %v", err)
+		return
+	}
+	c.onQuota(quota, defined)
+}
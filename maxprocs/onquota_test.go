@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type observedQuota struct {
+	quota   float64
+	defined bool
+}
+
+func quotaRecorder(observed *[]observedQuota) Option {
+	return OnQuota(func(quota float64, defined bool) {
+		*observed = append(*observed, observedQuota{quota, defined})
+	})
+}
+
+func TestOnQuota(t *testing.T) {
+	prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v1-burst")
+
+	t.Run("Set", func(t *testing.T) {
+		var observed []observedQuota
+		undo, err := Set(RootPrefix(prefix), UseSchedAffinity(false), quotaRecorder(&observed))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, []observedQuota{{1.5, true}}, observed, "should observe the quota before rounding")
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		var observed []observedQuota
+		_, _, err := Query(RootPrefix(prefix), UseSchedAffinity(false), quotaRecorder(&observed))
+		require.NoError(t, err, "Query failed")
+		assert.Equal(t, []observedQuota{{1.5, true}}, observed)
+	})
+
+	t.Run("EnvVarPresent", func(t *testing.T) {
+		withMax(t, 42, func() {
+			var observed []observedQuota
+			undo, err := Set(RootPrefix(prefix), UseSchedAffinity(false), quotaRecorder(&observed))
+			defer undo()
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, []observedQuota{{1.5, true}}, observed, "should observe the quota despite GOMAXPROCS")
+		})
+	})
+
+	t.Run("undefined", func(t *testing.T) {
+		var observed []observedQuota
+		quota := stubQuota(func(iruntime.Options) (float64, bool, error) {
+			return -1, false, nil
+		})
+		undo, err := Set(quota, quotaRecorder(&observed))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, []observedQuota{{-1, false}}, observed)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var observed []observedQuota
+		buf, logOpt := testLogger()
+		quota := stubQuota(func(iruntime.Options) (float64, bool, error) {
+			return -1, false, errors.New("failed")
+		})
+		undo, err := Set(logOpt, quota, quotaRecorder(&observed))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Empty(t, observed, "shouldn't observe a quota that couldn't be read")
+		assert.Contains(t, buf.String(), "maxprocs: Couldn't read CPU quota: failed")
+	})
+}
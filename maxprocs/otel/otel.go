@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package otel records the decisions of maxprocs.Set on OpenTelemetry
+// spans, tying the GOMAXPROCS value a process started with to its startup
+// traces. It lives in its own module so that the core maxprocs package
+// doesn't depend on OpenTelemetry.
+//
+//	ctx, span := tracer.Start(ctx, "startup")
+//	undo, err := maxprocs.Set(otel.WithSpan(span))
+package otel // import "github.com/emadolsky/automaxprocs/maxprocs/otel"
+
+import (
+	"github.com/emadolsky/automaxprocs/maxprocs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EventName is the name of the span event recording a decision.
+const EventName = "maxprocs.decision"
+
+// Attribute keys describing a maxprocs.Decision.
+const (
+	GOMAXPROCSKey  = attribute.Key("maxprocs.gomaxprocs")
+	MinBindingKey  = attribute.Key("maxprocs.min_binding")
+	HostnameKey    = attribute.Key("maxprocs.hostname")
+	ContainerIDKey = attribute.Key("maxprocs.container_id")
+	TraceKey       = attribute.Key("maxprocs.trace")
+)
+
+// WithSpan records the Decision of Set on span, both as span attributes and
+// as an event named EventName.
+func WithSpan(span trace.Span) maxprocs.Option {
+	return maxprocs.OnDecision(func(d maxprocs.Decision) {
+		attrs := Attributes(d)
+		span.SetAttributes(attrs...)
+		span.AddEvent(EventName, trace.WithAttributes(attrs...))
+	})
+}
+
+// Attributes returns the attributes describing d. The hostname, container
+// ID and trace are omitted when they're empty.
+func Attributes(d maxprocs.Decision) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		GOMAXPROCSKey.Int(d.GOMAXPROCS),
+		MinBindingKey.Bool(d.MinBinding),
+	}
+	if d.Hostname != "" {
+		attrs = append(attrs, HostnameKey.String(d.Hostname))
+	}
+	if d.ContainerID != "" {
+		attrs = append(attrs, ContainerIDKey.String(d.ContainerID))
+	}
+	if len(d.Trace) > 0 {
+		steps := make([]string, len(d.Trace))
+		for i, step := range d.Trace {
+			steps[i] = step.String()
+		}
+		attrs = append(attrs, TraceKey.StringSlice(steps))
+	}
+	return attrs
+}
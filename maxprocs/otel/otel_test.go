@@ -0,0 +1,88 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package otel
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/emadolsky/automaxprocs/maxprocs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWithSpan(t *testing.T) {
+	if _, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		t.Skip("GOMAXPROCS is set in the environment")
+	}
+	if !maxprocs.Supported() {
+		t.Skip("CPU limit detection isn't supported on this OS")
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	_, span := tp.Tracer("test").Start(context.Background(), "startup")
+
+	undo, err := maxprocs.Set(WithSpan(span))
+	require.NoError(t, err, "Set failed")
+	defer undo()
+	span.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	want := GOMAXPROCSKey.Int(runtime.GOMAXPROCS(0))
+	assert.Contains(t, spans[0].Attributes(), want)
+	assert.Contains(t, spans[0].Attributes(), MinBindingKey.Bool(false))
+
+	events := spans[0].Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, EventName, events[0].Name)
+	assert.Contains(t, events[0].Attributes, want)
+}
+
+func TestAttributes(t *testing.T) {
+	assert.Equal(t, []attribute.KeyValue{
+		GOMAXPROCSKey.Int(2),
+		MinBindingKey.Bool(false),
+	}, Attributes(maxprocs.Decision{GOMAXPROCS: 2}))
+
+	assert.Equal(t, []attribute.KeyValue{
+		GOMAXPROCSKey.Int(4),
+		MinBindingKey.Bool(true),
+		HostnameKey.String("node-1"),
+		ContainerIDKey.String("abcdef"),
+		TraceKey.StringSlice([]string{"quota=0.5 (CPU quota)", "minClamped=4 (Min(4))"}),
+	}, Attributes(maxprocs.Decision{
+		GOMAXPROCS:  4,
+		MinBinding:  true,
+		Hostname:    "node-1",
+		ContainerID: "abcdef",
+		Trace: []maxprocs.Step{
+			{Stage: maxprocs.StageQuota, Source: "CPU quota", Value: 0.5},
+			{Stage: maxprocs.StageMinClamped, Source: "Min(4)", Value: 4},
+		},
+	}))
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+// ReactToMemoryPSI halves GOMAXPROCS while the memory pressure of the
+// process exceeds threshold, the percentage of time some of its tasks were
+// stalled on memory over the last 10 seconds, as reported by the cgroup2
+// `memory.pressure` file. Fewer Ps mean less concurrent work, including
+// garbage collection, competing for memory. The cap never lowers GOMAXPROCS
+// below the minimum, and Set logs when it binds.
+//
+// This option is experimental. The pressure is read once per detection, so
+// GOMAXPROCS is only restored by the next detection after the pressure
+// subsided, i.e. once Set runs again or on the next tick of Watch. No cap
+// applies without cgroup2 or pressure stall information.
+// Disabled by default; values of zero or less disable it.
+func ReactToMemoryPSI(threshold float64) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.psiThreshold = threshold
+	})
+}
+
+// capByPressure halves maxProcs if the memory pressure exceeds the threshold
+// set with ReactToMemoryPSI. It returns the pressure read and true if the cap
+// changed maxProcs.
+func (c *config) capByPressure(maxProcs int) (int, float64, bool, error) {
+	if c.psiThreshold <= 0 {
+		return maxProcs, 0, false, nil
+	}
+
+	pressure, defined, err := c.memoryPressure(c.runtimeOptions())
+	if err != nil || !defined || pressure <= c.psiThreshold {
+		return maxProcs, pressure, false, err
+	}
+
+	procs := maxProcs / 2
+	if procs < c.minGOMAXPROCS {
+		procs = c.minGOMAXPROCS
+	}
+	if procs >= maxProcs {
+		return maxProcs, pressure, false, nil
+	}
+	return procs, pressure, true, nil
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubMemoryPressure(pressure float64, defined bool, err error, calls *int) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.memoryPressure = func(iruntime.Options) (float64, bool, error) {
+			*calls++
+			return pressure, defined, err
+		}
+	})
+}
+
+func TestReactToMemoryPSI(t *testing.T) {
+	quotaOpt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 8, iruntime.CPUQuotaUsed, nil
+	})
+
+	testTable := []struct {
+		name             string
+		threshold        float64
+		pressure         float64
+		undefined        bool
+		opts             []Option
+		expectedMaxProcs int
+		expectedCalls    int
+		expectedLog      string
+	}{
+		{
+			name:             "disabled",
+			pressure:         90,
+			expectedMaxProcs: 8,
+			expectedCalls:    0,
+			expectedLog:      "determined from CPU quota",
+		},
+		{
+			name:             "above-threshold",
+			threshold:        10,
+			pressure:         25.5,
+			expectedMaxProcs: 4,
+			expectedCalls:    1,
+			expectedLog:      "Updating GOMAXPROCS=4: halved under memory pressure of 25.5%, above 10%",
+		},
+		{
+			name:             "at-threshold",
+			threshold:        10,
+			pressure:         10,
+			expectedMaxProcs: 8,
+			expectedCalls:    1,
+			expectedLog:      "determined from CPU quota",
+		},
+		{
+			name:             "below-min",
+			threshold:        10,
+			pressure:         50,
+			opts:             []Option{Min(6)},
+			expectedMaxProcs: 6,
+			expectedCalls:    1,
+			expectedLog:      "Updating GOMAXPROCS=6: halved under memory pressure",
+		},
+		{
+			name:             "at-min",
+			threshold:        10,
+			pressure:         50,
+			opts:             []Option{Min(8)},
+			expectedMaxProcs: 8,
+			expectedCalls:    1,
+			expectedLog:      "determined from CPU quota",
+		},
+		{
+			name:             "no-psi",
+			threshold:        10,
+			undefined:        true,
+			expectedMaxProcs: 8,
+			expectedCalls:    1,
+			expectedLog:      "determined from CPU quota",
+		},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			buf, logOpt := testLogger()
+			opts := append([]Option{
+				logOpt,
+				quotaOpt,
+				stubMemoryPressure(tt.pressure, !tt.undefined, nil, &calls),
+				ReactToMemoryPSI(tt.threshold),
+			}, tt.opts...)
+			undo, err := Set(opts...)
+			defer undo()
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, tt.expectedMaxProcs, currentMaxProcs(), "unexpected GOMAXPROCS")
+			assert.Equal(t, tt.expectedCalls, calls, "unexpected memory pressure reads")
+			assert.Contains(t, buf.String(), tt.expectedLog, "unexpected log output")
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		calls := 0
+		prev := currentMaxProcs()
+		undo, err := Set(quotaOpt, stubMemoryPressure(0, false, errors.New("failed"), &calls), ReactToMemoryPSI(10))
+		defer undo()
+		assert.Error(t, err, "Set should fail if the memory pressure can't be read")
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+	})
+
+	t.Run("fixture", func(t *testing.T) {
+		// v2-pressure has a quota of 3 CPUs and a memory pressure of 42%.
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2-pressure")
+		undo, err := Set(RootPrefix(prefix), UseSchedAffinity(false), ReactToMemoryPSI(20))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, 1, currentMaxProcs(), "unexpected GOMAXPROCS")
+
+		d, ok := LastDecision()
+		require.True(t, ok)
+		assert.Contains(t, d.Trace, Step{Stage: StagePressureCapped, Source: "ReactToMemoryPSI(20)", Value: 1})
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// PrintDecision runs detection with the given options and writes a
+// human-readable report to w: the package version, the GOMAXPROCS value Set
+// would apply and how it's derived, the problems reported by Validate, and
+// the cgroup and proc files detection reads, with their content, as returned
+// by Snapshot. It never changes GOMAXPROCS, which makes it suitable for a
+// hidden command-line flag, such as --print-maxprocs, to diagnose a process
+// from a shell in its container. Like Query, it doesn't record a Decision,
+// call OnDecision or count its reads in Stats.
+//
+// Failures to detect are part of the report. PrintDecision only returns an
+// error if writing to w fails.
+func PrintDecision(w io.Writer, opts ...Option) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "automaxprocs %s\n", Version)
+
+	cfg := newConfig(opts)
+	cfg.forQuery = true
+	current := currentMaxProcs()
+	if _, d, err := cfg.prepare(); err != nil {
+		fmt.Fprintf(&b, "GOMAXPROCS: %d in effect, detection failed: %v\n", current, err)
+	} else if d.GOMAXPROCS == 0 {
+		fmt.Fprintf(&b, "GOMAXPROCS: %d in effect, Set would leave it unchanged\n", current)
+	} else {
+		fmt.Fprintf(&b, "GOMAXPROCS: %d in effect, Set would apply %d\n", current, d.GOMAXPROCS)
+		b.WriteString("trace:\n")
+		for _, step := range d.Trace {
+			fmt.Fprintf(&b, "  %v\n", step)
+		}
+	}
+
+	problems := Validate(opts...)
+	if len(problems) == 0 {
+		b.WriteString("problems: none\n")
+	} else {
+		b.WriteString("problems:\n")
+		for _, p := range problems {
+			fmt.Fprintf(&b, "  %v\n", p)
+		}
+	}
+
+	if files, err := Snapshot(opts...); err == nil {
+		b.WriteString("files:\n")
+		for _, f := range files {
+			printFile(&b, f)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// printFile writes the name of f to b, followed by its content indented, or
+// why it couldn't be read.
+func printFile(b *strings.Builder, f File) {
+	switch {
+	case os.IsNotExist(f.Err):
+		fmt.Fprintf(b, "  %s (missing)\n", f.Name)
+	case f.Err != nil:
+		fmt.Fprintf(b, "  %s (error: %v)\n", f.Name, f.Err)
+	default:
+		fmt.Fprintf(b, "  %s\n", f.Name)
+		for _, line := range strings.SplitAfter(strings.TrimSuffix(string(f.Content), "\n"), "\n") {
+			fmt.Fprintf(b, "    %s\n", strings.TrimSuffix(line, "\n"))
+		}
+	}
+}
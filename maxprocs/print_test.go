@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("failed") }
+
+func TestPrintDecision(t *testing.T) {
+	root := filepath.Join("..", "internal", "cgroups", "testdata", "root")
+	prev := currentMaxProcs()
+
+	t.Run("v2", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, PrintDecision(&buf, RootPrefix(filepath.Join(root, "v2")), UseSchedAffinity(false)))
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+
+		out := buf.String()
+		assert.Contains(t, out, "automaxprocs "+Version+"\n")
+		assert.Contains(t, out, fmt.Sprintf("GOMAXPROCS: %d in effect, Set would apply 3\n", prev))
+		assert.Contains(t, out, "trace:\n  quota=3 (CPU quota)\n")
+		assert.Contains(t, out, "problems: none\n")
+		assert.Contains(t, out, "  /sys/fs/cgroup/cpu.max\n    300000 100000\n")
+		assert.Contains(t, out, "  /sys/fs/cgroup/cpu.max.burst (missing)\n")
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, PrintDecision(&buf, RootPrefix(filepath.Join(root, "v2-root-cgroup"))))
+		assert.Contains(t, buf.String(), "Set would leave it unchanged\n")
+		assert.Contains(t, buf.String(), "problems:\n  quota-undefined: no CPU quota is set\n")
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		var buf bytes.Buffer
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return -1, iruntime.CPUQuotaUndefined, errors.New("unreadable")
+		})
+		require.NoError(t, PrintDecision(&buf, opt))
+		assert.Contains(t, buf.String(), "detection failed: unreadable\n")
+		assert.Contains(t, buf.String(), "detection-failed: unreadable\n")
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		Reset()
+		defer Reset()
+		var decided bool
+		onDecision := OnDecision(func(Decision) { decided = true })
+		failing := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return -1, iruntime.CPUQuotaUndefined, errors.New("unreadable")
+		})
+
+		var buf bytes.Buffer
+		require.NoError(t, PrintDecision(&buf, RootPrefix(filepath.Join(root, "v2")), UseSchedAffinity(false), onDecision))
+		require.NoError(t, PrintDecision(&buf, failing, onDecision))
+		assert.Equal(t, Counters{}, Stats(), "shouldn't count in Stats")
+		_, ok := LastDecision()
+		assert.False(t, ok, "shouldn't record a decision")
+		assert.False(t, decided, "shouldn't call OnDecision")
+	})
+
+	t.Run("write-error", func(t *testing.T) {
+		assert.Error(t, PrintDecision(failingWriter{}, RootPrefix(filepath.Join(root, "v2"))))
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"fmt"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+)
+
+// A Source tells where the GOMAXPROCS value reported by Query comes from.
+type Source int
+
+const (
+	// SourceRuntimeDefault means that Set would leave GOMAXPROCS at the
+	// runtime's default: no CPU quota or cpuset is defined, DeferToRuntime
+	// applies, or the CPU affinity mask, which the default already follows,
+	// allows fewer CPUs than the quota.
+	SourceRuntimeDefault Source = iota
+	// SourceEnv means that the GOMAXPROCS environment variable is set, so
+	// Set would honor it.
+	SourceEnv
+	// SourceCGroupQuota means that GOMAXPROCS is derived from the CPU
+	// quota, read from the cgroup or supplied with the CPU environment
+	// variable or CPUFile.
+	SourceCGroupQuota
+	// SourceCGroupCPUSet means that GOMAXPROCS is derived from the cpuset
+	// of the cgroup, because it allows fewer CPUs than the CPU quota or no
+	// quota is set.
+	SourceCGroupCPUSet
+)
+
+// String returns the name of s, e.g. "SourceEnv".
+func (s Source) String() string {
+	switch s {
+	case SourceRuntimeDefault:
+		return "SourceRuntimeDefault"
+	case SourceEnv:
+		return "SourceEnv"
+	case SourceCGroupQuota:
+		return "SourceCGroupQuota"
+	case SourceCGroupCPUSet:
+		return "SourceCGroupCPUSet"
+	default:
+		return fmt.Sprintf("Source(%d)", int(s))
+	}
+}
+
+// sourceOf returns the Source of a GOMAXPROCS value derived from the CPU
+// quota with the given status.
+func sourceOf(status iruntime.CPUQuotaStatus) Source {
+	switch status {
+	case iruntime.CPUSetUsed:
+		return SourceCGroupCPUSet
+	case iruntime.CPUAffinityUsed:
+		return SourceRuntimeDefault
+	default:
+		return SourceCGroupQuota
+	}
+}
+
+// Query runs the detection Set would run, with the same options, and
+// returns the GOMAXPROCS value Set would install along with where it comes
+// from, without changing GOMAXPROCS. When Set would leave GOMAXPROCS
+// unchanged, Query returns the value in effect. This lets programs log the
+// intended value at startup, or compare it with the value in effect to
+// detect drift.
+//
+// Unlike Set and Prepare, Query doesn't record a Decision, call OnDecision
+// or count its reads in Stats. If detection fails, it returns the error
+// along with the value in effect.
+func Query(opts ...Option) (int, Source, error) {
+	cfg := newConfig(opts)
+	cfg.forQuery = true
+	_, decision, err := cfg.prepare()
+	if err != nil {
+		return currentMaxProcs(), SourceRuntimeDefault, err
+	}
+	if decision.GOMAXPROCS == 0 {
+		maxProcs := currentMaxProcs()
+		if cfg.maxGOMAXPROCS > 0 && maxProcs > cfg.maxGOMAXPROCS {
+			maxProcs = cfg.maxGOMAXPROCS
+		}
+		return maxProcs, cfg.source, nil
+	}
+	return decision.GOMAXPROCS, cfg.source, nil
+}
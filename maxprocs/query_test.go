@@ -0,0 +1,104 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery(t *testing.T) {
+	testTable := []struct {
+		name             string
+		expectedMaxProcs int
+		expectedSource   Source
+	}{
+		{name: "v2", expectedMaxProcs: 3, expectedSource: SourceCGroupQuota},
+		{name: "v2-cpuset", expectedMaxProcs: 2, expectedSource: SourceCGroupCPUSet},
+		{name: "cpuset-only", expectedMaxProcs: 4, expectedSource: SourceCGroupCPUSet},
+	}
+
+	for _, tt := range testTable {
+		Reset()
+		prev := currentMaxProcs()
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", tt.name)
+		maxProcs, source, err := Query(RootPrefix(prefix), UseSchedAffinity(false))
+		require.NoError(t, err, "%v: Query failed", tt.name)
+		assert.Equal(t, tt.expectedMaxProcs, maxProcs, tt.name)
+		assert.Equal(t, tt.expectedSource, source, tt.name)
+		assert.Equal(t, prev, currentMaxProcs(), "%v: shouldn't alter GOMAXPROCS", tt.name)
+
+		_, ok := LastDecision()
+		assert.False(t, ok, "%v: shouldn't record a decision", tt.name)
+		assert.Equal(t, Counters{}, Stats(), "%v: shouldn't count in Stats", tt.name)
+	}
+
+	t.Run("matches Set", func(t *testing.T) {
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2")
+		maxProcs, _, err := Query(RootPrefix(prefix), UseSchedAffinity(false), Min(5))
+		require.NoError(t, err, "Query failed")
+		undo, err := Set(RootPrefix(prefix), UseSchedAffinity(false), Min(5))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, currentMaxProcs(), maxProcs)
+	})
+
+	t.Run("undefined", func(t *testing.T) {
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		maxProcs, source, err := Query(opt)
+		require.NoError(t, err, "Query failed")
+		assert.Equal(t, currentMaxProcs(), maxProcs)
+		assert.Equal(t, SourceRuntimeDefault, source)
+	})
+
+	t.Run("EnvVarPresent", func(t *testing.T) {
+		withMax(t, 42, func() {
+			maxProcs, source, err := Query()
+			require.NoError(t, err, "Query failed")
+			assert.Equal(t, currentMaxProcs(), maxProcs)
+			assert.Equal(t, SourceEnv, source)
+		})
+	})
+
+	t.Run("error", func(t *testing.T) {
+		Reset()
+		prev := currentMaxProcs()
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return 0, iruntime.CPUQuotaUndefined, errors.New("failed")
+		})
+		maxProcs, source, err := Query(opt)
+		assert.EqualError(t, err, "failed")
+		assert.Equal(t, prev, maxProcs)
+		assert.Equal(t, SourceRuntimeDefault, source)
+		assert.Equal(t, Counters{}, Stats(), "shouldn't count the failure in Stats")
+	})
+
+	assert.Equal(t, "SourceCGroupCPUSet", SourceCGroupCPUSet.String())
+	assert.Equal(t, "Source(42)", Source(42).String())
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import "fmt"
+
+// A Reason tells why Set chose the GOMAXPROCS value it logged. Each Reason
+// has a single log message, which is derived from it, so programs can
+// switch on Result.Code instead of matching the log output.
+type Reason int
+
+const (
+	// ReasonError means that detection failed, so GOMAXPROCS was left
+	// unchanged.
+	ReasonError Reason = iota
+	// ReasonEnvOverride means that the GOMAXPROCS environment variable, or
+	// the one named with EnvVar, is set and was honored.
+	ReasonEnvOverride
+	// ReasonEnvOverrideCapped means that the GOMAXPROCS environment
+	// variable, or the one named with EnvVar, is set but exceeds Max, so
+	// GOMAXPROCS was lowered to Max.
+	ReasonEnvOverrideCapped
+	// ReasonRuntimeDefault means that GOMAXPROCS was left at the Go
+	// runtime's container-aware default, with DeferToRuntime.
+	ReasonRuntimeDefault
+	// ReasonQuotaUndefined means that no CPU quota is defined, so
+	// GOMAXPROCS was left unchanged.
+	ReasonQuotaUndefined
+	// ReasonQuotaUndefinedCapped means that no CPU quota is defined and
+	// GOMAXPROCS was lowered to Max.
+	ReasonQuotaUndefinedCapped
+	// ReasonControllerUnavailable means that the cpu controller isn't
+	// enabled for the cgroup, so GOMAXPROCS was left unchanged.
+	ReasonControllerUnavailable
+	// ReasonControllerUnavailableCapped means that the cpu controller isn't
+	// enabled for the cgroup and GOMAXPROCS was lowered to Max.
+	ReasonControllerUnavailableCapped
+	// ReasonQuotaApplied means that GOMAXPROCS was derived from the CPU
+	// quota, read from the cgroup or supplied with the CPU environment
+	// variable or CPUFile.
+	ReasonQuotaApplied
+	// ReasonMinClamp means that the CPU quota is below the minimum, so
+	// GOMAXPROCS was raised to it.
+	ReasonMinClamp
+	// ReasonMaxClamp means that GOMAXPROCS was lowered to Max.
+	ReasonMaxClamp
+	// ReasonAffinity means that GOMAXPROCS was limited by the CPU affinity
+	// mask.
+	ReasonAffinity
+	// ReasonCPUSet means that GOMAXPROCS was limited by the cpuset of the
+	// cgroup.
+	ReasonCPUSet
+	// ReasonCPUSetMax means that GOMAXPROCS was derived from the cpuset of
+	// the cgroup, with SourceMax.
+	ReasonCPUSetMax
+	// ReasonMemoryLimit means that GOMAXPROCS was limited by the memory
+	// limit, with BalanceWithMemory.
+	ReasonMemoryLimit
+	// ReasonNUMA means that GOMAXPROCS was limited by the NUMA nodes the
+	// process may run on, with NUMANodes.
+	ReasonNUMA
+	// ReasonMemoryPressure means that GOMAXPROCS was halved under memory
+	// pressure, with ReactToMemoryPSI.
+	ReasonMemoryPressure
+	// ReasonAdjusted means that GOMAXPROCS was changed by the function set
+	// with Adjust.
+	ReasonAdjusted
+	// ReasonNoDowngrade means that GOMAXPROCS was left unchanged because
+	// NoDowngrade suppressed lowering it, to the value derived from the CPU
+	// quota or to Max.
+	ReasonNoDowngrade
+	// ReasonConflict means that GOMAXPROCS was left unchanged because it
+	// changed since detection started, with CompareAndSet.
+	ReasonConflict
+	// ReasonRuntimeDefaultCapped means that the Go runtime's
+	// container-aware default exceeds Max, so GOMAXPROCS was lowered to Max
+	// despite DeferToRuntime.
+	ReasonRuntimeDefaultCapped
+)
+
+// _reasons holds the name of each Reason and the format of the line logged
+// for it.
+var _reasons = [...]struct {
+	name   string
+	format string
+}{
+	ReasonError:                       {"ReasonError", ""},
+	ReasonEnvOverride:                 {"ReasonEnvOverride", "maxprocs: Honoring %s=%q as set in environment"},
+	ReasonEnvOverrideCapped:           {"ReasonEnvOverrideCapped", "maxprocs: Updating GOMAXPROCS=%v: %s=%q set in environment exceeds Max(%d)"},
+	ReasonRuntimeDefault:              {"ReasonRuntimeDefault", "maxprocs: Leaving GOMAXPROCS=%v: deferring to the Go runtime's container-aware default"},
+	ReasonQuotaUndefined:              {"ReasonQuotaUndefined", "maxprocs: Leaving GOMAXPROCS=%v: CPU quota undefined; consider setting a CPU limit"},
+	ReasonQuotaUndefinedCapped:        {"ReasonQuotaUndefinedCapped", "maxprocs: Updating GOMAXPROCS=%v: CPU quota undefined, limited by Max(%d)"},
+	ReasonControllerUnavailable:       {"ReasonControllerUnavailable", "maxprocs: Leaving GOMAXPROCS=%v: cpu controller unavailable"},
+	ReasonControllerUnavailableCapped: {"ReasonControllerUnavailableCapped", "maxprocs: Updating GOMAXPROCS=%v: cpu controller unavailable, limited by Max(%d)"},
+	ReasonQuotaApplied:                {"ReasonQuotaApplied", "maxprocs: Updating GOMAXPROCS=%v: determined from %s"},
+	ReasonMinClamp:                    {"ReasonMinClamp", "maxprocs: Updating GOMAXPROCS=%v: using minimum allowed GOMAXPROCS, CPU quota is below it"},
+	ReasonMaxClamp:                    {"ReasonMaxClamp", "maxprocs: Updating GOMAXPROCS=%v: limited by Max(%d)"},
+	ReasonAffinity:                    {"ReasonAffinity", "maxprocs: Updating GOMAXPROCS=%v: limited by CPU affinity"},
+	ReasonCPUSet:                      {"ReasonCPUSet", "maxprocs: Updating GOMAXPROCS=%v: limited by cpuset"},
+	ReasonCPUSetMax:                   {"ReasonCPUSetMax", "maxprocs: Updating GOMAXPROCS=%v: determined from cpuset with SourceMax"},
+	ReasonMemoryLimit:                 {"ReasonMemoryLimit", "maxprocs: Updating GOMAXPROCS=%v: limited by memory limit"},
+	ReasonNUMA:                        {"ReasonNUMA", "maxprocs: Updating GOMAXPROCS=%v: limited by %d NUMA node(s)"},
+	ReasonMemoryPressure:              {"ReasonMemoryPressure", "maxprocs: Updating GOMAXPROCS=%v: halved under memory pressure of %v%%, above %v%%"},
+	ReasonAdjusted:                    {"ReasonAdjusted", "maxprocs: Updating GOMAXPROCS=%v: adjusted from %v"},
+	ReasonNoDowngrade:                 {"ReasonNoDowngrade", "maxprocs: Leaving GOMAXPROCS=%v: NoDowngrade suppressed lowering it to %v"},
+	ReasonConflict:                    {"ReasonConflict", "maxprocs: Leaving GOMAXPROCS=%v: changed from %v since detection started, not applying %v"},
+	ReasonRuntimeDefaultCapped:        {"ReasonRuntimeDefaultCapped", "maxprocs: Updating GOMAXPROCS=%v: Go runtime's container-aware default exceeds Max(%d)"},
+}
+
+// String returns the name of r, e.g. "ReasonQuotaApplied".
+func (r Reason) String() string {
+	if r < 0 || int(r) >= len(_reasons) {
+		return fmt.Sprintf("Reason(%d)", int(r))
+	}
+	return _reasons[r].name
+}
+
+// format returns the format of the line logged for r.
+func (r Reason) format() string {
+	return _reasons[r].format
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReasonString(t *testing.T) {
+	tests := []struct {
+		reason Reason
+		want   string
+	}{
+		{ReasonError, "ReasonError"},
+		{ReasonQuotaApplied, "ReasonQuotaApplied"},
+		{ReasonConflict, "ReasonConflict"},
+		{Reason(-1), "Reason(-1)"},
+		{ReasonRuntimeDefaultCapped, "ReasonRuntimeDefaultCapped"},
+		{ReasonRuntimeDefaultCapped + 1, "Reason(21)"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.reason.String())
+	}
+
+	for r := ReasonEnvOverride; r <= ReasonRuntimeDefaultCapped; r++ {
+		assert.True(t, strings.HasPrefix(r.format(), "maxprocs: "), "no log line for %v", r)
+	}
+}
+
+func TestReasonLogged(t *testing.T) {
+	buf, logOpt := testLogger()
+	prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2")
+	result, undo, err := SetWithResult(logOpt, RootPrefix(prefix), UseSchedAffinity(false), Max(2))
+	defer undo()
+	require.NoError(t, err, "SetWithResult failed")
+	assert.Equal(t, ReasonMaxClamp, result.Code)
+	assert.Equal(t, "Updating GOMAXPROCS=2: limited by Max(2)", result.Reason)
+	assert.Contains(t, buf.String(), "maxprocs: "+result.Reason)
+}
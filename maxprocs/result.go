@@ -0,0 +1,93 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Result describes what SetWithResult did.
+type Result struct {
+	// PrevGOMAXPROCS is the GOMAXPROCS value in effect before the call.
+	PrevGOMAXPROCS int
+	// GOMAXPROCS is the value in effect once the call returned.
+	GOMAXPROCS int
+	// Quota is the CPU quota detected, as a fraction of CPUs, e.g. 2.5,
+	// before rounding and whatever limited GOMAXPROCS further, such as the
+	// cpuset. It's -1 if no quota is defined, even if the cpuset limited
+	// GOMAXPROCS, or if the GOMAXPROCS environment variable is set. See
+	// Decision.Quota.
+	Quota float64
+	// Reason explains the decision, as logged, e.g. "Updating GOMAXPROCS=2:
+	// determined from CPU quota". It's empty if detection failed.
+	Reason string
+	// Code tells why GOMAXPROCS was chosen, e.g. ReasonQuotaApplied. Reason
+	// is its log message.
+	Code Reason
+}
+
+// SetWithResult is like Set, but also returns a Result describing the
+// decision, so that programs don't need to parse the log output to learn
+// the value chosen and the quota it was derived from.
+func SetWithResult(opts ...Option) (Result, func(), error) {
+	return setWithResult(context.Background(), opts)
+}
+
+// setWithResult implements SetWithResult, bounding the file reads by ctx.
+func setWithResult(ctx context.Context, opts []Option) (Result, func(), error) {
+	cfg := newConfig(opts)
+	// Contexts that are never done would only cost a goroutine per read.
+	if ctx.Done() != nil {
+		cfg.ctx = ctx
+	}
+	prev := currentMaxProcs()
+	result := Result{PrevGOMAXPROCS: prev, GOMAXPROCS: prev, Quota: -1, Code: ReasonError}
+
+	apply, decision, err := cfg.prepare()
+	if err != nil {
+		return result, cfg.undoNoop, err
+	}
+	maxProcs, undo, err := apply()
+	result.GOMAXPROCS = maxProcs
+	result.Quota = decision.Quota
+	result.Reason = cfg.reason
+	result.Code = cfg.code
+	return result, undo, err
+}
+
+// setReason records the decision being logged for Result.Reason and
+// Result.Code.
+func (c *config) setReason(reason Reason, args ...interface{}) {
+	c.code = reason
+	c.reason = strings.TrimPrefix(fmt.Sprintf(c.reasonFormat(reason), args...), "maxprocs: ")
+}
+
+// reasonFormat returns the format of the line logged for reason, which
+// reports the value as computed rather than applied with DryRun.
+func (c *config) reasonFormat(reason Reason) string {
+	format := reason.format()
+	if c.dryRun {
+		format = strings.Replace(format, _updatingPrefix, _dryRunPrefix, 1)
+	}
+	return format
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetWithResult(t *testing.T) {
+	t.Run("quota", func(t *testing.T) {
+		prev := currentMaxProcs()
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2")
+		result, undo, err := SetWithResult(RootPrefix(prefix), UseSchedAffinity(false))
+		defer undo()
+		require.NoError(t, err, "SetWithResult failed")
+		assert.Equal(t, Result{
+			PrevGOMAXPROCS: prev,
+			GOMAXPROCS:     3,
+			Quota:          3,
+			Reason:         "Updating GOMAXPROCS=3: determined from CPU quota",
+			Code:           ReasonQuotaApplied,
+		}, result)
+		assert.Equal(t, 3, currentMaxProcs())
+	})
+
+	t.Run("min", func(t *testing.T) {
+		opt := stubProcs(func(min int, round func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			maxProcs, status := iruntime.QuotaToGOMAXPROCS(0.5, min, round)
+			return maxProcs, status, nil
+		})
+		quotaOpt := stubQuota(func(iruntime.Options) (float64, bool, error) {
+			return 0.5, true, nil
+		})
+		result, undo, err := SetWithResult(opt, quotaOpt, Min(2))
+		defer undo()
+		require.NoError(t, err, "SetWithResult failed")
+		assert.Equal(t, 2, result.GOMAXPROCS)
+		assert.Equal(t, 0.5, result.Quota)
+		assert.Equal(t, "Updating GOMAXPROCS=2: using minimum allowed GOMAXPROCS, CPU quota is below it", result.Reason)
+		assert.Equal(t, ReasonMinClamp, result.Code)
+	})
+
+	t.Run("cpuset", func(t *testing.T) {
+		// v2-cpuset has a quota of 4 CPUs and a cpuset of 2 CPUs.
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2-cpuset")
+		result, undo, err := SetWithResult(RootPrefix(prefix), UseSchedAffinity(false))
+		defer undo()
+		require.NoError(t, err, "SetWithResult failed")
+		assert.Equal(t, 2, result.GOMAXPROCS)
+		assert.Equal(t, 4.0, result.Quota, "should report the quota, not the cpuset")
+		assert.Equal(t, ReasonCPUSet, result.Code)
+	})
+
+	t.Run("cpuset only", func(t *testing.T) {
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "cpuset-only")
+		result, undo, err := SetWithResult(RootPrefix(prefix), UseSchedAffinity(false))
+		defer undo()
+		require.NoError(t, err, "SetWithResult failed")
+		assert.Equal(t, 4, result.GOMAXPROCS)
+		assert.Equal(t, -1.0, result.Quota, "no quota is defined")
+		assert.Equal(t, ReasonCPUSet, result.Code)
+	})
+
+	t.Run("undefined", func(t *testing.T) {
+		prev := currentMaxProcs()
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		result, undo, err := SetWithResult(opt)
+		defer undo()
+		require.NoError(t, err, "SetWithResult failed")
+		assert.Equal(t, Result{
+			PrevGOMAXPROCS: prev,
+			GOMAXPROCS:     prev,
+			Quota:          -1,
+			Reason:         "Leaving GOMAXPROCS=" + strconv.Itoa(prev) + ": CPU quota undefined; consider setting a CPU limit",
+			Code:           ReasonQuotaUndefined,
+		}, result)
+	})
+
+	t.Run("EnvVarPresent", func(t *testing.T) {
+		withMax(t, 42, func() {
+			result, undo, err := SetWithResult()
+			defer undo()
+			require.NoError(t, err, "SetWithResult failed")
+			assert.Equal(t, -1.0, result.Quota)
+			assert.Equal(t, `Honoring GOMAXPROCS="42" as set in environment`, result.Reason)
+			assert.Equal(t, ReasonEnvOverride, result.Code)
+		})
+	})
+
+	t.Run("error", func(t *testing.T) {
+		prev := currentMaxProcs()
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return 0, iruntime.CPUQuotaUndefined, errors.New("failed")
+		})
+		result, undo, err := SetWithResult(opt)
+		defer undo()
+		assert.EqualError(t, err, "failed")
+		assert.Equal(t, Result{PrevGOMAXPROCS: prev, GOMAXPROCS: prev, Quota: -1, Code: ReasonError}, result)
+	})
+}
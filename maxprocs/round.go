@@ -0,0 +1,252 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+)
+
+// _defaultRoundFunc holds the function set by SetDefaultRoundFunc, or nil if
+// DefaultRoundFunc is used.
+var _defaultRoundFunc struct {
+	sync.RWMutex
+
+	f func(v float64) int
+}
+
+// SetDefaultRoundFunc changes the function Set, Prepare and the other
+// detection functions use to convert the CPU quota from float to int when no
+// RoundQuotaFunc option is supplied, e.g. to round up across a codebase
+// without passing RoundQuotaFunc at every call site. RoundQuotaFunc still
+// takes precedence. A nil function restores DefaultRoundFunc.
+//
+// The function applies process-wide and only to calls started afterwards, so
+// it should be set early, e.g. in an init function, before anything calls
+// Set.
+func SetDefaultRoundFunc(rf func(v float64) int) {
+	_defaultRoundFunc.Lock()
+	defer _defaultRoundFunc.Unlock()
+	_defaultRoundFunc.f = rf
+}
+
+// defaultRoundFunc returns the function set by SetDefaultRoundFunc, or
+// DefaultRoundFunc.
+func defaultRoundFunc() func(v float64) int {
+	_defaultRoundFunc.RLock()
+	defer _defaultRoundFunc.RUnlock()
+	if _defaultRoundFunc.f == nil {
+		return DefaultRoundFunc
+	}
+	return _defaultRoundFunc.f
+}
+
+// RoundFloor rounds the CPU quota down, like DefaultRoundFunc. It's to be
+// used with RoundQuotaFunc or SetDefaultRoundFunc, like RoundNearest and
+// RoundCeil. As with every rounding function, the minimum set with Min is
+// applied to the result, so a quota of 0.4 still yields 1 by default.
+func RoundFloor(v float64) int {
+	return DefaultRoundFunc(v)
+}
+
+// RoundNearest rounds the CPU quota to the nearest integer, rounding halves
+// up: 2.4 yields 2 and 2.5 yields 3.
+func RoundNearest(v float64) int {
+	return int(math.Floor(v + 0.5))
+}
+
+// RoundCeil rounds the CPU quota up, so that a quota of 2.5 CPUs yields 3
+// rather than leaving half a CPU unused. Rounding up never goes beyond the
+// CPUs the process may run on: the result is capped at the size of its CPU
+// affinity mask, or at runtime.NumCPU() if the mask can't be read, so that a
+// quota of 8.5 CPUs yields 8 on an 8-CPU host. Use Max to bound the result
+// further.
+func RoundCeil(v float64) int {
+	procs := int(math.Ceil(v))
+	if cpus := _usableCPUs(); procs > cpus {
+		return cpus
+	}
+	return procs
+}
+
+// _usableCPUs returns the number of CPUs RoundCeil caps its result at. It's
+// a variable so that tests can stub the CPUs of the host.
+var _usableCPUs = usableCPUs
+
+// usableCPUs returns the number of CPUs in the affinity mask of the process,
+// or runtime.NumCPU() if it can't be read.
+func usableCPUs() int {
+	if cpus, err := iruntime.SchedAffinityCPUs(); err == nil && cpus > 0 {
+		return cpus
+	}
+	return runtime.NumCPU()
+}
+
+// A RoundingMode selects how Rounding converts the CPU quota from float to
+// int.
+type RoundingMode int
+
+const (
+	// Floor rounds the CPU quota down, like RoundFloor.
+	Floor RoundingMode = iota
+	// Ceil rounds the CPU quota up, like RoundCeil.
+	Ceil
+	// Nearest rounds the CPU quota to the nearest integer, like
+	// RoundNearest.
+	Nearest
+)
+
+// String returns the name of m, e.g. "Ceil".
+func (m RoundingMode) String() string {
+	switch m {
+	case Floor:
+		return "Floor"
+	case Ceil:
+		return "Ceil"
+	case Nearest:
+		return "Nearest"
+	default:
+		return fmt.Sprintf("RoundingMode(%d)", int(m))
+	}
+}
+
+// roundFunc returns the rounding function of m, or nil if m is unknown.
+func (m RoundingMode) roundFunc() func(v float64) int {
+	switch m {
+	case Floor:
+		return RoundFloor
+	case Ceil:
+		return RoundCeil
+	case Nearest:
+		return RoundNearest
+	default:
+		return nil
+	}
+}
+
+// Rounding selects one of the built-in ways to convert the CPU quota from
+// float to int, e.g. Set(Rounding(Ceil)), as a simpler alternative to
+// RoundQuotaFunc for configuration-driven setups. RoundQuotaFunc overrides
+// Rounding if both are supplied, whatever their order, while Rounding
+// overrides the function set with SetDefaultRoundFunc. Set returns an error
+// for an unknown mode. Without either option, the CPU quota is rounded as
+// with Floor, unless SetDefaultRoundFunc was called.
+func Rounding(mode RoundingMode) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.rounding = &mode
+	})
+}
+
+// WithFloorRounding is a shorthand for Rounding(Floor).
+func WithFloorRounding() Option {
+	return Rounding(Floor)
+}
+
+// WithCeilRounding is a shorthand for Rounding(Ceil).
+func WithCeilRounding() Option {
+	return Rounding(Ceil)
+}
+
+// WithNearestRounding is a shorthand for Rounding(Nearest).
+func WithNearestRounding() Option {
+	return Rounding(Nearest)
+}
+
+// _roundFuncs maps the names accepted by RoundFuncByName to the rounding
+// functions they select, named after the RoundingMode of each.
+var _roundFuncs = map[string]func(v float64) int{
+	"floor":   RoundFloor,
+	"ceil":    RoundCeil,
+	"nearest": RoundNearest,
+}
+
+// _roundUpWithTolerancePrefix prefixes the tolerance in the names of
+// RoundUpWithTolerance functions accepted by RoundFuncByName.
+const _roundUpWithTolerancePrefix = "ceil:"
+
+// RoundFuncByName returns the built-in rounding function with the given
+// name, to be used with RoundQuotaFunc or SetDefaultRoundFunc, so that
+// programs can let their configuration pick the rounding policy:
+//
+//	floor      RoundFloor, which rounds the CPU quota down
+//	ceil       RoundCeil, which rounds it up
+//	nearest    RoundNearest, which rounds it to the nearest integer
+//	ceil:EPS   RoundUpWithTolerance(EPS), e.g. "ceil:0.05"
+//
+// It returns false if name is unknown or the tolerance is invalid.
+func RoundFuncByName(name string) (func(v float64) int, bool) {
+	if rf, ok := _roundFuncs[name]; ok {
+		return rf, true
+	}
+	if !strings.HasPrefix(name, _roundUpWithTolerancePrefix) {
+		return nil, false
+	}
+	eps, err := strconv.ParseFloat(strings.TrimPrefix(name, _roundUpWithTolerancePrefix), 64)
+	if err != nil || !(eps >= 0 && eps < 1) {
+		return nil, false
+	}
+	return RoundUpWithTolerance(eps), true
+}
+
+// RoundFuncNames returns the names RoundFuncByName accepts without a
+// parameter, sorted, e.g. to validate a configuration or list the choices in
+// its documentation.
+func RoundFuncNames() []string {
+	names := make([]string, 0, len(_roundFuncs))
+	for name := range _roundFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DiminishingReturns returns a function, to be used with RoundQuotaFunc,
+// that lets GOMAXPROCS follow the CPU quota up to knee and grow by only
+// slope per CPU of quota beyond it, for workloads that scale poorly at high
+// core counts: with knee = 8 and slope = 0.75, quotas of 4 and 8 yield 4 and
+// 8, but 16 yields 14 and 40 yields 32. The result is rounded to the nearest
+// integer, rounding halves up, and is at least 1. It panics if knee is less
+// than 1 or slope isn't in (0, 1].
+func DiminishingReturns(knee, slope float64) func(v float64) int {
+	if !(knee >= 1) || math.IsInf(knee, 0) {
+		panic(fmt.Sprintf("maxprocs: knee %v must be at least 1", knee))
+	}
+	if !(slope > 0 && slope <= 1) {
+		panic(fmt.Sprintf("maxprocs: slope %v must be in (0, 1]", slope))
+	}
+	return func(v float64) int {
+		if v > knee {
+			v = knee + (v-knee)*slope
+		}
+		procs := int(math.Floor(v + 0.5))
+		if procs < 1 {
+			return 1
+		}
+		return procs
+	}
+}
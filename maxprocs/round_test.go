@@ -0,0 +1,267 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ceil(v float64) int { return int(math.Ceil(v)) }
+
+func withDefaultRoundFunc(rf func(v float64) int, f func()) {
+	SetDefaultRoundFunc(rf)
+	defer SetDefaultRoundFunc(nil)
+	f()
+}
+
+// stubUsableCPUs makes RoundCeil cap its result at cpus until the test ends.
+func stubUsableCPUs(t *testing.T, cpus int) {
+	prev := _usableCPUs
+	_usableCPUs = func() int { return cpus }
+	t.Cleanup(func() { _usableCPUs = prev })
+}
+
+func TestSetDefaultRoundFunc(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		assert.Equal(t, 2, Simulate(2.5, 8).GOMAXPROCS, "should round down by default")
+	})
+
+	t.Run("Global", func(t *testing.T) {
+		withDefaultRoundFunc(ceil, func() {
+			assert.Equal(t, 3, Simulate(2.5, 8).GOMAXPROCS, "should use the default round func")
+
+			opt := stubProcs(func(minValue int, round func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+				maxProcs, status := iruntime.QuotaToGOMAXPROCS(1.2, minValue, round)
+				return maxProcs, status, nil
+			})
+			undo, err := Set(opt)
+			defer undo()
+			require.NoError(t, err, "Set failed")
+			assert.Equal(t, 2, currentMaxProcs(), "Set should use the default round func")
+		})
+	})
+
+	t.Run("Option", func(t *testing.T) {
+		withDefaultRoundFunc(ceil, func() {
+			assert.Equal(t, 2, Simulate(2.5, 8, RoundQuotaFunc(DefaultRoundFunc)).GOMAXPROCS, "RoundQuotaFunc should take precedence")
+		})
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		SetDefaultRoundFunc(ceil)
+		SetDefaultRoundFunc(nil)
+		assert.Equal(t, 2, Simulate(2.5, 8).GOMAXPROCS, "nil should restore DefaultRoundFunc")
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		defer SetDefaultRoundFunc(nil)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					if i%2 == 0 {
+						SetDefaultRoundFunc(ceil)
+						continue
+					}
+					procs := Simulate(2.5, 8).GOMAXPROCS
+					assert.True(t, procs == 2 || procs == 3, "unexpected GOMAXPROCS=%v", procs)
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+}
+
+func TestRoundFuncByName(t *testing.T) {
+	stubUsableCPUs(t, 8)
+	assert.Equal(t, []string{"ceil", "floor", "nearest"}, RoundFuncNames())
+	for _, name := range RoundFuncNames() {
+		rf, ok := RoundFuncByName(name)
+		assert.True(t, ok, "%q should be registered", name)
+		assert.NotNil(t, rf, name)
+	}
+
+	testTable := []struct {
+		name     string
+		quota    float64
+		expected int
+	}{
+		{name: "floor", quota: 2.9, expected: 2},
+		{name: "floor", quota: 3, expected: 3},
+		{name: "ceil", quota: 2.1, expected: 3},
+		{name: "ceil", quota: 3, expected: 3},
+		{name: "ceil", quota: 0.2, expected: 1},
+		{name: "nearest", quota: 2.4, expected: 2},
+		{name: "nearest", quota: 2.5, expected: 3},
+		{name: "ceil:0.05", quota: 2.04, expected: 2},
+		{name: "ceil:0.05", quota: 2.06, expected: 3},
+		{name: "ceil:0", quota: 2.01, expected: 3},
+	}
+	for _, tt := range testTable {
+		rf, ok := RoundFuncByName(tt.name)
+		require.True(t, ok, tt.name)
+		assert.Equal(t, tt.expected, rf(tt.quota), "%v(%v)", tt.name, tt.quota)
+	}
+
+	for _, name := range []string{"", "down", "up", "Floor", "up:0.05", "ceil:", "ceil:1", "ceil:-0.1", "ceil:NaN", "ceil:two"} {
+		rf, ok := RoundFuncByName(name)
+		assert.False(t, ok, "%q shouldn't be accepted", name)
+		assert.Nil(t, rf, name)
+	}
+}
+
+func TestRounding(t *testing.T) {
+	stubUsableCPUs(t, 8)
+	testTable := []struct {
+		mode     RoundingMode
+		quota    float64
+		expected int
+	}{
+		{mode: Floor, quota: 2.5, expected: 2},
+		{mode: Floor, quota: 2.9, expected: 2},
+		{mode: Floor, quota: 3, expected: 3},
+		{mode: Ceil, quota: 2.1, expected: 3},
+		{mode: Ceil, quota: 3, expected: 3},
+		{mode: Ceil, quota: 0.2, expected: 1},
+		{mode: Nearest, quota: 2.4, expected: 2},
+		{mode: Nearest, quota: 2.5, expected: 3},
+		{mode: Nearest, quota: 3, expected: 3},
+	}
+	for _, tt := range testTable {
+		assert.Equal(t, tt.expected, Simulate(tt.quota, 0, Rounding(tt.mode)).GOMAXPROCS, "%v(%v)", tt.mode, tt.quota)
+	}
+
+	t.Run("shorthands", func(t *testing.T) {
+		assert.Equal(t, 2, Simulate(2.5, 0, WithFloorRounding()).GOMAXPROCS)
+		assert.Equal(t, 3, Simulate(2.1, 0, WithCeilRounding()).GOMAXPROCS)
+		assert.Equal(t, 3, Simulate(2.5, 0, WithNearestRounding()).GOMAXPROCS)
+		assert.Equal(t, 1, Simulate(0.4, 0, WithFloorRounding(), Min(1)).GOMAXPROCS, "the minimum should apply after rounding")
+	})
+
+	t.Run("RoundQuotaFunc precedence", func(t *testing.T) {
+		assert.Equal(t, 2, Simulate(2.5, 0, RoundQuotaFunc(DefaultRoundFunc), Rounding(Ceil)).GOMAXPROCS)
+		assert.Equal(t, 2, Simulate(2.5, 0, Rounding(Ceil), RoundQuotaFunc(DefaultRoundFunc)).GOMAXPROCS)
+	})
+
+	t.Run("default round func", func(t *testing.T) {
+		withDefaultRoundFunc(ceil, func() {
+			assert.Equal(t, 2, Simulate(2.5, 0, Rounding(Floor)).GOMAXPROCS, "Rounding should override the default")
+		})
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		prev := currentMaxProcs()
+		undo, err := Set(Rounding(RoundingMode(42)))
+		defer undo()
+		assert.EqualError(t, err, "maxprocs: unknown rounding mode RoundingMode(42)")
+		assert.Equal(t, prev, currentMaxProcs())
+	})
+
+	assert.Equal(t, []string{"Floor", "Ceil", "Nearest"}, []string{Floor.String(), Ceil.String(), Nearest.String()})
+}
+
+func TestRoundFuncs(t *testing.T) {
+	stubUsableCPUs(t, 8)
+	testTable := []struct {
+		name     string
+		rf       func(v float64) int
+		quota    float64
+		expected int
+	}{
+		{name: "RoundFloor", rf: RoundFloor, quota: 2.5, expected: 2},
+		{name: "RoundFloor", rf: RoundFloor, quota: 3, expected: 3},
+		{name: "RoundFloor", rf: RoundFloor, quota: 0.4, expected: 1},
+		{name: "RoundNearest", rf: RoundNearest, quota: 2.4, expected: 2},
+		{name: "RoundNearest", rf: RoundNearest, quota: 2.5, expected: 3},
+		{name: "RoundNearest", rf: RoundNearest, quota: 0.4, expected: 1},
+		{name: "RoundCeil", rf: RoundCeil, quota: 2.1, expected: 3},
+		{name: "RoundCeil", rf: RoundCeil, quota: 3, expected: 3},
+		{name: "RoundCeil", rf: RoundCeil, quota: 0.4, expected: 1},
+		{name: "RoundCeil", rf: RoundCeil, quota: 7.5, expected: 8},
+		{name: "RoundCeil", rf: RoundCeil, quota: 8.5, expected: 8},
+		{name: "RoundCeil", rf: RoundCeil, quota: 12, expected: 8},
+	}
+	for _, tt := range testTable {
+		assert.Equal(t, tt.expected, Simulate(tt.quota, 0, RoundQuotaFunc(tt.rf)).GOMAXPROCS, "%v(%v)", tt.name, tt.quota)
+	}
+
+	// The minimum is applied after rounding.
+	assert.Equal(t, 2, Simulate(0.4, 0, RoundQuotaFunc(RoundFloor), Min(2)).GOMAXPROCS)
+	// Rounding down doesn't depend on the CPUs of the host.
+	assert.Equal(t, 12, Simulate(12.5, 0, RoundQuotaFunc(RoundFloor)).GOMAXPROCS)
+}
+
+func TestRoundCeilUsableCPUs(t *testing.T) {
+	cpus := usableCPUs()
+	assert.True(t, cpus >= 1 && cpus <= runtime.NumCPU(), "unexpected CPU count %d", cpus)
+	assert.Equal(t, cpus, RoundCeil(float64(runtime.NumCPU())+0.5), "should cap at the usable CPUs")
+	assert.Equal(t, cpus, Simulate(float64(cpus)+0.5, 0, Rounding(Ceil)).GOMAXPROCS, "Rounding(Ceil) should cap too")
+}
+
+func TestDiminishingReturns(t *testing.T) {
+	testTable := []struct {
+		knee     float64
+		slope    float64
+		quota    float64
+		expected int
+	}{
+		{knee: 8, slope: 0.75, quota: 0.3, expected: 1},
+		{knee: 8, slope: 0.75, quota: 2.4, expected: 2},
+		{knee: 8, slope: 0.75, quota: 2.5, expected: 3},
+		{knee: 8, slope: 0.75, quota: 8, expected: 8},
+		{knee: 8, slope: 0.75, quota: 9, expected: 9},
+		{knee: 8, slope: 0.75, quota: 12, expected: 11},
+		{knee: 8, slope: 0.75, quota: 16, expected: 14},
+		{knee: 8, slope: 0.75, quota: 40, expected: 32},
+		{knee: 8, slope: 1, quota: 40, expected: 40},
+		{knee: 1, slope: 0.5, quota: 1, expected: 1},
+		{knee: 1, slope: 0.5, quota: 9, expected: 5},
+	}
+	for _, tt := range testTable {
+		round := DiminishingReturns(tt.knee, tt.slope)
+		assert.Equal(t, tt.expected, round(tt.quota), "knee=%v slope=%v quota=%v", tt.knee, tt.slope, tt.quota)
+	}
+
+	for _, tt := range []struct{ knee, slope float64 }{
+		{knee: 0.5, slope: 0.75},
+		{knee: math.NaN(), slope: 0.75},
+		{knee: math.Inf(1), slope: 0.75},
+		{knee: 8, slope: 0},
+		{knee: 8, slope: -0.5},
+		{knee: 8, slope: 1.5},
+		{knee: 8, slope: math.NaN()},
+	} {
+		assert.Panics(t, func() { DiminishingReturns(tt.knee, tt.slope) }, "knee=%v slope=%v", tt.knee, tt.slope)
+	}
+
+	assert.Equal(t, 14, Simulate(16, 0, RoundQuotaFunc(DiminishingReturns(8, 0.75))).GOMAXPROCS)
+}
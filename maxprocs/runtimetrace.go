@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"context"
+	"fmt"
+	"runtime/trace"
+	"strings"
+)
+
+// _traceCategory is the category of the runtime trace log events emitted by
+// WithRuntimeTrace.
+const _traceCategory = "automaxprocs"
+
+// WithRuntimeTrace logs every Decision to the runtime trace with trace.Log,
+// under the "automaxprocs" category, so that the GOMAXPROCS choice shows up
+// on the timeline of go tool trace. The event is attached to the task of the
+// Context option, if any. It's a no-op while tracing isn't active. Disabled
+// by default.
+func WithRuntimeTrace(enabled bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.runtimeTrace = enabled
+	})
+}
+
+// traceDecision logs d to the runtime trace if WithRuntimeTrace is enabled
+// and tracing is active.
+func (c *config) traceDecision(d Decision) {
+	if !c.runtimeTrace || !trace.IsEnabled() {
+		return
+	}
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	trace.Log(ctx, _traceCategory, d.traceMessage())
+}
+
+// traceMessage formats d for the runtime trace, e.g.
+// "GOMAXPROCS=4 minBinding=false burst=0 duration=1ms trace=[quota=4 (CPU quota) ...]".
+func (d Decision) traceMessage() string {
+	steps := make([]string, len(d.Trace))
+	for i, s := range d.Trace {
+		steps[i] = s.String()
+	}
+	msg := fmt.Sprintf("GOMAXPROCS=%d minBinding=%v burst=%v duration=%v trace=[%s]",
+		d.GOMAXPROCS, d.MinBinding, d.Burst, d.Duration, strings.Join(steps, " "))
+	if d.ContainerID != "" {
+		msg += " containerID=" + d.ContainerID
+	}
+	return msg
+}
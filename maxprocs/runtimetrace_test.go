@@ -0,0 +1,67 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"bytes"
+	"runtime/trace"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRuntimeTrace(t *testing.T) {
+	procs := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return 3, iruntime.CPUQuotaUsed, nil
+	})
+
+	t.Run("tracing inactive", func(t *testing.T) {
+		undo, err := Set(procs, WithRuntimeTrace(true))
+		defer undo()
+		require.NoError(t, err)
+		assert.Equal(t, 3, currentMaxProcs())
+	})
+
+	for _, enabled := range []bool{true, false} {
+		var buf bytes.Buffer
+		require.NoError(t, trace.Start(&buf), "couldn't start tracing")
+		undo, err := Set(procs, WithRuntimeTrace(enabled))
+		trace.Stop()
+		undo()
+		require.NoError(t, err)
+
+		d, ok := LastDecision()
+		require.True(t, ok)
+		assert.Equal(t, enabled, bytes.Contains(buf.Bytes(), []byte(d.traceMessage())), "enabled=%v", enabled)
+	}
+}
+
+func TestDecisionTraceMessage(t *testing.T) {
+	d := Decision{
+		GOMAXPROCS:  2,
+		Trace:       []Step{{Stage: StageQuota, Source: "CPU quota", Value: 2.5}},
+		ContainerID: "abc",
+	}
+	assert.Equal(t, "GOMAXPROCS=2 minBinding=false burst=0 duration=0s trace=[quota=2.5 (CPU quota)] containerID=abc", d.traceMessage())
+}
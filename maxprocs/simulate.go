@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"fmt"
+	"math"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+)
+
+// Simulate returns the Decision Set would make for a CPU quota of quota CPUs
+// on a machine whose CPU affinity mask allows numCPU CPUs, without reading
+// any file or the environment and without changing GOMAXPROCS. It runs the
+// same pipeline as Set: the rounding options, the minimum, the cap by the
+// affinity mask if UseSchedAffinity is enabled, and the Adjust function,
+// with each stage recorded in Decision.Trace. This makes it easy to check how
+// a combination of options behaves.
+//
+// A quota that isn't positive is treated as undefined, in which case Set
+// would leave GOMAXPROCS at the runtime's default, so the Decision holds
+// numCPU. With DeferToRuntime, if the running Go runtime derives its default
+// from the CPU limit, the Decision holds that default instead: the quota
+// rounded up, at least 2 and at most numCPU. Max lowers either default, as
+// it does in Set. A numCPU below 1 disables the cap by the affinity mask.
+// Options that need further input, such as BalanceWithMemory, NUMANodes and
+// ReactToMemoryPSI, don't apply, and the options aren't validated; use
+// Validate for that.
+func Simulate(quota float64, numCPU int, opts ...Option) Decision {
+	cfg := newConfig(opts)
+	cfg.memoryLimit = func(iruntime.Options) (int64, bool, error) {
+		return -1, false, nil
+	}
+	cfg.numaNodeCPUs = func(iruntime.Options) ([]int, error) {
+		return nil, nil
+	}
+	cfg.memoryPressure = func(iruntime.Options) (float64, bool, error) {
+		return -1, false, nil
+	}
+
+	d := Decision{Quota: -1}
+	if quota > 0 {
+		d.Quota = quota
+	}
+	if cfg.deferToRuntime && cfg.runtimeDefault() {
+		d.GOMAXPROCS = runtimeContainerDefault(quota, numCPU)
+		cfg.capSimulatedDefault(&d)
+		return d
+	}
+	if !(quota > 0) {
+		d.GOMAXPROCS = numCPU
+		cfg.capSimulatedDefault(&d)
+		return d
+	}
+
+	affinityUsed := false
+	if cfg.schedAffinity && numCPU > 0 && float64(numCPU) < quota {
+		quota, affinityUsed = float64(numCPU), true
+	}
+	maxProcs, status := iruntime.QuotaToGOMAXPROCS(quota, cfg.minGOMAXPROCS, cfg.tracedRound(&d.Trace, "CPU quota"))
+	if affinityUsed && status == iruntime.CPUQuotaUsed {
+		status = iruntime.CPUAffinityUsed
+	}
+	maxProcs, status = cfg.capMinAtQuota(d.Trace, maxProcs, status)
+
+	// The caps can't fail without I/O.
+	_, _, _, _, _, _ = cfg.decide(&d, maxProcs, status)
+	return d
+}
+
+// runtimeContainerDefault returns the default GOMAXPROCS the Go runtime
+// derives from a CPU quota of quota CPUs with numCPU CPUs available: the
+// quota rounded up and raised to 2, unless numCPU is lower.
+func runtimeContainerDefault(quota float64, numCPU int) int {
+	if !(quota > 0) {
+		return numCPU
+	}
+	procs := int(math.Ceil(quota))
+	if procs < 2 {
+		procs = 2
+	}
+	if numCPU > 0 && numCPU < procs {
+		procs = numCPU
+	}
+	return procs
+}
+
+// capSimulatedDefault lowers the runtime's default held by d to the maximum
+// set with Max, as capCurrent does in Set, recording the stage in d.Trace.
+func (c *config) capSimulatedDefault(d *Decision) {
+	if c.maxGOMAXPROCS <= 0 || d.GOMAXPROCS < 1 {
+		return
+	}
+	if d.GOMAXPROCS > c.maxGOMAXPROCS {
+		d.GOMAXPROCS = c.maxGOMAXPROCS
+	}
+	d.Trace = append(d.Trace, Step{
+		Stage:  StageMaxClamped,
+		Source: fmt.Sprintf("Max(%d)", c.maxGOMAXPROCS),
+		Value:  float64(d.GOMAXPROCS),
+	})
+}
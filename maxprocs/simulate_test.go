@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulate(t *testing.T) {
+	double := Adjust(func(proposed int, _ Decision) int { return proposed * 2 })
+
+	testTable := []struct {
+		name             string
+		quota            float64
+		numCPU           int
+		opts             []Option
+		expectedMaxProcs int
+		expectedBinding  bool
+	}{
+		{name: "default", quota: 2.5, numCPU: 8, expectedMaxProcs: 2},
+		{name: "undefined", quota: 0, numCPU: 8, expectedMaxProcs: 8},
+		{name: "negative", quota: -1, numCPU: 8, expectedMaxProcs: 8},
+		{name: "below-one", quota: 0.5, numCPU: 8, expectedMaxProcs: 1, expectedBinding: true},
+		{name: "min", quota: 2.5, numCPU: 8, opts: []Option{Min(4)}, expectedMaxProcs: 4, expectedBinding: true},
+		{name: "min-equal", quota: 4, numCPU: 8, opts: []Option{Min(4)}, expectedMaxProcs: 4},
+		{name: "affinity", quota: 6, numCPU: 4, expectedMaxProcs: 4},
+		{name: "affinity-disabled", quota: 6, numCPU: 4, opts: []Option{UseSchedAffinity(false)}, expectedMaxProcs: 6},
+		{name: "affinity-unknown", quota: 6, numCPU: 0, expectedMaxProcs: 6},
+		{name: "round-up", quota: 2.3, numCPU: 8, opts: []Option{RoundQuotaFunc(RoundUpWithTolerance(0.05))}, expectedMaxProcs: 3},
+		{name: "utilization", quota: 4, numCPU: 8, opts: []Option{TargetUtilization(0.8)}, expectedMaxProcs: 3},
+		{name: "utilization-min", quota: 1, numCPU: 8, opts: []Option{TargetUtilization(0.5), Min(2)}, expectedMaxProcs: 2, expectedBinding: true},
+		{name: "multiple", quota: 9, numCPU: 16, opts: []Option{RoundToMultiple(4)}, expectedMaxProcs: 8},
+		{name: "multiple-utilization", quota: 10, numCPU: 16, opts: []Option{RoundToMultiple(4), TargetUtilization(0.75)}, expectedMaxProcs: 4},
+		{name: "multiple-affinity", quota: 16, numCPU: 6, opts: []Option{RoundToMultiple(4)}, expectedMaxProcs: 4},
+		{name: "adjust", quota: 3, numCPU: 8, opts: []Option{double}, expectedMaxProcs: 6},
+		{name: "adjust-min", quota: 1, numCPU: 8, opts: []Option{Min(2), double}, expectedMaxProcs: 4, expectedBinding: true},
+		{name: "memory-ignored", quota: 4, numCPU: 8, opts: []Option{BalanceWithMemory(1)}, expectedMaxProcs: 4},
+		{name: "numa-ignored", quota: 4, numCPU: 8, opts: []Option{NUMANodes(1)}, expectedMaxProcs: 4},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Simulate(tt.quota, tt.numCPU, tt.opts...)
+			assert.Equal(t, tt.expectedMaxProcs, d.GOMAXPROCS)
+			assert.Equal(t, tt.expectedBinding, d.MinBinding)
+			if tt.quota > 0 {
+				require.NotEmpty(t, d.Trace)
+				assert.Equal(t, StageAdjusted, d.Trace[len(d.Trace)-1].Stage)
+				assert.Equal(t, float64(d.GOMAXPROCS), d.Trace[len(d.Trace)-1].Value)
+			} else {
+				assert.Empty(t, d.Trace)
+			}
+		})
+	}
+}
+
+func TestSimulateTrace(t *testing.T) {
+	d := Simulate(6, 4, Min(2))
+	assert.Equal(t, []Step{
+		{Stage: StageQuota, Source: "CPU affinity", Value: 4},
+		{Stage: StageScaled, Source: "TargetUtilization(1)", Value: 4},
+		{Stage: StageRounded, Source: "RoundQuotaFunc", Value: 4},
+		{Stage: StageMinClamped, Source: "Min(2)", Value: 4},
+		{Stage: StageAdjusted, Source: "Adjust", Value: 4},
+	}, d.Trace)
+}
+
+func TestSimulateMatchesSet(t *testing.T) {
+	opts := []Option{Min(2), TargetUtilization(0.9), RoundToMultiple(2), UseSchedAffinity(false)}
+	for _, quota := range []float64{0.5, 1, 2.5, 3.3, 7, 12.9} {
+		procs := stubProcs(func(min int, round func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			maxProcs, status := iruntime.QuotaToGOMAXPROCS(quota, min, round)
+			return maxProcs, status, nil
+		})
+		undo, err := Set(append([]Option{procs}, opts...)...)
+		require.NoError(t, err, "Set failed")
+		got, ok := LastDecision()
+		undo()
+		require.True(t, ok)
+
+		want := Simulate(quota, 0, opts...)
+		assert.Equal(t, want.GOMAXPROCS, got.GOMAXPROCS, "quota=%v", quota)
+		assert.Equal(t, want.MinBinding, got.MinBinding, "quota=%v", quota)
+		assert.Equal(t, want.Trace, got.Trace, "quota=%v", quota)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build go1.21
+// +build go1.21
+
+package maxprocs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Attribute keys of the records logged by WithSlog.
+const (
+	_slogKeyGOMAXPROCS  = "gomaxprocs"
+	_slogKeyPrevious    = "previous"
+	_slogKeyQuota       = "quota"
+	_slogKeySource      = "source"
+	_slogKeyReason      = "reason"
+	_slogKeyHostname    = "hostname"
+	_slogKeyContainerID = "container_id"
+)
+
+// _slogWarnPrefixes start the log lines WithSlog logs at warn level: values
+// that couldn't be read or parsed.
+var _slogWarnPrefixes = []string{
+	"maxprocs: Couldn't ",
+	"maxprocs: Ignoring ",
+}
+
+// WithSlog logs with logger instead of the printf function set with Logger.
+// The decision of Set is logged at info level as a structured record, whose
+// message explains it, e.g. "maxprocs: Updating GOMAXPROCS=2: determined
+// from CPU quota", with the attributes:
+//
+//	gomaxprocs    the value in effect once Set returned
+//	previous      the value in effect when detection started
+//	quota         the CPU count GOMAXPROCS was derived from, or -1 if none
+//	source        where GOMAXPROCS comes from, as a Source name
+//	reason        why GOMAXPROCS was chosen, as a Reason name
+//	hostname      with ContainerInfo, if known
+//	container_id  with ContainerInfo, if known
+//
+// Other lines are logged as plain messages, at warn level for values that
+// couldn't be read or parsed and at info level otherwise. It requires Go
+// 1.21 or later.
+func WithSlog(logger *slog.Logger) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.printf = func(format string, args ...interface{}) {
+			level := slog.LevelInfo
+			for _, prefix := range _slogWarnPrefixes {
+				if strings.HasPrefix(format, prefix) {
+					level = slog.LevelWarn
+				}
+			}
+			logger.Log(context.Background(), level, fmt.Sprintf(format, args...))
+		}
+		cfg.decisionLog = func(d Decision, msg string) {
+			logger.LogAttrs(context.Background(), slog.LevelInfo, msg, cfg.slogAttrs(d)...)
+		}
+	})
+}
+
+// slogAttrs returns the attributes describing d for WithSlog.
+func (c *config) slogAttrs(d Decision) []slog.Attr {
+	quota := -1.0
+	if len(d.Trace) > 0 && d.Trace[0].Stage == StageQuota {
+		quota = d.Trace[0].Value
+	}
+	attrs := []slog.Attr{
+		slog.Int(_slogKeyGOMAXPROCS, d.GOMAXPROCS),
+		slog.Int(_slogKeyPrevious, c.previous),
+		slog.Float64(_slogKeyQuota, quota),
+		slog.String(_slogKeySource, c.source.String()),
+		slog.String(_slogKeyReason, c.code.String()),
+	}
+	if d.Hostname != "" {
+		attrs = append(attrs, slog.String(_slogKeyHostname, d.Hostname))
+	}
+	if d.ContainerID != "" {
+		attrs = append(attrs, slog.String(_slogKeyContainerID, d.ContainerID))
+	}
+	return attrs
+}
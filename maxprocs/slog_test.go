@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build go1.21
+// +build go1.21
+
+package maxprocs
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func slogRecords(t testing.TB, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record), "couldn't decode %q", line)
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestWithSlog(t *testing.T) {
+	prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2")
+
+	t.Run("decision", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		logger := slog.New(slog.NewJSONHandler(buf, nil))
+		prev := currentMaxProcs()
+		undo, err := Set(RootPrefix(prefix), UseSchedAffinity(false), WithSlog(logger))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+
+		records := slogRecords(t, buf)
+		require.Len(t, records, 1, "expected a single record")
+		record := records[0]
+		assert.Equal(t, "INFO", record["level"])
+		assert.Equal(t, "maxprocs: Updating GOMAXPROCS=3: determined from CPU quota", record["msg"])
+		assert.Equal(t, float64(3), record[_slogKeyGOMAXPROCS])
+		assert.Equal(t, float64(prev), record[_slogKeyPrevious])
+		assert.Equal(t, float64(3), record[_slogKeyQuota])
+		assert.Equal(t, SourceCGroupQuota.String(), record[_slogKeySource])
+		assert.Equal(t, ReasonQuotaApplied.String(), record[_slogKeyReason])
+	})
+
+	t.Run("invalid CPU count", func(t *testing.T) {
+		require.NoError(t, os.Setenv(_cpuKey, "many"))
+		defer os.Unsetenv(_cpuKey)
+
+		buf := bytes.NewBuffer(nil)
+		logger := slog.New(slog.NewJSONHandler(buf, nil))
+		undo, err := Set(RootPrefix(prefix), UseSchedAffinity(false), WithSlog(logger))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+
+		records := slogRecords(t, buf)
+		require.NotEmpty(t, records, "expected records")
+		assert.Equal(t, "WARN", records[0]["level"])
+		assert.Contains(t, records[0]["msg"], "maxprocs: Ignoring AUTOMAXPROCS_CPU=")
+		assert.Equal(t, "INFO", records[len(records)-1]["level"])
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		logger := slog.New(slog.NewJSONHandler(buf, nil))
+		prev := currentMaxProcs()
+		defer runtime.GOMAXPROCS(prev)
+		apply, err := Prepare(RootPrefix(prefix), UseSchedAffinity(false), CompareAndSet(true), WithSlog(logger))
+		require.NoError(t, err, "Prepare failed")
+		runtime.GOMAXPROCS(prev + 2)
+		_, undo, err := apply()
+		require.NoError(t, err, "apply failed")
+		defer undo()
+
+		records := slogRecords(t, buf)
+		require.Len(t, records, 1, "expected a single record")
+		assert.Equal(t, ReasonConflict.String(), records[0][_slogKeyReason])
+		assert.Equal(t, float64(prev+2), records[0][_slogKeyGOMAXPROCS])
+	})
+
+	t.Run("Logger overrides", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		logger := slog.New(slog.NewJSONHandler(buf, nil))
+		text, opt := testLogger()
+		undo, err := Set(RootPrefix(prefix), UseSchedAffinity(false), WithSlog(logger), opt)
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Empty(t, buf.String(), "expected no slog records")
+		assert.Contains(t, text.String(), "maxprocs: Updating GOMAXPROCS=3: determined from CPU quota")
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+// File is the content of a cgroup or proc file read to detect the limits of
+// the process.
+type File struct {
+	// Name is the path of the file, relative to the root prefix, if any.
+	Name string
+	// Content is the content of the file, or nil if it couldn't be read.
+	Content []byte
+	// Err is the error reading the file, if any. It satisfies os.IsNotExist
+	// if the file doesn't exist.
+	Err error
+}
+
+// Snapshot returns every cgroup and proc file read to detect the CPU quota,
+// CPU burst, cpuset and memory limit of the process with the given options,
+// with its content at the time of the call, sorted by name, e.g. to attach
+// to a bug report when the detected GOMAXPROCS is unexpected. Failed
+// detections don't fail Snapshot: the files read until they failed are
+// returned.
+//
+// Snapshot doesn't change GOMAXPROCS, and ignores CacheToFile, CPUMaxFile
+// and CGroupPath so that the cgroup hierarchy is always read.
+func Snapshot(opts ...Option) ([]File, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	cancel := cfg.startTimeout()
+	defer cancel()
+
+	read := iruntime.Snapshot(cfg.runtimeOptions())
+	files := make([]File, len(read))
+	for i, f := range read {
+		files[i] = File{Name: f.Name, Content: f.Content, Err: f.Err}
+	}
+	return files, nil
+}
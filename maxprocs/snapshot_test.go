@@ -0,0 +1,47 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v1")
+	files, err := Snapshot(RootPrefix(prefix))
+	require.NoError(t, err, "Snapshot failed")
+
+	contents := make(map[string]string)
+	for _, f := range files {
+		if f.Err == nil {
+			contents[f.Name] = string(f.Content)
+		}
+	}
+	assert.Equal(t, "150000\n", contents["/sys/fs/cgroup/cpu,cpuacct/cpu.cfs_quota_us"])
+	assert.Equal(t, "536870912\n", contents["/sys/fs/cgroup/memory/large/memory.limit_in_bytes"])
+
+	_, err = Snapshot(RootPrefix(filepath.Join(prefix, "nonexistent")))
+	assert.Error(t, err, "expected an invalid root prefix to fail")
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"sync"
+	"time"
+)
+
+// Counters holds cumulative counters about the CPU quota detections run by
+// Set and Prepare, e.g. to report on a health endpoint that periodic
+// re-detection is alive and how often it changed GOMAXPROCS.
+type Counters struct {
+	// Reads is the number of times the CPU quota was read.
+	Reads int64
+	// Changes is the number of times a detected value was applied and
+	// differed from the GOMAXPROCS value in effect.
+	Changes int64
+	// Errors is the number of detections that failed.
+	Errors int64
+	// LastError is the error of the most recent failed detection, or nil
+	// if none failed.
+	LastError error
+	// LastDuration is how long the most recent detection took, whether it
+	// failed or not, or 0 if none ran.
+	LastDuration time.Duration
+}
+
+var _stats struct {
+	sync.Mutex
+
+	counters Counters
+}
+
+func recordRead() {
+	_stats.Lock()
+	defer _stats.Unlock()
+	_stats.counters.Reads++
+}
+
+func recordChange() {
+	_stats.Lock()
+	defer _stats.Unlock()
+	_stats.counters.Changes++
+}
+
+func recordError(err error) {
+	_stats.Lock()
+	defer _stats.Unlock()
+	_stats.counters.Errors++
+	_stats.counters.LastError = err
+}
+
+func recordDuration(d time.Duration) {
+	_stats.Lock()
+	defer _stats.Unlock()
+	_stats.counters.LastDuration = d
+}
+
+// recordRead counts a read of the CPU quota, unless c runs for Query.
+func (c *config) recordRead() {
+	if !c.forQuery {
+		recordRead()
+	}
+}
+
+// recordError counts a failed detection, unless c runs for Query.
+func (c *config) recordError(err error) {
+	if !c.forQuery {
+		recordError(err)
+	}
+}
+
+// Stats returns the counters accumulated since the process started or Reset
+// was last called. It's safe to call concurrently with Set.
+func Stats() Counters {
+	_stats.Lock()
+	defer _stats.Unlock()
+	return _stats.counters
+}
+
+func resetStats() {
+	_stats.Lock()
+	defer _stats.Unlock()
+	_stats.counters = Counters{}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countersOf returns c without its duration, which varies from run to run.
+func countersOf(c Counters) Counters {
+	c.LastDuration = 0
+	return c
+}
+
+func TestStats(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	target := currentMaxProcs() + 1
+	opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return target, iruntime.CPUQuotaUsed, nil
+	})
+
+	undo, err := Set(opt)
+	require.NoError(t, err, "Set failed")
+	assert.Equal(t, Counters{Reads: 1, Changes: 1}, countersOf(Stats()), "first detection should change GOMAXPROCS")
+
+	undoAgain, err := Set(opt)
+	require.NoError(t, err, "Set failed")
+	assert.Equal(t, Counters{Reads: 2, Changes: 1}, countersOf(Stats()), "same value shouldn't count as a change")
+	undoAgain()
+	undo()
+
+	failure := errors.New("failed")
+	_, err = Set(stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return -1, iruntime.CPUQuotaUndefined, failure
+	}))
+	require.Error(t, err, "Set should have failed")
+	assert.Equal(t, Counters{Reads: 3, Changes: 1, Errors: 1, LastError: failure}, countersOf(Stats()))
+
+	withMax(t, 2, func() {
+		undo, err := Set(opt)
+		defer undo()
+		require.NoError(t, err, "Set failed")
+		assert.Equal(t, int64(3), Stats().Reads, "honoring GOMAXPROCS shouldn't read the CPU quota")
+	})
+
+	Reset()
+	assert.Equal(t, Counters{}, Stats(), "Reset should zero the counters")
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+)
+
+// ErrUnsupportedPlatform is returned, wrapped with the name of the OS, by
+// Set and the functions that run the same detection when no CPU limit can
+// be detected on the current OS; see Supported.
+var ErrUnsupportedPlatform = errors.New("maxprocs: CPU limit detection not supported")
+
+// Supported reports whether CPU limit detection is compiled in for the
+// current OS: cgroups on Linux and job objects on Windows. Elsewhere, Set
+// returns an error wrapping ErrUnsupportedPlatform, along with an undo
+// function that does nothing, unless GOMAXPROCS is set in the environment
+// or the CPU quota is read from files given with RootPrefix, CPUMaxFile,
+// CGroupPath, FromFile or the AUTOMAXPROCS_CPU environment variable.
+func Supported() bool {
+	return iruntime.Supported()
+}
+
+// checkSupported returns an error wrapping ErrUnsupportedPlatform if the
+// CPU quota is to be detected on an OS that doesn't support it.
+func (c *config) checkSupported() error {
+	if c.supported || c.rootPrefix != "" || c.cpuMaxFile != "" || c.cgroupPath != "" {
+		return nil
+	}
+	return fmt.Errorf("%w on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
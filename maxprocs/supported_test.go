@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unsupportedPlatform makes detection behave as on an OS that doesn't
+// support it.
+func unsupportedPlatform() Option {
+	return optionFunc(func(cfg *config) {
+		cfg.supported = false
+	})
+}
+
+func TestSupported(t *testing.T) {
+	assert.Equal(t, runtime.GOOS == "linux" || runtime.GOOS == "windows", Supported())
+}
+
+func TestUnsupportedPlatform(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		prev := currentMaxProcs()
+		undo, err := Set(unsupportedPlatform())
+		require.NotNil(t, undo, "undo should be usable")
+		defer undo()
+		assert.True(t, errors.Is(err, ErrUnsupportedPlatform), "unexpected error %v", err)
+		assert.EqualError(t, err, "maxprocs: CPU limit detection not supported on "+runtime.GOOS)
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+	})
+
+	t.Run("env", func(t *testing.T) {
+		withMax(t, 42, func() {
+			undo, err := Set(unsupportedPlatform())
+			defer undo()
+			assert.NoError(t, err, "GOMAXPROCS should still be honored")
+		})
+	})
+
+	t.Run("root prefix", func(t *testing.T) {
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2")
+		undo, err := Set(unsupportedPlatform(), RootPrefix(prefix), UseSchedAffinity(false))
+		defer undo()
+		require.NoError(t, err, "files under a root prefix should still be read")
+		assert.Equal(t, 3, currentMaxProcs())
+	})
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+// ThreadQuotaCPUs returns the CPU quota applied to the thread tid of the
+// calling process as a fraction of CPUs, read from
+// `/proc/self/task/<tid>/cgroup`, and whether a quota is defined at all.
+//
+// This only matters in cgroup2 threaded mode, where the threads of a process
+// can be moved into child cgroups with a cpu.max of their own. GOMAXPROCS is
+// derived from the quota of the process, which covers all of its threads, so
+// a thread pinned into a tighter subgroup gets less CPU time than GOMAXPROCS
+// suggests. Outside of threaded subtrees, every thread shares the cgroup of
+// the process and this returns the same as QuotaCPUs. Options that control
+// where cgroup information is read from are applied; the others are ignored.
+func ThreadQuotaCPUs(tid int, opts ...Option) (float64, bool, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return -1, false, err
+	}
+
+	cancel := cfg.startTimeout()
+	defer cancel()
+	return iruntime.ThreadCPUQuota(cfg.runtimeOptions(), tid)
+}
+
+// warnIfThreaded logs a warning if the cgroup of the process is part of a
+// cgroup2 threaded subtree, whose threads may be subject to CPU quotas that
+// GOMAXPROCS doesn't account for. The cgroup type is informational, so a
+// failure to read it is ignored.
+func (c *config) warnIfThreaded() {
+	threaded, err := c.threaded(c.runtimeOptions())
+	if err != nil || !threaded {
+		return
+	}
+	c.log("maxprocs: cgroup is in threaded mode; its threads may have CPU quotas of their own, which GOMAXPROCS doesn't account for")
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetWarnsOnThreadedCGroup(t *testing.T) {
+	testTable := []struct {
+		name             string
+		expectedMaxProcs int
+		expectedWarning  bool
+	}{
+		{name: "v2-threaded", expectedMaxProcs: 4, expectedWarning: true},
+		{name: "v2", expectedMaxProcs: 3, expectedWarning: false},
+	}
+
+	for _, tt := range testTable {
+		buf, logOpt := testLogger()
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", tt.name)
+		undo, err := Set(logOpt, RootPrefix(prefix), UseSchedAffinity(false))
+		require.NoError(t, err, "%v: Set failed", tt.name)
+		assert.Equal(t, tt.expectedMaxProcs, currentMaxProcs(), tt.name)
+		if tt.expectedWarning {
+			assert.Contains(t, buf.String(), "cgroup is in threaded mode", tt.name)
+		} else {
+			assert.NotContains(t, buf.String(), "threaded mode", tt.name)
+		}
+		undo()
+	}
+}
+
+func TestThreadQuotaCPUs(t *testing.T) {
+	prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2-threaded")
+
+	quota, defined, err := ThreadQuotaCPUs(42, RootPrefix(prefix))
+	require.NoError(t, err, "ThreadQuotaCPUs failed")
+	assert.True(t, defined, "thread quota should be defined")
+	assert.Equal(t, 1.0, quota, "should read the quota of the thread's subgroup")
+
+	quota, defined, err = QuotaCPUs(RootPrefix(prefix))
+	require.NoError(t, err, "QuotaCPUs failed")
+	assert.True(t, defined, "process quota should be defined")
+	assert.Equal(t, 4.0, quota, "should read the quota of the process' cgroup")
+}
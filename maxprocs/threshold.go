@@ -0,0 +1,68 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import "math"
+
+// ChangeThreshold sets how much the CPU quota must move before a
+// re-evaluation of it changes GOMAXPROCS. A new value is only applied when
+// the rounded GOMAXPROCS differs from the one in effect and the quota differs
+// by more than delta from the quota that produced it, so small fluctuations
+// around a rounding boundary (e.g. 1.98 -> 2.02 -> 1.98) don't toggle
+// GOMAXPROCS back and forth.
+//
+// By default, delta is 0 and any change of the rounded value is applied.
+// Negative values are ignored. A one-shot Set always applies the value it
+// computes.
+func ChangeThreshold(delta float64) Option {
+	return optionFunc(func(cfg *config) {
+		if delta >= 0 {
+			cfg.changeThreshold = delta
+		}
+	})
+}
+
+// changeFilter decides whether a re-evaluated CPU quota should replace the
+// GOMAXPROCS value currently in effect.
+type changeFilter struct {
+	delta float64
+
+	applied bool
+	quota   float64
+	procs   int
+}
+
+// accept reports whether procs, derived from quota, should be applied, and
+// records it as the value in effect if so.
+func (f *changeFilter) accept(quota float64, procs int) bool {
+	if f.applied {
+		if procs == f.procs {
+			return false
+		}
+		if f.delta > 0 && math.Abs(quota-f.quota) <= f.delta {
+			return false
+		}
+	}
+	f.applied = true
+	f.quota = quota
+	f.procs = procs
+	return true
+}
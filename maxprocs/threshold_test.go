@@ -0,0 +1,92 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeThreshold(t *testing.T) {
+	assert.Equal(t, 0.0, newConfig(nil).changeThreshold, "default threshold should be 0")
+	assert.Equal(t, 0.25, newConfig([]Option{ChangeThreshold(0.25)}).changeThreshold)
+	assert.Equal(t, 0.25, newConfig([]Option{ChangeThreshold(0.25), ChangeThreshold(-1)}).changeThreshold,
+		"negative thresholds should be ignored")
+}
+
+func TestChangeFilter(t *testing.T) {
+	type step struct {
+		quota    float64
+		expected bool
+	}
+
+	testTable := []struct {
+		name  string
+		delta float64
+		steps []step
+	}{
+		{
+			name:  "default",
+			delta: 0,
+			steps: []step{
+				{2.0, true},
+				{2.05, false},
+				{2.0, false},
+				{1.98, true},
+				{2.02, true},
+				{1.98, true},
+			},
+		},
+		{
+			name:  "deadband",
+			delta: 0.1,
+			steps: []step{
+				{2.0, true},
+				{2.05, false},
+				{1.98, false},
+				{2.02, false},
+				{1.95, false},
+				{1.85, true},
+				{1.95, false},
+				{2.02, true},
+			},
+		},
+		{
+			name:  "large-change",
+			delta: 0.5,
+			steps: []step{
+				{4.0, true},
+				{3.6, false},
+				{2.9, true},
+				{4.0, true},
+			},
+		},
+	}
+
+	for _, tt := range testTable {
+		f := changeFilter{delta: tt.delta}
+		for i, s := range tt.steps {
+			assert.Equal(t, s.expected, f.accept(s.quota, DefaultRoundFunc(s.quota)),
+				"%s: step %d (quota %v)", tt.name, i, s.quota)
+		}
+	}
+}
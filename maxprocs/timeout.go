@@ -0,0 +1,76 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// _defaultTimeout holds the time.Duration set by SetDefaultTimeout. It is
+// accessed atomically.
+var _defaultTimeout int64
+
+// SetDefaultTimeout bounds how long each call to Set, Prepare, QuotaCPUs or
+// SampleUsage may spend reading cgroup and proc files. A read that doesn't
+// complete in time is abandoned, the call returns the context's error and
+// GOMAXPROCS is left unchanged. Zero, the default, disables the timeout;
+// negative values are treated as zero.
+//
+// The timeout applies process-wide, so applications calling Set from many
+// places don't have to configure each call. SetWithContext overrides it for
+// a single call.
+func SetDefaultTimeout(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.StoreInt64(&_defaultTimeout, int64(d))
+}
+
+func defaultTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&_defaultTimeout))
+}
+
+// SetWithContext is like Set, but abandons the cgroup and proc files reads
+// once ctx is done, e.g. when a hung file system blocks them past the
+// deadline of ctx: it then returns the context's error and leaves
+// GOMAXPROCS unchanged. ctx overrides the timeout set with
+// SetDefaultTimeout, which only applies if ctx is never done, e.g. for
+// context.Background().
+func SetWithContext(ctx context.Context, opts ...Option) (func(), error) {
+	_, undo, err := setWithResult(ctx, opts)
+	return undo, err
+}
+
+// startTimeout bounds the file reads made with c.runtimeOptions by the
+// default timeout, unless they're already bound by a per-call context. The
+// returned function releases the timer and must be called once detection is
+// done.
+func (c *config) startTimeout() context.CancelFunc {
+	timeout := defaultTimeout()
+	if timeout == 0 || c.ctx != nil {
+		return func() {}
+	}
+	var cancel context.CancelFunc
+	c.ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	return cancel
+}
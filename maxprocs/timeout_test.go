@@ -0,0 +1,163 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withDefaultTimeout(d time.Duration, f func()) {
+	prev := defaultTimeout()
+	SetDefaultTimeout(d)
+	defer SetDefaultTimeout(prev)
+	f()
+}
+
+func TestSetDefaultTimeout(t *testing.T) {
+	t.Run("NoTimeout", func(t *testing.T) {
+		opt := stubProcs(func(_ int, _ func(v float64) int, opts iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			assert.Nil(t, opts.Context, "shouldn't bound reads without a timeout")
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		withDefaultTimeout(0, func() {
+			_, err := Set(opt)
+			require.NoError(t, err, "Set failed")
+		})
+	})
+
+	t.Run("NegativeTimeout", func(t *testing.T) {
+		withDefaultTimeout(-time.Second, func() {
+			assert.Equal(t, time.Duration(0), defaultTimeout(), "negative timeouts should be ignored")
+		})
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		opt := stubProcs(func(_ int, _ func(v float64) int, opts iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			require.NotNil(t, opts.Context, "should bound reads with a timeout")
+			deadline, ok := opts.Context.Deadline()
+			assert.True(t, ok, "context should have a deadline")
+			assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second)
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		withDefaultTimeout(time.Minute, func() {
+			_, err := Set(opt)
+			require.NoError(t, err, "Set failed")
+		})
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		opt := stubProcs(func(_ int, _ func(v float64) int, opts iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			<-opts.Context.Done()
+			return -1, iruntime.CPUQuotaUndefined, opts.Context.Err()
+		})
+		prev := currentMaxProcs()
+		withDefaultTimeout(time.Millisecond, func() {
+			undo, err := Set(opt)
+			defer undo()
+			assert.Equal(t, context.DeadlineExceeded, err, "Set should fail once the timeout expires")
+		})
+		assert.Equal(t, prev, currentMaxProcs(), "shouldn't alter GOMAXPROCS")
+	})
+
+	t.Run("QuotaCPUs", func(t *testing.T) {
+		opt := stubQuota(func(opts iruntime.Options) (float64, bool, error) {
+			<-opts.Context.Done()
+			return -1, false, opts.Context.Err()
+		})
+		withDefaultTimeout(time.Millisecond, func() {
+			_, _, err := QuotaCPUs(opt)
+			assert.Equal(t, context.DeadlineExceeded, err)
+		})
+	})
+}
+
+func TestSetWithContext(t *testing.T) {
+	t.Run("Background", func(t *testing.T) {
+		opt := stubProcs(func(_ int, _ func(v float64) int, opts iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			assert.Nil(t, opts.Context, "shouldn't bound reads by a context that is never done")
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		_, err := SetWithContext(context.Background(), opt)
+		require.NoError(t, err, "SetWithContext failed")
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		opt := stubProcs(func(_ int, _ func(v float64) int, opts iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			require.NotNil(t, opts.Context, "should bound reads by ctx")
+			deadline, ok := opts.Context.Deadline()
+			assert.True(t, ok, "context should have a deadline")
+			assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second)
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		_, err := SetWithContext(ctx, opt)
+		require.NoError(t, err, "SetWithContext failed")
+	})
+
+	t.Run("DefaultTimeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+		defer cancel()
+		opt := stubProcs(func(_ int, _ func(v float64) int, opts iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			deadline, ok := opts.Context.Deadline()
+			assert.True(t, ok, "context should have a deadline")
+			assert.WithinDuration(t, time.Now().Add(time.Hour), deadline, 5*time.Second, "ctx should override the default timeout")
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		withDefaultTimeout(time.Minute, func() {
+			_, err := SetWithContext(ctx, opt)
+			require.NoError(t, err, "SetWithContext failed")
+		})
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		opt := stubProcs(func(_ int, _ func(v float64) int, opts iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			<-opts.Context.Done()
+			return -1, iruntime.CPUQuotaUndefined, opts.Context.Err()
+		})
+		prev := currentMaxProcs()
+		undo, err := SetWithContext(ctx, opt)
+		defer undo()
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.Equal(t, prev, currentMaxProcs(), "should leave GOMAXPROCS unchanged")
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2")
+		prev := currentMaxProcs()
+		undo, err := SetWithContext(ctx, RootPrefix(prefix), UseSchedAffinity(false))
+		defer undo()
+		assert.Equal(t, context.Canceled, err, "should fail reading the cgroup files")
+		assert.Equal(t, prev, currentMaxProcs(), "should leave GOMAXPROCS unchanged")
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import "fmt"
+
+// Stage identifies a step of the computation of GOMAXPROCS from the CPU
+// quota.
+type Stage string
+
+const (
+	// StageQuota is the CPU quota, as a fraction of CPUs, once capped by
+	// the cpuset and the CPU affinity mask.
+	StageQuota Stage = "quota"
+	// StageScaled is the quota multiplied by the target utilization.
+	StageScaled Stage = "scaled"
+	// StageRounded is the scaled quota converted to an int.
+	StageRounded Stage = "rounded"
+	// StageMinClamped is the rounded value, raised to the minimum
+	// GOMAXPROCS if it's below it.
+	StageMinClamped Stage = "minClamped"
+	// StageMaxClamped is the clamped value, lowered to the maximum
+	// GOMAXPROCS set with Max if it's above it. It's only recorded when a
+	// maximum is set.
+	StageMaxClamped Stage = "maxClamped"
+	// StageMemoryCapped is the clamped value, lowered to respect the memory
+	// limit with BalanceWithMemory. It's only recorded when BalanceWithMemory
+	// is used.
+	StageMemoryCapped Stage = "memoryCapped"
+	// StageNUMACapped is the memory-capped value, lowered to the CPUs of
+	// the NUMA nodes allowed with NUMANodes. It's only recorded when
+	// NUMANodes is used.
+	StageNUMACapped Stage = "numaCapped"
+	// StagePressureCapped is the NUMA-capped value, halved under memory
+	// pressure with ReactToMemoryPSI. It's only recorded when
+	// ReactToMemoryPSI is used.
+	StagePressureCapped Stage = "pressureCapped"
+	// StageAdjusted is the value returned by the Adjust function.
+	StageAdjusted Stage = "adjusted"
+)
+
+// Step records the value GOMAXPROCS had after one stage of its computation.
+type Step struct {
+	Stage Stage `json:"stage"`
+	// Source describes the input or option that governs the stage, such as
+	// "CPU quota" or "Min(2)".
+	Source string  `json:"source"`
+	Value  float64 `json:"value"`
+}
+
+// String formats s for logs and debug output, e.g. "rounded=4 (RoundQuotaFunc)".
+func (s Step) String() string {
+	return fmt.Sprintf("%s=%v (%s)", s.Stage, s.Value, s.Source)
+}
+
+// tracedRound returns c.round, which additionally records into trace the
+// quota it's called with and the value after each of its stages. origin
+// describes where the quota comes from.
+func (c *config) tracedRound(trace *[]Step, origin string) func(v float64) int {
+	return func(v float64) int {
+		procs := c.round(v)
+		rounding := "RoundQuotaFunc"
+		if c.multiple > 1 {
+			rounding = fmt.Sprintf("RoundToMultiple(%d)", c.multiple)
+		}
+		*trace = []Step{
+			{Stage: StageQuota, Source: origin, Value: v},
+			{Stage: StageScaled, Source: fmt.Sprintf("TargetUtilization(%v)", c.utilization), Value: v * c.utilization},
+			{Stage: StageRounded, Source: rounding, Value: float64(procs)},
+		}
+		return procs
+	}
+}
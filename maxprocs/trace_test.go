@@ -0,0 +1,126 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubQuotaStatus(quota float64, status iruntime.CPUQuotaStatus) Option {
+	return stubProcs(func(min int, round func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		maxProcs, quotaStatus := iruntime.QuotaToGOMAXPROCS(quota, min, round)
+		if quotaStatus == iruntime.CPUQuotaUsed {
+			quotaStatus = status
+		}
+		return maxProcs, quotaStatus, nil
+	})
+}
+
+func TestDecisionTrace(t *testing.T) {
+	t.Run("every-stage", func(t *testing.T) {
+		var calls int
+		undo, err := Set(
+			stubQuotaStatus(5, iruntime.CPUQuotaUsed),
+			TargetUtilization(0.8),
+			RoundToMultiple(2),
+			Min(2),
+			BalanceWithMemory(_mib),
+			stubMemoryLimit(3*_mib, true, nil, &calls),
+			Adjust(func(proposed int, _ Decision) int { return proposed - 1 }),
+		)
+		defer undo()
+		require.NoError(t, err, "Set failed")
+
+		decision, ok := LastDecision()
+		require.True(t, ok, "Set should record its decision")
+		assert.Equal(t, 2, decision.GOMAXPROCS)
+		assert.Equal(t, []Step{
+			{Stage: StageQuota, Source: "CPU quota", Value: 5},
+			{Stage: StageScaled, Source: "TargetUtilization(0.8)", Value: 4},
+			{Stage: StageRounded, Source: "RoundToMultiple(2)", Value: 4},
+			{Stage: StageMinClamped, Source: "Min(2)", Value: 4},
+			{Stage: StageMemoryCapped, Source: "BalanceWithMemory(1048576)", Value: 3},
+			{Stage: StageAdjusted, Source: "Adjust", Value: 2},
+		}, decision.Trace)
+	})
+
+	t.Run("min-clamped", func(t *testing.T) {
+		undo, err := Set(stubQuotaStatus(0.5, iruntime.CPUQuotaUsed), Min(2))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+
+		decision, ok := LastDecision()
+		require.True(t, ok, "Set should record its decision")
+		assert.Equal(t, []Step{
+			{Stage: StageQuota, Source: "CPU quota", Value: 0.5},
+			{Stage: StageScaled, Source: "TargetUtilization(1)", Value: 0.5},
+			{Stage: StageRounded, Source: "RoundQuotaFunc", Value: 0},
+			{Stage: StageMinClamped, Source: "Min(2)", Value: 2},
+			{Stage: StageAdjusted, Source: "Adjust", Value: 2},
+		}, decision.Trace)
+	})
+
+	t.Run("affinity", func(t *testing.T) {
+		undo, err := Set(stubQuotaStatus(2, iruntime.CPUAffinityUsed))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+
+		decision, ok := LastDecision()
+		require.True(t, ok, "Set should record its decision")
+		require.NotEmpty(t, decision.Trace)
+		assert.Equal(t, Step{Stage: StageQuota, Source: "CPU affinity", Value: 2}, decision.Trace[0])
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		withCPUEnv(t, "3", func() {
+			undo, err := Set()
+			defer undo()
+			require.NoError(t, err, "Set failed")
+
+			decision, ok := LastDecision()
+			require.True(t, ok, "Set should record its decision")
+			require.NotEmpty(t, decision.Trace)
+			assert.Equal(t, Step{Stage: StageQuota, Source: _cpuKey, Value: 3}, decision.Trace[0])
+		})
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		undo, err := Set(stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			return -1, iruntime.CPUQuotaUndefined, nil
+		}))
+		defer undo()
+		require.NoError(t, err, "Set failed")
+
+		decision, ok := LastDecision()
+		require.True(t, ok, "Set should record its decision")
+		assert.Empty(t, decision.Trace)
+	})
+}
+
+func TestStepString(t *testing.T) {
+	assert.Equal(t, "rounded=4 (RoundQuotaFunc)", Step{Stage: StageRounded, Source: "RoundQuotaFunc", Value: 4}.String())
+	assert.Equal(t, "quota=2.5 (CPU quota)", Step{Stage: StageQuota, Source: "CPU quota", Value: 2.5}.String())
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"fmt"
+	"time"
+)
+
+// UsageSample is a reading of the CPU time consumed by the cgroup of the
+// calling process, along with its CPU quota. Two samples give the
+// utilization of the quota over the interval between them; see Utilization.
+type UsageSample struct {
+	// Time is when the sample was taken.
+	Time time.Time
+	// Usage is the total CPU time consumed by the cgroup, as accounted in
+	// cpu.stat with cgroup2 and in cpuacct.usage with cgroup v1.
+	Usage time.Duration
+	// Quota is the CPU quota of the cgroup, as a fraction of CPUs.
+	Quota float64
+}
+
+// SampleUsage reads the CPU time consumed by the cgroup of the calling
+// process and its CPU quota. It returns an error if either can't be
+// determined. Options that control where cgroup information is read from
+// are applied; the others are ignored.
+func SampleUsage(opts ...Option) (UsageSample, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return UsageSample{}, err
+	}
+
+	cancel := cfg.startTimeout()
+	defer cancel()
+	return cfg.sampleUsage()
+}
+
+func (c *config) sampleUsage() (UsageSample, error) {
+	quota, defined, err := c.quotaCPUs(c.runtimeOptions())
+	if err != nil {
+		return UsageSample{}, err
+	}
+	if !defined {
+		return UsageSample{}, fmt.Errorf("maxprocs: CPU quota undefined")
+	}
+
+	usage, defined, err := c.usage(c.runtimeOptions())
+	if err != nil {
+		return UsageSample{}, err
+	}
+	if !defined {
+		return UsageSample{}, fmt.Errorf("maxprocs: CPU usage isn't accounted")
+	}
+	return UsageSample{Time: time.Now(), Usage: usage, Quota: quota}, nil
+}
+
+// Utilization returns the fraction of the CPU quota of cur consumed between
+// prev and cur, from 0 (idle) to 1 (using the whole quota). It returns 0 if
+// cur wasn't taken after prev. Since the kernel lets a cgroup exceed its
+// quota briefly, e.g. with CFS burst, the result is capped at 1.
+func Utilization(prev, cur UsageSample) float64 {
+	elapsed := cur.Time.Sub(prev.Time)
+	if elapsed <= 0 || !(cur.Quota > 0) {
+		return 0
+	}
+	used := (cur.Usage - prev.Usage).Seconds()
+	available := elapsed.Seconds() * cur.Quota
+	switch u := used / available; {
+	case u < 0:
+		return 0
+	case u > 1:
+		return 1
+	default:
+		return u
+	}
+}
+
+// EffectiveUtilization samples the CPU usage of the cgroup of the calling
+// process twice, interval apart, and returns the fraction of its CPU quota
+// consumed in between; see Utilization. It blocks for interval, which must
+// be positive. This suits feedback loops, such as custom autoscalers, that
+// need to know how close a process runs to its quota.
+func EffectiveUtilization(interval time.Duration, opts ...Option) (float64, error) {
+	if interval <= 0 {
+		return 0, fmt.Errorf("maxprocs: interval %v must be positive", interval)
+	}
+	prev, err := SampleUsage(opts...)
+	if err != nil {
+		return 0, err
+	}
+	time.Sleep(interval)
+	cur, err := SampleUsage(opts...)
+	if err != nil {
+		return 0, err
+	}
+	return Utilization(prev, cur), nil
+}
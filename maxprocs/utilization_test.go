@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubUsage(usage []time.Duration, defined bool, err error) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.usage = func(iruntime.Options) (time.Duration, bool, error) {
+			u := usage[0]
+			if len(usage) > 1 {
+				usage = usage[1:]
+			}
+			return u, defined, err
+		}
+	})
+}
+
+func TestUtilization(t *testing.T) {
+	start := time.Unix(1000, 0)
+	sample := func(elapsed, usage time.Duration, quota float64) UsageSample {
+		return UsageSample{Time: start.Add(elapsed), Usage: usage, Quota: quota}
+	}
+	prev := sample(0, 10*time.Second, 2)
+
+	testTable := []struct {
+		name     string
+		cur      UsageSample
+		expected float64
+	}{
+		{name: "idle", cur: sample(time.Second, 10*time.Second, 2), expected: 0},
+		{name: "half", cur: sample(time.Second, 11*time.Second, 2), expected: 0.5},
+		{name: "full", cur: sample(2*time.Second, 14*time.Second, 2), expected: 1},
+		{name: "fractional quota", cur: sample(time.Second, 10*time.Second+250*time.Millisecond, 0.5), expected: 0.5},
+		{name: "burst", cur: sample(time.Second, 13*time.Second, 2), expected: 1},
+		{name: "counter reset", cur: sample(time.Second, time.Second, 2), expected: 0},
+		{name: "same time", cur: sample(0, 11*time.Second, 2), expected: 0},
+		{name: "no quota", cur: sample(time.Second, 11*time.Second, 0), expected: 0},
+	}
+
+	for _, tt := range testTable {
+		assert.Equal(t, tt.expected, Utilization(prev, tt.cur), tt.name)
+	}
+}
+
+func TestSampleUsage(t *testing.T) {
+	t.Run("v2", func(t *testing.T) {
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "v2")
+		s, err := SampleUsage(RootPrefix(prefix))
+		require.NoError(t, err)
+		assert.Equal(t, 4*time.Second, s.Usage)
+		assert.Equal(t, 3.0, s.Quota)
+		assert.False(t, s.Time.IsZero())
+	})
+
+	t.Run("quota undefined", func(t *testing.T) {
+		_, err := SampleUsage(stubQuota(func(iruntime.Options) (float64, bool, error) {
+			return -1, false, nil
+		}), stubUsage([]time.Duration{time.Second}, true, nil))
+		assert.Error(t, err)
+	})
+
+	t.Run("usage unavailable", func(t *testing.T) {
+		_, err := SampleUsage(stubQuota(func(iruntime.Options) (float64, bool, error) {
+			return 2, true, nil
+		}), stubUsage([]time.Duration{0}, false, nil))
+		assert.Error(t, err)
+	})
+
+	t.Run("usage error", func(t *testing.T) {
+		_, err := SampleUsage(stubQuota(func(iruntime.Options) (float64, bool, error) {
+			return 2, true, nil
+		}), stubUsage([]time.Duration{0}, true, errors.New("failed")))
+		assert.Error(t, err)
+	})
+}
+
+func TestEffectiveUtilization(t *testing.T) {
+	quotaOpt := stubQuota(func(iruntime.Options) (float64, bool, error) {
+		return 1, true, nil
+	})
+
+	u, err := EffectiveUtilization(time.Millisecond, quotaOpt, stubUsage([]time.Duration{time.Second, time.Second}, true, nil))
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, u, "idle")
+
+	u, err = EffectiveUtilization(time.Millisecond, quotaOpt, stubUsage([]time.Duration{0, time.Hour}, true, nil))
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, u, "should be capped at the quota")
+
+	_, err = EffectiveUtilization(0, quotaOpt)
+	assert.Error(t, err, "interval must be positive")
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"fmt"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+)
+
+// ProblemCode identifies a kind of Problem.
+type ProblemCode string
+
+const (
+	// ProblemInvalidConfig is reported when the options can't be used for
+	// detection, e.g. because the root prefix doesn't exist.
+	ProblemInvalidConfig ProblemCode = "invalid-config"
+	// ProblemDetectionFailed is reported when the cgroup or proc files
+	// couldn't be read or parsed.
+	ProblemDetectionFailed ProblemCode = "detection-failed"
+	// ProblemCPUControllerMissing is reported when no cgroup hierarchy has
+	// the cpu controller, so no CPU quota can be applied.
+	ProblemCPUControllerMissing ProblemCode = "cpu-controller-missing"
+	// ProblemQuotaUndefined is reported when the cpu controller is available
+	// but no CPU quota is set.
+	ProblemQuotaUndefined ProblemCode = "quota-undefined"
+	// ProblemQuotaBelowMin is reported when the rounded CPU quota is lower
+	// than the minimum GOMAXPROCS.
+	ProblemQuotaBelowMin ProblemCode = "quota-below-min"
+	// ProblemHybridCPUOnV1 is reported when cgroup2 is mounted next to v1
+	// hierarchies but the cpu controller is attached to a v1 one, so limits
+	// set through cgroup2 don't apply.
+	ProblemHybridCPUOnV1 ProblemCode = "hybrid-cpu-on-v1"
+	// ProblemCPUSetBelowQuota is reported when the cpuset of the cgroup
+	// allows fewer CPUs than the CPU quota, so part of the quota can't be
+	// used.
+	ProblemCPUSetBelowQuota ProblemCode = "cpuset-below-quota"
+)
+
+// Problem describes an issue with the cgroup layout of the calling process.
+type Problem struct {
+	Code    ProblemCode
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Code, p.Message)
+}
+
+// Validate runs detection with the given options and reports the problems
+// found with the cgroup layout of the calling process, if any. It never
+// changes GOMAXPROCS and doesn't honor the GOMAXPROCS environment variable,
+// which makes it suitable for preflight checks.
+func Validate(opts ...Option) []Problem {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return []Problem{{Code: ProblemInvalidConfig, Message: err.Error()}}
+	}
+
+	cancel := cfg.startTimeout()
+	defer cancel()
+
+	detectionFailed := func(err error) []Problem {
+		return []Problem{{Code: ProblemDetectionFailed, Message: err.Error()}}
+	}
+
+	var problems []Problem
+	layout, err := cfg.layout(cfg.runtimeOptions())
+	if err != nil {
+		return detectionFailed(err)
+	}
+	if layout.Hybrid && layout.CPUControllerV1 {
+		problems = append(problems, Problem{
+			Code:    ProblemHybridCPUOnV1,
+			Message: "cgroup2 is mounted next to v1 hierarchies but the cpu controller is on v1",
+		})
+	}
+
+	// A cpuset stands in for a missing CPU quota when setting GOMAXPROCS,
+	// but shouldn't hide the missing quota from the report.
+	runtimeOpts := cfg.runtimeOptions()
+	runtimeOpts.CPUSet = false
+	maxProcs, status, err := cfg.procs(cfg.minGOMAXPROCS, cfg.round, runtimeOpts)
+	if err != nil {
+		return detectionFailed(err)
+	}
+	switch status {
+	case iruntime.CPUQuotaControllerUnavailable:
+		problems = append(problems, Problem{
+			Code:    ProblemCPUControllerMissing,
+			Message: "no cgroup hierarchy has the cpu controller",
+		})
+	case iruntime.CPUQuotaUndefined:
+		problems = append(problems, Problem{
+			Code:    ProblemQuotaUndefined,
+			Message: "no CPU quota is set",
+		})
+	case iruntime.CPUQuotaMinUsed:
+		problems = append(problems, Problem{
+			Code:    ProblemQuotaBelowMin,
+			Message: fmt.Sprintf("CPU quota is below the minimum GOMAXPROCS=%v", maxProcs),
+		})
+	}
+
+	if cfg.cpuSet && status != iruntime.CPUQuotaUndefined && status != iruntime.CPUQuotaControllerUnavailable {
+		problem, err := cfg.cpuSetProblem(runtimeOpts)
+		if err != nil {
+			return detectionFailed(err)
+		}
+		if problem != nil {
+			problems = append(problems, *problem)
+		}
+	}
+	return problems
+}
+
+// cpuSetProblem returns a ProblemCPUSetBelowQuota if the cpuset of the
+// process allows fewer CPUs than its CPU quota, and nil otherwise.
+func (c *config) cpuSetProblem(opts iruntime.Options) (*Problem, error) {
+	cpus, defined, err := c.cpuSetCPUs(opts)
+	if err != nil || !defined {
+		return nil, err
+	}
+	quota, defined, err := c.quotaCPUs(opts)
+	if err != nil || !defined || !(float64(cpus) < quota) {
+		return nil, err
+	}
+	return &Problem{
+		Code:    ProblemCPUSetBelowQuota,
+		Message: fmt.Sprintf("cpuset allows %d CPUs, fewer than the CPU quota of %v", cpus, quota),
+	}, nil
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stubLayout(layout iruntime.Layout, err error) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.layout = func(iruntime.Options) (iruntime.Layout, error) { return layout, err }
+	})
+}
+
+func stubStatus(maxProcs int, status iruntime.CPUQuotaStatus, err error) Option {
+	return stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return maxProcs, status, err
+	})
+}
+
+func TestValidate(t *testing.T) {
+	root := filepath.Join("..", "internal", "cgroups", "testdata", "root")
+	testTable := []struct {
+		name          string
+		opts          []Option
+		expectedCodes []ProblemCode
+	}{
+		{
+			name: "quota-used",
+			opts: []Option{
+				stubLayout(iruntime.Layout{CPUControllerV1: true}, nil),
+				stubStatus(2, iruntime.CPUQuotaUsed, nil),
+				stubCPUSetCPUs(-1, false, nil),
+			},
+		},
+		{
+			name: "quota-undefined",
+			opts: []Option{
+				stubLayout(iruntime.Layout{CGroupV2: true}, nil),
+				stubStatus(-1, iruntime.CPUQuotaUndefined, nil),
+			},
+			expectedCodes: []ProblemCode{ProblemQuotaUndefined},
+		},
+		{
+			name: "cpu-controller-missing",
+			opts: []Option{
+				stubLayout(iruntime.Layout{}, nil),
+				stubStatus(-1, iruntime.CPUQuotaControllerUnavailable, nil),
+			},
+			expectedCodes: []ProblemCode{ProblemCPUControllerMissing},
+		},
+		{
+			name: "quota-below-min",
+			opts: []Option{
+				stubLayout(iruntime.Layout{CPUControllerV1: true}, nil),
+				stubStatus(2, iruntime.CPUQuotaMinUsed, nil),
+				stubCPUSetCPUs(-1, false, nil),
+				Min(2),
+			},
+			expectedCodes: []ProblemCode{ProblemQuotaBelowMin},
+		},
+		{
+			name: "hybrid-cpu-on-v1",
+			opts: []Option{
+				stubLayout(iruntime.Layout{Hybrid: true, CPUControllerV1: true}, nil),
+				stubStatus(-1, iruntime.CPUQuotaUndefined, nil),
+			},
+			expectedCodes: []ProblemCode{ProblemHybridCPUOnV1, ProblemQuotaUndefined},
+		},
+		{
+			name: "hybrid-cpu-on-v2",
+			opts: []Option{
+				stubLayout(iruntime.Layout{Hybrid: true}, nil),
+				stubStatus(2, iruntime.CPUQuotaUsed, nil),
+				stubCPUSetCPUs(-1, false, nil),
+			},
+		},
+		{
+			name: "layout-error",
+			opts: []Option{
+				stubLayout(iruntime.Layout{}, errors.New("failed")),
+				stubStatus(2, iruntime.CPUQuotaUsed, nil),
+			},
+			expectedCodes: []ProblemCode{ProblemDetectionFailed},
+		},
+		{
+			name: "quota-error",
+			opts: []Option{
+				stubLayout(iruntime.Layout{Hybrid: true, CPUControllerV1: true}, nil),
+				stubStatus(-1, iruntime.CPUQuotaUndefined, errors.New("failed")),
+			},
+			expectedCodes: []ProblemCode{ProblemDetectionFailed},
+		},
+		{
+			name: "cpuset-below-quota",
+			opts: []Option{
+				stubLayout(iruntime.Layout{CGroupV2: true}, nil),
+				stubStatus(4, iruntime.CPUQuotaUsed, nil),
+				stubCPUSetCPUs(2, true, nil),
+				stubQuota(func(iruntime.Options) (float64, bool, error) { return 4, true, nil }),
+			},
+			expectedCodes: []ProblemCode{ProblemCPUSetBelowQuota},
+		},
+		{
+			name: "cpuset-within-quota",
+			opts: []Option{
+				stubLayout(iruntime.Layout{CGroupV2: true}, nil),
+				stubStatus(2, iruntime.CPUQuotaUsed, nil),
+				stubCPUSetCPUs(2, true, nil),
+				stubQuota(func(iruntime.Options) (float64, bool, error) { return 2, true, nil }),
+			},
+		},
+		{
+			name: "cpuset-ignored",
+			opts: []Option{
+				stubLayout(iruntime.Layout{CGroupV2: true}, nil),
+				stubStatus(4, iruntime.CPUQuotaUsed, nil),
+				stubCPUSetCPUs(2, true, nil),
+				stubQuota(func(iruntime.Options) (float64, bool, error) { return 4, true, nil }),
+				IgnoreCPUSet(true),
+			},
+		},
+		{
+			name: "cpuset-error",
+			opts: []Option{
+				stubLayout(iruntime.Layout{CGroupV2: true}, nil),
+				stubStatus(4, iruntime.CPUQuotaUsed, nil),
+				stubCPUSetCPUs(-1, false, errors.New("failed")),
+			},
+			expectedCodes: []ProblemCode{ProblemDetectionFailed},
+		},
+		{
+			name:          "fixture-cpuset-below-quota",
+			opts:          []Option{RootPrefix(filepath.Join(root, "v2-cpuset")), UseSchedAffinity(false)},
+			expectedCodes: []ProblemCode{ProblemCPUSetBelowQuota},
+		},
+		{
+			name: "fixture-cpuset-above-quota",
+			opts: []Option{RootPrefix(filepath.Join(root, "v1-cpuset")), UseSchedAffinity(false)},
+		},
+		{
+			name:          "invalid-root-prefix",
+			opts:          []Option{RootPrefix(filepath.Join(t.TempDir(), "nonexistent"))},
+			expectedCodes: []ProblemCode{ProblemInvalidConfig},
+		},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := currentMaxProcs()
+			problems := Validate(tt.opts...)
+			assert.Equal(t, prev, currentMaxProcs(), "Validate shouldn't alter GOMAXPROCS")
+
+			var codes []ProblemCode
+			for _, p := range problems {
+				assert.NotEmpty(t, p.Message, "problem %q should have a message", p.Code)
+				codes = append(codes, p.Code)
+			}
+			assert.Equal(t, tt.expectedCodes, codes)
+		})
+	}
+}
+
+func TestProblemString(t *testing.T) {
+	p := Problem{Code: ProblemQuotaUndefined, Message: "no CPU quota is set"}
+	assert.Equal(t, "quota-undefined: no CPU quota is set", p.String())
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"time"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+)
+
+// _quotaPollInterval is how often WaitForQuota reads the CPU quota again.
+const _quotaPollInterval = 100 * time.Millisecond
+
+// WaitForQuota makes Set and Prepare read the CPU quota again, every 100ms
+// for up to timeout, if none is defined at first. Some orchestrators only
+// write cpu.max a moment after the container has started, so the first read
+// finds no limit. A cpuset doesn't end the wait, since it's usually in place
+// before the quota. Set returns as soon as a quota appears, or once timeout
+// elapses settles on what it found without one, such as the cpuset or the
+// GOMAXPROCS value in effect, logging either outcome. The wait counts
+// against SetDefaultTimeout. It doesn't apply when the cpu controller is
+// unavailable, since no quota can appear then. Disabled by default, so that
+// Set doesn't delay the start of processes without a quota.
+func WaitForQuota(timeout time.Duration) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.quotaWait = timeout
+	})
+}
+
+// WithDebounce makes WaitForQuota wait d once a CPU quota appears and read it
+// again, repeating until two consecutive reads agree, before settling on it.
+// Some controllers write cpu.max in two operations, so the first read after
+// the quota appears can pair the new quota with the old period; debouncing
+// coalesces such bursts into a single update. With WaitForQuota, the reads
+// still count against its timeout. With Watch, a tick that would change
+// GOMAXPROCS reads the quota again d later and only applies the result if
+// both reads agree, leaving it to a later tick otherwise. Set without
+// WaitForQuota ignores it. Disabled by default.
+func WithDebounce(d time.Duration) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.debounce = d
+	})
+}
+
+// waitForQuota polls the CPU quota while none is defined, until one is or
+// c.quotaWait elapses, and returns the last detection.
+func (c *config) waitForQuota(round func(v float64) int, maxProcs int, status iruntime.CPUQuotaStatus) (int, iruntime.CPUQuotaStatus, error) {
+	if c.quotaWait <= 0 {
+		return maxProcs, status, nil
+	}
+	if pending, err := c.quotaPending(status); err != nil || !pending {
+		return maxProcs, status, err
+	}
+
+	var done <-chan struct{}
+	if c.ctx != nil {
+		done = c.ctx.Done()
+	}
+	start := time.Now()
+	deadline := start.Add(c.quotaWait)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			c.log("maxprocs: No CPU quota appeared within %v", c.quotaWait)
+			return maxProcs, status, nil
+		}
+		if remaining > c.quotaPollInterval {
+			remaining = c.quotaPollInterval
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return -1, iruntime.CPUQuotaUndefined, c.ctx.Err()
+		}
+
+		c.recordRead()
+		var err error
+		maxProcs, status, err = c.procs(c.minGOMAXPROCS, round, c.runtimeOptions())
+		if err != nil {
+			return -1, status, err
+		}
+		pending, err := c.quotaPending(status)
+		if err != nil {
+			return -1, status, err
+		}
+		if !pending {
+			c.log("maxprocs: CPU quota appeared after %v", time.Since(start).Round(time.Millisecond))
+			return c.settleQuota(round, maxProcs, status, deadline, done)
+		}
+	}
+}
+
+// quotaPending reports whether a detection with the given status found no
+// CPU quota while the cpu controller is available, so that one may still
+// appear. Without a quota, the detection may still be limited by the
+// cpuset, with the status of a quota derived from it, so the quota is read
+// again to tell.
+func (c *config) quotaPending(status iruntime.CPUQuotaStatus) (bool, error) {
+	switch status {
+	case iruntime.CPUQuotaUndefined:
+		return true, nil
+	case iruntime.CPUSetUsed, iruntime.CPUQuotaMinUsed, iruntime.CPUAffinityUsed:
+		_, quotaStatus, err := c.quota(c.runtimeOptions())
+		return quotaStatus == iruntime.CPUQuotaUndefined && err == nil, err
+	default:
+		return false, nil
+	}
+}
+
+// settleQuota reads the CPU quota again every c.debounce until the detection
+// stops changing or deadline passes, and returns the last detection.
+func (c *config) settleQuota(round func(v float64) int, maxProcs int, status iruntime.CPUQuotaStatus, deadline time.Time, done <-chan struct{}) (int, iruntime.CPUQuotaStatus, error) {
+	for c.debounce > 0 && time.Until(deadline) > 0 {
+		timer := time.NewTimer(c.debounce)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return -1, iruntime.CPUQuotaUndefined, c.ctx.Err()
+		}
+
+		c.recordRead()
+		settled, settledStatus, err := c.procs(c.minGOMAXPROCS, round, c.runtimeOptions())
+		if err != nil {
+			return -1, settledStatus, err
+		}
+		if settled == maxProcs && settledStatus == status {
+			break
+		}
+		maxProcs, status = settled, settledStatus
+	}
+	return maxProcs, status, nil
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubQuotaPollInterval(d time.Duration) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.quotaPollInterval = d
+	})
+}
+
+// quotaAfter returns a stub detection that finds no CPU quota for the first
+// n calls and a quota of 3 CPUs afterwards, counting the calls in calls.
+func quotaAfter(n int, calls *int) Option {
+	return stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		*calls++
+		if *calls <= n {
+			return -1, iruntime.CPUQuotaUndefined, nil
+		}
+		return 3, iruntime.CPUQuotaUsed, nil
+	})
+}
+
+func TestWaitForQuota(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		calls := 0
+		prev := currentMaxProcs()
+		undo, err := Set(quotaAfter(1, &calls), stubQuotaPollInterval(time.Millisecond))
+		defer undo()
+		require.NoError(t, err)
+		assert.Equal(t, 1, calls, "shouldn't wait by default")
+		assert.Equal(t, prev, currentMaxProcs())
+	})
+
+	t.Run("appears", func(t *testing.T) {
+		calls := 0
+		buf, logOpt := testLogger()
+		undo, err := Set(logOpt, quotaAfter(3, &calls), WaitForQuota(time.Minute), stubQuotaPollInterval(time.Millisecond))
+		defer undo()
+		require.NoError(t, err)
+		assert.Equal(t, 4, calls, "should stop polling once the quota appears")
+		assert.Equal(t, 3, currentMaxProcs())
+		assert.Contains(t, buf.String(), "maxprocs: CPU quota appeared after")
+		assert.Contains(t, buf.String(), "Updating GOMAXPROCS=3")
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		calls := 0
+		buf, logOpt := testLogger()
+		prev := currentMaxProcs()
+		undo, err := Set(logOpt, quotaAfter(1000, &calls), WaitForQuota(20*time.Millisecond), stubQuotaPollInterval(5*time.Millisecond))
+		defer undo()
+		require.NoError(t, err)
+		assert.True(t, calls > 1, "should have polled")
+		assert.Equal(t, prev, currentMaxProcs())
+		assert.Contains(t, buf.String(), "maxprocs: No CPU quota appeared within 20ms")
+		assert.Contains(t, buf.String(), "CPU quota undefined")
+	})
+
+	t.Run("controller unavailable", func(t *testing.T) {
+		calls := 0
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			calls++
+			return -1, iruntime.CPUQuotaControllerUnavailable, nil
+		})
+		undo, err := Set(opt, WaitForQuota(time.Minute), stubQuotaPollInterval(time.Millisecond))
+		defer undo()
+		require.NoError(t, err)
+		assert.Equal(t, 1, calls, "no quota can appear without a cpu controller")
+	})
+
+	t.Run("error", func(t *testing.T) {
+		calls := 0
+		opt := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			calls++
+			if calls > 1 {
+				return -1, iruntime.CPUQuotaUndefined, errors.New("failed")
+			}
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		prev := currentMaxProcs()
+		undo, err := Set(opt, WaitForQuota(time.Minute), stubQuotaPollInterval(time.Millisecond))
+		defer undo()
+		assert.Error(t, err, "an error while polling should be reported")
+		assert.Equal(t, prev, currentMaxProcs())
+	})
+
+	t.Run("default timeout", func(t *testing.T) {
+		SetDefaultTimeout(10 * time.Millisecond)
+		defer SetDefaultTimeout(0)
+
+		calls := 0
+		start := time.Now()
+		undo, err := Set(quotaAfter(1000, &calls), WaitForQuota(time.Minute), stubQuotaPollInterval(time.Millisecond))
+		defer undo()
+		assert.Error(t, err, "the default timeout should bound the wait")
+		assert.True(t, time.Since(start) < time.Minute)
+	})
+}
+
+func TestWaitForQuotaWithCPUSet(t *testing.T) {
+	t.Run("gives up", func(t *testing.T) {
+		// cpuset-inherit-v2 has no quota and a cpuset of 2 CPUs.
+		buf, logOpt := testLogger()
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "cpuset-inherit-v2")
+		start := time.Now()
+		undo, err := Set(logOpt, RootPrefix(prefix), UseSchedAffinity(false), WaitForQuota(20*time.Millisecond), stubQuotaPollInterval(5*time.Millisecond))
+		defer undo()
+		require.NoError(t, err)
+		assert.True(t, time.Since(start) >= 20*time.Millisecond, "the cpuset shouldn't end the wait")
+		assert.Equal(t, 2, currentMaxProcs(), "should fall back to the cpuset")
+		assert.Contains(t, buf.String(), "maxprocs: No CPU quota appeared within 20ms")
+		assert.Contains(t, buf.String(), "limited by cpuset")
+	})
+
+	t.Run("appears", func(t *testing.T) {
+		// A cgroup2 root with a cpuset of 4 of the 8 CPUs of the host, whose
+		// quota of 1 CPU is only written after Set started.
+		root := t.TempDir()
+		files := map[string]string{
+			"proc/self/mountinfo":                 "1 0 0:1 / /sys/fs/cgroup rw - cgroup2 cgroup2 rw\n",
+			"proc/self/cgroup":                    "0::/\n",
+			"sys/fs/cgroup/cpu.max":               "max 100000\n",
+			"sys/fs/cgroup/cpuset.cpus.effective": "0-3\n",
+			"sys/devices/system/cpu/online":       "0-7\n",
+		}
+		for name, content := range files {
+			path := filepath.Join(root, filepath.FromSlash(name))
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+			require.NoError(t, ioutil.WriteFile(path, []byte(content), 0o644))
+		}
+		cpuMax := filepath.Join(root, "sys", "fs", "cgroup", "cpu.max")
+		written := make(chan error, 1)
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			tmp := cpuMax + ".tmp"
+			if err := ioutil.WriteFile(tmp, []byte("100000 100000\n"), 0o644); err != nil {
+				written <- err
+				return
+			}
+			written <- os.Rename(tmp, cpuMax)
+		}()
+
+		buf, logOpt := testLogger()
+		undo, err := Set(logOpt, RootPrefix(root), UseSchedAffinity(false), WaitForQuota(time.Minute), stubQuotaPollInterval(time.Millisecond))
+		defer undo()
+		require.NoError(t, <-written)
+		require.NoError(t, err)
+		assert.Equal(t, 1, currentMaxProcs(), "should apply the quota once it appears")
+		assert.Contains(t, buf.String(), "maxprocs: CPU quota appeared after")
+	})
+
+	t.Run("controller unavailable", func(t *testing.T) {
+		// cpuset-only has a cpuset of 4 CPUs but no cpu controller.
+		prefix := filepath.Join("..", "internal", "cgroups", "testdata", "root", "cpuset-only")
+		start := time.Now()
+		undo, err := Set(RootPrefix(prefix), UseSchedAffinity(false), WaitForQuota(time.Minute), stubQuotaPollInterval(time.Millisecond))
+		defer undo()
+		require.NoError(t, err)
+		assert.True(t, time.Since(start) < time.Second, "no quota can appear without a cpu controller")
+		assert.Equal(t, 4, currentMaxProcs())
+	})
+}
+
+func TestWithDebounce(t *testing.T) {
+	// procsSequence returns a stub detection that finds no CPU quota at first,
+	// then 2 CPUs while cpu.max is half written, and 3 CPUs afterwards.
+	procsSequence := func(calls *int) Option {
+		return stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			*calls++
+			switch *calls {
+			case 1:
+				return -1, iruntime.CPUQuotaUndefined, nil
+			case 2:
+				return 2, iruntime.CPUQuotaUsed, nil
+			default:
+				return 3, iruntime.CPUQuotaUsed, nil
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		calls := 0
+		undo, err := Set(procsSequence(&calls), WaitForQuota(time.Minute), stubQuotaPollInterval(time.Millisecond))
+		defer undo()
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, 2, currentMaxProcs(), "should act on the first read")
+	})
+
+	t.Run("coalesces writes", func(t *testing.T) {
+		calls := 0
+		buf, logOpt := testLogger()
+		undo, err := Set(logOpt, procsSequence(&calls), WaitForQuota(time.Minute), WithDebounce(time.Millisecond), stubQuotaPollInterval(time.Millisecond))
+		defer undo()
+		require.NoError(t, err)
+		assert.Equal(t, 4, calls, "should read until two reads agree")
+		assert.Equal(t, 3, currentMaxProcs())
+		assert.Equal(t, 1, strings.Count(buf.String(), "Updating GOMAXPROCS="), "should update once")
+		assert.Contains(t, buf.String(), "Updating GOMAXPROCS=3")
+	})
+
+	t.Run("without wait", func(t *testing.T) {
+		calls := 0
+		undo, err := Set(procsSequence(&calls), WithDebounce(time.Millisecond))
+		defer undo()
+		require.NoError(t, err)
+		assert.Equal(t, 1, calls, "debouncing only applies when waiting for a quota")
+	})
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// _watchBuffer is the capacity of the channel Watch returns.
+const _watchBuffer = 16
+
+// Update describes a change of GOMAXPROCS made by Watch.
+type Update struct {
+	// Old is the GOMAXPROCS value in effect before the change.
+	Old int
+	// New is the GOMAXPROCS value installed.
+	New int
+	// Time is when the change was made.
+	Time time.Time
+}
+
+// Watch re-runs the detection of Set every interval, with the same options,
+// until ctx is done, so that changes of the CPU quota made while the process
+// runs, e.g. by a vertical pod autoscaler, are picked up. GOMAXPROCS is only
+// changed when the computed value differs from the one in effect, and every
+// change is sent on the returned channel, which is closed once ctx is done.
+// Updates are dropped if the channel is full, so it should be drained.
+//
+// The same rounding applies on every tick, so a quota moving between 2.4
+// and 2.6 yields GOMAXPROCS=2 throughout with the default rounding. Quotas
+// fluctuating around a rounding boundary, e.g. 1.98 and 2.02, are kept from
+// toggling GOMAXPROCS with ChangeThreshold, and quotas written in several
+// steps from being applied halfway with WithDebounce. Ticks don't wait for a
+// quota with WaitForQuota: without one, GOMAXPROCS is left alone until the
+// next tick. Failed detections are logged and leave GOMAXPROCS unchanged
+// until the next tick. Watch returns an error if interval isn't positive or
+// the options are invalid.
+//
+// Changes made by Watch are recorded as decisions like those of Set, and
+// aren't undone when it stops.
+func Watch(ctx context.Context, interval time.Duration, opts ...Option) (<-chan Update, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("maxprocs: interval %v must be positive", interval)
+	}
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	updates := make(chan Update, _watchBuffer)
+	go func() {
+		defer close(updates)
+		filter := changeFilter{delta: cfg.changeThreshold}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			update, ok := watchTick(ctx, opts, &filter)
+			if !ok {
+				continue
+			}
+			select {
+			case updates <- update:
+			default:
+			}
+		}
+	}()
+	return updates, nil
+}
+
+// watchTick runs the detection once and applies its result if filter
+// accepts it and it differs from the GOMAXPROCS value in effect. With
+// WithDebounce, a result that would change GOMAXPROCS is only applied if a
+// second detection, once the debounce delay elapsed, agrees with it. It
+// returns false if GOMAXPROCS wasn't changed.
+func watchTick(ctx context.Context, opts []Option, filter *changeFilter) (Update, bool) {
+	cfg, apply, d, ok := detectTick(ctx, opts)
+	if !ok {
+		return Update{}, false
+	}
+	if cfg.debounce > 0 && d.GOMAXPROCS != currentMaxProcs() {
+		timer := time.NewTimer(cfg.debounce)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return Update{}, false
+		}
+		// A quota written in two steps is picked up on a later tick once
+		// the reads agree.
+		_, settledApply, settled, ok := detectTick(ctx, opts)
+		if !ok || settled.GOMAXPROCS != d.GOMAXPROCS {
+			return Update{}, false
+		}
+		apply, d = settledApply, settled
+	}
+
+	quota := -1.0
+	if len(d.Trace) > 0 && d.Trace[0].Stage == StageQuota {
+		quota = d.Trace[0].Value
+	}
+	prev := currentMaxProcs()
+	if !filter.accept(quota, d.GOMAXPROCS) || d.GOMAXPROCS == prev {
+		return Update{}, false
+	}
+
+	maxProcs, _, err := apply()
+	if err != nil || maxProcs == prev {
+		return Update{}, false
+	}
+	return Update{Old: prev, New: maxProcs, Time: time.Now()}, true
+}
+
+// detectTick runs the detection of a tick with a fresh config, since
+// detection records its outcome in it. It returns false, having logged any
+// error, if there's nothing to apply: when the environment sets GOMAXPROCS
+// or no quota is defined, the value in effect is left alone. Reads are
+// abandoned once ctx is done, so that a blocked read doesn't keep Watch
+// from stopping.
+func detectTick(ctx context.Context, opts []Option) (*config, func() (int, func(), error), *Decision, bool) {
+	cfg := newConfig(opts)
+	if ctx.Done() != nil {
+		cfg.ctx = ctx
+	}
+	// Only the first Set waits for a quota to appear, so that a tick never
+	// blocks for the whole wait.
+	cfg.quotaWait = 0
+	apply, d, err := cfg.prepare()
+	if err != nil {
+		cfg.log("maxprocs: Couldn't re-detect the CPU quota: %v", err)
+		return cfg, nil, nil, false
+	}
+	if d.GOMAXPROCS == 0 {
+		return cfg, nil, nil, false
+	}
+	return cfg, apply, d, true
+}
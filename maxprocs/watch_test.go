@@ -0,0 +1,222 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// quotaSequence returns an option whose detection yields the given quotas
+// in turn, repeating the last one, and reports an error for negative ones.
+func quotaSequence(quotas ...float64) Option {
+	var mu sync.Mutex
+	return stubProcs(func(min int, round func(v float64) int, _ iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		mu.Lock()
+		quota := quotas[0]
+		if len(quotas) > 1 {
+			quotas = quotas[1:]
+		}
+		mu.Unlock()
+		if quota < 0 {
+			return -1, iruntime.CPUQuotaUndefined, errors.New("failed")
+		}
+		maxProcs, status := iruntime.QuotaToGOMAXPROCS(quota, min, round)
+		return maxProcs, status, nil
+	})
+}
+
+// collectUpdates watches with opts until the quotas settled, and returns the
+// updates sent.
+func collectUpdates(t *testing.T, opts ...Option) []Update {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	updates, err := Watch(ctx, time.Millisecond, opts...)
+	require.NoError(t, err, "Watch failed")
+
+	var got []Update
+	for u := range updates {
+		got = append(got, u)
+	}
+	return got
+}
+
+func TestWatch(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	t.Run("changes", func(t *testing.T) {
+		runtime.GOMAXPROCS(2)
+		start := time.Now()
+		updates := collectUpdates(t, quotaSequence(2, 2, 3, 3, 5))
+		require.Len(t, updates, 2)
+		assert.Equal(t, 2, updates[0].Old)
+		assert.Equal(t, 3, updates[0].New)
+		assert.Equal(t, 3, updates[1].Old)
+		assert.Equal(t, 5, updates[1].New)
+		assert.False(t, updates[0].Time.Before(start), "update should be timestamped")
+		assert.Equal(t, 5, currentMaxProcs())
+
+		d, ok := LastDecision()
+		require.True(t, ok, "changes should be recorded")
+		assert.Equal(t, 5, d.GOMAXPROCS)
+	})
+
+	t.Run("same rounding", func(t *testing.T) {
+		runtime.GOMAXPROCS(2)
+		updates := collectUpdates(t, quotaSequence(2.4, 2.6, 2.4, 2.6, 2.4))
+		assert.Empty(t, updates)
+		assert.Equal(t, 2, currentMaxProcs())
+	})
+
+	t.Run("ChangeThreshold", func(t *testing.T) {
+		runtime.GOMAXPROCS(2)
+		updates := collectUpdates(t, ChangeThreshold(0.1), quotaSequence(2.0, 1.98, 2.02, 1.98))
+		assert.Empty(t, updates, "fluctuations within the threshold shouldn't apply")
+		assert.Equal(t, 2, currentMaxProcs())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		runtime.GOMAXPROCS(2)
+		buf, logOpt := testLogger()
+		updates := collectUpdates(t, logOpt, quotaSequence(-1, 4))
+		require.Len(t, updates, 1)
+		assert.Equal(t, 4, updates[0].New)
+		assert.Contains(t, buf.String(), "maxprocs: Couldn't re-detect the CPU quota: failed")
+	})
+
+	t.Run("ExportEnv", func(t *testing.T) {
+		runtime.GOMAXPROCS(2)
+		defer func() {
+			os.Unsetenv(_maxProcsKey)
+			clearExportedEnv()
+		}()
+		updates := collectUpdates(t, ExportEnv(true), quotaSequence(3, 3, 5))
+		require.Len(t, updates, 2, "the exported value shouldn't stop later ticks")
+		assert.Equal(t, 3, updates[0].New)
+		assert.Equal(t, 5, updates[1].New)
+		assert.Equal(t, "5", os.Getenv(_maxProcsKey), "the latest value should be exported")
+	})
+
+	t.Run("WithDebounce", func(t *testing.T) {
+		runtime.GOMAXPROCS(2)
+		// 3 is only seen once, while the quota is half written.
+		updates := collectUpdates(t, WithDebounce(time.Millisecond), quotaSequence(3, 2, 5, 5))
+		require.Len(t, updates, 1, "only agreeing reads should apply")
+		assert.Equal(t, 2, updates[0].Old)
+		assert.Equal(t, 5, updates[0].New)
+	})
+
+	t.Run("WaitForQuota", func(t *testing.T) {
+		var mu sync.Mutex
+		calls := 0
+		undefined := stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			return -1, iruntime.CPUQuotaUndefined, nil
+		})
+		start := time.Now()
+		updates := collectUpdates(t, undefined, WaitForQuota(time.Minute), stubQuotaPollInterval(time.Hour))
+		assert.Empty(t, updates)
+		assert.True(t, time.Since(start) < 10*time.Second, "ticks shouldn't wait for a quota")
+		mu.Lock()
+		defer mu.Unlock()
+		assert.True(t, calls > 1, "should detect on every tick, got %d calls", calls)
+	})
+
+	t.Run("cgroup move", func(t *testing.T) {
+		InvalidateCache()
+		defer InvalidateCache()
+		runtime.GOMAXPROCS(1)
+
+		// A cgroup2 root with two cgroups the process is moved between.
+		root := t.TempDir()
+		procCGroup := filepath.Join(root, "proc", "self", "cgroup")
+		require.NoError(t, os.MkdirAll(filepath.Dir(procCGroup), 0o755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, "proc", "self", "mountinfo"),
+			[]byte("34 33 0:29 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:10 - cgroup2 cgroup rw\n"), 0o644))
+		for name, cpuMax := range map[string]string{"a": "200000 100000\n", "b": "400000 100000\n"} {
+			dir := filepath.Join(root, "sys", "fs", "cgroup", name)
+			require.NoError(t, os.MkdirAll(dir, 0o755))
+			require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cpu.max"), []byte(cpuMax), 0o644))
+		}
+		move := func(cgroup string) {
+			require.NoError(t, ioutil.WriteFile(procCGroup, []byte("0::"+cgroup+"\n"), 0o644))
+		}
+		move("/a")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		updates, err := Watch(ctx, time.Millisecond, RootPrefix(root), UseSchedAffinity(false), CacheInMemory(time.Hour))
+		require.NoError(t, err, "Watch failed")
+		require.Equal(t, 2, (<-updates).New, "should apply the quota of the first cgroup")
+		move("/b")
+		require.Equal(t, 4, (<-updates).New, "should apply the quota of the cgroup moved to")
+	})
+
+	t.Run("blocked read", func(t *testing.T) {
+		started := make(chan struct{})
+		var once sync.Once
+		// A read hanging on an unresponsive mount only returns once its
+		// context is done.
+		blocked := stubProcs(func(_ int, _ func(v float64) int, opts iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+			once.Do(func() { close(started) })
+			if opts.Context == nil {
+				time.Sleep(time.Hour)
+			}
+			<-opts.Context.Done()
+			return -1, iruntime.CPUQuotaUndefined, opts.Context.Err()
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		updates, err := Watch(ctx, time.Millisecond, blocked)
+		require.NoError(t, err, "Watch failed")
+		<-started
+		cancel()
+
+		select {
+		case _, ok := <-updates:
+			assert.False(t, ok, "shouldn't send updates")
+		case <-time.After(10 * time.Second):
+			t.Fatal("Watch should stop while a read is blocked")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := Watch(context.Background(), 0)
+		assert.Error(t, err, "interval should be positive")
+
+		_, err = Watch(context.Background(), time.Second, TargetUtilization(2))
+		assert.Error(t, err, "options should be validated")
+	})
+}
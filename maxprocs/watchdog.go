@@ -0,0 +1,73 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// _warnUnsetKey is the environment variable that enables the warning
+	// logged when Set isn't called shortly after startup.
+	_warnUnsetKey = "AUTOMAXPROCS_WARN_UNSET"
+	// _warnUnsetDelay is how long after startup Set is expected to have
+	// been called.
+	_warnUnsetDelay = 5 * time.Second
+)
+
+// _setCalled is non-zero once Set or Prepare was called.
+var _setCalled int32
+
+// If AUTOMAXPROCS_WARN_UNSET=1, log a warning with log.Printf if neither Set
+// nor Prepare was called a few seconds after startup, which catches programs
+// that import maxprocs but forgot to call Set, e.g. expecting the import to
+// adjust GOMAXPROCS the way importing the top-level automaxprocs package
+// does. Without the variable, no timer is started.
+func init() {
+	startUnsetWatchdog(os.Getenv(_warnUnsetKey), _warnUnsetDelay, log.Printf)
+}
+
+// startUnsetWatchdog schedules the warning logged with printf after delay if
+// Set wasn't called by then, provided that value, the content of
+// AUTOMAXPROCS_WARN_UNSET, is "1". It returns false if no warning is
+// scheduled.
+func startUnsetWatchdog(value string, delay time.Duration, printf func(string, ...interface{})) bool {
+	if value != "1" {
+		return false
+	}
+	time.AfterFunc(delay, func() { warnIfUnset(delay, printf) })
+	return true
+}
+
+// warnIfUnset logs a warning with printf if Set wasn't called yet.
+func warnIfUnset(delay time.Duration, printf func(string, ...interface{})) {
+	if atomic.LoadInt32(&_setCalled) == 0 {
+		printf("maxprocs: Set wasn't called within %v of startup; GOMAXPROCS=%v isn't adjusted to the CPU quota", delay, currentMaxProcs())
+	}
+}
+
+// markSetCalled records that Set or Prepare was called.
+func markSetCalled() {
+	atomic.StoreInt32(&_setCalled, 1)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package maxprocs
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	iruntime "github.com/emadolsky/automaxprocs/internal/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnsetWatchdog(t *testing.T) {
+	prev := atomic.LoadInt32(&_setCalled)
+	defer atomic.StoreInt32(&_setCalled, prev)
+
+	warnings := make(chan string, 1)
+	printf := func(format string, args ...interface{}) {
+		warnings <- fmt.Sprintf(format, args...)
+	}
+
+	for _, value := range []string{"", "0", "true"} {
+		assert.False(t, startUnsetWatchdog(value, time.Millisecond, printf), "%q shouldn't enable the warning", value)
+	}
+
+	atomic.StoreInt32(&_setCalled, 0)
+	require.True(t, startUnsetWatchdog("1", time.Millisecond, printf))
+	select {
+	case warning := <-warnings:
+		assert.Contains(t, warning, "Set wasn't called within 1ms of startup")
+	case <-time.After(time.Second):
+		t.Fatal("expected a warning")
+	}
+
+	undo, err := Set(stubProcs(func(int, func(v float64) int, iruntime.Options) (int, iruntime.CPUQuotaStatus, error) {
+		return -1, iruntime.CPUQuotaUndefined, nil
+	}))
+	require.NoError(t, err, "Set failed")
+	undo()
+	warnIfUnset(time.Millisecond, printf)
+	select {
+	case warning := <-warnings:
+		t.Fatalf("unexpected warning after Set: %v", warning)
+	default:
+	}
+}
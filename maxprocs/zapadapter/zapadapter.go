@@ -0,0 +1,86 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package zapadapter logs the decisions of maxprocs.Set with a zap logger.
+// It lives in its own module so that the core maxprocs package doesn't
+// depend on zap.
+//
+//	undo, err := maxprocs.Set(zapadapter.Logger(logger), zapadapter.WithDecision(logger))
+package zapadapter // import "github.com/emadolsky/automaxprocs/maxprocs/zapadapter"
+
+import (
+	"github.com/emadolsky/automaxprocs/maxprocs"
+	"go.uber.org/zap"
+)
+
+// DecisionMessage is the message of the entry logged by WithDecision.
+const DecisionMessage = "maxprocs decision"
+
+// Field keys describing a maxprocs.Decision.
+const (
+	GOMAXPROCSKey  = "gomaxprocs"
+	MinBindingKey  = "min_binding"
+	HostnameKey    = "hostname"
+	ContainerIDKey = "container_id"
+	BurstKey       = "burst"
+	TraceKey       = "trace"
+	DurationKey    = "duration"
+)
+
+// Logger sends the log lines of maxprocs to logger at info level, as a
+// drop-in replacement for maxprocs.Logger(log.Printf).
+func Logger(logger *zap.Logger) maxprocs.Option {
+	return maxprocs.Logger(logger.WithOptions(zap.AddCallerSkip(1)).Sugar().Infof)
+}
+
+// WithDecision logs the Decision of Set to logger at info level, with the
+// DecisionMessage message and the fields returned by Fields, so that the
+// decision can be queried as structured data.
+func WithDecision(logger *zap.Logger) maxprocs.Option {
+	return maxprocs.OnDecision(func(d maxprocs.Decision) {
+		logger.Info(DecisionMessage, Fields(d)...)
+	})
+}
+
+// Fields returns the fields describing d. The hostname, container ID, burst
+// and trace are omitted when they're empty.
+func Fields(d maxprocs.Decision) []zap.Field {
+	fields := []zap.Field{
+		zap.Int(GOMAXPROCSKey, d.GOMAXPROCS),
+		zap.Bool(MinBindingKey, d.MinBinding),
+	}
+	if d.Hostname != "" {
+		fields = append(fields, zap.String(HostnameKey, d.Hostname))
+	}
+	if d.ContainerID != "" {
+		fields = append(fields, zap.String(ContainerIDKey, d.ContainerID))
+	}
+	if d.Burst > 0 {
+		fields = append(fields, zap.Float64(BurstKey, d.Burst))
+	}
+	if len(d.Trace) > 0 {
+		steps := make([]string, len(d.Trace))
+		for i, step := range d.Trace {
+			steps[i] = step.String()
+		}
+		fields = append(fields, zap.Strings(TraceKey, steps))
+	}
+	return append(fields, zap.Duration(DurationKey, d.Duration))
+}
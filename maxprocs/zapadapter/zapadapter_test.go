@@ -0,0 +1,91 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapadapter
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/emadolsky/automaxprocs/maxprocs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogger(t *testing.T) {
+	if _, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		t.Skip("GOMAXPROCS is set in the environment")
+	}
+	if !maxprocs.Supported() {
+		t.Skip("CPU limit detection isn't supported on this OS")
+	}
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(core)
+
+	undo, err := maxprocs.Set(Logger(logger), WithDecision(logger))
+	require.NoError(t, err, "Set failed")
+	defer undo()
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	assert.Contains(t, entries[0].Message, "maxprocs: ")
+	assert.Equal(t, zapcore.InfoLevel, entries[0].Level)
+
+	assert.Equal(t, DecisionMessage, entries[1].Message)
+	fields := entries[1].ContextMap()
+	assert.Equal(t, int64(runtime.GOMAXPROCS(0)), fields[GOMAXPROCSKey])
+	assert.Equal(t, false, fields[MinBindingKey])
+	assert.Contains(t, fields, DurationKey)
+}
+
+func TestFields(t *testing.T) {
+	assert.Equal(t, []zap.Field{
+		zap.Int(GOMAXPROCSKey, 2),
+		zap.Bool(MinBindingKey, false),
+		zap.Duration(DurationKey, 0),
+	}, Fields(maxprocs.Decision{GOMAXPROCS: 2}))
+
+	assert.Equal(t, []zap.Field{
+		zap.Int(GOMAXPROCSKey, 4),
+		zap.Bool(MinBindingKey, true),
+		zap.String(HostnameKey, "node-1"),
+		zap.String(ContainerIDKey, "abcdef"),
+		zap.Float64(BurstKey, 0.5),
+		zap.Strings(TraceKey, []string{"quota=0.5 (CPU quota)", "minClamped=4 (Min(4))"}),
+		zap.Duration(DurationKey, time.Millisecond),
+	}, Fields(maxprocs.Decision{
+		GOMAXPROCS:  4,
+		MinBinding:  true,
+		Hostname:    "node-1",
+		ContainerID: "abcdef",
+		Burst:       0.5,
+		Trace: []maxprocs.Step{
+			{Stage: maxprocs.StageQuota, Source: "CPU quota", Value: 0.5},
+			{Stage: maxprocs.StageMinClamped, Source: "Min(4)", Value: 4},
+		},
+		Duration: time.Millisecond,
+	}))
+}